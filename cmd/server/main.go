@@ -1,95 +1,311 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"traefik-challenge-2/internal/config"
+	applog "traefik-challenge-2/internal/log"
+	"traefik-challenge-2/internal/metrics"
 	"traefik-challenge-2/internal/proxy"
+	"traefik-challenge-2/internal/version"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
+	// Print build information and exit when requested.
+	showVersion := flag.Bool("version", false, "print version information and exit")
+	flag.Parse()
+	if *showVersion {
+		fmt.Println(version.Get())
+		return
+	}
+
 	// Load application configuration from yalm file.
 	appConfig, err := config.Load()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Optional one-time reachability check of all targets before taking traffic.
+	if err := runStartupProbe(appConfig); err != nil {
+		log.Fatal(err)
+	}
+
 	// Build the reverse proxy:
 	// - Single upstream: reverse proxy
 	// - Multiple upstreams: reverse load-balanced proxy
 	// - Optional in-memory cache (LRU) controlled by config
+	// The cache warns (throttled) when evictions exceed the configured rate; with shards > 1
+	// keys are spread over independently locked LRU shards. The optional sweeper drops
+	// expired entries, keeping them for max_stale so they can still be served stale.
+	// max_bytes_per_key bounds the bytes all variants of one resource may hold together.
+	responseCache := proxy.NewShardedLRUCacheWithOptions(appConfig.Cache.Shards, proxy.LRUCacheOptions{
+		MaxEntries:       appConfig.Cache.MaxEntries,
+		EvictionWarnRate: appConfig.Cache.EvictionWarnRate,
+		SweepInterval:    appConfig.Cache.SweepInterval,
+		SweepRetain:      appConfig.Cache.MaxStale,
+		MaxBytesPerKey:   appConfig.Cache.MaxBytesPerKey,
+	})
 	var reverseProxy *proxy.ReverseProxy
 	if len(appConfig.TargetURLs) > 1 {
 		reverseProxy = proxy.NewReverseProxyMulti(
 			appConfig.TargetURLs,
-			proxy.NewLRUCache(appConfig.Cache.MaxEntries),
+			responseCache,
 			appConfig.Cache.Enabled,
 		)
 	} else {
 		reverseProxy = proxy.NewReverseProxy(
 			appConfig.TargetURL,
-			proxy.NewLRUCache(appConfig.Cache.MaxEntries),
+			responseCache,
 			appConfig.Cache.Enabled,
 		)
 	}
 
-	// Configure load-balancer strategy and health checks.
-	reverseProxy.ConfigureBalancer(appConfig.LoadBalancerStrategy)
+	// Namespace cache keys so deployments sharing a cache stay isolated.
+	reverseProxy.SetCacheKeyPrefix(appConfig.Cache.KeyPrefix)
+	reverseProxy.SetShareHeadGet(appConfig.Cache.ShareHeadGet)
+	// Keep the gzip/br body produced on MISS so hot compressible HITs skip re-compression.
+	reverseProxy.SetStoreCompressed(appConfig.Cache.StoreCompressed)
+	reverseProxy.SetPerUpstreamCacheKey(appConfig.Cache.PerUpstreamKey)
+	// Sort query parameters in cache keys only; upstreams still see the client's order.
+	reverseProxy.SetNormalizeQuery(appConfig.Cache.NormalizeQuery)
+	// On these paths, misses may be served from the entry stored without the query string.
+	reverseProxy.SetCacheQueryFallback(appConfig.Cache.QueryFallbackPaths)
+	// Never serve content more than max_stale past expiry, whatever stale-* directives say.
+	reverseProxy.SetMaxStale(appConfig.Cache.MaxStale)
+	reverseProxy.SetCookieCachePolicy(appConfig.Cache.IgnoreCookieRequests, appConfig.Cache.AllowedCookies)
+	// Bound the CPU spent buffering/hashing request bodies for cache keys (runs before the queue).
+	reverseProxy.SetBodyHashConcurrency(appConfig.Cache.BodyHashConcurrency)
+	// Stream (and do not cache) request bodies too large to be worth hashing.
+	reverseProxy.SetMaxBodyHashBytes(appConfig.Cache.MaxBodyHashBytes)
+	// Debugging aid: echo computed cache keys in X-Cache-Key.
+	reverseProxy.SetExposeCacheKey(appConfig.Debug.ExposeCacheKey)
+	// Per-upstream metrics are labelled by a response header, bounded by an optional allowlist.
+	reverseProxy.SetUpstreamLabel(appConfig.Metrics.UpstreamLabelHeader, appConfig.Metrics.UpstreamLabelValues)
+	// proxy_error_ratio reports the 5xx share over this sliding window.
+	metrics.SetErrorRatioWindow(appConfig.Metrics.ErrorRatioWindow)
+	// Debugging aid: report upstream latency in X-Upstream-Response-Time (ms).
+	reverseProxy.SetExposeUpstreamTime(appConfig.Debug.ExposeUpstreamTime)
+
+	// Configure load-balancer strategy, health checks and the optional failover pool.
+	if err := reverseProxy.ConfigureBalancer(appConfig.LoadBalancerStrategy); err != nil {
+		log.Fatal(err)
+	}
 	reverseProxy.SetHealthCheckEnabled(appConfig.LoadBalancerHealthCheck)
+	if len(appConfig.BackupTargetURLs) > 0 {
+		reverseProxy.SetBackupTargets(appConfig.BackupTargetURLs)
+	}
+	// Route clients from configured networks (e.g. internal ranges) to their own target pools.
+	if err := reverseProxy.SetClientNetworkPools(appConfig.ClientNetworks); err != nil {
+		log.Fatalf("client networks: %v", err)
+	}
+	// Passively eject targets that keep failing (state visible at /admin/upstreams).
+	reverseProxy.SetOutlierDetection(appConfig.OutlierDetection.ConsecutiveFailures, appConfig.OutlierDetection.EjectionTime, appConfig.OutlierDetection.MaxEjectionPercent)
+	// 503 + Retry-After when no upstream can serve; 502 for upstream protocol errors.
+	reverseProxy.SetUpstreamUnavailable(appConfig.UpstreamUnavailable.RetryAfter, appConfig.UpstreamUnavailable.RefusedStatus)
+	// Optionally probe targets in the background (jittered) instead of at pick time.
+	reverseProxy.SetHealthCheckSchedule(appConfig.HealthCheck.Interval, appConfig.HealthCheck.Jitter)
+	reverseProxy.SetHealthCheckConcurrency(appConfig.HealthCheck.Concurrency)
+	// Each probe has its own deadline; only the /healthz status is read.
+	proxy.SetHealthProbeTimeout(appConfig.HealthCheck.Timeout)
+	// Keep upstream connection pools warm with periodic lightweight requests.
+	if appConfig.UpstreamKeepalive.Enabled {
+		reverseProxy.SetUpstreamKeepalive(appConfig.UpstreamKeepalive.Interval, appConfig.UpstreamKeepalive.Method, appConfig.UpstreamKeepalive.Path)
+	}
 
 	// Restrict allowed HTTP methods as configured.
 	reverseProxy.SetAllowedMethods(appConfig.AllowedMethods)
+	// Answer "OPTIONS *" locally and keep TRACE from reaching upstreams.
+	reverseProxy.SetMethodHandling(appConfig.HandleOptions, appConfig.BlockTrace)
+	// Absolute-form targets must use one of these schemes.
+	reverseProxy.SetAllowedSchemes(appConfig.AllowedSchemes)
+	// Only answer the configured Host headers (421 otherwise); empty accepts any host.
+	reverseProxy.SetAllowedHosts(appConfig.AllowedHosts)
+	// Reverse proxy by default; forward mode tunnels CONNECT and follows absolute URIs.
+	reverseProxy.SetMode(appConfig.Mode)
+	// CONNECT only tunnels to these host:port destinations (none by default).
+	reverseProxy.SetConnectAllowlist(appConfig.ConnectAllowlist)
+
+	// Per-request budget propagated upstream (context deadline + timeout header).
+	reverseProxy.SetRequestTimeout(appConfig.RequestTimeout, appConfig.RequestTimeoutHeader)
+	// Clients may shorten (never extend past client_timeout_max) their own budget.
+	reverseProxy.SetClientTimeout(appConfig.ClientTimeoutHeader, appConfig.ClientTimeoutMax)
+	// Targets configured with their own timeout override the global one; weights feed wrr_ewma;
+	// per-target headers (e.g. backend API keys) are only sent to that target.
+	for _, targetOptions := range appConfig.TargetOptions {
+		reverseProxy.SetUpstreamTimeout(targetOptions.URL, targetOptions.Timeout)
+		reverseProxy.SetUpstreamWeight(targetOptions.URL, targetOptions.Weight)
+		reverseProxy.SetUpstreamHeaders(targetOptions.URL, targetOptions.Headers)
+	}
+	// Reject overlong URIs with 414 before cache/upstream work (0 = unlimited).
+	reverseProxy.SetMaxURILength(appConfig.MaxURILength)
+	// Bound how much of an upstream body is buffered; larger bodies are streamed and not cached.
+	reverseProxy.SetMaxUpstreamBodyBytes(appConfig.MaxUpstreamBodyBytes)
+	// Forward encoded path bytes such as %2F unchanged.
+	reverseProxy.SetPreserveEncodedPath(appConfig.PreserveEncodedPath)
+	// Targets with a path (http://backend/svc) act as mounted at "/" for redirects and cookies.
+	reverseProxy.SetRewriteMountedPaths(appConfig.RewriteMountedPaths)
+	// "/a" and "/a/" share a cache entry (and optionally an upstream path) when normalized.
+	reverseProxy.SetTrailingSlashNormalization(appConfig.TrailingSlash, appConfig.TrailingSlashForward)
+
+	// Gzip (or Brotli, when enabled and accepted) client responses when negotiated
+	// (never for Cache-Control: no-transform).
+	reverseProxy.SetCompression(appConfig.Compression.Enabled, appConfig.Compression.MinSize)
+	reverseProxy.SetCompressionBrotli(appConfig.Compression.Brotli)
+
+	// Relay SSE/gRPC bodies as they arrive with the configured buffer and flush cadence.
+	reverseProxy.SetStreaming(appConfig.Stream.BufferBytes, appConfig.Stream.FlushInterval)
+	// Optionally keep uncacheable chunked upstream responses chunked instead of buffering them.
+	reverseProxy.SetStreamChunked(appConfig.Stream.Chunked)
+
+	// Decode gzip request bodies (bounded) so cache hashing and upstreams see plain payloads.
+	reverseProxy.SetRequestDecompression(appConfig.RequestDecompress, appConfig.RequestDecompressMax)
+
+	// Proxy-generated errors (405) as {"status","error","request_id"} JSON when enabled.
+	reverseProxy.SetJSONErrors(appConfig.JSONErrors)
+
+	// Friendly fixed response for "/" when no upstream is available (static routes win).
+	if appConfig.DefaultRootResponse.Enabled {
+		reverseProxy.SetDefaultRootResponse(appConfig.DefaultRootResponse.Status, appConfig.DefaultRootResponse.ContentType, appConfig.DefaultRootResponse.Body)
+	}
+
+	// Maintenance 503 (toggled at runtime via POST /admin/maintenance).
+	reverseProxy.SetMaintenanceResponse(appConfig.Maintenance.RetryAfter, appConfig.Maintenance.Message)
+	reverseProxy.SetMaintenance(appConfig.Maintenance.Enabled)
+
+	// Reject uploads whose body does not match the client's Content-MD5/Digest header
+	// (bodies are buffered to be checked, up to a cap).
+	reverseProxy.SetValidateContentDigest(appConfig.ValidateContentDigest, appConfig.ValidateContentDigestMax)
+
+	// Adopt incoming trace IDs (B3, X-Amzn-Trace-Id, ...) as X-Request-ID instead of generating one.
+	reverseProxy.SetTraceIDHeaders(appConfig.TraceIDHeaders)
+
+	// Hide backend-revealing response headers from clients.
+	reverseProxy.SetStripResponseHeaders(appConfig.StripResponseHeaders)
+
+	// Choose which forwarding headers (X-Forwarded-* / Forwarded) are sent upstream.
+	reverseProxy.SetForwardedHeaderMode(appConfig.ForwardedHeaderMode)
+
+	// Optional shadow traffic through a bounded worker pool.
+	if appConfig.Mirror.Target != nil {
+		reverseProxy.SetMirror(appConfig.Mirror.Target, appConfig.Mirror.Workers, appConfig.Mirror.QueueSize, appConfig.Mirror.MaxBodyBytes)
+	}
+
+	// De-duplicate double-submitted requests carrying an Idempotency-Key.
+	reverseProxy.SetIdempotency(appConfig.Idempotency.Enabled, appConfig.Idempotency.Window)
+	// Share one upstream call among identical concurrent GETs on allowlisted paths.
+	reverseProxy.SetCollapseForwarding(appConfig.CollapseForwarding.Enabled, appConfig.CollapseForwarding.Paths)
+
+	// Detect HTTP/2 and gzip support of every target once (optionally switching to HTTP/2-only upstream connections).
+	if appConfig.CapabilityProbe.Enabled {
+		capabilities := reverseProxy.ProbeUpstreamCapabilities(appConfig.CapabilityProbe.Timeout, appConfig.CapabilityProbe.ConfigureTransport)
+		log.Print(proxy.SummarizeCapabilities(capabilities))
+	}
 
 	// Queue configuration (used only for cache misses inside the proxy).
+	// When disabled, misses go straight upstream with no queue or concurrency limit.
 	queueConfig := appConfig.Queue
-	reverseProxy = reverseProxy.WithQueue(queueConfig)
+	if appConfig.QueueEnabled {
+		reverseProxy = reverseProxy.WithQueue(queueConfig)
+	}
+
+	// Static routes are answered before any cache/upstream work; everything else is proxied.
+	proxyHandler, err := proxy.NewStaticRouter(appConfig.StaticRoutes, reverseProxy)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Replace inline endpoint registration with helper.
-	serverMux := newServerMux(reverseProxy)
+	serverMux := newServerMux(reverseProxy, proxyHandler, appConfig)
 
 	// Startup summary for observability.
 	log.Printf(
-		"Listening on %s, upstreams=%d primary=%s lb=%s hc=%v cache=%v queue(max=%d,concurrent=%d) tls(enabled=%v)",
+		"%s listening on %s, mode=%s upstreams=%d backups=%d primary=%s lb=%s hc=%v cache=%v queue(enabled=%v,max=%d,concurrent=%d) tls(enabled=%v)",
+		version.Get(),
 		appConfig.ListenAddr,
+		appConfig.Mode,
 		len(appConfig.TargetURLs),
+		len(appConfig.BackupTargetURLs),
 		appConfig.TargetURL.String(),
 		appConfig.LoadBalancerStrategy,
 		appConfig.LoadBalancerHealthCheck,
 		appConfig.Cache.Enabled,
+		appConfig.QueueEnabled,
 		queueConfig.MaxQueue,
 		queueConfig.MaxConcurrent,
 		appConfig.TLS.Enabled,
 	)
 
-	// Start server with consistent server headers.
-	if err := startServer(appConfig, withProxyHeaders(serverMux)); err != nil {
+	// Report whether Loki shipping is enabled/reachable and keep re-checking it (proxy_loki_up).
+	stopLokiMonitor := applog.StartLokiMonitor(0)
+	defer stopLokiMonitor()
+
+	// Start server with consistent server headers (and X-Served-By when exposed).
+	servedBy := ""
+	if appConfig.ExposeServedBy {
+		servedBy = appConfig.InstanceID
+		if servedBy == "" {
+			servedBy = applog.MustHostname()
+		}
+	}
+	if err := startServer(appConfig, proxy.WithProxyHeaders(withConnectRouting(proxyHandler, serverMux), servedBy)); err != nil {
 		log.Fatal(err)
 	}
 }
 // newServerMux assembles all HTTP endpoints.
-func newServerMux(reverseProxy *proxy.ReverseProxy) *http.ServeMux {
+func newServerMux(reverseProxy *proxy.ReverseProxy, proxyHandler http.Handler, appConfig *config.Config) *http.ServeMux {
 	mux := http.NewServeMux()
 	// Expose Prometheus metrics.
 	mux.Handle("/metrics", promhttp.Handler())
 	// Proxy all other requests;
-	mux.Handle("/", reverseProxy)
+	mux.Handle("/", proxyHandler)
 	// Local health endpoint for the proxy.
 	mux.HandleFunc("/healthz", healthHandler)
+	// Token-guarded admin endpoints (403 when no token is configured).
+	mux.Handle("/admin/cache/keys", proxy.RequireAdminToken(appConfig.Admin.Token, reverseProxy.CacheKeysHandler()))
+	mux.Handle("/admin/version", proxy.RequireAdminToken(appConfig.Admin.Token, version.Handler()))
+	mux.Handle("/admin/upstreams", proxy.RequireAdminToken(appConfig.Admin.Token, reverseProxy.UpstreamsHandler()))
+	mux.Handle("/admin/maintenance", proxy.RequireAdminToken(appConfig.Admin.Token, reverseProxy.MaintenanceHandler()))
+	mux.Handle("/admin/transport/reset", proxy.RequireAdminToken(appConfig.Admin.Token, reverseProxy.TransportResetHandler()))
+	mux.Handle("/admin/metrics.json", proxy.RequireAdminToken(appConfig.Admin.Token, metrics.JSONHandler()))
+	mux.Handle("/admin/errors", proxy.RequireAdminToken(appConfig.Admin.Token, applog.RecentErrorsHandler()))
 	return mux
 }
 
+// runStartupProbe probes each configured target once (if enabled, bounded by
+// health_check.concurrency and startup_probe.deadline), logs a summary, and returns
+// an error when require_one_healthy is set and nothing responds.
+func runStartupProbe(appConfig *config.Config) error {
+	if !appConfig.StartupProbe.Enabled {
+		return nil
+	}
+	results, err := proxy.StartupSelfTestWithOptions(appConfig.TargetURLs, proxy.StartupProbeOptions{
+		Timeout:           appConfig.StartupProbe.Timeout,
+		Concurrency:       appConfig.HealthCheck.Concurrency,
+		Deadline:          appConfig.StartupProbe.Deadline,
+		RequireOneHealthy: appConfig.StartupProbe.RequireOneHealthy,
+	})
+	log.Print(proxy.SummarizeStartupProbe(results))
+	return err
+}
+
 // healthHandler responds to local health checks.
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte("ok"))
 }
 
-// withServerHeaders adds a simple Server header to every response.
-func withProxyHeaders(next http.Handler) http.Handler {
+// withConnectRouting sends CONNECT requests straight to the proxy: their authority-form
+// target has no path, so ServeMux would answer 404 before the proxy could tunnel or reject them.
+func withConnectRouting(proxyHandler, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Server", "FCReverseProxy/3.0")
+		if r.Method == http.MethodConnect {
+			proxyHandler.ServeHTTP(w, r)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
@@ -9,22 +9,35 @@ import (
 	"encoding/pem"
 	"log"
 	"math/big"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"time"
 
 	"traefik-challenge-2/internal/config"
+	"traefik-challenge-2/internal/metrics"
+	"traefik-challenge-2/internal/proxy"
 )
 
 // startServer starts an HTTP server if TLS is disabled, otherwise HTTPS.
 // If TLS is enabled and no cert/key are provided, a self-signed pair for localhost is generated.
 // The handler is the fully-wrapped root HTTP handler.
 func startServer(appConfig *config.Config, rootHandler http.Handler) error {
+	listener, err := listen(appConfig)
+	if err != nil {
+		return err
+	}
+
 	if !appConfig.TLS.Enabled {
-		// Plain HTTP mode
+		// Plain HTTP mode; accept h2c (HTTP/2 prior knowledge) so gRPC clients work without TLS.
 		log.Printf("Starting HTTP on %s", appConfig.ListenAddr)
-		return http.ListenAndServe(appConfig.ListenAddr, rootHandler)
+		server := &http.Server{
+			Addr:      appConfig.ListenAddr,
+			Handler:   rootHandler,
+			Protocols: plainServerProtocols(),
+		}
+		return server.Serve(listener)
 	}
 
 	// Provide default filenames if not specified in config.
@@ -38,7 +51,7 @@ func startServer(appConfig *config.Config, rootHandler http.Handler) error {
 	// Ensure there is a certificate pair available (create self-signed if missing).
 	if err := ensureSelfSignedIfMissing(appConfig.TLS.CertFile, appConfig.TLS.KeyFile); err != nil {
 		log.Printf("TLS enabled but could not create self-signed cert: %v (falling back to HTTP)", err)
-		return http.ListenAndServe(appConfig.ListenAddr, rootHandler)
+		return http.Serve(listener, rootHandler)
 	}
 
 	// If cert/key exist, start HTTPS with a conservative TLS configuration.
@@ -52,13 +65,39 @@ func startServer(appConfig *config.Config, rootHandler http.Handler) error {
 				MinVersion: tls.VersionTLS12,
 			},
 		}
+		// Count handshakes by TLS version/cipher and outcome (proxy_tls_handshakes_total).
+		metrics.InstrumentTLSHandshakes(server)
 		log.Printf("Starting HTTPS (static/self-signed) on %s cert=%s key=%s", appConfig.ListenAddr, appConfig.TLS.CertFile, appConfig.TLS.KeyFile)
-		return server.ListenAndServeTLS(appConfig.TLS.CertFile, appConfig.TLS.KeyFile)
+		return server.ServeTLS(listener, appConfig.TLS.CertFile, appConfig.TLS.KeyFile)
 	}
 
 	// Safeguard: should not happen since ensureSelfSignedIfMissing already attempted generation.
 	log.Printf("TLS enabled but cert/key not present; falling back to HTTP on %s", appConfig.ListenAddr)
-	return http.ListenAndServe(appConfig.ListenAddr, rootHandler)
+	return http.Serve(listener, rootHandler)
+}
+
+// listen opens the TCP listener, throttling accepts when proxy.accept_rate is set.
+func listen(appConfig *config.Config) (net.Listener, error) {
+	listenAddr := appConfig.ListenAddr
+	if listenAddr == "" {
+		listenAddr = ":http"
+	}
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, err
+	}
+	if appConfig.AcceptRate > 0 {
+		log.Printf("Accept rate limit: %.2f conns/s (burst %d)", appConfig.AcceptRate, appConfig.AcceptBurst)
+	}
+	return proxy.NewAcceptRateListener(listener, appConfig.AcceptRate, appConfig.AcceptBurst), nil
+}
+
+// plainServerProtocols enables HTTP/1.1 and unencrypted HTTP/2 (h2c) on a plain listener.
+func plainServerProtocols() *http.Protocols {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return protocols
 }
 
 // ensureSelfSignedIfMissing generates a localhost self-signed certificate if either file is missing.
@@ -3,8 +3,11 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 	"traefik-challenge-2/internal/proxy"
@@ -12,6 +15,44 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// HealthCheckConfig schedules background health probes (Interval 0 = probe on demand).
+type HealthCheckConfig struct {
+	Interval    time.Duration
+	Jitter      time.Duration // random per-probe offset within this window
+	Concurrency int           // probes in flight at once, background and startup (0 = unbounded)
+	Timeout     time.Duration // deadline of one probe (0 = default 500ms)
+}
+
+// UpstreamKeepaliveConfig schedules warmup requests to every target (separate from health checks).
+type UpstreamKeepaliveConfig struct {
+	Enabled  bool
+	Interval time.Duration
+	Method   string // default HEAD
+	Path     string // default /
+}
+
+// UpstreamUnavailableConfig configures how "upstream down" is reported to clients.
+type UpstreamUnavailableConfig struct {
+	RetryAfter    time.Duration // Retry-After on 503 when no upstream can take the request (0 = omitted)
+	RefusedStatus int           // status for a refused upstream connection: 503 or 502
+}
+
+// OutlierDetectionConfig configures passive ejection of failing targets (0 failures = off).
+type OutlierDetectionConfig struct {
+	ConsecutiveFailures int           // failed requests in a row (transport error or 5xx) that eject a target
+	EjectionTime        time.Duration // how long an ejected target is skipped
+	MaxEjectionPercent  int           // most targets ejected at once, in percent (0 = default 50)
+}
+
+// TargetOptions holds per-target settings given with the rich target form
+// ({url: ..., timeout: ...}) in proxy.targets or proxy.backup_targets.
+type TargetOptions struct {
+	URL     *url.URL
+	Timeout time.Duration     // overrides proxy.request_timeout for this target (0 = global)
+	Weight  int               // static weight for weighted strategies (0 = default of 1)
+	Headers map[string]string // injected into requests sent to this target only (values redacted in logs)
+}
+
 // TLSConfig holds TLS enablement and file paths for certificate and key.
 type TLSConfig struct {
 	Enabled  bool
@@ -21,36 +62,220 @@ type TLSConfig struct {
 
 // Config holds all runtime settings derived from YAML and defaults.
 type Config struct {
-	ListenAddr              string     // Example: ":8080"
-	TargetURL               *url.URL   // First (primary) target for backward compatibility
-	TargetURLs              []*url.URL // All targets (>=1)
-	Cache                   CacheConfig
-	Queue                   proxy.QueueConfig
-	AllowedMethods          []string
-	LoadBalancerStrategy    string
-	LoadBalancerHealthCheck bool
-	TLS                     TLSConfig
+	ListenAddr               string                    // Example: ":8080"
+	TargetURL                *url.URL                  // First (primary) target for backward compatibility
+	TargetURLs               []*url.URL                // All targets (>=1)
+	BackupTargetURLs         []*url.URL                // Failover pool used only when all primaries are down
+	ClientNetworks           []proxy.ClientNetworkPool // target pools selected by client CIDR
+	TargetOptions            []TargetOptions           // per-target settings from the rich target form
+	Cache                    CacheConfig
+	Queue                    proxy.QueueConfig
+	QueueEnabled             bool // false -> misses go straight upstream, no queue/limiter
+	AllowedMethods           []string
+	HandleOptions            bool          // answer "OPTIONS *" with the allowed methods
+	BlockTrace               bool          // reject TRACE with 405
+	AllowedSchemes           []string      // schemes accepted in absolute-form request targets
+	AllowedHosts             []string      // Host headers accepted (empty = any), others get 421
+	StripResponseHeaders     []string      // removed from client responses (beyond hop-by-hop)
+	TraceIDHeaders           []string      // incoming trace headers adopted as the request ID
+	RequestTimeout           time.Duration // end-to-end budget per request (0 = none)
+	RequestTimeoutHeader     string        // header carrying the remaining budget in ms
+	ClientTimeoutHeader      string        // client header requesting a shorter budget in ms
+	ClientTimeoutMax         time.Duration // cap on client-requested budgets (0 = header ignored)
+	MaxURILength             int           // longest accepted request URI in bytes (0 = unlimited)
+	AcceptRate               float64       // new connections accepted per second (0 = unlimited)
+	AcceptBurst              int           // connections accepted back-to-back before throttling
+	MaxUpstreamBodyBytes     int64         // most upstream body bytes buffered; larger bodies stream uncached (0 = no cap)
+	PreserveEncodedPath      bool          // forward percent-encoded path bytes (e.g. %2F) unchanged
+	RewriteMountedPaths      bool          // strip a target's path prefix from Location/Set-Cookie paths
+	TrailingSlash            string        // off | strip | add: canonical trailing slash for cache keys
+	TrailingSlashForward     bool          // also forward the normalized path upstream
+	LoadBalancerStrategy     string
+	LoadBalancerHealthCheck  bool
+	HealthCheck              HealthCheckConfig
+	UpstreamKeepalive        UpstreamKeepaliveConfig
+	OutlierDetection         OutlierDetectionConfig
+	UpstreamUnavailable      UpstreamUnavailableConfig
+	TLS                      TLSConfig
+	ForwardedHeaderMode      string   // legacy | rfc7239 | both
+	Mode                     string   // reverse | forward
+	ConnectAllowlist         []string // host:port destinations CONNECT may tunnel to (empty = none)
+	Admin                    AdminConfig
+	Idempotency              IdempotencyConfig
+	StartupProbe             StartupProbeConfig
+	CapabilityProbe          CapabilityProbeConfig
+	StaticRoutes             []proxy.StaticRoute // fixed responses served without an upstream
+	Mirror                   MirrorConfig
+	Compression              CompressionConfig
+	Stream                   StreamConfig
+	CollapseForwarding       CollapseConfig
+	Debug                    DebugConfig
+	Metrics                  MetricsConfig
+	Maintenance              MaintenanceConfig
+	DefaultRootResponse      RootResponseConfig
+	RequestDecompress        bool   // decode gzip client request bodies before hashing/forwarding
+	RequestDecompressMax     int64  // cap on decoded request body bytes (decompression-bomb guard)
+	ValidateContentDigest    bool   // reject bodies not matching Content-MD5/Digest with 400
+	ValidateContentDigestMax int64  // cap on bodies buffered for digest checks (413 above it)
+	JSONErrors               bool   // proxy-generated errors use a JSON envelope
+	ExposeServedBy           bool   // add X-Served-By naming this instance to every response
+	InstanceID               string // X-Served-By value (empty = hostname)
+}
+
+// StreamConfig configures relaying of streamed responses (server-sent events, gRPC).
+type StreamConfig struct {
+	BufferBytes   int           // copy buffer size
+	FlushInterval time.Duration // max time written data may sit unflushed (0 = flush every write)
+	Chunked       bool          // relay uncacheable unknown-length responses chunked instead of buffering
+}
+
+// CompressionConfig configures gzip/Brotli compression of client responses.
+type CompressionConfig struct {
+	Enabled bool
+	MinSize int  // bodies smaller than this (bytes) are not compressed
+	Brotli  bool // also offer br, preferred over gzip
+}
+
+// MaintenanceConfig configures the maintenance-mode 503 toggled via /admin/maintenance.
+type MaintenanceConfig struct {
+	Enabled    bool          // start in maintenance mode
+	RetryAfter time.Duration // advertised in Retry-After (0 = omitted)
+	Message    string        // 503 body
+}
+
+// RootResponseConfig configures the response for "/" when no upstream is available.
+type RootResponseConfig struct {
+	Enabled     bool
+	Status      int // default 503
+	ContentType string
+	Body        string
+}
+
+// MetricsConfig configures how per-upstream metrics are labelled.
+type MetricsConfig struct {
+	UpstreamLabelHeader string        // response header naming the upstream (default X-Upstream)
+	UpstreamLabelValues []string      // allowed label values; others become "other" (empty = any)
+	ErrorRatioWindow    time.Duration // how far back proxy_error_ratio looks (0 = default 1m)
+}
+
+// DebugConfig holds troubleshooting switches that are off by default.
+type DebugConfig struct {
+	ExposeCacheKey     bool // echo the computed cache key in X-Cache-Key
+	ExposeUpstreamTime bool // add X-Upstream-Response-Time (ms) to upstream-fetched responses
+}
+
+// CollapseConfig configures coalescing of identical concurrent GETs on allowlisted paths.
+type CollapseConfig struct {
+	Enabled bool
+	Paths   []string // path prefixes eligible for collapsing
+}
+
+// MirrorConfig configures shadow traffic sent to a mirror target by a bounded worker pool.
+type MirrorConfig struct {
+	Target       *url.URL // nil disables mirroring
+	Workers      int
+	QueueSize    int   // mirrored requests beyond this backlog are dropped
+	MaxBodyBytes int64 // requests with larger bodies are not mirrored
+}
+
+// StartupProbeConfig configures the one-time upstream reachability check at startup.
+type StartupProbeConfig struct {
+	Enabled           bool
+	RequireOneHealthy bool          // exit non-zero when no target responds
+	Timeout           time.Duration // per-target probe timeout
+	Deadline          time.Duration // budget for the whole startup probe (0 = none)
+}
+
+// CapabilityProbeConfig configures the one-time HTTP/2 and gzip detection of targets at startup.
+type CapabilityProbeConfig struct {
+	Enabled            bool
+	Timeout            time.Duration // per-target probe timeout
+	ConfigureTransport bool          // switch to HTTP/2-only upstream connections when every target supports it
+}
+
+// IdempotencyConfig configures Idempotency-Key based request de-duplication.
+type IdempotencyConfig struct {
+	Enabled bool
+	Window  time.Duration // how long a finished response is replayed to retries
+}
+
+// AdminConfig configures the token-guarded /admin endpoints.
+type AdminConfig struct {
+	Token string // empty disables admin endpoints (403)
 }
 
 // CacheConfig configures the in-memory response cache.
 type CacheConfig struct {
-	Enabled    bool
-	MaxEntries int
-	TTL        time.Duration
+	Enabled      bool
+	MaxEntries   int
+	TTL          time.Duration
+	KeyPrefix    string        // namespace prepended to cache keys (multi-tenant shared caches)
+	ShareHeadGet bool          // serve HEAD requests from cached GET entries
+	MinTTL       time.Duration // TTLs below this are not cached (0 = no floor)
+	MaxTTL       time.Duration // TTLs above this are capped (0 = no cap)
+	// Requests with cookies bypass the cache unless the response is public.
+	IgnoreCookieRequests bool
+	AllowedCookies       []string // cookie names that never affect cacheability
+	PerUpstreamKey       bool     // include the selected upstream host in cache keys
+	NormalizeQuery       bool     // sort query parameters in cache keys (upstream keeps the original order)
+	QueryFallbackPaths   []string // path prefixes whose misses fall back to the query-stripped key
+	EvictionWarnRate     int      // warn when evictions/sec exceed this (0 = never)
+	Shards               int      // independent LRU shards (<= 1 = single lock)
+	// Hard limit on serving expired entries under stale-* directives (0 = never serve stale).
+	MaxStale time.Duration
+	// Interval of the background sweep removing expired entries (0 = lazy removal only).
+	SweepInterval time.Duration
+	// Response statuses that are never cached, regardless of directives.
+	NeverCacheStatuses []int
+	// Responses with Last-Modified but no explicit freshness live 10% of their age (capped by MaxTTL).
+	HeuristicFreshness bool
+	// Default TTLs by status code or range, used instead of TTL when the upstream sends no freshness.
+	StatusTTLs []proxy.StatusTTL
+	// Up to this fraction of each TTL is randomly shaved off so expirations spread out (0 = off).
+	TTLJitter float64
+	// Requests buffering/hashing bodies for cache keys at once (0 = unlimited).
+	BodyHashConcurrency int
+	// Larger request bodies are streamed unhashed and bypass the cache (0 = no cap).
+	MaxBodyHashBytes int64
+	// Body bytes all variants of one resource may hold before older variants are evicted (0 = no cap).
+	MaxBytesPerKey int
+	// Cache the compressed body sent on MISS so HITs are not compressed again.
+	StoreCompressed bool
 }
 
 const (
-	defaultListen              = ":8080"
-	defaultCacheEnabled        = true
-	defaultCacheMaxEntries     = 2048
-	defaultQueueMax            = 1000
-	defaultQueueMaxConcurrent  = 100
-	defaultQueueEnqueueTimeout = 2 * time.Second
-	defaultQueueWaitHeader     = true
-	defaultAllowedMethods      = "GET,HEAD,POST,PUT,PATCH,DELETE"
-	defaultLBHealthCheck       = true
-	defaultLBStrategy          = "rr"
-	defaultCacheTTL            = 60 * time.Second
+	defaultListen               = ":8080"
+	defaultCacheEnabled         = true
+	defaultCacheMaxEntries      = 2048
+	defaultQueueMax             = 1000
+	defaultQueueMaxConcurrent   = 100
+	defaultQueueEnqueueTimeout  = 2 * time.Second
+	defaultQueueWaitHeader      = true
+	defaultQueueEnabled         = true
+	defaultHandleOptions        = true
+	defaultBlockTrace           = true
+	defaultAllowedMethods       = "GET,HEAD,POST,PUT,PATCH,DELETE"
+	defaultLBHealthCheck        = true
+	defaultKeepaliveInterval    = 30 * time.Second
+	defaultLBStrategy           = "rr"
+	defaultAssumeScheme         = "http"
+	defaultCacheTTL             = 60 * time.Second
+	defaultForwardedHeaderMode  = proxy.ForwardedModeLegacy
+	defaultIdempotencyWindow    = 10 * time.Second
+	defaultStartupProbeTimeout  = 2 * time.Second
+	defaultStartupProbeDeadline = 10 * time.Second
+	defaultHealthConcurrency    = 8
+	defaultMirrorWorkers        = 4
+	defaultMirrorQueueSize      = 64
+	defaultMirrorMaxBodyBytes   = 1 << 20
+	defaultCompressionMinSize   = 256
+	defaultStreamBufferBytes    = 32 << 10
+	defaultRequestDecompressMax = 10 << 20
+	defaultContentDigestMax     = 10 << 20
+	defaultRequestTimeoutHdr    = "X-Request-Timeout-Ms"
+	defaultIgnoreCookieReqs     = true
+	defaultOutlierEjectionTime  = 30 * time.Second
+	defaultUnavailableRetry     = 5 * time.Second
 )
 
 // --- YAML model (pointers used so we can distinguish "omitted" vs "false/zero") ---
@@ -58,33 +283,247 @@ const (
 type yamlRoot struct {
 	Proxy    *yamlProxy    `yaml:"proxy"`
 	Upstream *yamlUpstream `yaml:"upstream"`
+	Metrics  *yamlMetrics  `yaml:"metrics"`
+}
+
+// yamlMetrics mirrors the proxy-relevant keys of the "metrics" section (the rest configures
+// the observability stack and Loki shipping, read elsewhere).
+type yamlMetrics struct {
+	UpstreamLabelHeader *string  `yaml:"upstream_label_header"`
+	UpstreamLabelValues []string `yaml:"upstream_label_values"`
+	ErrorRatioWindow    *string  `yaml:"error_ratio_window"`
 }
 
 // yamlProxy mirrors the "proxy" section of the YAML configuration.
 type yamlProxy struct {
-	Listen                  *string    `yaml:"listen"`
-	Targets                 []string   `yaml:"targets"`
-	LoadBalancerStrategy    *string    `yaml:"load_balancer_strategy"`
-	LoadBalancerHealthCheck *bool      `yaml:"load_balancer_health_check"`
-	AllowedMethods          []string   `yaml:"allowed_methods"`
-	Cache                   *yamlCache `yaml:"cache"`
-	Queue                   *yamlQueue `yaml:"queue"`
-	TLS                     *yamlTLS   `yaml:"tls"`
+	Listen                   *string                  `yaml:"listen"`
+	Includes                 []string                 `yaml:"includes"`
+	Targets                  []yamlTarget             `yaml:"targets"`
+	AssumeScheme             *string                  `yaml:"assume_scheme"`
+	MaxTargets               *int                     `yaml:"max_targets"`
+	BackupTargets            []yamlTarget             `yaml:"backup_targets"`
+	ClientNetworks           []yamlClientNetwork      `yaml:"client_networks"`
+	LoadBalancerStrategy     *string                  `yaml:"load_balancer_strategy"`
+	LoadBalancerHealthCheck  *bool                    `yaml:"load_balancer_health_check"`
+	HealthCheck              *yamlHealthCheck         `yaml:"health_check"`
+	UpstreamKeepalive        *yamlUpstreamKeepalive   `yaml:"upstream_keepalive"`
+	OutlierDetection         *yamlOutlierDetection    `yaml:"outlier_detection"`
+	UpstreamUnavailable      *yamlUpstreamUnavailable `yaml:"upstream_unavailable"`
+	AllowedMethods           []string                 `yaml:"allowed_methods"`
+	HandleOptions            *bool                    `yaml:"handle_options"`
+	BlockTrace               *bool                    `yaml:"block_trace"`
+	AllowedSchemes           []string                 `yaml:"allowed_schemes"`
+	AllowedHosts             []string                 `yaml:"allowed_hosts"`
+	StripResponseHeaders     []string                 `yaml:"strip_response_headers"`
+	TraceIDHeaders           []string                 `yaml:"trace_id_headers"`
+	RequestTimeout           *string                  `yaml:"request_timeout"`
+	RequestTimeoutHeader     *string                  `yaml:"request_timeout_header"`
+	ClientTimeoutHeader      *string                  `yaml:"client_timeout_header"`
+	ClientTimeoutMax         *string                  `yaml:"client_timeout_max"`
+	MaxURILength             *int                     `yaml:"max_uri_length"`
+	AcceptRate               *float64                 `yaml:"accept_rate"`
+	AcceptBurst              *int                     `yaml:"accept_burst"`
+	MaxUpstreamBodyBytes     *int64                   `yaml:"max_upstream_body_bytes"`
+	PreserveEncodedPath      *bool                    `yaml:"preserve_encoded_path"`
+	RewriteMountedPaths      *bool                    `yaml:"rewrite_mounted_paths"`
+	NormalizeTrailingSlash   *string                  `yaml:"normalize_trailing_slash"`
+	TrailingSlashForward     *bool                    `yaml:"normalize_trailing_slash_forward"`
+	Cache                    *yamlCache               `yaml:"cache"`
+	Queue                    *yamlQueue               `yaml:"queue"`
+	TLS                      *yamlTLS                 `yaml:"tls"`
+	ForwardedHeaderMode      *string                  `yaml:"forwarded_header_mode"`
+	Mode                     *string                  `yaml:"mode"`
+	ConnectAllowlist         []string                 `yaml:"connect_allowlist"`
+	Admin                    *yamlAdmin               `yaml:"admin"`
+	Idempotency              *yamlIdempotency         `yaml:"idempotency"`
+	StartupProbe             *yamlStartupProbe        `yaml:"startup_probe"`
+	CapabilityProbe          *yamlCapabilityProbe     `yaml:"capability_probe"`
+	StaticRoutes             []yamlStaticRoute        `yaml:"static_routes"`
+	Mirror                   *yamlMirror              `yaml:"mirror"`
+	Compression              *yamlCompression         `yaml:"compression"`
+	Stream                   *yamlStream              `yaml:"stream"`
+	CollapseForwarding       *yamlCollapse            `yaml:"collapse_forwarding"`
+	Debug                    *yamlDebug               `yaml:"debug"`
+	Maintenance              *yamlMaintenance         `yaml:"maintenance"`
+	DefaultRootResponse      *yamlRootResponse        `yaml:"default_root_response"`
+	RequestDecompress        *bool                    `yaml:"request_decompress"`
+	RequestDecompressMax     *int64                   `yaml:"request_decompress_max_bytes"`
+	ValidateContentDigest    *bool                    `yaml:"validate_content_digest"`
+	ValidateContentDigestMax *int64                   `yaml:"validate_content_digest_max_bytes"`
+	JSONErrors               *bool                    `yaml:"json_errors"`
+	ExposeServedBy           *bool                    `yaml:"expose_served_by"`
+	InstanceID               *string                  `yaml:"instance_id"`
 }
 
 // yamlCache mirrors the "proxy.cache" section.
 type yamlCache struct {
-	Enabled    *bool   `yaml:"enabled"`
-	MaxEntries *int    `yaml:"max_entries"`
-	TTL        *string `yaml:"ttl"`
+	Enabled              *bool             `yaml:"enabled"`
+	MaxEntries           *int              `yaml:"max_entries"`
+	TTL                  *string           `yaml:"ttl"`
+	KeyPrefix            *string           `yaml:"key_prefix"`
+	ShareHeadGet         *bool             `yaml:"share_head_get"`
+	MinTTL               *string           `yaml:"min_ttl"`
+	MaxTTL               *string           `yaml:"max_ttl"`
+	IgnoreCookieRequests *bool             `yaml:"ignore_cookie_requests"`
+	AllowedCookies       []string          `yaml:"allowed_cookies"`
+	PerUpstreamKey       *bool             `yaml:"per_upstream_key"`
+	NormalizeQuery       *bool             `yaml:"normalize_query"`
+	QueryFallbackPaths   []string          `yaml:"query_fallback_paths"`
+	EvictionWarnRate     *int              `yaml:"eviction_warn_rate"`
+	Shards               *int              `yaml:"shards"`
+	MaxStale             *string           `yaml:"max_stale"`
+	NeverCacheStatuses   []int             `yaml:"never_cache_statuses"`
+	HeuristicFreshness   *bool             `yaml:"heuristic_freshness"`
+	StatusTTLs           map[string]string `yaml:"status_ttls"`
+	TTLJitter            *float64          `yaml:"ttl_jitter"`
+	SweepInterval        *string           `yaml:"sweep_interval"`
+	BodyHashConcurrency  *int              `yaml:"body_hash_concurrency"`
+	MaxBodyHashBytes     *int64            `yaml:"max_body_hash_bytes"`
+	MaxBytesPerKey       *int              `yaml:"max_bytes_per_key"`
+	StoreCompressed      *bool             `yaml:"store_compressed"`
+}
+
+// yamlHealthCheck mirrors the "proxy.health_check" section.
+type yamlHealthCheck struct {
+	Interval    *string `yaml:"interval"`
+	Jitter      *string `yaml:"jitter"`
+	Concurrency *int    `yaml:"concurrency"`
+	Timeout     *string `yaml:"timeout"`
+}
+
+// yamlUpstreamKeepalive mirrors the "proxy.upstream_keepalive" section.
+type yamlUpstreamKeepalive struct {
+	Enabled  *bool   `yaml:"enabled"`
+	Interval *string `yaml:"interval"`
+	Method   *string `yaml:"method"`
+	Path     *string `yaml:"path"`
+}
+
+// yamlOutlierDetection mirrors the "proxy.outlier_detection" section.
+type yamlOutlierDetection struct {
+	ConsecutiveFailures *int    `yaml:"consecutive_failures"`
+	EjectionTime        *string `yaml:"ejection_time"`
+	MaxEjectionPercent  *int    `yaml:"max_ejection_percent"`
+}
+
+// yamlUpstreamUnavailable mirrors the "proxy.upstream_unavailable" section.
+type yamlUpstreamUnavailable struct {
+	RetryAfter    *string `yaml:"retry_after"`
+	RefusedStatus *int    `yaml:"refused_status"`
+}
+
+// yamlTarget is a proxy.targets entry: a URL string or a mapping with per-target options.
+type yamlTarget struct {
+	URL     string            `yaml:"url"`
+	Timeout *string           `yaml:"timeout"`
+	Weight  *int              `yaml:"weight"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// UnmarshalYAML accepts both "http://host:port" and {url: "http://host:port", timeout: "2s"}.
+func (target *yamlTarget) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		target.URL = node.Value
+		return nil
+	}
+	type plainTarget yamlTarget
+	return node.Decode((*plainTarget)(target))
+}
+
+// yamlClientNetwork is a proxy.client_networks entry routing matching clients to its own targets.
+type yamlClientNetwork struct {
+	Name    string       `yaml:"name"`
+	CIDRs   []string     `yaml:"cidrs"`
+	Targets []yamlTarget `yaml:"targets"`
+}
+
+// parseTarget validates a target entry and returns its URL and options (nil when none are set).
+// A URL without "://" (e.g. "localhost:9000") gets assumeScheme prepended when it is set;
+// the result must still have a scheme and host.
+func parseTarget(entry yamlTarget, kind, assumeScheme string) (*url.URL, *TargetOptions, error) {
+	rawURL := strings.TrimSpace(entry.URL)
+	if assumeScheme != "" && rawURL != "" && !strings.Contains(rawURL, "://") {
+		rawURL = assumeScheme + "://" + rawURL
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return nil, nil, fmt.Errorf("config: invalid %s %q", kind, entry.URL)
+	}
+	hasTimeout := entry.Timeout != nil && strings.TrimSpace(*entry.Timeout) != ""
+	if !hasTimeout && entry.Weight == nil && len(entry.Headers) == 0 {
+		return parsedURL, nil, nil
+	}
+	options := &TargetOptions{URL: parsedURL}
+	if hasTimeout {
+		timeout, err := time.ParseDuration(strings.TrimSpace(*entry.Timeout))
+		if err != nil || timeout < 0 {
+			return nil, nil, fmt.Errorf("config: invalid timeout %q for %s %q", *entry.Timeout, kind, entry.URL)
+		}
+		options.Timeout = timeout
+	}
+	if entry.Weight != nil {
+		if *entry.Weight < 1 {
+			return nil, nil, fmt.Errorf("config: invalid weight %d for %s %q (must be >= 1)", *entry.Weight, kind, entry.URL)
+		}
+		options.Weight = *entry.Weight
+	}
+	for name := range entry.Headers {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " :\t\r\n") {
+			return nil, nil, fmt.Errorf("config: invalid header name %q for %s %q", name, kind, entry.URL)
+		}
+	}
+	options.Headers = entry.Headers
+	return parsedURL, options, nil
+}
+
+// parseStatusRange parses a status key: an exact code ("404"), a class ("4xx") or an
+// inclusive range ("400-499"), all within 100-599.
+func parseStatusRange(key string) (minStatus, maxStatus int, ok bool) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if len(key) == 3 && strings.HasSuffix(key, "xx") && key[0] >= '1' && key[0] <= '5' {
+		class := int(key[0]-'0') * 100
+		return class, class + 99, true
+	}
+	low, high, isRange := strings.Cut(key, "-")
+	minStatus, err := strconv.Atoi(strings.TrimSpace(low))
+	if err != nil {
+		return 0, 0, false
+	}
+	maxStatus = minStatus
+	if isRange {
+		if maxStatus, err = strconv.Atoi(strings.TrimSpace(high)); err != nil {
+			return 0, 0, false
+		}
+	}
+	if minStatus < 100 || maxStatus > 599 || minStatus > maxStatus {
+		return 0, 0, false
+	}
+	return minStatus, maxStatus, true
+}
+
+// rejectDuplicateTargets returns an error naming the first target listed twice in where,
+// comparing upstream identities (scheme, host and port with defaults filled in).
+func rejectDuplicateTargets(targets []*url.URL, where string) error {
+	for i, target := range targets {
+		for _, earlier := range targets[:i] {
+			if proxy.SameUpstream(earlier, target) {
+				return fmt.Errorf("config: duplicate target %q in %s (same upstream as %q)", target, where, earlier)
+			}
+		}
+	}
+	return nil
 }
 
 // yamlQueue mirrors the "proxy.queue" section.
 type yamlQueue struct {
-	MaxQueue        *int    `yaml:"max_queue"`
-	MaxConcurrent   *int    `yaml:"max_concurrent"`
-	EnqueueTimeout  *string `yaml:"enqueue_timeout"`
-	QueueWaitHeader *bool   `yaml:"queue_wait_header"`
+	Enabled         *bool          `yaml:"enabled"`
+	MaxQueue        *int           `yaml:"max_queue"`
+	MaxConcurrent   *int           `yaml:"max_concurrent"`
+	EnqueueTimeout  *string        `yaml:"enqueue_timeout"`
+	QueueWaitHeader *bool          `yaml:"queue_wait_header"`
+	WarmupWindow    *string        `yaml:"warmup_window"`
+	WarmupFraction  *float64       `yaml:"warmup_fraction"`
+	MethodLimits    map[string]int `yaml:"method_limits"`
 }
 
 // yamlTLS mirrors the "proxy.tls" section.
@@ -94,30 +533,115 @@ type yamlTLS struct {
 	KeyFile  *string `yaml:"key_file"`
 }
 
+// yamlAdmin mirrors the "proxy.admin" section.
+type yamlAdmin struct {
+	Token *string `yaml:"token"`
+}
+
+// yamlMaintenance mirrors the "proxy.maintenance" section.
+type yamlMaintenance struct {
+	Enabled    *bool   `yaml:"enabled"`
+	RetryAfter *string `yaml:"retry_after"`
+	Message    *string `yaml:"message"`
+}
+
+// yamlIdempotency mirrors the "proxy.idempotency" section.
+type yamlIdempotency struct {
+	Enabled *bool   `yaml:"enabled"`
+	Window  *string `yaml:"window"`
+}
+
+// yamlStartupProbe mirrors the "proxy.startup_probe" section.
+type yamlStartupProbe struct {
+	Enabled           *bool   `yaml:"enabled"`
+	RequireOneHealthy *bool   `yaml:"require_one_healthy"`
+	Timeout           *string `yaml:"timeout"`
+	Deadline          *string `yaml:"deadline"`
+}
+
+// yamlCapabilityProbe mirrors the "proxy.capability_probe" section.
+type yamlCapabilityProbe struct {
+	Enabled            *bool   `yaml:"enabled"`
+	Timeout            *string `yaml:"timeout"`
+	ConfigureTransport *bool   `yaml:"configure_transport"`
+}
+
+// yamlRootResponse mirrors the "proxy.default_root_response" section.
+type yamlRootResponse struct {
+	Enabled     *bool   `yaml:"enabled"`
+	Status      *int    `yaml:"status"`
+	ContentType *string `yaml:"content_type"`
+	Body        *string `yaml:"body"`
+}
+
+// yamlStaticRoute mirrors one entry of "proxy.static_routes".
+type yamlStaticRoute struct {
+	Path        string `yaml:"path"`
+	Status      int    `yaml:"status"`
+	ContentType string `yaml:"content_type"`
+	Body        string `yaml:"body"`
+	File        string `yaml:"file"`
+}
+
+// yamlMirror mirrors the "proxy.mirror" section.
+type yamlMirror struct {
+	Target       *string `yaml:"target"`
+	Workers      *int    `yaml:"workers"`
+	QueueSize    *int    `yaml:"queue_size"`
+	MaxBodyBytes *int64  `yaml:"max_body_bytes"`
+}
+
+// yamlDebug mirrors the "proxy.debug" section.
+type yamlDebug struct {
+	ExposeCacheKey     *bool `yaml:"expose_cache_key"`
+	ExposeUpstreamTime *bool `yaml:"expose_upstream_time"`
+}
+
+// yamlCollapse mirrors the "proxy.collapse_forwarding" section.
+type yamlCollapse struct {
+	Enabled *bool    `yaml:"enabled"`
+	Paths   []string `yaml:"paths"`
+}
+
+// yamlStream mirrors the "proxy.stream" section.
+type yamlStream struct {
+	BufferBytes   *int    `yaml:"buffer_bytes"`
+	FlushInterval *string `yaml:"flush_interval"`
+	Chunked       *bool   `yaml:"chunked_passthrough"`
+}
+
+// yamlCompression mirrors the "proxy.compression" section.
+type yamlCompression struct {
+	Enabled *bool `yaml:"enabled"`
+	MinSize *int  `yaml:"min_size"`
+	Brotli  *bool `yaml:"brotli"`
+}
+
 // yamlUpstream exists for backward-compatibility (unused for now).
 type yamlUpstream struct {
 	Listen any `yaml:"listen"` // accept string or list
 }
 
 // Load reads configuration from YAML, applies defaults, normalizes values,
-// and returns a ready-to-use Config instance.
+// and returns a ready-to-use Config instance. CONFIG_FILES and proxy.includes layer
+// several files into one document before it is interpreted (see loadMergedYAML).
 func Load() (*Config, error) {
-	// Find the config file path.
-	configFilePath, err := findConfigFile()
+	// Find the config file path(s).
+	configFilePaths, err := configFilePaths()
 	if err != nil {
 		return nil, err
 	}
 
-	// Read the YAML configuration file from disk.
-	fileBytes, err := os.ReadFile(configFilePath)
+	// Read and deep-merge the YAML files (later files override earlier keys).
+	mergedYAML, err := loadMergedYAML(configFilePaths)
 	if err != nil {
-		return nil, fmt.Errorf("read config file %s: %w", configFilePath, err)
+		return nil, err
 	}
 
-	// Unmarshal into the YAML model so we can tell "omitted" vs "explicit zero/false".
+	// Decode into the YAML model so we can tell "omitted" vs "explicit zero/false".
 	var yamlRootCfg yamlRoot
-	if err := yaml.Unmarshal(fileBytes, &yamlRootCfg); err != nil {
-		return nil, fmt.Errorf("parse yaml %s: %w", configFilePath, err)
+	if err := mergedYAML.Decode(&yamlRootCfg); err != nil {
+		return nil, fmt.Errorf("parse yaml %s: %w", strings.Join(configFilePaths, ","), err)
 	}
 	if yamlRootCfg.Proxy == nil {
 		return nil, errors.New("config: proxy section is required")
@@ -127,9 +651,10 @@ func Load() (*Config, error) {
 	cfg := &Config{
 		ListenAddr: defaultListen,
 		Cache: CacheConfig{
-			Enabled:    defaultCacheEnabled,
-			MaxEntries: defaultCacheMaxEntries,
-			TTL:        defaultCacheTTL,
+			Enabled:              defaultCacheEnabled,
+			MaxEntries:           defaultCacheMaxEntries,
+			TTL:                  defaultCacheTTL,
+			IgnoreCookieRequests: defaultIgnoreCookieReqs,
 		},
 		Queue: proxy.QueueConfig{
 			MaxQueue:        defaultQueueMax,
@@ -137,14 +662,60 @@ func Load() (*Config, error) {
 			EnqueueTimeout:  defaultQueueEnqueueTimeout,
 			QueueWaitHeader: defaultQueueWaitHeader,
 		},
+		QueueEnabled:            defaultQueueEnabled,
 		AllowedMethods:          parseMethods(defaultAllowedMethods),
+		HandleOptions:           defaultHandleOptions,
+		BlockTrace:              defaultBlockTrace,
+		AllowedSchemes:          []string{"http", "https"},
 		LoadBalancerStrategy:    defaultLBStrategy,
 		LoadBalancerHealthCheck: defaultLBHealthCheck,
+		HealthCheck:             HealthCheckConfig{Concurrency: defaultHealthConcurrency},
+		UpstreamKeepalive:       UpstreamKeepaliveConfig{Interval: defaultKeepaliveInterval, Method: http.MethodHead, Path: "/"},
+		OutlierDetection:        OutlierDetectionConfig{EjectionTime: defaultOutlierEjectionTime},
+		UpstreamUnavailable:     UpstreamUnavailableConfig{RetryAfter: defaultUnavailableRetry, RefusedStatus: http.StatusServiceUnavailable},
 		TLS: TLSConfig{
 			Enabled:  false,
 			CertFile: "",
 			KeyFile:  "",
 		},
+		ForwardedHeaderMode:  defaultForwardedHeaderMode,
+		Mode:                 proxy.ModeReverse,
+		RequestTimeoutHeader: defaultRequestTimeoutHdr,
+		ClientTimeoutHeader:  defaultRequestTimeoutHdr,
+		Idempotency: IdempotencyConfig{
+			Enabled: false,
+			Window:  defaultIdempotencyWindow,
+		},
+		StartupProbe: StartupProbeConfig{
+			Enabled:           false,
+			RequireOneHealthy: false,
+			Timeout:           defaultStartupProbeTimeout,
+			Deadline:          defaultStartupProbeDeadline,
+		},
+		CapabilityProbe: CapabilityProbeConfig{
+			Enabled: false,
+			Timeout: defaultStartupProbeTimeout,
+		},
+		Mirror: MirrorConfig{
+			Workers:      defaultMirrorWorkers,
+			QueueSize:    defaultMirrorQueueSize,
+			MaxBodyBytes: defaultMirrorMaxBodyBytes,
+		},
+		Compression: CompressionConfig{
+			Enabled: false,
+			MinSize: defaultCompressionMinSize,
+		},
+		RequestDecompressMax:     defaultRequestDecompressMax,
+		ValidateContentDigestMax: defaultContentDigestMax,
+		Stream: StreamConfig{
+			BufferBytes: defaultStreamBufferBytes,
+		},
+		DefaultRootResponse: RootResponseConfig{
+			Status: http.StatusServiceUnavailable,
+		},
+		Metrics: MetricsConfig{
+			UpstreamLabelHeader: "X-Upstream",
+		},
 	}
 
 	// Apply proxy.listen if provided.
@@ -153,40 +724,317 @@ func Load() (*Config, error) {
 	}
 
 	// Collect and validate at least one target (proxy.targets only).
-	var rawTargetStrings []string
-	if len(yamlRootCfg.Proxy.Targets) > 0 {
-		rawTargetStrings = yamlRootCfg.Proxy.Targets
-	}
-	if len(rawTargetStrings) == 0 {
+	if len(yamlRootCfg.Proxy.Targets) == 0 {
 		return nil, errors.New(`config: proxy.targets must be defined with at least one URL (e.g., ["http://localhost:9000"])`)
 	}
 
-	// Parse and validate each target URL.
+	// Scheme assumed for host-only targets ("localhost:9000"); "" requires explicit schemes.
+	assumeScheme := defaultAssumeScheme
+	if yamlRootCfg.Proxy.AssumeScheme != nil {
+		assumeScheme = strings.ToLower(strings.TrimSpace(*yamlRootCfg.Proxy.AssumeScheme))
+		if assumeScheme != "" && assumeScheme != "http" && assumeScheme != "https" {
+			return nil, fmt.Errorf("config: invalid assume_scheme %q (want http, https or empty)", *yamlRootCfg.Proxy.AssumeScheme)
+		}
+	}
+
+	// Parse and validate each target (URL string or rich form with options).
 	var parsedTargetURLs []*url.URL
-	for _, targetStr := range rawTargetStrings {
-		parsedURL, err := url.Parse(strings.TrimSpace(targetStr))
-		if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
-			return nil, fmt.Errorf("config: invalid target %q", targetStr)
+	for _, targetEntry := range yamlRootCfg.Proxy.Targets {
+		parsedURL, options, err := parseTarget(targetEntry, "target", assumeScheme)
+		if err != nil {
+			return nil, err
 		}
 		parsedTargetURLs = append(parsedTargetURLs, parsedURL)
+		if options != nil {
+			cfg.TargetOptions = append(cfg.TargetOptions, *options)
+		}
 	}
 	cfg.TargetURLs = parsedTargetURLs
 	cfg.TargetURL = parsedTargetURLs[0] // first item remains the primary target
 
+	// Backup (failover) targets (optional).
+	for _, backupEntry := range yamlRootCfg.Proxy.BackupTargets {
+		parsedURL, options, err := parseTarget(backupEntry, "backup target", assumeScheme)
+		if err != nil {
+			return nil, err
+		}
+		cfg.BackupTargetURLs = append(cfg.BackupTargetURLs, parsedURL)
+		if options != nil {
+			cfg.TargetOptions = append(cfg.TargetOptions, *options)
+		}
+	}
+	// A target listed twice (primaries and backups share one pool of identities) would
+	// skew balancing and be probed twice.
+	if err := rejectDuplicateTargets(append(append([]*url.URL{}, cfg.TargetURLs...), cfg.BackupTargetURLs...), "proxy.targets/backup_targets"); err != nil {
+		return nil, err
+	}
+	configuredTargets := len(cfg.TargetURLs) + len(cfg.BackupTargetURLs)
+
+	// Client network pools (optional): first pool whose CIDR contains the client wins.
+	for index, networkEntry := range yamlRootCfg.Proxy.ClientNetworks {
+		pool := proxy.ClientNetworkPool{Name: strings.TrimSpace(networkEntry.Name)}
+		if pool.Name == "" {
+			pool.Name = fmt.Sprintf("pool-%d", index)
+		}
+		if len(networkEntry.CIDRs) == 0 || len(networkEntry.Targets) == 0 {
+			return nil, fmt.Errorf("config: proxy.client_networks %q needs at least one cidr and one target", pool.Name)
+		}
+		for _, cidr := range networkEntry.CIDRs {
+			if _, _, err := net.ParseCIDR(strings.TrimSpace(cidr)); err != nil {
+				return nil, fmt.Errorf("config: invalid cidr %q in proxy.client_networks %q", cidr, pool.Name)
+			}
+			pool.CIDRs = append(pool.CIDRs, strings.TrimSpace(cidr))
+		}
+		for _, targetEntry := range networkEntry.Targets {
+			parsedURL, options, err := parseTarget(targetEntry, "client network target", assumeScheme)
+			if err != nil {
+				return nil, err
+			}
+			pool.Targets = append(pool.Targets, parsedURL)
+			if options != nil {
+				cfg.TargetOptions = append(cfg.TargetOptions, *options)
+			}
+		}
+		if err := rejectDuplicateTargets(pool.Targets, fmt.Sprintf("proxy.client_networks %q", pool.Name)); err != nil {
+			return nil, err
+		}
+		configuredTargets += len(pool.Targets)
+		cfg.ClientNetworks = append(cfg.ClientNetworks, pool)
+	}
+
+	// Optional cap on configured targets (primaries, backups and client network pools).
+	if maxTargets := yamlRootCfg.Proxy.MaxTargets; maxTargets != nil {
+		if *maxTargets < 0 {
+			return nil, fmt.Errorf("config: invalid proxy.max_targets %d", *maxTargets)
+		}
+		if *maxTargets > 0 && configuredTargets > *maxTargets {
+			return nil, fmt.Errorf("config: %d targets configured, more than proxy.max_targets %d", configuredTargets, *maxTargets)
+		}
+	}
+
 	// Load balancer strategy (optional).
 	if yamlRootCfg.Proxy.LoadBalancerStrategy != nil && strings.TrimSpace(*yamlRootCfg.Proxy.LoadBalancerStrategy) != "" {
 		cfg.LoadBalancerStrategy = strings.TrimSpace(*yamlRootCfg.Proxy.LoadBalancerStrategy)
+		if _, err := proxy.CanonicalStrategy(cfg.LoadBalancerStrategy); err != nil {
+			return nil, fmt.Errorf("config: invalid load_balancer_strategy: %v", err)
+		}
 	}
 	// Load balancer health check (optional).
 	if yamlRootCfg.Proxy.LoadBalancerHealthCheck != nil {
 		cfg.LoadBalancerHealthCheck = *yamlRootCfg.Proxy.LoadBalancerHealthCheck
 	}
+	if yamlRootCfg.Proxy.HealthCheck != nil {
+		if yamlRootCfg.Proxy.HealthCheck.Interval != nil && strings.TrimSpace(*yamlRootCfg.Proxy.HealthCheck.Interval) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.HealthCheck.Interval))
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("config: invalid health_check.interval %q", *yamlRootCfg.Proxy.HealthCheck.Interval)
+			}
+			cfg.HealthCheck.Interval = parsed
+		}
+		if yamlRootCfg.Proxy.HealthCheck.Jitter != nil && strings.TrimSpace(*yamlRootCfg.Proxy.HealthCheck.Jitter) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.HealthCheck.Jitter))
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("config: invalid health_check.jitter %q", *yamlRootCfg.Proxy.HealthCheck.Jitter)
+			}
+			cfg.HealthCheck.Jitter = parsed
+		}
+		if concurrency := yamlRootCfg.Proxy.HealthCheck.Concurrency; concurrency != nil {
+			if *concurrency < 0 {
+				return nil, fmt.Errorf("config: invalid health_check.concurrency %d", *concurrency)
+			}
+			cfg.HealthCheck.Concurrency = *concurrency
+		}
+		if yamlRootCfg.Proxy.HealthCheck.Timeout != nil && strings.TrimSpace(*yamlRootCfg.Proxy.HealthCheck.Timeout) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.HealthCheck.Timeout))
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("config: invalid health_check.timeout %q", *yamlRootCfg.Proxy.HealthCheck.Timeout)
+			}
+			cfg.HealthCheck.Timeout = parsed
+		}
+	}
+
+	// Upstream keepalive/warmup requests (optional).
+	if keepalive := yamlRootCfg.Proxy.UpstreamKeepalive; keepalive != nil {
+		if keepalive.Enabled != nil {
+			cfg.UpstreamKeepalive.Enabled = *keepalive.Enabled
+		}
+		if keepalive.Interval != nil && strings.TrimSpace(*keepalive.Interval) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*keepalive.Interval))
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("config: invalid upstream_keepalive.interval %q", *keepalive.Interval)
+			}
+			cfg.UpstreamKeepalive.Interval = parsed
+		}
+		if keepalive.Method != nil && strings.TrimSpace(*keepalive.Method) != "" {
+			cfg.UpstreamKeepalive.Method = strings.ToUpper(strings.TrimSpace(*keepalive.Method))
+		}
+		if keepalive.Path != nil && strings.TrimSpace(*keepalive.Path) != "" {
+			cfg.UpstreamKeepalive.Path = strings.TrimSpace(*keepalive.Path)
+		}
+	}
+
+	// Passive outlier ejection (optional).
+	if yamlRootCfg.Proxy.OutlierDetection != nil {
+		if failures := yamlRootCfg.Proxy.OutlierDetection.ConsecutiveFailures; failures != nil {
+			if *failures < 0 {
+				return nil, fmt.Errorf("config: invalid outlier_detection.consecutive_failures %d", *failures)
+			}
+			cfg.OutlierDetection.ConsecutiveFailures = *failures
+		}
+		if yamlRootCfg.Proxy.OutlierDetection.EjectionTime != nil && strings.TrimSpace(*yamlRootCfg.Proxy.OutlierDetection.EjectionTime) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.OutlierDetection.EjectionTime))
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("config: invalid outlier_detection.ejection_time %q", *yamlRootCfg.Proxy.OutlierDetection.EjectionTime)
+			}
+			cfg.OutlierDetection.EjectionTime = parsed
+		}
+		if percent := yamlRootCfg.Proxy.OutlierDetection.MaxEjectionPercent; percent != nil {
+			if *percent < 0 || *percent > 100 {
+				return nil, fmt.Errorf("config: invalid outlier_detection.max_ejection_percent %d", *percent)
+			}
+			cfg.OutlierDetection.MaxEjectionPercent = *percent
+		}
+	}
+
+	// Upstream-down responses (optional).
+	if yamlRootCfg.Proxy.UpstreamUnavailable != nil {
+		if retryAfter := yamlRootCfg.Proxy.UpstreamUnavailable.RetryAfter; retryAfter != nil && strings.TrimSpace(*retryAfter) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*retryAfter))
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("config: invalid upstream_unavailable.retry_after %q", *retryAfter)
+			}
+			cfg.UpstreamUnavailable.RetryAfter = parsed
+		}
+		if refusedStatus := yamlRootCfg.Proxy.UpstreamUnavailable.RefusedStatus; refusedStatus != nil {
+			if *refusedStatus != http.StatusServiceUnavailable && *refusedStatus != http.StatusBadGateway {
+				return nil, fmt.Errorf("config: invalid upstream_unavailable.refused_status %d (want 502 or 503)", *refusedStatus)
+			}
+			cfg.UpstreamUnavailable.RefusedStatus = *refusedStatus
+		}
+	}
 
 	// Allowed HTTP methods (optional). Normalize to upper-case unique values.
 	if len(yamlRootCfg.Proxy.AllowedMethods) > 0 {
 		cfg.AllowedMethods = parseMethods(strings.Join(yamlRootCfg.Proxy.AllowedMethods, ","))
 	}
 
+	// Special-method handling (optional).
+	if yamlRootCfg.Proxy.HandleOptions != nil {
+		cfg.HandleOptions = *yamlRootCfg.Proxy.HandleOptions
+	}
+	if yamlRootCfg.Proxy.BlockTrace != nil {
+		cfg.BlockTrace = *yamlRootCfg.Proxy.BlockTrace
+	}
+	if len(yamlRootCfg.Proxy.AllowedSchemes) > 0 {
+		cfg.AllowedSchemes = nil
+		for _, scheme := range yamlRootCfg.Proxy.AllowedSchemes {
+			scheme = strings.ToLower(strings.TrimSpace(scheme))
+			if scheme != "http" && scheme != "https" {
+				return nil, fmt.Errorf("config: invalid allowed_schemes entry %q (want http or https)", scheme)
+			}
+			cfg.AllowedSchemes = append(cfg.AllowedSchemes, scheme)
+		}
+	}
+
+	// Host allowlist (optional): entries may also be comma-separated.
+	for _, host := range strings.Split(strings.Join(yamlRootCfg.Proxy.AllowedHosts, ","), ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if strings.ContainsAny(host, "/ *") {
+			return nil, fmt.Errorf("config: invalid allowed_hosts entry %q", host)
+		}
+		cfg.AllowedHosts = append(cfg.AllowedHosts, host)
+	}
+
+	// End-to-end request budget (optional).
+	if yamlRootCfg.Proxy.RequestTimeout != nil && strings.TrimSpace(*yamlRootCfg.Proxy.RequestTimeout) != "" {
+		parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.RequestTimeout))
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("config: invalid request_timeout %q", *yamlRootCfg.Proxy.RequestTimeout)
+		}
+		cfg.RequestTimeout = parsed
+	}
+	if yamlRootCfg.Proxy.RequestTimeoutHeader != nil {
+		cfg.RequestTimeoutHeader = strings.TrimSpace(*yamlRootCfg.Proxy.RequestTimeoutHeader)
+	}
+	// Client-requested budgets (optional).
+	if yamlRootCfg.Proxy.ClientTimeoutHeader != nil {
+		cfg.ClientTimeoutHeader = strings.TrimSpace(*yamlRootCfg.Proxy.ClientTimeoutHeader)
+	}
+	if yamlRootCfg.Proxy.ClientTimeoutMax != nil && strings.TrimSpace(*yamlRootCfg.Proxy.ClientTimeoutMax) != "" {
+		parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.ClientTimeoutMax))
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("config: invalid client_timeout_max %q", *yamlRootCfg.Proxy.ClientTimeoutMax)
+		}
+		cfg.ClientTimeoutMax = parsed
+	}
+
+	// Request URI length limit (optional).
+	if yamlRootCfg.Proxy.MaxURILength != nil {
+		if *yamlRootCfg.Proxy.MaxURILength < 0 {
+			return nil, fmt.Errorf("config: invalid max_uri_length %d", *yamlRootCfg.Proxy.MaxURILength)
+		}
+		cfg.MaxURILength = *yamlRootCfg.Proxy.MaxURILength
+	}
+
+	// Connection accept throttling (optional).
+	if yamlRootCfg.Proxy.AcceptRate != nil {
+		if *yamlRootCfg.Proxy.AcceptRate < 0 {
+			return nil, fmt.Errorf("config: invalid accept_rate %v", *yamlRootCfg.Proxy.AcceptRate)
+		}
+		cfg.AcceptRate = *yamlRootCfg.Proxy.AcceptRate
+	}
+	if yamlRootCfg.Proxy.AcceptBurst != nil {
+		if *yamlRootCfg.Proxy.AcceptBurst < 0 {
+			return nil, fmt.Errorf("config: invalid accept_burst %d", *yamlRootCfg.Proxy.AcceptBurst)
+		}
+		cfg.AcceptBurst = *yamlRootCfg.Proxy.AcceptBurst
+	}
+	if yamlRootCfg.Proxy.MaxUpstreamBodyBytes != nil {
+		if *yamlRootCfg.Proxy.MaxUpstreamBodyBytes < 0 {
+			return nil, fmt.Errorf("config: invalid max_upstream_body_bytes %d", *yamlRootCfg.Proxy.MaxUpstreamBodyBytes)
+		}
+		cfg.MaxUpstreamBodyBytes = *yamlRootCfg.Proxy.MaxUpstreamBodyBytes
+	}
+
+	// Path encoding preservation (optional).
+	if yamlRootCfg.Proxy.PreserveEncodedPath != nil {
+		cfg.PreserveEncodedPath = *yamlRootCfg.Proxy.PreserveEncodedPath
+	}
+	if yamlRootCfg.Proxy.RewriteMountedPaths != nil {
+		cfg.RewriteMountedPaths = *yamlRootCfg.Proxy.RewriteMountedPaths
+	}
+
+	// Trailing-slash normalization (optional).
+	if yamlRootCfg.Proxy.NormalizeTrailingSlash != nil && strings.TrimSpace(*yamlRootCfg.Proxy.NormalizeTrailingSlash) != "" {
+		mode := strings.ToLower(strings.TrimSpace(*yamlRootCfg.Proxy.NormalizeTrailingSlash))
+		switch mode {
+		case proxy.TrailingSlashOff, proxy.TrailingSlashStrip, proxy.TrailingSlashAdd:
+			cfg.TrailingSlash = mode
+		default:
+			return nil, fmt.Errorf("config: invalid normalize_trailing_slash %q (want off, strip or add)", *yamlRootCfg.Proxy.NormalizeTrailingSlash)
+		}
+	}
+	if yamlRootCfg.Proxy.TrailingSlashForward != nil {
+		cfg.TrailingSlashForward = *yamlRootCfg.Proxy.TrailingSlashForward
+	}
+
+	// Extra response headers stripped before reaching clients (optional).
+	for _, headerName := range yamlRootCfg.Proxy.StripResponseHeaders {
+		if headerName = strings.TrimSpace(headerName); headerName != "" {
+			cfg.StripResponseHeaders = append(cfg.StripResponseHeaders, headerName)
+		}
+	}
+
+	// Trace headers whose value becomes the request ID (optional).
+	for _, headerName := range yamlRootCfg.Proxy.TraceIDHeaders {
+		if headerName = strings.TrimSpace(headerName); headerName != "" {
+			cfg.TraceIDHeaders = append(cfg.TraceIDHeaders, headerName)
+		}
+	}
+
 	// Cache section (optional).
 	if yamlRootCfg.Proxy.Cache != nil {
 		if yamlRootCfg.Proxy.Cache.Enabled != nil {
@@ -202,10 +1050,131 @@ func Load() (*Config, error) {
 				return nil, fmt.Errorf("config: invalid cache.ttl: %v", err)
 			}
 		}
+		if yamlRootCfg.Proxy.Cache.KeyPrefix != nil {
+			cfg.Cache.KeyPrefix = strings.TrimSpace(*yamlRootCfg.Proxy.Cache.KeyPrefix)
+		}
+		if yamlRootCfg.Proxy.Cache.ShareHeadGet != nil {
+			cfg.Cache.ShareHeadGet = *yamlRootCfg.Proxy.Cache.ShareHeadGet
+		}
+		if yamlRootCfg.Proxy.Cache.PerUpstreamKey != nil {
+			cfg.Cache.PerUpstreamKey = *yamlRootCfg.Proxy.Cache.PerUpstreamKey
+		}
+		if yamlRootCfg.Proxy.Cache.NormalizeQuery != nil {
+			cfg.Cache.NormalizeQuery = *yamlRootCfg.Proxy.Cache.NormalizeQuery
+		}
+		for _, pathPrefix := range yamlRootCfg.Proxy.Cache.QueryFallbackPaths {
+			if pathPrefix = strings.TrimSpace(pathPrefix); pathPrefix != "" {
+				if !strings.HasPrefix(pathPrefix, "/") {
+					return nil, fmt.Errorf("config: invalid cache.query_fallback_paths entry %q", pathPrefix)
+				}
+				cfg.Cache.QueryFallbackPaths = append(cfg.Cache.QueryFallbackPaths, pathPrefix)
+			}
+		}
+		if yamlRootCfg.Proxy.Cache.EvictionWarnRate != nil {
+			if *yamlRootCfg.Proxy.Cache.EvictionWarnRate < 0 {
+				return nil, fmt.Errorf("config: invalid cache.eviction_warn_rate %d", *yamlRootCfg.Proxy.Cache.EvictionWarnRate)
+			}
+			cfg.Cache.EvictionWarnRate = *yamlRootCfg.Proxy.Cache.EvictionWarnRate
+		}
+		if yamlRootCfg.Proxy.Cache.Shards != nil {
+			if *yamlRootCfg.Proxy.Cache.Shards < 0 {
+				return nil, fmt.Errorf("config: invalid cache.shards %d", *yamlRootCfg.Proxy.Cache.Shards)
+			}
+			cfg.Cache.Shards = *yamlRootCfg.Proxy.Cache.Shards
+		}
+		if yamlRootCfg.Proxy.Cache.BodyHashConcurrency != nil {
+			if *yamlRootCfg.Proxy.Cache.BodyHashConcurrency < 0 {
+				return nil, fmt.Errorf("config: invalid cache.body_hash_concurrency %d", *yamlRootCfg.Proxy.Cache.BodyHashConcurrency)
+			}
+			cfg.Cache.BodyHashConcurrency = *yamlRootCfg.Proxy.Cache.BodyHashConcurrency
+		}
+		if yamlRootCfg.Proxy.Cache.MaxBodyHashBytes != nil {
+			if *yamlRootCfg.Proxy.Cache.MaxBodyHashBytes < 0 {
+				return nil, fmt.Errorf("config: invalid cache.max_body_hash_bytes %d", *yamlRootCfg.Proxy.Cache.MaxBodyHashBytes)
+			}
+			cfg.Cache.MaxBodyHashBytes = *yamlRootCfg.Proxy.Cache.MaxBodyHashBytes
+		}
+		if yamlRootCfg.Proxy.Cache.MaxBytesPerKey != nil {
+			if *yamlRootCfg.Proxy.Cache.MaxBytesPerKey < 0 {
+				return nil, fmt.Errorf("config: invalid cache.max_bytes_per_key %d", *yamlRootCfg.Proxy.Cache.MaxBytesPerKey)
+			}
+			cfg.Cache.MaxBytesPerKey = *yamlRootCfg.Proxy.Cache.MaxBytesPerKey
+		}
+		if yamlRootCfg.Proxy.Cache.StoreCompressed != nil {
+			cfg.Cache.StoreCompressed = *yamlRootCfg.Proxy.Cache.StoreCompressed
+		}
+		if yamlRootCfg.Proxy.Cache.MaxStale != nil && strings.TrimSpace(*yamlRootCfg.Proxy.Cache.MaxStale) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.Cache.MaxStale))
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("config: invalid cache.max_stale %q", *yamlRootCfg.Proxy.Cache.MaxStale)
+			}
+			cfg.Cache.MaxStale = parsed
+		}
+		if yamlRootCfg.Proxy.Cache.SweepInterval != nil && strings.TrimSpace(*yamlRootCfg.Proxy.Cache.SweepInterval) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.Cache.SweepInterval))
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("config: invalid cache.sweep_interval %q", *yamlRootCfg.Proxy.Cache.SweepInterval)
+			}
+			cfg.Cache.SweepInterval = parsed
+		}
+		if yamlRootCfg.Proxy.Cache.MinTTL != nil && strings.TrimSpace(*yamlRootCfg.Proxy.Cache.MinTTL) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.Cache.MinTTL))
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("config: invalid cache.min_ttl %q", *yamlRootCfg.Proxy.Cache.MinTTL)
+			}
+			cfg.Cache.MinTTL = parsed
+		}
+		if yamlRootCfg.Proxy.Cache.MaxTTL != nil && strings.TrimSpace(*yamlRootCfg.Proxy.Cache.MaxTTL) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.Cache.MaxTTL))
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("config: invalid cache.max_ttl %q", *yamlRootCfg.Proxy.Cache.MaxTTL)
+			}
+			cfg.Cache.MaxTTL = parsed
+		}
+		if yamlRootCfg.Proxy.Cache.IgnoreCookieRequests != nil {
+			cfg.Cache.IgnoreCookieRequests = *yamlRootCfg.Proxy.Cache.IgnoreCookieRequests
+		}
+		for _, cookieName := range yamlRootCfg.Proxy.Cache.AllowedCookies {
+			if cookieName = strings.TrimSpace(cookieName); cookieName != "" {
+				cfg.Cache.AllowedCookies = append(cfg.Cache.AllowedCookies, cookieName)
+			}
+		}
+		for _, status := range yamlRootCfg.Proxy.Cache.NeverCacheStatuses {
+			if status < 100 || status > 599 {
+				return nil, fmt.Errorf("config: invalid cache.never_cache_statuses entry %d", status)
+			}
+			cfg.Cache.NeverCacheStatuses = append(cfg.Cache.NeverCacheStatuses, status)
+		}
+		if yamlRootCfg.Proxy.Cache.HeuristicFreshness != nil {
+			cfg.Cache.HeuristicFreshness = *yamlRootCfg.Proxy.Cache.HeuristicFreshness
+		}
+		if yamlRootCfg.Proxy.Cache.TTLJitter != nil {
+			if *yamlRootCfg.Proxy.Cache.TTLJitter < 0 || *yamlRootCfg.Proxy.Cache.TTLJitter >= 1 {
+				return nil, fmt.Errorf("config: invalid cache.ttl_jitter %v (want 0 <= jitter < 1)", *yamlRootCfg.Proxy.Cache.TTLJitter)
+			}
+			cfg.Cache.TTLJitter = *yamlRootCfg.Proxy.Cache.TTLJitter
+		}
+		for statusKey, ttlValue := range yamlRootCfg.Proxy.Cache.StatusTTLs {
+			minStatus, maxStatus, ok := parseStatusRange(statusKey)
+			if !ok {
+				return nil, fmt.Errorf("config: invalid cache.status_ttls status %q (use 404, 4xx or 400-499)", statusKey)
+			}
+			ttl, err := time.ParseDuration(strings.TrimSpace(ttlValue))
+			if err != nil || ttl < 0 {
+				return nil, fmt.Errorf("config: invalid cache.status_ttls ttl %q for %q", ttlValue, statusKey)
+			}
+			cfg.Cache.StatusTTLs = append(cfg.Cache.StatusTTLs, proxy.StatusTTL{MinStatus: minStatus, MaxStatus: maxStatus, TTL: ttl})
+		}
+		if cfg.Cache.MaxTTL > 0 && cfg.Cache.MinTTL > cfg.Cache.MaxTTL {
+			return nil, fmt.Errorf("config: cache.min_ttl (%s) exceeds cache.max_ttl (%s)", cfg.Cache.MinTTL, cfg.Cache.MaxTTL)
+		}
 	}
 
 	// Queue section (optional).
 	if yamlRootCfg.Proxy.Queue != nil {
+		if yamlRootCfg.Proxy.Queue.Enabled != nil {
+			cfg.QueueEnabled = *yamlRootCfg.Proxy.Queue.Enabled
+		}
 		if yamlRootCfg.Proxy.Queue.MaxQueue != nil && *yamlRootCfg.Proxy.Queue.MaxQueue > 0 {
 			cfg.Queue.MaxQueue = *yamlRootCfg.Proxy.Queue.MaxQueue
 		}
@@ -223,6 +1192,28 @@ func Load() (*Config, error) {
 		if yamlRootCfg.Proxy.Queue.QueueWaitHeader != nil {
 			cfg.Queue.QueueWaitHeader = *yamlRootCfg.Proxy.Queue.QueueWaitHeader
 		}
+		if yamlRootCfg.Proxy.Queue.WarmupWindow != nil && strings.TrimSpace(*yamlRootCfg.Proxy.Queue.WarmupWindow) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.Queue.WarmupWindow))
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("config: invalid queue.warmup_window %q", *yamlRootCfg.Proxy.Queue.WarmupWindow)
+			}
+			cfg.Queue.WarmupWindow = parsed
+		}
+		if yamlRootCfg.Proxy.Queue.WarmupFraction != nil {
+			if fraction := *yamlRootCfg.Proxy.Queue.WarmupFraction; fraction <= 0 || fraction > 1 {
+				return nil, fmt.Errorf("config: invalid queue.warmup_fraction %v (want 0 < f <= 1)", fraction)
+			}
+			cfg.Queue.WarmupFraction = *yamlRootCfg.Proxy.Queue.WarmupFraction
+		}
+		for method, limit := range yamlRootCfg.Proxy.Queue.MethodLimits {
+			if limit <= 0 {
+				return nil, fmt.Errorf("config: invalid queue.method_limits[%s] %d (must be > 0)", method, limit)
+			}
+			if cfg.Queue.MethodLimits == nil {
+				cfg.Queue.MethodLimits = make(map[string]int)
+			}
+			cfg.Queue.MethodLimits[strings.ToUpper(strings.TrimSpace(method))] = limit
+		}
 	}
 
 	// TLS section (optional).
@@ -238,8 +1229,282 @@ func Load() (*Config, error) {
 		}
 	}
 
-	// Apply default cache TTL to proxy package.
+	// Forwarding header mode (optional).
+	if yamlRootCfg.Proxy.Mode != nil && strings.TrimSpace(*yamlRootCfg.Proxy.Mode) != "" {
+		mode := strings.ToLower(strings.TrimSpace(*yamlRootCfg.Proxy.Mode))
+		switch mode {
+		case proxy.ModeReverse, proxy.ModeForward:
+			cfg.Mode = mode
+		default:
+			return nil, fmt.Errorf("config: invalid mode %q (want reverse or forward)", mode)
+		}
+	}
+	for _, destination := range yamlRootCfg.Proxy.ConnectAllowlist {
+		destination = strings.TrimSpace(destination)
+		if destination == "" {
+			continue
+		}
+		if host, port, err := net.SplitHostPort(destination); err != nil || host == "" || port == "" {
+			return nil, fmt.Errorf("config: invalid connect_allowlist entry %q (want host:port)", destination)
+		}
+		cfg.ConnectAllowlist = append(cfg.ConnectAllowlist, destination)
+	}
+	if yamlRootCfg.Proxy.ForwardedHeaderMode != nil && strings.TrimSpace(*yamlRootCfg.Proxy.ForwardedHeaderMode) != "" {
+		mode := strings.ToLower(strings.TrimSpace(*yamlRootCfg.Proxy.ForwardedHeaderMode))
+		switch mode {
+		case proxy.ForwardedModeLegacy, proxy.ForwardedModeRFC7239, proxy.ForwardedModeBoth:
+			cfg.ForwardedHeaderMode = mode
+		default:
+			return nil, fmt.Errorf("config: invalid forwarded_header_mode %q (want legacy, rfc7239 or both)", mode)
+		}
+	}
+
+	// Admin section (optional).
+	if yamlRootCfg.Proxy.Admin != nil && yamlRootCfg.Proxy.Admin.Token != nil {
+		cfg.Admin.Token = strings.TrimSpace(*yamlRootCfg.Proxy.Admin.Token)
+	}
+
+	// Maintenance section (optional).
+	if yamlRootCfg.Proxy.Maintenance != nil {
+		if yamlRootCfg.Proxy.Maintenance.Enabled != nil {
+			cfg.Maintenance.Enabled = *yamlRootCfg.Proxy.Maintenance.Enabled
+		}
+		if yamlRootCfg.Proxy.Maintenance.RetryAfter != nil && strings.TrimSpace(*yamlRootCfg.Proxy.Maintenance.RetryAfter) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.Maintenance.RetryAfter))
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("config: invalid maintenance.retry_after %q", *yamlRootCfg.Proxy.Maintenance.RetryAfter)
+			}
+			cfg.Maintenance.RetryAfter = parsed
+		}
+		if yamlRootCfg.Proxy.Maintenance.Message != nil {
+			cfg.Maintenance.Message = strings.TrimSpace(*yamlRootCfg.Proxy.Maintenance.Message)
+		}
+	}
+
+	// Idempotency section (optional).
+	if yamlRootCfg.Proxy.Idempotency != nil {
+		if yamlRootCfg.Proxy.Idempotency.Enabled != nil {
+			cfg.Idempotency.Enabled = *yamlRootCfg.Proxy.Idempotency.Enabled
+		}
+		if yamlRootCfg.Proxy.Idempotency.Window != nil && strings.TrimSpace(*yamlRootCfg.Proxy.Idempotency.Window) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.Idempotency.Window))
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("config: invalid idempotency.window %q", *yamlRootCfg.Proxy.Idempotency.Window)
+			}
+			cfg.Idempotency.Window = parsed
+		}
+	}
+
+	// Static (fixed-response) routes (optional).
+	for _, staticRoute := range yamlRootCfg.Proxy.StaticRoutes {
+		routePath := strings.TrimSpace(staticRoute.Path)
+		if !strings.HasPrefix(routePath, "/") {
+			return nil, fmt.Errorf("config: invalid static_routes path %q", staticRoute.Path)
+		}
+		if staticRoute.Body != "" && staticRoute.File != "" {
+			return nil, fmt.Errorf("config: static_routes %s sets both body and file", routePath)
+		}
+		cfg.StaticRoutes = append(cfg.StaticRoutes, proxy.StaticRoute{
+			Path:        routePath,
+			Status:      staticRoute.Status,
+			ContentType: strings.TrimSpace(staticRoute.ContentType),
+			Body:        staticRoute.Body,
+			File:        strings.TrimSpace(staticRoute.File),
+		})
+	}
+
+	// Default root response section (optional).
+	if rootResponse := yamlRootCfg.Proxy.DefaultRootResponse; rootResponse != nil {
+		if rootResponse.Enabled != nil {
+			cfg.DefaultRootResponse.Enabled = *rootResponse.Enabled
+		}
+		if rootResponse.Status != nil {
+			if *rootResponse.Status < 100 || *rootResponse.Status > 599 {
+				return nil, fmt.Errorf("config: invalid default_root_response.status %d", *rootResponse.Status)
+			}
+			cfg.DefaultRootResponse.Status = *rootResponse.Status
+		}
+		if rootResponse.ContentType != nil {
+			cfg.DefaultRootResponse.ContentType = strings.TrimSpace(*rootResponse.ContentType)
+		}
+		if rootResponse.Body != nil {
+			cfg.DefaultRootResponse.Body = *rootResponse.Body
+		}
+	}
+
+	// Startup probe section (optional).
+	if yamlRootCfg.Proxy.StartupProbe != nil {
+		if yamlRootCfg.Proxy.StartupProbe.Enabled != nil {
+			cfg.StartupProbe.Enabled = *yamlRootCfg.Proxy.StartupProbe.Enabled
+		}
+		if yamlRootCfg.Proxy.StartupProbe.RequireOneHealthy != nil {
+			cfg.StartupProbe.RequireOneHealthy = *yamlRootCfg.Proxy.StartupProbe.RequireOneHealthy
+		}
+		if yamlRootCfg.Proxy.StartupProbe.Timeout != nil && strings.TrimSpace(*yamlRootCfg.Proxy.StartupProbe.Timeout) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.StartupProbe.Timeout))
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("config: invalid startup_probe.timeout %q", *yamlRootCfg.Proxy.StartupProbe.Timeout)
+			}
+			cfg.StartupProbe.Timeout = parsed
+		}
+		if yamlRootCfg.Proxy.StartupProbe.Deadline != nil && strings.TrimSpace(*yamlRootCfg.Proxy.StartupProbe.Deadline) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.StartupProbe.Deadline))
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("config: invalid startup_probe.deadline %q", *yamlRootCfg.Proxy.StartupProbe.Deadline)
+			}
+			cfg.StartupProbe.Deadline = parsed
+		}
+	}
+
+	if yamlRootCfg.Proxy.CapabilityProbe != nil {
+		if yamlRootCfg.Proxy.CapabilityProbe.Enabled != nil {
+			cfg.CapabilityProbe.Enabled = *yamlRootCfg.Proxy.CapabilityProbe.Enabled
+		}
+		if yamlRootCfg.Proxy.CapabilityProbe.ConfigureTransport != nil {
+			cfg.CapabilityProbe.ConfigureTransport = *yamlRootCfg.Proxy.CapabilityProbe.ConfigureTransport
+		}
+		if yamlRootCfg.Proxy.CapabilityProbe.Timeout != nil && strings.TrimSpace(*yamlRootCfg.Proxy.CapabilityProbe.Timeout) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.CapabilityProbe.Timeout))
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("config: invalid capability_probe.timeout %q", *yamlRootCfg.Proxy.CapabilityProbe.Timeout)
+			}
+			cfg.CapabilityProbe.Timeout = parsed
+		}
+	}
+
+	// Mirror section (optional).
+	if yamlRootCfg.Proxy.Mirror != nil {
+		if yamlRootCfg.Proxy.Mirror.Target != nil && strings.TrimSpace(*yamlRootCfg.Proxy.Mirror.Target) != "" {
+			parsedURL, err := url.Parse(strings.TrimSpace(*yamlRootCfg.Proxy.Mirror.Target))
+			if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
+				return nil, fmt.Errorf("config: invalid mirror.target %q", *yamlRootCfg.Proxy.Mirror.Target)
+			}
+			cfg.Mirror.Target = parsedURL
+		}
+		if yamlRootCfg.Proxy.Mirror.Workers != nil && *yamlRootCfg.Proxy.Mirror.Workers > 0 {
+			cfg.Mirror.Workers = *yamlRootCfg.Proxy.Mirror.Workers
+		}
+		if yamlRootCfg.Proxy.Mirror.QueueSize != nil && *yamlRootCfg.Proxy.Mirror.QueueSize > 0 {
+			cfg.Mirror.QueueSize = *yamlRootCfg.Proxy.Mirror.QueueSize
+		}
+		if yamlRootCfg.Proxy.Mirror.MaxBodyBytes != nil && *yamlRootCfg.Proxy.Mirror.MaxBodyBytes > 0 {
+			cfg.Mirror.MaxBodyBytes = *yamlRootCfg.Proxy.Mirror.MaxBodyBytes
+		}
+	}
+
+	// Compression section (optional).
+	if yamlRootCfg.Proxy.Compression != nil {
+		if yamlRootCfg.Proxy.Compression.Enabled != nil {
+			cfg.Compression.Enabled = *yamlRootCfg.Proxy.Compression.Enabled
+		}
+		if yamlRootCfg.Proxy.Compression.MinSize != nil && *yamlRootCfg.Proxy.Compression.MinSize > 0 {
+			cfg.Compression.MinSize = *yamlRootCfg.Proxy.Compression.MinSize
+		}
+		if yamlRootCfg.Proxy.Compression.Brotli != nil {
+			cfg.Compression.Brotli = *yamlRootCfg.Proxy.Compression.Brotli
+		}
+	}
+
+	// Debug section (optional).
+	if yamlRootCfg.Proxy.Debug != nil {
+		if yamlRootCfg.Proxy.Debug.ExposeCacheKey != nil {
+			cfg.Debug.ExposeCacheKey = *yamlRootCfg.Proxy.Debug.ExposeCacheKey
+		}
+		if yamlRootCfg.Proxy.Debug.ExposeUpstreamTime != nil {
+			cfg.Debug.ExposeUpstreamTime = *yamlRootCfg.Proxy.Debug.ExposeUpstreamTime
+		}
+	}
+
+	// Collapse forwarding section (optional).
+	if yamlRootCfg.Proxy.CollapseForwarding != nil {
+		if yamlRootCfg.Proxy.CollapseForwarding.Enabled != nil {
+			cfg.CollapseForwarding.Enabled = *yamlRootCfg.Proxy.CollapseForwarding.Enabled
+		}
+		for _, pathPrefix := range yamlRootCfg.Proxy.CollapseForwarding.Paths {
+			if pathPrefix = strings.TrimSpace(pathPrefix); pathPrefix != "" {
+				if !strings.HasPrefix(pathPrefix, "/") {
+					return nil, fmt.Errorf("config: invalid collapse_forwarding path %q", pathPrefix)
+				}
+				cfg.CollapseForwarding.Paths = append(cfg.CollapseForwarding.Paths, pathPrefix)
+			}
+		}
+	}
+
+	// Streaming section (optional).
+	if yamlRootCfg.Proxy.Stream != nil {
+		if yamlRootCfg.Proxy.Stream.BufferBytes != nil {
+			if *yamlRootCfg.Proxy.Stream.BufferBytes <= 0 {
+				return nil, fmt.Errorf("config: invalid stream.buffer_bytes %d", *yamlRootCfg.Proxy.Stream.BufferBytes)
+			}
+			cfg.Stream.BufferBytes = *yamlRootCfg.Proxy.Stream.BufferBytes
+		}
+		if yamlRootCfg.Proxy.Stream.FlushInterval != nil && strings.TrimSpace(*yamlRootCfg.Proxy.Stream.FlushInterval) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*yamlRootCfg.Proxy.Stream.FlushInterval))
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("config: invalid stream.flush_interval %q", *yamlRootCfg.Proxy.Stream.FlushInterval)
+			}
+			cfg.Stream.FlushInterval = parsed
+		}
+		if yamlRootCfg.Proxy.Stream.Chunked != nil {
+			cfg.Stream.Chunked = *yamlRootCfg.Proxy.Stream.Chunked
+		}
+	}
+
+	// Client request body decompression (optional).
+	if yamlRootCfg.Proxy.RequestDecompress != nil {
+		cfg.RequestDecompress = *yamlRootCfg.Proxy.RequestDecompress
+	}
+	if yamlRootCfg.Proxy.RequestDecompressMax != nil {
+		if *yamlRootCfg.Proxy.RequestDecompressMax <= 0 {
+			return nil, fmt.Errorf("config: invalid request_decompress_max_bytes %d", *yamlRootCfg.Proxy.RequestDecompressMax)
+		}
+		cfg.RequestDecompressMax = *yamlRootCfg.Proxy.RequestDecompressMax
+	}
+	if yamlRootCfg.Proxy.ValidateContentDigest != nil {
+		cfg.ValidateContentDigest = *yamlRootCfg.Proxy.ValidateContentDigest
+	}
+	if yamlRootCfg.Proxy.ValidateContentDigestMax != nil {
+		if *yamlRootCfg.Proxy.ValidateContentDigestMax <= 0 {
+			return nil, fmt.Errorf("config: invalid validate_content_digest_max_bytes %d", *yamlRootCfg.Proxy.ValidateContentDigestMax)
+		}
+		cfg.ValidateContentDigestMax = *yamlRootCfg.Proxy.ValidateContentDigestMax
+	}
+	if yamlRootCfg.Proxy.JSONErrors != nil {
+		cfg.JSONErrors = *yamlRootCfg.Proxy.JSONErrors
+	}
+	if yamlRootCfg.Proxy.ExposeServedBy != nil {
+		cfg.ExposeServedBy = *yamlRootCfg.Proxy.ExposeServedBy
+	}
+	if yamlRootCfg.Proxy.InstanceID != nil {
+		cfg.InstanceID = strings.TrimSpace(*yamlRootCfg.Proxy.InstanceID)
+	}
+
+	// Metrics section (optional): per-upstream label header and value allowlist, error ratio window.
+	if yamlRootCfg.Metrics != nil {
+		if yamlRootCfg.Metrics.UpstreamLabelHeader != nil && strings.TrimSpace(*yamlRootCfg.Metrics.UpstreamLabelHeader) != "" {
+			cfg.Metrics.UpstreamLabelHeader = strings.TrimSpace(*yamlRootCfg.Metrics.UpstreamLabelHeader)
+		}
+		for _, value := range yamlRootCfg.Metrics.UpstreamLabelValues {
+			if value = strings.TrimSpace(value); value != "" {
+				cfg.Metrics.UpstreamLabelValues = append(cfg.Metrics.UpstreamLabelValues, value)
+			}
+		}
+		if window := yamlRootCfg.Metrics.ErrorRatioWindow; window != nil && strings.TrimSpace(*window) != "" {
+			parsed, err := time.ParseDuration(strings.TrimSpace(*window))
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("config: invalid metrics.error_ratio_window %q", *window)
+			}
+			cfg.Metrics.ErrorRatioWindow = parsed
+		}
+	}
+
+	// Apply default cache TTL, TTL bounds and jitter, never-cache statuses and heuristic freshness to proxy package.
 	proxy.SetDefaultCacheTTL(cfg.Cache.TTL)
+	proxy.SetCacheTTLBounds(cfg.Cache.MinTTL, cfg.Cache.MaxTTL)
+	proxy.SetNeverCacheStatuses(cfg.Cache.NeverCacheStatuses)
+	proxy.SetHeuristicFreshness(cfg.Cache.HeuristicFreshness)
+	proxy.SetStatusTTLs(cfg.Cache.StatusTTLs)
+	proxy.SetCacheTTLJitter(cfg.Cache.TTLJitter)
 
 	return cfg, nil
 }
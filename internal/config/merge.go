@@ -0,0 +1,148 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFilesEnv lists config files merged in order (later files override earlier keys);
+// it replaces the default configs/config.yaml lookup when set.
+const configFilesEnv = "CONFIG_FILES"
+
+// configFilePaths returns the files to merge: CONFIG_FILES (comma-separated) when set,
+// otherwise the default config file.
+func configFilePaths() ([]string, error) {
+	if listed := strings.TrimSpace(os.Getenv(configFilesEnv)); listed != "" {
+		var paths []string
+		for _, path := range strings.Split(listed, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				paths = append(paths, path)
+			}
+		}
+		if len(paths) > 0 {
+			return paths, nil
+		}
+	}
+	configFilePath, err := findConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	return []string{configFilePath}, nil
+}
+
+// loadMergedYAML reads every file, then the proxy.includes of each one (paths relative to
+// the including file, merged right after it), and deep-merges them in that order into one
+// document. Mappings merge key by key; scalars and lists from later files replace earlier
+// values, and an explicit null restores the default. Included files may not include others.
+func loadMergedYAML(paths []string) (*yaml.Node, error) {
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, path := range paths {
+		document, err := readYAMLMapping(path)
+		if err != nil {
+			return nil, err
+		}
+		includes, err := includedFiles(document, path)
+		if err != nil {
+			return nil, err
+		}
+		mergeYAMLMappings(merged, document)
+		for _, includePath := range includes {
+			included, err := readYAMLMapping(includePath)
+			if err != nil {
+				return nil, err
+			}
+			if nested, err := includedFiles(included, includePath); err != nil {
+				return nil, err
+			} else if len(nested) > 0 {
+				return nil, fmt.Errorf("config: %s: proxy.includes is not allowed in an included file", includePath)
+			}
+			mergeYAMLMappings(merged, included)
+		}
+	}
+	return merged, nil
+}
+
+// readYAMLMapping parses path and returns its top-level mapping (empty for an empty file).
+func readYAMLMapping(path string) (*yaml.Node, error) {
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file %s: %w", path, err)
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(fileBytes, &document); err != nil {
+		return nil, fmt.Errorf("parse yaml %s: %w", path, err)
+	}
+	if len(document.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("parse yaml %s: top level must be a mapping", path)
+	}
+	return root, nil
+}
+
+// includedFiles returns the proxy.includes entries of document, resolved against the
+// directory of the file that lists them.
+func includedFiles(document *yaml.Node, path string) ([]string, error) {
+	proxySection := mappingValue(document, "proxy")
+	if proxySection == nil || proxySection.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	includesNode := mappingValue(proxySection, "includes")
+	if includesNode == nil {
+		return nil, nil
+	}
+	var includes []string
+	if err := includesNode.Decode(&includes); err != nil {
+		return nil, fmt.Errorf("config: invalid proxy.includes in %s: %w", path, err)
+	}
+	var resolved []string
+	for _, include := range includes {
+		if include = strings.TrimSpace(include); include == "" {
+			continue
+		}
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		resolved = append(resolved, include)
+	}
+	return resolved, nil
+}
+
+// mappingValue returns the value node stored under key in mapping, or nil.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mergeYAMLMappings merges src into dst: nested mappings are merged recursively and any
+// other value in src replaces the one in dst.
+func mergeYAMLMappings(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		existing := -1
+		for j := 0; j+1 < len(dst.Content); j += 2 {
+			if dst.Content[j].Value == key.Value {
+				existing = j + 1
+				break
+			}
+		}
+		switch {
+		case existing < 0:
+			dst.Content = append(dst.Content, key, value)
+		case dst.Content[existing].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeYAMLMappings(dst.Content[existing], value)
+		default:
+			dst.Content[existing] = value
+		}
+	}
+}
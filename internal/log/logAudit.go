@@ -0,0 +1,87 @@
+package applog
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// auditApp is the Loki "app" label of audit events, kept apart from the access log.
+const auditApp = "proxy-audit"
+
+// Audit categories of security-relevant decisions.
+const (
+	AuditAuth      = "auth"       // admin token checks
+	AuditMethod    = "method"     // method allowlist, blocked TRACE/CONNECT
+	AuditRateLimit = "rate_limit" // admission rejected under load
+)
+
+// AuditEvent is one security-relevant decision about a request.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Category  string    `json:"category"`
+	Decision  string    `json:"decision"` // "deny"
+	Reason    string    `json:"reason"`
+	ClientIP  string    `json:"client_ip"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+var (
+	// auditEnabled toggles audit events independently of the access log levels
+	// (logging.audit_enabled).
+	auditEnabled atomic.Bool
+
+	auditHookMu sync.RWMutex
+	auditHook   func(AuditEvent)
+)
+
+// SetAuditEnabled turns audit events on or off.
+func SetAuditEnabled(enabled bool) {
+	lokiOnce.Do(initLoki)
+	auditEnabled.Store(enabled)
+}
+
+// SetAuditHook registers fn to receive every emitted audit event (nil removes it), e.g. to
+// forward events to a SIEM.
+func SetAuditHook(fn func(AuditEvent)) {
+	auditHookMu.Lock()
+	defer auditHookMu.Unlock()
+	auditHook = fn
+}
+
+// Audit records a security-relevant decision when audit events are enabled: one JSON line
+// printed locally and pushed to Loki under app=proxy-audit, then passed to the hook.
+func Audit(event AuditEvent) {
+	lokiOnce.Do(initLoki)
+	if !auditEnabled.Load() {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Decision == "" {
+		event.Decision = "deny"
+	}
+
+	lineBytes, _ := json.Marshal(event)
+	line := "AUDIT " + string(lineBytes)
+	if logEnabled() {
+		log.Print(line)
+	}
+	pushLoki(auditApp, "info", map[string]string{
+		"category": event.Category,
+		"decision": event.Decision,
+		"host":     MustHostname(),
+	}, line)
+
+	auditHookMu.RLock()
+	hook := auditHook
+	auditHookMu.RUnlock()
+	if hook != nil {
+		hook(event)
+	}
+}
@@ -0,0 +1,104 @@
+package applog
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRecentErrors is how many error events the ring keeps (logging.recent_errors).
+const defaultRecentErrors = 100
+
+// ErrorEvent is one proxy error or 4xx/5xx response kept for GET /admin/errors.
+type ErrorEvent struct {
+	Time      time.Time `json:"time"`
+	Status    int       `json:"status"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	Upstream  string    `json:"upstream"`
+	Cache     string    `json:"cache,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// errorRing holds the most recent error events, overwriting the oldest once full.
+// It is filled regardless of the log level toggles so on-call can inspect errors without Loki.
+var errorRing = struct {
+	sync.Mutex
+	events []ErrorEvent
+	next   int // slot the next event is written to
+	full   bool
+}{events: make([]ErrorEvent, defaultRecentErrors)}
+
+// SetRecentErrorsCapacity resizes the ring to keep the last n error events (<= 0 disables it).
+// Events already recorded are dropped.
+func SetRecentErrorsCapacity(n int) {
+	if n < 0 {
+		n = 0
+	}
+	errorRing.Lock()
+	defer errorRing.Unlock()
+	errorRing.events = make([]ErrorEvent, n)
+	errorRing.next = 0
+	errorRing.full = false
+}
+
+// recordError appends event to the ring.
+func recordError(event ErrorEvent) {
+	errorRing.Lock()
+	defer errorRing.Unlock()
+	if len(errorRing.events) == 0 {
+		return
+	}
+	errorRing.events[errorRing.next] = event
+	errorRing.next = (errorRing.next + 1) % len(errorRing.events)
+	if errorRing.next == 0 {
+		errorRing.full = true
+	}
+}
+
+// RecentErrors returns the recorded error events, newest first.
+func RecentErrors() []ErrorEvent {
+	errorRing.Lock()
+	defer errorRing.Unlock()
+	count := errorRing.next
+	if errorRing.full {
+		count = len(errorRing.events)
+	}
+	events := make([]ErrorEvent, 0, count)
+	for i := 1; i <= count; i++ {
+		index := (errorRing.next - i + len(errorRing.events)) % len(errorRing.events)
+		events = append(events, errorRing.events[index])
+	}
+	return events
+}
+
+// RecentErrorsHandler serves the error ring as JSON, newest first; ?limit=N returns at most N events.
+func RecentErrorsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		events := RecentErrors()
+		if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+			limit, err := strconv.Atoi(limitParam)
+			if err != nil || limit < 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			if limit < len(events) {
+				events = events[:limit]
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(struct {
+			Count  int          `json:"count"`
+			Errors []ErrorEvent `json:"errors"`
+		}{Count: len(events), Errors: events})
+	})
+}
@@ -1,7 +1,6 @@
 package applog
 
 import (
-	"bytes"
 	"encoding/json"
 	"flag"
 	"log"
@@ -66,7 +65,8 @@ func MustHostname() string {
 	return hostname
 }
 
-// Emit prints locally (if enabled and level allowed) and pushes the same line to Loki.
+// Emit prints locally (if enabled and level allowed) and pushes the same line to Loki and,
+// for non-debug lines, to syslog when configured.
 // The "level" is normalized (lowercased) and also used to filter based on config.
 func Emit(level, app string, labels map[string]string, line string) {
 	normalizedLevel := strings.ToLower(level)
@@ -78,6 +78,11 @@ func Emit(level, app string, labels map[string]string, line string) {
 
 	// Forward to Loki with the "level" label applied
 	PushLokiWithLevel(normalizedLevel, app, labels, line)
+
+	// Concise lines also go to syslog (if configured and level allowed)
+	if levelEnabled(normalizedLevel) {
+		emitSyslog(normalizedLevel, line)
+	}
 }
 
 // levelEnabled reports if a given log level is enabled according to config.
@@ -100,14 +105,24 @@ func levelEnabled(level string) bool {
 // It is a no-op if Loki is not configured or if the provided level is disabled.
 func PushLokiWithLevel(level, app string, labels map[string]string, line string) {
 	lokiOnce.Do(initLoki)
-	if lokiURL == "" || !levelEnabled(level) {
+	if currentLokiURL() == "" || !levelEnabled(level) {
+		return
+	}
+	pushLoki(app, strings.ToLower(strings.TrimSpace(level)), labels, line)
+}
+
+// pushLoki sends line to Loki under the app and level labels plus labels, regardless of
+// level toggles. Callers must have run initLoki.
+func pushLoki(app, level string, labels map[string]string, line string) {
+	pushURL := currentLokiURL()
+	if pushURL == "" {
 		return
 	}
 
 	// Prepare stream labels (always include "app" and "level")
 	streamLabels := map[string]string{
 		"app":   app,
-		"level": strings.ToLower(strings.TrimSpace(level)),
+		"level": level,
 	}
 	for k, v := range labels {
 		if strings.TrimSpace(k) == "" {
@@ -136,23 +151,20 @@ func PushLokiWithLevel(level, app string, labels map[string]string, line string)
 
 	payloadBytes, _ := json.Marshal(lokiPayload)
 
-	// Fire-and-forget HTTP request
-	request, err := http.NewRequest("POST", lokiURL, bytes.NewReader(payloadBytes))
-	if err != nil {
-		return
-	}
-	request.Header.Set("Content-Type", "application/json")
-	_, _ = lokiClient.Do(request)
+	// Fire-and-forget HTTP request; the outcome only feeds proxy_loki_up.
+	recordLokiResult(sendLoki(pushURL, payloadBytes))
 }
 
-// initLoki lazily reads configuration for Loki URL and logging level toggles.
+// initLoki lazily reads configuration for Loki URL, logging level toggles and the
+// optional syslog sink.
 // Precedence:
 //   1) If configs/config.yaml or configs/config.yml exists, read them.
-//   2) If loki_url is a base URL, normalize it to the push endpoint:
+//   2) If loki_url is a base URL, normalize it to the push endpoint (see setLokiURL):
 //      <base>/loki/api/v1/push
+//   3) If logging.syslog.enabled is set, connect the syslog sink (failures are logged).
 func initLoki() {
 	// Default: not configured
-	lokiURL = ""
+	configuredURL := ""
 
 	// Prefer configs/config.yaml|yml
 	configPath := ""
@@ -166,12 +178,22 @@ func initLoki() {
 	if configPath != "" {
 		var config struct {
 			Metrics *struct {
-				LokiURL string `yaml:"loki_url"`
+				LokiURL           string `yaml:"loki_url"`
+				LokiCheckInterval string `yaml:"loki_check_interval"`
 			} `yaml:"metrics"`
 			Logging *struct {
 				InfoEnabled  *bool `yaml:"info_enabled"`
 				DebugEnabled *bool `yaml:"debug_enabled"`
 				ErrorEnabled *bool `yaml:"error_enabled"`
+				AuditEnabled *bool `yaml:"audit_enabled"`
+				RecentErrors *int  `yaml:"recent_errors"`
+				Syslog       *struct {
+					Enabled  bool   `yaml:"enabled"`
+					Network  string `yaml:"network"`
+					Address  string `yaml:"address"`
+					Facility string `yaml:"facility"`
+					Tag      string `yaml:"tag"`
+				} `yaml:"syslog"`
 			} `yaml:"logging"`
 		}
 
@@ -179,7 +201,14 @@ func initLoki() {
 			if err := yaml.Unmarshal(cfgBytes, &config); err == nil {
 				// Loki URL (may be base or full push path)
 				if config.Metrics != nil && strings.TrimSpace(config.Metrics.LokiURL) != "" {
-					lokiURL = strings.TrimSpace(config.Metrics.LokiURL)
+					configuredURL = config.Metrics.LokiURL
+				}
+				if config.Metrics != nil && config.Metrics.LokiCheckInterval != "" {
+					if interval, err := time.ParseDuration(config.Metrics.LokiCheckInterval); err == nil && interval > 0 {
+						lokiCheckInterval = interval
+					} else {
+						log.Printf("metrics.loki_check_interval ignored: invalid duration %q", config.Metrics.LokiCheckInterval)
+					}
 				}
 				// Apply logging level toggles if present
 				if config.Logging != nil {
@@ -192,14 +221,22 @@ func initLoki() {
 					if config.Logging.ErrorEnabled != nil {
 						errorEnabled = *config.Logging.ErrorEnabled
 					}
+					if config.Logging.AuditEnabled != nil {
+						auditEnabled.Store(*config.Logging.AuditEnabled)
+					}
+					if config.Logging.RecentErrors != nil {
+						SetRecentErrorsCapacity(*config.Logging.RecentErrors)
+					}
+					if syslogCfg := config.Logging.Syslog; syslogCfg != nil && syslogCfg.Enabled {
+						if err := ConfigureSyslog(syslogCfg.Network, syslogCfg.Address, syslogCfg.Facility, syslogCfg.Tag); err != nil {
+							log.Printf("logging.syslog disabled: %v", err)
+						}
+					}
 				}
 			}
 		}
 	}
 
-	// Normalize to full push path if base URL provided
-	if lokiURL != "" && !strings.Contains(lokiURL, "/loki/api/v1/push") {
-		lokiURL = strings.TrimRight(lokiURL, "/") + "/loki/api/v1/push"
-	}
+	setLokiURL(configuredURL)
 }
 
@@ -0,0 +1,147 @@
+package applog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+// Loki reachability states, used to log only transitions.
+const (
+	lokiStateUnknown int32 = iota
+	lokiStateUp
+	lokiStateDown
+)
+
+var (
+	lokiMu sync.RWMutex
+
+	// lokiCheckInterval is how often StartLokiMonitor re-checks Loki (metrics.loki_check_interval).
+	lokiCheckInterval = 30 * time.Second
+
+	// lokiState is the outcome of the last push or check (lokiState* constants).
+	lokiState atomic.Int32
+)
+
+// ConfigureLoki replaces the push endpoint from configuration: a base URL gets
+// /loki/api/v1/push appended and an empty url disables shipping.
+func ConfigureLoki(url string) {
+	lokiOnce.Do(initLoki)
+	setLokiURL(url)
+}
+
+// setLokiURL stores url as the push endpoint, normalizing a base URL to the push path.
+func setLokiURL(url string) {
+	url = strings.TrimSpace(url)
+	if url != "" && !strings.Contains(url, "/loki/api/v1/push") {
+		url = strings.TrimRight(url, "/") + "/loki/api/v1/push"
+	}
+	lokiMu.Lock()
+	lokiURL = url
+	lokiMu.Unlock()
+	lokiState.Store(lokiStateUnknown)
+}
+
+// currentLokiURL returns the push endpoint ("" when Loki is not configured).
+func currentLokiURL() string {
+	lokiMu.RLock()
+	defer lokiMu.RUnlock()
+	return lokiURL
+}
+
+// sendLoki posts a push payload; any transport error or non-2xx status is an error.
+func sendLoki(pushURL string, payload []byte) error {
+	request, err := http.NewRequest(http.MethodPost, pushURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := lokiClient.Do(request)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 4<<10))
+	_ = response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// recordLokiResult updates proxy_loki_up and logs locally when Loki goes down or comes back.
+// Lines are printed directly: routing them through Emit would push to Loki again.
+func recordLokiResult(err error) {
+	imetrics.LokiUpSet(err == nil)
+	next := lokiStateUp
+	if err != nil {
+		next = lokiStateDown
+	}
+	previous := lokiState.Swap(next)
+	if previous == next || !logEnabled() {
+		return
+	}
+	switch {
+	case next == lokiStateDown:
+		log.Printf("loki unreachable at %s: %v (log lines are dropped until it recovers)", currentLokiURL(), err)
+	case previous == lokiStateDown:
+		log.Printf("loki reachable again at %s", currentLokiURL())
+	}
+}
+
+// CheckLoki sends an empty push to verify Loki accepts requests and records the result.
+// It returns nil when Loki is not configured.
+func CheckLoki() error {
+	lokiOnce.Do(initLoki)
+	pushURL := currentLokiURL()
+	if pushURL == "" {
+		return nil
+	}
+	err := sendLoki(pushURL, []byte(`{"streams":[]}`))
+	recordLokiResult(err)
+	return err
+}
+
+// StartLokiMonitor logs whether Loki shipping is enabled and reachable, then re-checks it
+// every interval (<= 0 uses metrics.loki_check_interval, default 30s) so proxy_loki_up
+// and the local log reflect an endpoint that is down at startup or recovers later.
+// The returned function stops the monitor.
+func StartLokiMonitor(interval time.Duration) (stop func()) {
+	lokiOnce.Do(initLoki)
+	pushURL := currentLokiURL()
+	if pushURL == "" {
+		log.Printf("loki logging disabled (metrics.loki_url not set)")
+		return func() {}
+	}
+	if interval <= 0 {
+		interval = lokiCheckInterval
+	}
+	if err := CheckLoki(); err != nil {
+		log.Printf("loki logging enabled: url=%s reachable=false (%v); re-checking every %s", pushURL, err, interval)
+	} else {
+		log.Printf("loki logging enabled: url=%s reachable=true", pushURL)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_ = CheckLoki()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -11,7 +11,7 @@ import (
 
 // Loki client configuration and logging-level toggles.
 //
-// lokiURL: endpoint where logs are pushed.
+// lokiURL: endpoint where logs are pushed (guarded by lokiMu; see logLoki.go).
 // lokiOnce: ensures one-time Loki client initialization.
 // lokiClient: short timeout HTTP client for fire-and-forget logging.
 // infoEnabled/debugEnabled/errorEnabled: feature toggles for log levels.
@@ -92,6 +92,21 @@ func LogProxyError(status int, cacheLabel string, upstreamName string, req *http
 		status, req.Method, requestURI, upstreamName, cacheLabel, err, req.Header.Get("X-Request-ID"),
 	)
 	Emit("error", "proxy", labels, errorLine)
+
+	errorMessage := ""
+	if err != nil {
+		errorMessage = err.Error()
+	}
+	recordError(ErrorEvent{
+		Time:      time.Now(),
+		Status:    status,
+		Method:    req.Method,
+		URL:       requestURI,
+		Upstream:  upstreamName,
+		Cache:     cacheLabel,
+		Error:     errorMessage,
+		RequestID: req.Header.Get("X-Request-ID"),
+	})
 }
 
 // LogProxyRequestCacheHit logs a request that is served from cache before responding.
@@ -204,6 +219,17 @@ func LogProxyResponseCacheHit(
 			errLine = errLine + " " + strings.TrimSpace(respBodyNote)
 		}
 		Emit("error", "proxy", labels, errLine)
+
+		recordError(ErrorEvent{
+			Time:      time.Now(),
+			Status:    status,
+			Method:    req.Method,
+			URL:       requestURI,
+			Upstream:  upstreamName,
+			Cache:     cacheLabel,
+			Error:     strings.TrimSpace(respBodyNote),
+			RequestID: req.Header.Get("X-Request-ID"),
+		})
 	}
 }
 
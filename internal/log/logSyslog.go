@@ -0,0 +1,86 @@
+//go:build !windows && !plan9
+
+package applog
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+	"sync"
+)
+
+// syslogWriter receives the concise (non-debug) log lines when syslog is configured.
+var (
+	syslogMu     sync.RWMutex
+	syslogWriter *syslog.Writer
+)
+
+// syslogFacilities maps logging.syslog.facility names to syslog priorities.
+var syslogFacilities = map[string]syslog.Priority{
+	"kern": syslog.LOG_KERN, "user": syslog.LOG_USER, "mail": syslog.LOG_MAIL,
+	"daemon": syslog.LOG_DAEMON, "auth": syslog.LOG_AUTH, "syslog": syslog.LOG_SYSLOG,
+	"lpr": syslog.LOG_LPR, "news": syslog.LOG_NEWS, "uucp": syslog.LOG_UUCP,
+	"cron": syslog.LOG_CRON, "authpriv": syslog.LOG_AUTHPRIV, "ftp": syslog.LOG_FTP,
+	"local0": syslog.LOG_LOCAL0, "local1": syslog.LOG_LOCAL1, "local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3, "local4": syslog.LOG_LOCAL4, "local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6, "local7": syslog.LOG_LOCAL7,
+}
+
+// ConfigureSyslog sends info and error lines (the concise access log, not debug output) to
+// a syslog server in addition to local output and Loki. network/address are passed to
+// log/syslog ("udp", "127.0.0.1:514"); both empty use the local syslog daemon. facility
+// defaults to "user" and tag to "proxy". A previous syslog connection is closed.
+func ConfigureSyslog(network, address, facility, tag string) error {
+	facility = strings.ToLower(strings.TrimSpace(facility))
+	if facility == "" {
+		facility = "user"
+	}
+	priority, ok := syslogFacilities[facility]
+	if !ok {
+		return fmt.Errorf("applog: unknown syslog facility %q", facility)
+	}
+	if strings.TrimSpace(tag) == "" {
+		tag = "proxy"
+	}
+	writer, err := syslog.Dial(strings.TrimSpace(network), strings.TrimSpace(address), priority|syslog.LOG_INFO, tag)
+	if err != nil {
+		return fmt.Errorf("applog: connect to syslog: %w", err)
+	}
+	syslogMu.Lock()
+	previous := syslogWriter
+	syslogWriter = writer
+	syslogMu.Unlock()
+	if previous != nil {
+		_ = previous.Close()
+	}
+	return nil
+}
+
+// DisableSyslog stops sending lines to syslog and closes the connection.
+func DisableSyslog() {
+	syslogMu.Lock()
+	previous := syslogWriter
+	syslogWriter = nil
+	syslogMu.Unlock()
+	if previous != nil {
+		_ = previous.Close()
+	}
+}
+
+// emitSyslog forwards a non-debug line to syslog with a matching severity.
+func emitSyslog(level, line string) {
+	syslogMu.RLock()
+	writer := syslogWriter
+	syslogMu.RUnlock()
+	if writer == nil {
+		return
+	}
+	switch level {
+	case "debug":
+		return
+	case "error":
+		_ = writer.Err(line)
+	default:
+		_ = writer.Info(line)
+	}
+}
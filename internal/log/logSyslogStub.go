@@ -0,0 +1,16 @@
+//go:build windows || plan9
+
+package applog
+
+import "errors"
+
+// ConfigureSyslog is unavailable where log/syslog is not supported.
+func ConfigureSyslog(network, address, facility, tag string) error {
+	return errors.New("applog: syslog is not supported on this platform")
+}
+
+// DisableSyslog is a no-op where log/syslog is not supported.
+func DisableSyslog() {}
+
+// emitSyslog is a no-op where log/syslog is not supported.
+func emitSyslog(level, line string) {}
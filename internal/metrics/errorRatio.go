@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultErrorRatioWindow is how far back proxy_error_ratio looks unless overridden.
+const defaultErrorRatioWindow = time.Minute
+
+// errorRatioBuckets is the number of slots the window is split into; older slots are
+// dropped whole, so the window slides in steps of window/errorRatioBuckets.
+const errorRatioBuckets = 60
+
+// errorRatio is a sliding-window counter of client-facing responses and the 5xx among them.
+type errorRatio struct {
+	mu    sync.Mutex
+	step  time.Duration
+	slots [errorRatioBuckets]errorRatioSlot
+}
+
+type errorRatioSlot struct {
+	tick   int64 // window step this slot currently counts (time / step)
+	total  uint64
+	errors uint64
+}
+
+func newErrorRatio(window time.Duration) *errorRatio {
+	ratio := &errorRatio{}
+	ratio.reset(window)
+	return ratio
+}
+
+// reset clears all counts and resizes the window.
+func (ratio *errorRatio) reset(window time.Duration) {
+	if window <= 0 {
+		window = defaultErrorRatioWindow
+	}
+	ratio.mu.Lock()
+	defer ratio.mu.Unlock()
+	ratio.step = max(window/errorRatioBuckets, time.Millisecond)
+	ratio.slots = [errorRatioBuckets]errorRatioSlot{}
+}
+
+// observe counts one response, as an error when status is 5xx.
+func (ratio *errorRatio) observe(status int) {
+	ratio.mu.Lock()
+	defer ratio.mu.Unlock()
+	tick := time.Now().UnixNano() / int64(ratio.step)
+	slot := &ratio.slots[tick%errorRatioBuckets]
+	if slot.tick != tick {
+		*slot = errorRatioSlot{tick: tick}
+	}
+	slot.total++
+	if status >= 500 {
+		slot.errors++
+	}
+}
+
+// value returns errors/total over the window, or 0 when nothing was observed.
+func (ratio *errorRatio) value() float64 {
+	ratio.mu.Lock()
+	defer ratio.mu.Unlock()
+	tick := time.Now().UnixNano() / int64(ratio.step)
+	var total, errors uint64
+	for _, slot := range ratio.slots {
+		if slot.tick > tick-errorRatioBuckets && slot.tick <= tick {
+			total += slot.total
+			errors += slot.errors
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(errors) / float64(total)
+}
+
+var (
+	proxyErrors = newErrorRatio(defaultErrorRatioWindow)
+
+	// proxyErrorRatio is the share of 5xx client-facing responses over the sliding window,
+	// computed at scrape time so it decays to 0 once errors stop.
+	proxyErrorRatio = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "proxy_error_ratio",
+			Help: "Share of proxy responses with a 5xx status over the recent sliding window (0-1)",
+		},
+		func() float64 { return proxyErrors.value() },
+	)
+)
+
+// SetErrorRatioWindow sets how far back proxy_error_ratio looks and clears its counts.
+// window <= 0 restores the default (1m).
+func SetErrorRatioWindow(window time.Duration) {
+	proxyErrors.reset(window)
+}
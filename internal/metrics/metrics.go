@@ -4,10 +4,12 @@
 package metrics
 
 import (
+	"errors"
 	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 // Proxy metrics (low-cardinality)
@@ -48,6 +50,22 @@ var (
 		},
 		[]string{"upstream"},
 	)
+	// proxyUpstreamActiveConnections mirrors the least-connections balancer's active request count per upstream.
+	proxyUpstreamActiveConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxy_upstream_active_connections",
+			Help: "Active upstream requests tracked by the least-connections balancer, by upstream host",
+		},
+		[]string{"upstream"},
+	)
+	// proxyUpstreamPendingSelections mirrors the balancer's picked-but-not-yet-acquired reservations per upstream.
+	proxyUpstreamPendingSelections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxy_upstream_pending_selections",
+			Help: "Pending least-connections selections (picked, not yet started), by upstream host",
+		},
+		[]string{"upstream"},
+	)
 	// queueDepth reports the number of requests currently waiting in the proxy queue (not executing).
 	queueDepth = prometheus.NewGauge(
 		prometheus.GaugeOpts{
@@ -69,6 +87,92 @@ var (
 			Help: "Total requests that timed out while waiting in queue",
 		},
 	)
+	// mirrorDropped counts shadow (mirrored) requests dropped because the mirror pool was saturated.
+	mirrorDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "proxy_mirror_dropped_total",
+			Help: "Total mirrored requests dropped because the mirror worker pool was saturated",
+		},
+	)
+	// upstreamErrors counts failed upstream round trips by upstream host and error class
+	// (canceled, timeout, refused, reset, dns, tls, protocol).
+	upstreamErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_upstream_errors_total",
+			Help: "Total failed upstream round trips by upstream and error class",
+		},
+		[]string{"upstream", "class"},
+	)
+	// upstreamEjections counts passive outlier ejections by upstream host.
+	upstreamEjections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_upstream_ejections_total",
+			Help: "Total times an upstream was ejected from load balancing after consecutive failures",
+		},
+		[]string{"upstream"},
+	)
+	// cacheEvictions counts entries evicted because the response cache was full.
+	cacheEvictions = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "proxy_cache_evictions_total",
+			Help: "Total LRU entries evicted from the response cache to make room",
+		},
+	)
+	// cacheHitsServed counts fresh cache HITs written to clients; HITs never enter the queue,
+	// so this keeps counting while the queue is saturated.
+	cacheHitsServed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "proxy_cache_hits_served_total",
+			Help: "Total fresh cache HITs served to clients (never queued)",
+		},
+	)
+	// staleServed counts expired cache entries served, by the directive that allowed it.
+	staleServed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_cache_stale_served_total",
+			Help: "Total expired cache entries served under stale-while-revalidate or stale-if-error",
+		},
+		[]string{"reason"},
+	)
+	// compressedResponses counts client responses compressed by the proxy, by encoding.
+	compressedResponses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_compressed_responses_total",
+			Help: "Total client responses compressed by the proxy, by content encoding",
+		},
+		[]string{"encoding"},
+	)
+	// tlsHandshakes counts client TLS handshakes by negotiated version, cipher and result.
+	tlsHandshakes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_tls_handshakes_total",
+			Help: "Total client TLS handshakes by negotiated version, cipher suite and result (success/failure)",
+		},
+		[]string{"version", "cipher", "result"},
+	)
+	// lokiUp reports whether the last Loki push or reachability check succeeded.
+	lokiUp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "proxy_loki_up",
+			Help: "1 if the last Loki push or reachability check succeeded, 0 otherwise",
+		},
+	)
+	// cacheKeyBuild measures request keying on the cache path: buffering and hashing the body,
+	// then building the key (includes waiting for a body-hash slot when they are capped).
+	cacheKeyBuild = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "proxy_cache_key_build_seconds",
+			Help:    "Time spent buffering/hashing request bodies and building cache keys",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10), // 10µs .. ~2.6s
+		},
+	)
+	// cacheBodyHashBytes counts request body bytes hashed into cache keys.
+	cacheBodyHashBytes = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "proxy_cache_body_hash_bytes_total",
+			Help: "Total request body bytes hashed (SHA-256) for cache keys",
+		},
+	)
 	// queueWait measures time spent waiting in the queue (excludes execution time).
 	queueWait = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
@@ -145,11 +249,25 @@ func init() {
 		// proxy
 		proxyRequestsTotal,
 		proxyReqDuration,
+		proxyErrorRatio,
 		proxyUpstreamInflight,
+		proxyUpstreamActiveConnections,
+		proxyUpstreamPendingSelections,
 		queueDepth,
 		queueRejected,
 		queueTimeouts,
 		queueWait,
+		mirrorDropped,
+		upstreamErrors,
+		upstreamEjections,
+		cacheEvictions,
+		cacheHitsServed,
+		staleServed,
+		cacheKeyBuild,
+		cacheBodyHashBytes,
+		compressedResponses,
+		tlsHandshakes,
+		lokiUp,
 		// upstream
 		upRequestsTotal,
 		upRequestDuration,
@@ -158,6 +276,25 @@ func init() {
 		proxyUpstreamRequestsTotal,
 		proxyUpstreamReqDuration,
 	)
+
+	// Go runtime (goroutines, GC, memory) and process (CPU, FDs) metrics.
+	registerRuntimeCollectors(prometheus.DefaultRegisterer)
+}
+
+// registerRuntimeCollectors registers the Go and process collectors on reg. The default
+// registry already ships them, so an AlreadyRegisteredError is expected and ignored.
+func registerRuntimeCollectors(reg prometheus.Registerer) {
+	for _, collector := range []prometheus.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	} {
+		if err := reg.Register(collector); err != nil {
+			var alreadyRegistered prometheus.AlreadyRegisteredError
+			if !errors.As(err, &alreadyRegistered) {
+				panic(err)
+			}
+		}
+	}
 }
 
 // normCacheLabel normalizes the cache label to a bounded set of values.
@@ -176,6 +313,7 @@ func normCacheLabel(v string) string {
 func ObserveProxyResponse(method string, status int, cache string, dur time.Duration) {
 	cache = normCacheLabel(cache)
 	proxyRequestsTotal.WithLabelValues(method, strconv.Itoa(status), cache).Inc()
+	proxyErrors.observe(status)
 	proxyReqDuration.WithLabelValues(method, cache).Observe(dur.Seconds())
 }
 
@@ -196,12 +334,59 @@ func IncProxyUpstreamInflight(host string) { proxyUpstreamInflight.WithLabelValu
 // DecProxyUpstreamInflight decrements the in-flight counter for a given upstream host.
 func DecProxyUpstreamInflight(host string) { proxyUpstreamInflight.WithLabelValues(host).Dec() }
 
+// SetUpstreamBalancerCounts publishes the least-connections balancer counters for an upstream host.
+func SetUpstreamBalancerCounts(host string, active, pending int64) {
+	proxyUpstreamActiveConnections.WithLabelValues(host).Set(float64(active))
+	proxyUpstreamPendingSelections.WithLabelValues(host).Set(float64(pending))
+}
+
 // QueueRejectedInc increments the count of requests rejected due to a full queue.
 func QueueRejectedInc() { queueRejected.Inc() }
 
 // QueueTimeoutsInc increments the count of requests that timed out while waiting in the queue.
 func QueueTimeoutsInc() { queueTimeouts.Inc() }
 
+// MirrorDroppedInc increments the count of mirrored requests dropped under saturation.
+func MirrorDroppedInc() { mirrorDropped.Inc() }
+
+// UpstreamErrorInc counts a failed upstream round trip for host with the given error class.
+func UpstreamErrorInc(upstream, class string) { upstreamErrors.WithLabelValues(upstream, class).Inc() }
+
+// UpstreamEjectionInc counts an outlier ejection of the given upstream host.
+func UpstreamEjectionInc(upstream string) { upstreamEjections.WithLabelValues(upstream).Inc() }
+
+// CacheEvictionInc increments the count of LRU capacity evictions from the response cache.
+func CacheEvictionInc() { cacheEvictions.Inc() }
+
+// CacheHitServedInc counts a fresh cache HIT written to a client.
+func CacheHitServedInc() { cacheHitsServed.Inc() }
+
+// StaleServedInc counts an expired entry served under the given stale-* directive.
+func StaleServedInc(reason string) { staleServed.WithLabelValues(reason).Inc() }
+
+// ObserveCacheKeyBuild records how long keying a request for the cache took.
+func ObserveCacheKeyBuild(d time.Duration) { cacheKeyBuild.Observe(d.Seconds()) }
+
+// CacheBodyHashBytesAdd counts n request body bytes hashed for a cache key.
+func CacheBodyHashBytesAdd(n int) { cacheBodyHashBytes.Add(float64(n)) }
+
+// CompressedResponseInc counts a client response compressed with the given encoding.
+func CompressedResponseInc(encoding string) { compressedResponses.WithLabelValues(encoding).Inc() }
+
+// TLSHandshakeInc counts a client TLS handshake with the given outcome.
+func TLSHandshakeInc(version, cipher, result string) {
+	tlsHandshakes.WithLabelValues(version, cipher, result).Inc()
+}
+
+// LokiUpSet records whether Loki accepted the last push or reachability check.
+func LokiUpSet(up bool) {
+	if up {
+		lokiUp.Set(1)
+		return
+	}
+	lokiUp.Set(0)
+}
+
 // QueueWaitObserve observes time spent waiting in the queue for a single request.
 func QueueWaitObserve(d time.Duration) { queueWait.Observe(d.Seconds()) }
 
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// jsonSample is one metric series in the JSON snapshot. Histograms and summaries are
+// reduced to their count and sum.
+type jsonSample struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  *float64          `json:"value,omitempty"`
+	Count  *uint64           `json:"count,omitempty"`
+	Sum    *float64          `json:"sum,omitempty"`
+}
+
+// JSONHandler serves a snapshot of every registered metric as JSON, for tooling that
+// cannot scrape the Prometheus text format.
+func JSONHandler() http.Handler {
+	return jsonHandler(prometheus.DefaultGatherer)
+}
+
+func jsonHandler(gatherer prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		families, err := gatherer.Gather()
+		if err != nil && len(families) == 0 {
+			http.Error(w, "gather metrics: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		samples := []jsonSample{}
+		for _, family := range families {
+			for _, metric := range family.GetMetric() {
+				samples = append(samples, toJSONSample(family, metric))
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(struct {
+			Metrics []jsonSample `json:"metrics"`
+		}{samples})
+	})
+}
+
+// toJSONSample flattens one series of family into its JSON form.
+func toJSONSample(family *dto.MetricFamily, metric *dto.Metric) jsonSample {
+	sample := jsonSample{Name: family.GetName(), Type: jsonMetricType(family.GetType())}
+	if pairs := metric.GetLabel(); len(pairs) > 0 {
+		sample.Labels = make(map[string]string, len(pairs))
+		for _, pair := range pairs {
+			sample.Labels[pair.GetName()] = pair.GetValue()
+		}
+	}
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		sample.Value = jsonFloat(metric.GetCounter().GetValue())
+	case dto.MetricType_GAUGE:
+		sample.Value = jsonFloat(metric.GetGauge().GetValue())
+	case dto.MetricType_UNTYPED:
+		sample.Value = jsonFloat(metric.GetUntyped().GetValue())
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		count := metric.GetHistogram().GetSampleCount()
+		sample.Count, sample.Sum = &count, jsonFloat(metric.GetHistogram().GetSampleSum())
+	case dto.MetricType_SUMMARY:
+		count := metric.GetSummary().GetSampleCount()
+		sample.Count, sample.Sum = &count, jsonFloat(metric.GetSummary().GetSampleSum())
+	}
+	return sample
+}
+
+// jsonFloat returns value as a pointer, or nil for NaN/Inf which JSON cannot encode.
+func jsonFloat(value float64) *float64 {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil
+	}
+	return &value
+}
+
+func jsonMetricType(metricType dto.MetricType) string {
+	switch metricType {
+	case dto.MetricType_COUNTER:
+		return "counter"
+	case dto.MetricType_GAUGE:
+		return "gauge"
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		return "histogram"
+	case dto.MetricType_SUMMARY:
+		return "summary"
+	default:
+		return "untyped"
+	}
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// InstrumentTLSHandshakes records every client TLS handshake on server in
+// proxy_tls_handshakes_total. It chains the server's ConnState hook: a connection counts as
+// a success when it first becomes active (or closes with a completed handshake) and as a
+// failure when it closes before the handshake completed. Plain TCP connections are ignored.
+func InstrumentTLSHandshakes(server *http.Server) {
+	var counted sync.Map // net.Conn -> struct{}, connections already reported
+	previous := server.ConnState
+	server.ConnState = func(conn net.Conn, state http.ConnState) {
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			switch state {
+			case http.StateActive:
+				if _, seen := counted.LoadOrStore(conn, struct{}{}); !seen {
+					observeTLSHandshake(tlsConn.ConnectionState())
+				}
+			case http.StateHijacked, http.StateClosed:
+				if _, seen := counted.LoadAndDelete(conn); !seen {
+					observeTLSHandshake(tlsConn.ConnectionState())
+				}
+			}
+		}
+		if previous != nil {
+			previous(conn, state)
+		}
+	}
+}
+
+// observeTLSHandshake labels a handshake by its negotiated parameters; failures that ended
+// before negotiation report "unknown" version/cipher.
+func observeTLSHandshake(state tls.ConnectionState) {
+	version, cipher := "unknown", "unknown"
+	if state.Version != 0 {
+		version = tls.VersionName(state.Version)
+	}
+	if state.CipherSuite != 0 {
+		cipher = tls.CipherSuiteName(state.CipherSuite)
+	}
+	result := "failure"
+	if state.HandshakeComplete {
+		result = "success"
+	}
+	TLSHandshakeInc(version, cipher, result)
+}
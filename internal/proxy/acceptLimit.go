@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// acceptRateListener delays Accept so new connections are taken at most rate per second
+// (with bursts up to burst). Pending connections wait in the kernel backlog, so a connect
+// flood cannot make the proxy spin up handlers faster than the configured rate.
+type acceptRateListener struct {
+	net.Listener
+
+	mu       sync.Mutex
+	rate     float64 // tokens added per second
+	burst    float64 // bucket capacity
+	tokens   float64
+	last     time.Time
+	closed   chan struct{}
+	closeErr error
+	once     sync.Once
+}
+
+// NewAcceptRateListener wraps inner so it accepts at most rate connections per second,
+// allowing bursts of up to burst (< 1 -> ceil(rate)). rate <= 0 returns inner unchanged.
+func NewAcceptRateListener(inner net.Listener, rate float64, burst int) net.Listener {
+	if rate <= 0 {
+		return inner
+	}
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+	return &acceptRateListener{
+		Listener: inner,
+		rate:     rate,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Accept waits for a token before accepting the next connection.
+func (l *acceptRateListener) Accept() (net.Conn, error) {
+	if wait := l.reserve(); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-l.closed:
+			timer.Stop()
+			return nil, net.ErrClosed
+		}
+	}
+	return l.Listener.Accept()
+}
+
+// Close stops pending waits and closes the underlying listener.
+func (l *acceptRateListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+		l.closeErr = l.Listener.Close()
+	})
+	return l.closeErr
+}
+
+// reserve takes one token and returns how long the caller must wait for it.
+// The bucket may go negative so concurrent Accept calls queue behind each other.
+func (l *acceptRateListener) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	applog "traefik-challenge-2/internal/log"
+)
+
+const (
+	// Default and maximum page sizes for admin listings (keeps responses bounded).
+	defaultAdminListLimit = 100
+	maxAdminListLimit     = 1000
+)
+
+// RequireAdminToken guards admin endpoints with a static token.
+// The token may be sent as "Authorization: Bearer <token>" or "X-Admin-Token: <token>".
+// When no token is configured the endpoint is disabled and always answers 403.
+func RequireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented := strings.TrimSpace(r.Header.Get("X-Admin-Token"))
+		if presented == "" {
+			if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+				presented = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+			}
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			switch {
+			case token == "":
+				auditDeny(r, applog.AuditAuth, "admin endpoints disabled (no token configured)")
+			case presented == "":
+				auditDeny(r, applog.AuditAuth, "missing admin token")
+			default:
+				auditDeny(r, applog.AuditAuth, "invalid admin token")
+			}
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cacheKeysResponse is the JSON body returned by CacheKeysHandler.
+type cacheKeysResponse struct {
+	Total  int              `json:"total"`
+	Offset int              `json:"offset"`
+	Limit  int              `json:"limit"`
+	Keys   []CacheEntryInfo `json:"keys"`
+}
+
+// CacheKeysHandler lists stored cache keys with pagination (?limit=&offset=).
+// Only metadata is returned; cached bodies are never exposed.
+func (proxy *ReverseProxy) CacheKeysHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit := defaultAdminListLimit
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(parsed, maxAdminListLimit)
+		}
+		offset := 0
+		if raw := r.URL.Query().Get("offset"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 0 {
+				http.Error(w, "invalid offset", http.StatusBadRequest)
+				return
+			}
+			offset = parsed
+		}
+
+		entries, total := proxy.cache.List(limit, offset)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(cacheKeysResponse{
+			Total:  total,
+			Offset: offset,
+			Limit:  limit,
+			Keys:   entries,
+		})
+	})
+}
+
+// upstreamsResponse is the JSON body returned by UpstreamsHandler.
+type upstreamsResponse struct {
+	Strategy  string         `json:"strategy"`
+	Upstreams []upstreamInfo `json:"upstreams"`
+}
+
+// upstreamInfo describes one configured target and its passive-ejection state.
+type upstreamInfo struct {
+	URL                 string     `json:"url"`
+	Pool                string     `json:"pool"` // primary, backup or a client network pool name
+	Ejected             bool       `json:"ejected"`
+	EjectedUntil        *time.Time `json:"ejected_until,omitempty"`
+	Ejections           int64      `json:"ejections"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+// UpstreamsHandler lists every configured target with its ejection count and current
+// ejection state, so operators can spot a flapping backend.
+func (proxy *ReverseProxy) UpstreamsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		response := upstreamsResponse{Strategy: proxy.balancer.Strategy(), Upstreams: []upstreamInfo{}}
+		describe := func(pool string, targets []*url.URL) {
+			for _, target := range targets {
+				info := upstreamInfo{URL: target.String(), Pool: pool}
+				if proxy.outliers != nil {
+					state := proxy.outliers.snapshot(target)
+					info.Ejections = state.ejections
+					info.ConsecutiveFailures = state.failures
+					if time.Now().Before(state.ejectedUntil) {
+						info.Ejected = true
+						info.EjectedUntil = &state.ejectedUntil
+					}
+				}
+				response.Upstreams = append(response.Upstreams, info)
+			}
+		}
+		describe("primary", proxy.targets)
+		describe("backup", proxy.backupTargets)
+		for _, pool := range proxy.networkPools {
+			describe(pool.name, pool.targets)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(response)
+	})
+}
+
+// ResetTransport closes every idle upstream connection (HTTP and gRPC transports), so the
+// next requests dial fresh connections instead of reusing keep-alives to instances that
+// were replaced by a deployment. In-flight requests are not affected.
+func (proxy *ReverseProxy) ResetTransport() {
+	proxy.transport.CloseIdleConnections()
+	if proxy.grpcTransport != nil {
+		proxy.grpcTransport.CloseIdleConnections()
+	}
+	applog.Emit("info", "proxy", map[string]string{"component": "transport"},
+		"upstream transport reset: idle connections closed")
+}
+
+// TransportResetHandler drops idle upstream connections on POST (see ResetTransport) and
+// answers 204.
+func (proxy *ReverseProxy) TransportResetHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		proxy.ResetTransport()
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
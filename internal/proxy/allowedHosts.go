@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+// SetAllowedHosts restricts the Host headers the proxy answers to hosts (names or IPs,
+// case-insensitive, ports ignored). Requests for any other host get 421 Misdirected
+// Request before cache keys are built, so forged Host headers can neither reach upstreams
+// nor poison cache entries. An empty list allows every host.
+func (proxy *ReverseProxy) SetAllowedHosts(hosts []string) {
+	allowed := make(map[string]struct{}, len(hosts))
+	for _, host := range hosts {
+		if host = canonicalHost(host); host != "" {
+			allowed[host] = struct{}{}
+		}
+	}
+	if len(allowed) == 0 {
+		allowed = nil
+	}
+	proxy.allowedHosts = allowed
+}
+
+// hostAllowed reports whether req.Host passes the allowlist (always true when none is set).
+func (proxy *ReverseProxy) hostAllowed(req *http.Request) bool {
+	if proxy.allowedHosts == nil {
+		return true
+	}
+	_, ok := proxy.allowedHosts[canonicalHost(req.Host)]
+	return ok
+}
+
+// rejectMisdirected answers a request whose Host is not in the allowlist with 421.
+func (proxy *ReverseProxy) rejectMisdirected(w http.ResponseWriter, req *http.Request, startTime time.Time) {
+	w.Header().Set("X-Request-ID", ensureRequestID(req))
+	imetrics.ObserveProxyResponse(req.Method, http.StatusMisdirectedRequest, "REJECTED", time.Since(startTime))
+	proxy.writeErrorBody(w, req, http.StatusMisdirectedRequest, "misdirected request")
+}
+
+// canonicalHost lowercases host and drops any port, IPv6 brackets and trailing dot.
+func canonicalHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return strings.TrimSuffix(host, ".")
+}
@@ -0,0 +1,20 @@
+package proxy
+
+import (
+	"net/http"
+
+	applog "traefik-challenge-2/internal/log"
+)
+
+// auditDeny records a denied request in the audit log (logging.audit_enabled).
+func auditDeny(req *http.Request, category, reason string) {
+	applog.Audit(applog.AuditEvent{
+		Category:  category,
+		Decision:  "deny",
+		Reason:    reason,
+		ClientIP:  clientIPFromRequest(req),
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		RequestID: req.Header.Get("X-Request-ID"),
+	})
+}
@@ -1,10 +1,14 @@
 package proxy
 
 import (
+	"fmt"
 	"math"
 	"net/url"
 	"strings"
 	"sync/atomic"
+	"time"
+
+	imetrics "traefik-challenge-2/internal/metrics"
 )
 
 type Balancer interface {
@@ -26,12 +30,13 @@ type roundRobinBalancer struct {
 	targets             []*url.URL // immutable list of upstream targets
 	nextIndex           uint64     // next index to use for round-robin (atomic)
 	healthChecksEnabled bool       // whether on-demand health probes are used
+	isHealthy           healthProbe
 }
 
 func NewRoundRobinBalancer(upstreamTargets []*url.URL, healthChecksEnabled bool) Balancer {
 	// Defensive copy to avoid accidental external mutations.
 	copiedTargets := append([]*url.URL{}, upstreamTargets...)
-	return &roundRobinBalancer{targets: copiedTargets, healthChecksEnabled: healthChecksEnabled}
+	return &roundRobinBalancer{targets: copiedTargets, healthChecksEnabled: healthChecksEnabled, isHealthy: isTargetHealthy}
 }
 
 func (b *roundRobinBalancer) Pick(previewOnly bool) *url.URL {
@@ -57,7 +62,7 @@ func (b *roundRobinBalancer) Pick(previewOnly bool) *url.URL {
 	// Health checks enabled: return the first healthy target in RR order.
 	for i := uint64(0); i < targetCount; i++ {
 		candidateTarget := b.targets[(startIndex+i)%targetCount]
-		if isTargetHealthy(candidateTarget) {
+		if b.isHealthy(candidateTarget) {
 			return candidateTarget
 		}
 	}
@@ -69,6 +74,8 @@ func (b *roundRobinBalancer) Acquire(_ *url.URL) func() { return func() {} }
 func (b *roundRobinBalancer) Targets() []*url.URL       { return b.targets }
 func (b *roundRobinBalancer) Strategy() string          { return "round_robin" }
 
+func (b *roundRobinBalancer) setHealthProbe(probe healthProbe) { b.isHealthy = probe }
+
 // ----- Least Connections -----
 
 type lcState struct {
@@ -80,6 +87,7 @@ type lcState struct {
 type leastConnectionsBalancer struct {
 	targetStates        []*lcState
 	healthChecksEnabled bool
+	isHealthy           healthProbe
 }
 
 func NewLeastConnectionsBalancer(upstreamTargets []*url.URL, healthChecksEnabled bool) Balancer {
@@ -88,7 +96,7 @@ func NewLeastConnectionsBalancer(upstreamTargets []*url.URL, healthChecksEnabled
 	for _, u := range upstreamTargets {
 		targetStates = append(targetStates, &lcState{upstreamURL: u})
 	}
-	return &leastConnectionsBalancer{targetStates: targetStates, healthChecksEnabled: healthChecksEnabled}
+	return &leastConnectionsBalancer{targetStates: targetStates, healthChecksEnabled: healthChecksEnabled, isHealthy: isTargetHealthy}
 }
 
 func (b *leastConnectionsBalancer) Pick(previewOnly bool) *url.URL {
@@ -102,7 +110,7 @@ func (b *leastConnectionsBalancer) Pick(previewOnly bool) *url.URL {
 		min := int64(math.MaxInt64)
 		cands := make([]*lcState, 0, len(b.targetStates))
 		for _, st := range b.targetStates {
-			if b.healthChecksEnabled && !isTargetHealthy(st.upstreamURL) {
+			if b.healthChecksEnabled && !b.isHealthy(st.upstreamURL) {
 				continue
 			}
 			load := atomic.LoadInt64(&st.activeConnections)
@@ -146,12 +154,15 @@ func (b *leastConnectionsBalancer) Pick(previewOnly bool) *url.URL {
 		// Try to reserve: CAS pendingSelections = p -> p+1
 		p := atomic.LoadInt64(&best.pendingSelections)
 		if atomic.CompareAndSwapInt64(&best.pendingSelections, p, p+1) {
+			best.publishCounts()
 			return best.upstreamURL
 		}
 		// Contention detected; retry selection with updated loads.
 	}
 }
 
+func (b *leastConnectionsBalancer) setHealthProbe(probe healthProbe) { b.isHealthy = probe }
+
 func (b *leastConnectionsBalancer) Acquire(targetURL *url.URL) func() {
 	var selectedState *lcState
 	for _, st := range b.targetStates {
@@ -166,11 +177,34 @@ func (b *leastConnectionsBalancer) Acquire(targetURL *url.URL) func() {
 	// Convert reservation into an active connection.
 	atomic.AddInt64(&selectedState.pendingSelections, -1)
 	atomic.AddInt64(&selectedState.activeConnections, 1)
+	selectedState.publishCounts()
 	return func() {
 		atomic.AddInt64(&selectedState.activeConnections, -1)
+		selectedState.publishCounts()
+	}
+}
+
+// releaseSelection drops a reservation made by Pick for a request that will never call
+// Acquire (it was answered without going upstream).
+func (b *leastConnectionsBalancer) releaseSelection(targetURL *url.URL) {
+	for _, st := range b.targetStates {
+		if sameUpstream(st.upstreamURL, targetURL) {
+			atomic.AddInt64(&st.pendingSelections, -1)
+			st.publishCounts()
+			return
+		}
 	}
 }
 
+// publishCounts exports the current active/pending counters as gauges.
+func (st *lcState) publishCounts() {
+	imetrics.SetUpstreamBalancerCounts(
+		st.upstreamURL.Host,
+		atomic.LoadInt64(&st.activeConnections),
+		atomic.LoadInt64(&st.pendingSelections),
+	)
+}
+
 func (b *leastConnectionsBalancer) Targets() []*url.URL {
 	out := make([]*url.URL, 0, len(b.targetStates))
 	for _, st := range b.targetStates {
@@ -180,6 +214,10 @@ func (b *leastConnectionsBalancer) Targets() []*url.URL {
 }
 func (b *leastConnectionsBalancer) Strategy() string { return "least_connections" }
 
+// SameUpstream reports whether a and b name the same upstream: scheme, host and port
+// compared case-insensitively, with default ports filled in.
+func SameUpstream(a, b *url.URL) bool { return sameUpstream(a, b) }
+
 // sameUpstream compares two URLs as upstream identities (scheme + host + normalized port).
 func sameUpstream(a, b *url.URL) bool {
 	if a == nil || b == nil {
@@ -215,22 +253,175 @@ func sameUpstream(a, b *url.URL) bool {
 
 // newBalancer creates a Balancer based on the specified strategy.
 func newBalancer(strategy string, upstreamTargets []*url.URL, healthChecksEnabled bool) Balancer {
-	switch strings.ToLower(strings.TrimSpace(strategy)) {
-	case "least_conn", "lc", "least-connections", "least_connections":
+	canonical, _ := CanonicalStrategy(strategy)
+	switch canonical {
+	case "least_connections":
 		return NewLeastConnectionsBalancer(upstreamTargets, healthChecksEnabled)
+	case "wrr_ewma":
+		return NewWeightedEWMABalancer(upstreamTargets, healthChecksEnabled)
 	default:
 		return NewRoundRobinBalancer(upstreamTargets, healthChecksEnabled)
 	}
 }
 
-// ConfigureBalancer switches balancing strategy at runtime.
-func (proxy *ReverseProxy) ConfigureBalancer(strategy string) {
+// strategyAliases maps every accepted load_balancer_strategy spelling (lowercase) to the
+// canonical strategy name reported by Balancer.Strategy.
+var strategyAliases = map[string]string{
+	"rr":                "round_robin",
+	"round_robin":       "round_robin",
+	"round-robin":       "round_robin",
+	"lc":                "least_connections",
+	"least_conn":        "least_connections",
+	"least_connections": "least_connections",
+	"least-connections": "least_connections",
+	"wrr-ewma":          "wrr_ewma",
+	"wrr_ewma":          "wrr_ewma",
+}
+
+// CanonicalStrategy resolves a strategy name or alias (case-insensitive; empty means rr)
+// to its canonical name, and fails for unknown names instead of silently using rr.
+func CanonicalStrategy(strategy string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(strategy))
+	if name == "" {
+		return "round_robin", nil
+	}
+	if canonical, ok := strategyAliases[name]; ok {
+		return canonical, nil
+	}
+	return "", fmt.Errorf("unknown load balancer strategy %q (want rr, lc or wrr_ewma)", strategy)
+}
+
+// ----- Failover (primary pool + backup pool) -----
+
+// failoverBalancer picks from the primary pool and only falls back to the backup
+// pool when the primary pool yields no target (all primaries unhealthy/ejected).
+type failoverBalancer struct {
+	primary Balancer
+	backup  Balancer
+}
+
+func NewFailoverBalancer(primary, backup Balancer) Balancer {
+	return &failoverBalancer{primary: primary, backup: backup}
+}
+
+func (b *failoverBalancer) Pick(previewOnly bool) *url.URL {
+	if target := b.primary.Pick(previewOnly); target != nil {
+		return target
+	}
+	return b.backup.Pick(previewOnly)
+}
+
+func (b *failoverBalancer) Acquire(targetURL *url.URL) func() {
+	// Route to the pool that owns the target so per-pool counters stay consistent.
+	for _, backupTarget := range b.backup.Targets() {
+		if sameUpstream(backupTarget, targetURL) {
+			return b.backup.Acquire(targetURL)
+		}
+	}
+	return b.primary.Acquire(targetURL)
+}
+
+func (b *failoverBalancer) Targets() []*url.URL {
+	return append(append([]*url.URL{}, b.primary.Targets()...), b.backup.Targets()...)
+}
+func (b *failoverBalancer) Strategy() string { return b.primary.Strategy() + "+failover" }
+
+func (b *failoverBalancer) setHealthProbe(probe healthProbe) {
+	setBalancerHealthProbe(b.primary, probe)
+	setBalancerHealthProbe(b.backup, probe)
+}
+
+func (b *failoverBalancer) setWeights(weightOf func(*url.URL) int) {
+	setBalancerWeights(b.primary, weightOf)
+	setBalancerWeights(b.backup, weightOf)
+}
+
+func (b *failoverBalancer) releaseSelection(targetURL *url.URL) {
+	for _, backupTarget := range b.backup.Targets() {
+		if sameUpstream(backupTarget, targetURL) {
+			releaseBalancerSelection(b.backup, targetURL)
+			return
+		}
+	}
+	releaseBalancerSelection(b.primary, targetURL)
+}
+
+func (b *failoverBalancer) observeLatency(targetURL *url.URL, latency time.Duration, failed bool) {
+	observeBalancerLatency(b.primary, targetURL, latency, failed)
+	observeBalancerLatency(b.backup, targetURL, latency, failed)
+}
+
+// healthProbe reports whether a target should receive traffic.
+type healthProbe func(targetURL *url.URL) bool
+
+// setBalancerHealthProbe replaces how a built-in balancer decides target health
+// (e.g. cached results from the background checker); other balancers are left alone.
+func setBalancerHealthProbe(balancer Balancer, probe healthProbe) {
+	if aware, ok := balancer.(interface{ setHealthProbe(healthProbe) }); ok {
+		aware.setHealthProbe(probe)
+	}
+}
+
+// releaseBalancerSelection returns a picked-but-unused target to balancers that reserve
+// slots on Pick (least connections); other balancers are left alone.
+func releaseBalancerSelection(balancer Balancer, targetURL *url.URL) {
+	if aware, ok := balancer.(interface{ releaseSelection(*url.URL) }); ok {
+		aware.releaseSelection(targetURL)
+	}
+}
+
+// rebuildBalancer recreates the balancer from the current strategy, targets,
+// backup targets, and health-check setting.
+func (proxy *ReverseProxy) rebuildBalancer() {
+	// Passive ejection filters targets even when active health checks are off.
+	filterTargets := proxy.healthChecksEnabled || proxy.outliers != nil
+	if proxy.outliers != nil {
+		proxy.outliers.setPoolSize(proxy.outlierPoolSize())
+	}
+	balancer := newBalancer(proxy.lbStrategy, proxy.targets, filterTargets)
+	if len(proxy.backupTargets) > 0 {
+		balancer = NewFailoverBalancer(balancer, newBalancer(proxy.lbStrategy, proxy.backupTargets, filterTargets))
+	}
+	// Client network pools get their own balancer with the same strategy and health checks.
+	for _, pool := range proxy.networkPools {
+		pool.balancer = newBalancer(proxy.lbStrategy, pool.targets, filterTargets)
+	}
+	// Weighted strategies start from the configured static weights.
+	setBalancerWeights(balancer, proxy.weightFor)
+	for _, pool := range proxy.networkPools {
+		setBalancerWeights(pool.balancer, proxy.weightFor)
+	}
+	// With a background checker, balancers read its cached results instead of probing per pick.
+	proxy.restartHealthMonitor()
+	proxy.restartKeepalive()
+	if probe := proxy.targetProbe(); probe != nil {
+		setBalancerHealthProbe(balancer, probe)
+		for _, pool := range proxy.networkPools {
+			setBalancerHealthProbe(pool.balancer, probe)
+		}
+	}
+	proxy.balancer = balancer
+}
+
+// ConfigureBalancer switches balancing strategy at runtime. Unknown strategy names are
+// rejected and the current strategy is kept.
+func (proxy *ReverseProxy) ConfigureBalancer(strategy string) error {
+	if _, err := CanonicalStrategy(strategy); err != nil {
+		return err
+	}
 	proxy.lbStrategy = strategy
-	proxy.balancer = newBalancer(proxy.lbStrategy, proxy.targets, proxy.healthChecksEnabled)
+	proxy.rebuildBalancer()
+	return nil
 }
 
 // Toggle active health checks in the load balancer at runtime.
 func (proxy *ReverseProxy) SetHealthCheckEnabled(enabled bool) {
 	proxy.healthChecksEnabled = enabled
-	proxy.balancer = newBalancer(proxy.lbStrategy, proxy.targets, proxy.healthChecksEnabled)
+	proxy.rebuildBalancer()
+}
+
+// SetBackupTargets configures a failover pool used only when no primary target is available.
+func (proxy *ReverseProxy) SetBackupTargets(backupTargets []*url.URL) {
+	proxy.backupTargets = append([]*url.URL{}, backupTargets...)
+	proxy.rebuildBalancer()
 }
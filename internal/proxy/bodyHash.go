@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+var (
+	// errBodyTooLargeToHash marks bodies above max_body_hash_bytes; they are streamed unhashed
+	// and the request skips the cache.
+	errBodyTooLargeToHash = errors.New("request body too large to hash for cache key")
+	// errBodyHashAbandoned reports a client that went away while waiting for a hashing slot.
+	errBodyHashAbandoned = errors.New("request cancelled while waiting to hash body")
+)
+
+// SetBodyHashConcurrency bounds how many requests may buffer and SHA-256 their bodies for
+// cache keying at the same time. This pre-upstream CPU work runs before the queue (which
+// only wraps the upstream path), so it needs its own cap. limit <= 0 removes the cap.
+func (proxy *ReverseProxy) SetBodyHashConcurrency(limit int) {
+	if limit <= 0 {
+		proxy.bodyHashSlots = nil
+		return
+	}
+	proxy.bodyHashSlots = make(chan struct{}, limit)
+}
+
+// SetMaxBodyHashBytes caps the body size buffered to compute cache-key body hashes. Larger
+// bodies are streamed to the upstream instead and their requests bypass the cache.
+// maxBytes <= 0 hashes bodies of any size.
+func (proxy *ReverseProxy) SetMaxBodyHashBytes(maxBytes int64) {
+	proxy.maxBodyHashBytes = max(maxBytes, 0)
+}
+
+// hashRequestBody buffers the request body, puts it back for forwarding and returns its
+// hex SHA-256 (empty for bodyless requests). It waits for a hashing slot when a cap is set
+// (errBodyHashAbandoned if the client goes away first) and returns errBodyTooLargeToHash,
+// leaving the body streamable, when it exceeds max_body_hash_bytes.
+func (proxy *ReverseProxy) hashRequestBody(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", nil
+	}
+	// A declared oversize body is not touched at all.
+	if proxy.maxBodyHashBytes > 0 && req.ContentLength > proxy.maxBodyHashBytes {
+		return "", errBodyTooLargeToHash
+	}
+	if proxy.bodyHashSlots != nil {
+		select {
+		case proxy.bodyHashSlots <- struct{}{}:
+			defer func() { <-proxy.bodyHashSlots }()
+		case <-req.Context().Done():
+			return "", errBodyHashAbandoned
+		}
+	}
+	var bodyReader io.Reader = req.Body
+	if proxy.maxBodyHashBytes > 0 {
+		// Read one byte past the cap so an oversize body of unknown length is detected early.
+		bodyReader = io.LimitReader(req.Body, proxy.maxBodyHashBytes+1)
+	}
+	bodyBytes, err := io.ReadAll(bodyReader)
+	if err != nil {
+		return "", nil
+	}
+	if proxy.maxBodyHashBytes > 0 && int64(len(bodyBytes)) > proxy.maxBodyHashBytes {
+		// Replay the bytes already read, then stream the rest from the client.
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(bodyBytes), req.Body), req.Body}
+		return "", errBodyTooLargeToHash
+	}
+	// Restore body for further handling
+	req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	if len(bodyBytes) == 0 {
+		return "", nil
+	}
+	imetrics.CacheBodyHashBytesAdd(len(bodyBytes))
+	sum := sha256.Sum256(bodyBytes)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -2,11 +2,18 @@ package proxy
 
 import (
 	"container/list"
+	"fmt"
+	"math/rand/v2"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	applog "traefik-challenge-2/internal/log"
+	imetrics "traefik-challenge-2/internal/metrics"
 )
 
 // CachedResponse stores the full HTTP response needed to serve a cache HIT
@@ -27,8 +34,21 @@ type Cache interface {
 	Get(key string) (resp *CachedResponse, ok bool, stale bool)
 	Set(key string, resp *CachedResponse, ttl time.Duration)
 	Delete(key string)
+	// DeletePrefix removes every key starting with prefix and returns how many were removed.
+	DeletePrefix(prefix string) int
 	Purge()
 	Stats() CacheStats
+	// List returns a page of entry metadata (most recently used first) and the total entry count.
+	List(limit, offset int) ([]CacheEntryInfo, int)
+}
+
+// CacheEntryInfo describes a stored entry without exposing its body.
+type CacheEntryInfo struct {
+	Key        string    `json:"key"`
+	StoredAt   time.Time `json:"stored_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Size       int       `json:"size"`
+	StatusCode int       `json:"status_code"`
 }
 
 // CacheStats tracks basic cache metrics.
@@ -38,6 +58,7 @@ type CacheStats struct {
 	Misses    uint64 // Number of lookups that found no entry
 	Stores    uint64 // Number of inserts
 	Evictions uint64 // Number of LRU evictions
+	Expired   uint64 // Number of expired entries removed by the background sweeper
 }
 
 // lruCache is a simple thread-safe LRU cache with TTL per item.
@@ -47,12 +68,80 @@ type lruCache struct {
 	items      map[string]*list.Element
 	maxEntries int
 	stats      CacheStats
+	pressure   *evictionPressure // nil when eviction-rate warnings are disabled
+	sweeper    *cacheSweeper     // nil when background sweeping is disabled
+
+	maxBytesPerKey int                      // byte budget shared by all variants of one resource (0 = unlimited)
+	resources      map[string]*variantGroup // variants per resource (variantBaseKey); nil when unlimited
+}
+
+// LRUCacheOptions configures an LRU cache built with NewLRUCacheWithOptions.
+type LRUCacheOptions struct {
+	MaxEntries int // <= 0 uses 1024
+	// EvictionWarnRate is the evictions-per-second rate above which the cache is
+	// considered to be thrashing (0 disables pressure reporting).
+	EvictionWarnRate int
+	// EvictionWarnInterval throttles pressure reports (<= 0 uses one minute).
+	EvictionWarnInterval time.Duration
+	// OnEvictionPressure receives the observed evictions in the last second whenever the
+	// rate is exceeded (throttled). Nil logs a warning. It runs with the cache locked and
+	// must not call back into the cache.
+	OnEvictionPressure func(evictionsPerSecond int)
+	// SweepInterval enables a background janitor that removes expired entries at this
+	// interval instead of leaving them until capacity evicts them (0 disables it).
+	SweepInterval time.Duration
+	// SweepRetain keeps entries this long past expiry so they can still be served stale.
+	SweepRetain time.Duration
+	// MaxBytesPerKey caps the body bytes held by all variants (Accept/Accept-Encoding) of one
+	// resource; storing a variant past it evicts that resource's least recently used variants
+	// first (0 = unlimited).
+	MaxBytesPerKey int
+}
+
+// evictionPressure tracks evictions in one-second windows and reports (throttled)
+// when a window exceeds the configured rate. It may be shared by several cache shards.
+type evictionPressure struct {
+	mu           sync.Mutex
+	warnRate     int
+	warnInterval time.Duration
+	report       func(evictionsPerSecond int)
+	windowStart  time.Time
+	windowCount  int
+	lastReport   time.Time
+}
+
+// observe records one eviction at now and reports if the current window crossed the rate.
+func (pressure *evictionPressure) observe(now time.Time) {
+	pressure.mu.Lock()
+	defer pressure.mu.Unlock()
+	if now.Sub(pressure.windowStart) >= time.Second {
+		pressure.windowStart = now
+		pressure.windowCount = 0
+	}
+	pressure.windowCount++
+	if pressure.windowCount <= pressure.warnRate {
+		return
+	}
+	if !pressure.lastReport.IsZero() && now.Sub(pressure.lastReport) < pressure.warnInterval {
+		return
+	}
+	pressure.lastReport = now
+	pressure.report(pressure.windowCount)
+}
+
+// logEvictionPressure is the default pressure report: a warn log line.
+func logEvictionPressure(evictionsPerSecond int) {
+	applog.Emit("warn", "proxy", map[string]string{"component": "cache"},
+		fmt.Sprintf("cache eviction pressure: %d evictions in the last second; consider raising cache.max_entries", evictionsPerSecond))
 }
 
 // lruEntry wraps a cache key and its CachedResponse for storage in the LRU list.
 type lruEntry struct {
 	key string
 	val *CachedResponse
+
+	group   *variantGroup // resource this entry is a variant of; nil when unlimited
+	variant *list.Element // position in group.variants
 }
 
 // context key for cached request key
@@ -78,6 +167,143 @@ func SetDefaultCacheTTL(d time.Duration) {
 	defaultCacheTTL.Store(d)
 }
 
+// cacheResponsePolicy holds global bounds applied to TTLs derived from upstream directives.
+type cacheResponsePolicy struct {
+	minTTL time.Duration // TTLs below this are not cached (0 = no floor)
+	maxTTL time.Duration // TTLs above this are capped (0 = no cap)
+	// Statuses that are never stored, whatever the upstream directives say.
+	neverCacheStatuses map[int]struct{}
+	// Derive the TTL of responses without explicit freshness from Last-Modified.
+	heuristicFreshness bool
+	// Per-status TTLs used instead of the default when the upstream sent no freshness.
+	statusTTLs []StatusTTL
+	// Fraction of each TTL randomly shaved off on store, spreading out expirations.
+	ttlJitter float64
+}
+
+// StatusTTL is the default TTL for responses whose status is in [MinStatus, MaxStatus].
+type StatusTTL struct {
+	MinStatus int
+	MaxStatus int
+	TTL       time.Duration
+}
+
+var responsePolicy atomic.Pointer[cacheResponsePolicy]
+
+func init() {
+	responsePolicy.Store(&cacheResponsePolicy{})
+}
+
+// SetCacheTTLBounds caps cached TTLs at maxTTL and refuses to cache entries whose TTL
+// would be below minTTL. Zero disables the respective bound.
+func SetCacheTTLBounds(minTTL, maxTTL time.Duration) {
+	updated := *responsePolicy.Load()
+	updated.minTTL = max(minTTL, 0)
+	updated.maxTTL = max(maxTTL, 0)
+	responsePolicy.Store(&updated)
+}
+
+// SetNeverCacheStatuses lists response status codes that always BYPASS the cache, even
+// when otherwise cacheable (e.g. 301 from an upstream that reuses redirects). Empty clears it.
+func SetNeverCacheStatuses(statuses []int) {
+	updated := *responsePolicy.Load()
+	updated.neverCacheStatuses = nil
+	if len(statuses) > 0 {
+		updated.neverCacheStatuses = make(map[int]struct{}, len(statuses))
+		for _, status := range statuses {
+			updated.neverCacheStatuses[status] = struct{}{}
+		}
+	}
+	responsePolicy.Store(&updated)
+}
+
+// SetHeuristicFreshness makes responses that carry Last-Modified but no max-age/s-maxage/
+// Expires fresh for 10% of their age at response time (RFC 9111 4.2.2) instead of the flat
+// default TTL. The result is still subject to the min/max TTL bounds.
+func SetHeuristicFreshness(enabled bool) {
+	updated := *responsePolicy.Load()
+	updated.heuristicFreshness = enabled
+	responsePolicy.Store(&updated)
+}
+
+// SetStatusTTLs sets per-status default TTLs, used for cacheable responses without
+// max-age/s-maxage/Expires in place of the flat default (and before heuristic freshness).
+// When several rules match, the narrowest range wins. Empty clears them.
+func SetStatusTTLs(rules []StatusTTL) {
+	updated := *responsePolicy.Load()
+	updated.statusTTLs = append([]StatusTTL(nil), rules...)
+	responsePolicy.Store(&updated)
+}
+
+// SetCacheTTLJitter shortens every stored TTL by a random fraction of up to jitter (0..1),
+// so entries stored together (e.g. refilled after a purge) do not all expire, and hit the
+// upstream, at the same instant. TTLs are only ever shortened, never extended past what the
+// upstream allowed. 0 disables it; values are clamped to [0, 1).
+func SetCacheTTLJitter(jitter float64) {
+	updated := *responsePolicy.Load()
+	updated.ttlJitter = min(max(jitter, 0), 0.99)
+	responsePolicy.Store(&updated)
+}
+
+// jitterTTL applies the configured TTL jitter to ttl.
+func jitterTTL(ttl time.Duration) time.Duration {
+	jitter := responsePolicy.Load().ttlJitter
+	if jitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	return ttl - time.Duration(rand.Float64()*jitter*float64(ttl))
+}
+
+// statusTTL returns the TTL of the narrowest rule covering status.
+func statusTTL(status int) (time.Duration, bool) {
+	rules := responsePolicy.Load().statusTTLs
+	var best *StatusTTL
+	for i, rule := range rules {
+		if status < rule.MinStatus || status > rule.MaxStatus {
+			continue
+		}
+		if best == nil || rule.MaxStatus-rule.MinStatus < best.MaxStatus-best.MinStatus {
+			best = &rules[i]
+		}
+	}
+	if best == nil {
+		return 0, false
+	}
+	return best.TTL, true
+}
+
+// heuristicTTL returns 10% of the time between Last-Modified and the response's Date (or
+// now), or false when Last-Modified is missing, invalid or not in the past.
+func heuristicTTL(header http.Header) (time.Duration, bool) {
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return 0, false
+	}
+	responseTime, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		responseTime = time.Now()
+	}
+	ttl := responseTime.Sub(lastModified) / 10
+	return ttl, ttl > 0
+}
+
+// applyTTLBounds enforces the configured min/max TTL on a directive-derived TTL. A zero TTL
+// (max-age=0) is never stored: the cache would otherwise keep it for the default TTL.
+func applyTTLBounds(ttl time.Duration) (time.Duration, bool) {
+	if ttl <= 0 {
+		return 0, false
+	}
+	policy := responsePolicy.Load()
+	if policy.maxTTL > 0 && ttl > policy.maxTTL {
+		ttl = policy.maxTTL
+	}
+	if policy.minTTL > 0 && ttl < policy.minTTL {
+		// Sub-floor windows (including max-age=0) are not worth storing.
+		return 0, false
+	}
+	return ttl, true
+}
+
 // getDefaultCacheTTL returns the currently configured default cache TTL.
 func getDefaultCacheTTL() time.Duration {
 	if v := defaultCacheTTL.Load(); v != nil {
@@ -91,13 +317,54 @@ func getDefaultCacheTTL() time.Duration {
 // NewLRUCache creates a new LRU cache with a maximum number of entries.
 // If maxEntries <= 0, it defaults to 1024.
 func NewLRUCache(maxEntries int) Cache {
-	if maxEntries <= 0 {
-		maxEntries = 1024
+	return NewLRUCacheWithOptions(LRUCacheOptions{MaxEntries: maxEntries})
+}
+
+// NewLRUCacheWithOptions creates an LRU cache that can also report eviction pressure.
+func NewLRUCacheWithOptions(opts LRUCacheOptions) Cache {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1024
 	}
+	cache := newLRUShard(opts.MaxEntries, newEvictionPressure(opts))
+	cache.setMaxBytesPerKey(opts.MaxBytesPerKey)
+	cache.sweeper = startCacheSweeper([]*lruCache{cache}, opts.SweepInterval, opts.SweepRetain)
+	return cache
+}
+
+// newLRUShard builds a single-lock LRU holding up to maxEntries items.
+func newLRUShard(maxEntries int, pressure *evictionPressure) *lruCache {
 	return &lruCache{
 		lruList:    list.New(),
 		items:      make(map[string]*list.Element),
 		maxEntries: maxEntries,
+		pressure:   pressure,
+	}
+}
+
+// setMaxBytesPerKey enables per-resource byte accounting (limit <= 0 disables it).
+func (cache *lruCache) setMaxBytesPerKey(limit int) {
+	if limit <= 0 {
+		return
+	}
+	cache.maxBytesPerKey = limit
+	cache.resources = make(map[string]*variantGroup)
+}
+
+// newEvictionPressure returns the pressure tracker described by opts (nil when disabled).
+func newEvictionPressure(opts LRUCacheOptions) *evictionPressure {
+	if opts.EvictionWarnRate <= 0 {
+		return nil
+	}
+	if opts.EvictionWarnInterval <= 0 {
+		opts.EvictionWarnInterval = time.Minute
+	}
+	if opts.OnEvictionPressure == nil {
+		opts.OnEvictionPressure = logEvictionPressure
+	}
+	return &evictionPressure{
+		warnRate:     opts.EvictionWarnRate,
+		warnInterval: opts.EvictionWarnInterval,
+		report:       opts.OnEvictionPressure,
 	}
 }
 
@@ -112,6 +379,7 @@ func (cache *lruCache) Get(cacheKey string) (*CachedResponse, bool, bool) {
 
 		// Touch the element to mark it as most recently used.
 		cache.lruList.MoveToFront(element)
+		cache.touchVariant(entry)
 
 		// If expired, signal stale=true while still returning the entry for validation use.
 		if time.Now().After(entry.val.ExpiresAt) {
@@ -132,7 +400,7 @@ func (cache *lruCache) Set(cacheKey string, response *CachedResponse, ttl time.D
 	if ttl <= 0 {
 		ttl = getDefaultCacheTTL()
 	}
-	response.ExpiresAt = time.Now().Add(ttl)
+	response.ExpiresAt = time.Now().Add(jitterTTL(ttl))
 
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
@@ -140,13 +408,18 @@ func (cache *lruCache) Set(cacheKey string, response *CachedResponse, ttl time.D
 	if element, found := cache.items[cacheKey]; found {
 		// Update the existing entry and mark it as most recently used.
 		entry := element.Value.(*lruEntry)
+		cache.resizeVariant(entry, len(response.Body)-len(entry.val.Body))
 		entry.val = response
 		cache.lruList.MoveToFront(element)
+		cache.touchVariant(entry)
+		cache.enforceVariantBudget(element)
 	} else {
 		// Insert a new entry at the front (most recently used).
 		element := cache.lruList.PushFront(&lruEntry{key: cacheKey, val: response})
 		cache.items[cacheKey] = element
 		cache.stats.Stores++
+		cache.addVariant(element)
+		cache.enforceVariantBudget(element)
 
 		// Enforce capacity using LRU eviction policy.
 		if cache.lruList.Len() > cache.maxEntries {
@@ -158,10 +431,15 @@ func (cache *lruCache) Set(cacheKey string, response *CachedResponse, ttl time.D
 }
 
 // removeOldest evicts the least recently used entry (at the back of the list).
+// Only these capacity evictions feed the eviction metric and pressure report.
 func (cache *lruCache) removeOldest() {
 	element := cache.lruList.Back()
 	if element != nil {
 		cache.removeElement(element)
+		imetrics.CacheEvictionInc()
+		if cache.pressure != nil {
+			cache.pressure.observe(time.Now())
+		}
 	}
 }
 
@@ -170,6 +448,7 @@ func (cache *lruCache) removeElement(element *list.Element) {
 	cache.lruList.Remove(element)
 	entry := element.Value.(*lruEntry)
 	delete(cache.items, entry.key)
+	cache.removeVariant(entry)
 	cache.stats.Evictions++
 }
 
@@ -184,6 +463,23 @@ func (cache *lruCache) Delete(cacheKey string) {
 	}
 }
 
+// DeletePrefix removes all keys that start with the given prefix.
+// It is used to purge a single namespace from a cache shared by several proxies.
+func (cache *lruCache) DeletePrefix(prefix string) int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	removed := 0
+	for cacheKey, element := range cache.items {
+		if strings.HasPrefix(cacheKey, prefix) {
+			cache.removeElement(element)
+			removed++
+		}
+	}
+	cache.stats.Entries = cache.lruList.Len()
+	return removed
+}
+
 // Purge clears all entries from the cache.
 // It is like a reset of the cache state.
 func (cache *lruCache) Purge() {
@@ -192,9 +488,45 @@ func (cache *lruCache) Purge() {
 
 	cache.lruList = list.New()
 	cache.items = make(map[string]*list.Element)
+	if cache.resources != nil {
+		cache.resources = make(map[string]*variantGroup)
+	}
 	cache.stats.Entries = 0
 }
 
+// List returns metadata for up to limit entries starting at offset, walking the LRU
+// list from most to least recently used. The snapshot is taken under the cache lock.
+func (cache *lruCache) List(limit, offset int) ([]CacheEntryInfo, int) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	total := cache.lruList.Len()
+	if limit <= 0 || offset < 0 || offset >= total {
+		return []CacheEntryInfo{}, total
+	}
+	if remaining := total - offset; limit > remaining {
+		limit = remaining
+	}
+
+	entries := make([]CacheEntryInfo, 0, limit)
+	position := 0
+	for element := cache.lruList.Front(); element != nil && len(entries) < limit; element = element.Next() {
+		if position < offset {
+			position++
+			continue
+		}
+		entry := element.Value.(*lruEntry)
+		entries = append(entries, CacheEntryInfo{
+			Key:        entry.key,
+			StoredAt:   entry.val.StoredAt,
+			ExpiresAt:  entry.val.ExpiresAt,
+			Size:       len(entry.val.Body),
+			StatusCode: entry.val.StatusCode,
+		})
+	}
+	return entries, total
+}
+
 // Stats returns current cache statistics.
 func (cache *lruCache) Stats() CacheStats {
 	cache.mu.Lock()
@@ -202,6 +534,12 @@ func (cache *lruCache) Stats() CacheStats {
 	return cache.stats
 }
 
+// Close stops the background sweeper, if any. The cache stays usable.
+func (cache *lruCache) Close() error {
+	cache.sweeper.close()
+	return nil
+}
+
 // ===== HTTP Cache Helpers =====
 
 // hopHeaders lists hop-by-hop headers that should not be cached or forwarded as-is.
@@ -243,6 +581,18 @@ func isCacheableRequest(req *http.Request) bool {
 // isCacheableResponse validates if a response is cacheable and computes its TTL.
 // It returns (ttl, ok). If ok=false, the response must not be cached.
 func isCacheableResponse(response *http.Response) (ttl time.Duration, ok bool) {
+	if _, never := responsePolicy.Load().neverCacheStatuses[response.StatusCode]; never {
+		return 0, false
+	}
+	ttl, ok = responseDirectiveTTL(response)
+	if !ok {
+		return 0, false
+	}
+	return applyTTLBounds(ttl)
+}
+
+// responseDirectiveTTL derives cacheability and TTL from status and upstream directives.
+func responseDirectiveTTL(response *http.Response) (ttl time.Duration, ok bool) {
 	// Only cache common cacheable status codes.
 	switch response.StatusCode {
 	case 200, 203, 204, 300, 301, 404, 410:
@@ -279,6 +629,18 @@ func isCacheableResponse(response *http.Response) (ttl time.Duration, ok bool) {
 		}
 	}
 
+	// Without explicit freshness, a configured per-status TTL replaces the default.
+	if ttl, ok := statusTTL(response.StatusCode); ok {
+		return ttl, true
+	}
+
+	// Without explicit freshness, Last-Modified can give a heuristic TTL (when enabled).
+	if responsePolicy.Load().heuristicFreshness {
+		if ttl, ok := heuristicTTL(response.Header); ok {
+			return ttl, true
+		}
+	}
+
 	// Fallback to configured default TTL when no upstream directives exist.
 	return getDefaultCacheTTL(), true
 }
@@ -310,28 +672,156 @@ func parseCacheControl(headerValue string) map[string]string {
 	return directives
 }
 
+// cacheKeyHeaders are the only request headers that take part in built-in cache (and
+// collapse) keys, with the tag each is written under. Together with the method, URL and
+// body hash they are the content-relevant inputs of a key; volatile headers (request IDs,
+// trace context, Date) are left out simply by not being listed here.
+var cacheKeyHeaders = []struct{ name, tag string }{
+	{"Accept", "|a="},
+	{"Accept-Encoding", "|ae="},
+}
+
 // buildCacheKey generates a stable cache key for a request.
-// It combines method, scheme, host, path, query, and a few Vary-like headers.
-func buildCacheKey(req *http.Request) string {
+// It combines an optional namespace prefix, method, scheme, host, path, query, and the
+// cacheKeyHeaders dimensions. The body hash, when any, is appended by the caller.
+func buildCacheKey(req *http.Request, keyPrefix string, sortQuery bool) string {
 	keyBuilder := strings.Builder{}
+	keyBuilder.WriteString(keyPrefix)
 	keyBuilder.WriteString(req.Method)
 	keyBuilder.WriteString(" ")
-	keyBuilder.WriteString(req.URL.Scheme)
+	// Forward-mode origins differ by scheme too: http://a/x and https://a/x are distinct resources.
+	scheme := req.URL.Scheme
+	if origin := forwardOrigin(req); origin != nil {
+		scheme = origin.Scheme
+	}
+	keyBuilder.WriteString(scheme)
 	keyBuilder.WriteString("://")
 	keyBuilder.WriteString(req.Host)
-	keyBuilder.WriteString(singleJoiningSlash("", req.URL.Path))
+	// Escaped form keeps "/a%2Fb" and "/a/b" apart (they differ upstream when encoding is preserved).
+	keyBuilder.WriteString(singleJoiningSlash("", req.URL.EscapedPath()))
 	if req.URL.RawQuery != "" {
 		keyBuilder.WriteString("?")
-		keyBuilder.WriteString(req.URL.RawQuery)
+		if sortQuery {
+			keyBuilder.WriteString(sortedRawQuery(req.URL.RawQuery))
+		} else {
+			keyBuilder.WriteString(req.URL.RawQuery)
+		}
 	}
 	// Include common Vary dimensions to reduce collisions across content variants.
-	keyBuilder.WriteString("|a=")
-	keyBuilder.WriteString(strings.TrimSpace(req.Header.Get("Accept")))
-	keyBuilder.WriteString("|ae=")
-	keyBuilder.WriteString(strings.TrimSpace(req.Header.Get("Accept-Encoding")))
+	for _, keyHeader := range cacheKeyHeaders {
+		keyBuilder.WriteString(keyHeader.tag)
+		keyBuilder.WriteString(normalizeKeyHeaderValue(req.Header.Values(keyHeader.name)))
+	}
 	return keyBuilder.String()
 }
 
+// normalizeKeyHeaderValue canonicalizes a keyed header so spelling differences that do not
+// change the negotiated content ("GZIP,  br" vs "gzip,br", repeated header lines) map to
+// one key: elements are lowercased, trimmed (also around ";" parameters) and comma-joined.
+func normalizeKeyHeaderValue(values []string) string {
+	elements := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			parts := strings.Split(element, ";")
+			for i := range parts {
+				parts[i] = strings.ToLower(strings.TrimSpace(parts[i]))
+			}
+			if normalized := strings.Join(parts, ";"); normalized != "" {
+				elements = append(elements, normalized)
+			}
+		}
+	}
+	return strings.Join(elements, ",")
+}
+
+// varyWithinKey reports whether every request header named in the response's Vary is part
+// of the cache key. A response varying on anything else (a header the key ignores, or "*")
+// could be stored for one request and served to others whose header differs, which is how
+// unkeyed headers poison a cache; such responses are not stored.
+func varyWithinKey(header http.Header) bool {
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if !isCacheKeyHeader(name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isCacheKeyHeader reports whether name is one of the cacheKeyHeaders.
+func isCacheKeyHeader(name string) bool {
+	for _, keyHeader := range cacheKeyHeaders {
+		if strings.EqualFold(keyHeader.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedRawQuery orders query parameters by name for cache keys. The sort is stable, so
+// repeated parameters keep their relative order (a=2&a=1 stays distinct from a=1&a=2), and
+// pairs are compared raw so encodings are preserved.
+func sortedRawQuery(rawQuery string) string {
+	pairs := strings.Split(rawQuery, "&")
+	sort.SliceStable(pairs, func(i, j int) bool {
+		nameI, _, _ := strings.Cut(pairs[i], "=")
+		nameJ, _, _ := strings.Cut(pairs[j], "=")
+		return nameI < nameJ
+	})
+	return strings.Join(pairs, "&")
+}
+
+// headToGetCacheKey maps a HEAD cache key to the key of the equivalent GET request.
+// Keys differ only by the method token written right after the namespace prefix.
+func headToGetCacheKey(headKey, keyPrefix string) string {
+	return keyPrefix + http.MethodGet + strings.TrimPrefix(headKey, keyPrefix+http.MethodHead)
+}
+
+// notModifiedSince reports whether a GET/HEAD carrying If-Modified-Since can be answered
+// with 304 from a cached 200 whose Last-Modified is not newer than the client's date.
+// If-None-Match takes precedence per RFC 9110, so requests carrying it are not answered here.
+func notModifiedSince(req *http.Request, cachedEntry *CachedResponse) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if cachedEntry.StatusCode != http.StatusOK || req.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	ifModifiedSince, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(cachedEntry.Header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(ifModifiedSince)
+}
+
+// clientMinFresh returns the freshness the client still requires of a cached response
+// (Cache-Control: min-fresh=<seconds>); 0 when absent or invalid.
+func clientMinFresh(req *http.Request) time.Duration {
+	value, found := parseCacheControl(req.Header.Get("Cache-Control"))["min-fresh"]
+	if !found {
+		return 0
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// freshFor returns how long a cached entry stays fresh after now (negative once expired).
+func freshFor(entry *CachedResponse, now time.Time) time.Duration {
+	return entry.ExpiresAt.Sub(now)
+}
+
 // Checks if the client explicitly requested no-cache.
 func clientNoCache(req *http.Request) bool {
 	directives := parseCacheControl(req.Header.Get("Cache-Control"))
@@ -346,3 +836,10 @@ func clientNoCache(req *http.Request) bool {
 	}
 	return false
 }
+
+// clientOnlyIfCached reports whether the client accepts only a stored response
+// (Cache-Control: only-if-cached, RFC 9111 5.2.1.7).
+func clientOnlyIfCached(req *http.Request) bool {
+	_, ok := parseCacheControl(req.Header.Get("Cache-Control"))["only-if-cached"]
+	return ok
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// sweepBatchSize bounds how many entries a sweep inspects per lock acquisition, so a large
+// cache is never locked for a full scan.
+const sweepBatchSize = 256
+
+// cacheSweeper periodically removes expired entries from one or more LRU shards.
+type cacheSweeper struct {
+	shards   []*lruCache
+	interval time.Duration
+	retain   time.Duration
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// startCacheSweeper launches the background janitor; it returns nil when interval <= 0.
+func startCacheSweeper(shards []*lruCache, interval, retain time.Duration) *cacheSweeper {
+	if interval <= 0 {
+		return nil
+	}
+	sweeper := &cacheSweeper{
+		shards:   shards,
+		interval: interval,
+		retain:   max(retain, 0),
+		stop:     make(chan struct{}),
+	}
+	go sweeper.run()
+	return sweeper
+}
+
+func (sweeper *cacheSweeper) run() {
+	ticker := time.NewTicker(sweeper.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, shard := range sweeper.shards {
+				shard.sweepExpired(sweeper.retain)
+			}
+		case <-sweeper.stop:
+			return
+		}
+	}
+}
+
+// close stops the janitor; safe to call more than once and on a nil sweeper.
+func (sweeper *cacheSweeper) close() {
+	if sweeper == nil {
+		return
+	}
+	sweeper.stopOnce.Do(func() { close(sweeper.stop) })
+}
+
+// sweepExpired removes entries that expired more than retain ago (retain keeps entries
+// around for stale serving). It walks from the least recently used end in batches of
+// sweepBatchSize, releasing the lock between batches, and stops early if the entry it
+// was about to resume from was removed meanwhile. It returns the number of entries removed.
+func (cache *lruCache) sweepExpired(retain time.Duration) int {
+	removed := 0
+	var cursor *list.Element
+	for firstBatch := true; ; firstBatch = false {
+		cache.mu.Lock()
+		if firstBatch {
+			cursor = cache.lruList.Back()
+		} else if cache.items[cursor.Value.(*lruEntry).key] != cursor {
+			cache.mu.Unlock()
+			return removed
+		}
+		cutoff := time.Now().Add(-retain)
+		for scanned := 0; cursor != nil && scanned < sweepBatchSize; scanned++ {
+			previous := cursor.Prev()
+			if entry := cursor.Value.(*lruEntry); entry.val.ExpiresAt.Before(cutoff) {
+				cache.lruList.Remove(cursor)
+				delete(cache.items, entry.key)
+				cache.removeVariant(entry)
+				cache.stats.Expired++
+				removed++
+			}
+			cursor = previous
+		}
+		cache.stats.Entries = cache.lruList.Len()
+		cache.mu.Unlock()
+		if cursor == nil {
+			return removed
+		}
+	}
+}
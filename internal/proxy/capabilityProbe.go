@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// UpstreamCapabilities reports what one target supports, as seen by a startup probe.
+type UpstreamCapabilities struct {
+	Target *url.URL
+	HTTP2  bool  // h2 via ALPN for https targets, h2c with prior knowledge for http targets
+	Gzip   bool  // answered Accept-Encoding: gzip with a gzip-encoded body
+	Err    error // set when the target could not be probed at all
+}
+
+// ProbeUpstreamCapabilities asks every target (backups and client network pools included)
+// for its path once and records whether it speaks HTTP/2 and compresses with gzip. Each
+// probe is bounded by timeout (<= 0 uses 2s). With configureTransport, when every target
+// speaks HTTP/2 the upstream transport is switched to HTTP/2 only (h2c for http targets);
+// otherwise, and in forward mode, the transport is left as is. Gzip support is informational.
+func (proxy *ReverseProxy) ProbeUpstreamCapabilities(timeout time.Duration, configureTransport bool) []UpstreamCapabilities {
+	if timeout <= 0 {
+		timeout = defaultStartupProbeTimeout
+	}
+	h2cProtocols := new(http.Protocols)
+	h2cProtocols.SetUnencryptedHTTP2(true)
+	h2cTransport := proxy.transport.Clone()
+	h2cTransport.Protocols = h2cProtocols
+	defaultTransport := proxy.transport.Clone()
+	defer h2cTransport.CloseIdleConnections()
+	defer defaultTransport.CloseIdleConnections()
+
+	targets := proxy.allTargets()
+	results := make([]UpstreamCapabilities, 0, len(targets))
+	allHTTP2 := len(targets) > 0
+	for _, target := range targets {
+		result := UpstreamCapabilities{Target: target}
+		if strings.EqualFold(target.Scheme, "https") {
+			// ALPN negotiates h2 when the upstream offers it.
+			result.HTTP2, result.Gzip, result.Err = probeCapabilitiesOnce(defaultTransport, target, timeout)
+		} else if _, gzip, err := probeCapabilitiesOnce(h2cTransport, target, timeout); err == nil {
+			result.HTTP2, result.Gzip = true, gzip
+		} else {
+			// No h2c: the preface is rejected, so retry over HTTP/1.1.
+			_, result.Gzip, result.Err = probeCapabilitiesOnce(defaultTransport, target, timeout)
+		}
+		allHTTP2 = allHTTP2 && result.HTTP2
+		results = append(results, result)
+	}
+
+	if configureTransport && allHTTP2 && !proxy.forwardMode {
+		http2Only := new(http.Protocols)
+		http2Only.SetHTTP2(true)
+		http2Only.SetUnencryptedHTTP2(true)
+		proxy.transport.Protocols = http2Only
+	}
+	return results
+}
+
+// probeCapabilitiesOnce issues GET <target path> with Accept-Encoding: gzip over transport
+// and reports whether the response came over HTTP/2 and was gzip-encoded.
+func probeCapabilitiesOnce(transport http.RoundTripper, target *url.URL, timeout time.Duration) (http2, gzip bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	probeURL := &url.URL{Scheme: target.Scheme, Host: target.Host, Path: target.Path}
+	if probeURL.Scheme == "" {
+		probeURL.Scheme = "http"
+	}
+	if probeURL.Path == "" {
+		probeURL.Path = "/"
+	}
+	probeRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return false, false, err
+	}
+	// Set explicitly so the transport neither adds nor strips the encoding.
+	probeRequest.Header.Set("Accept-Encoding", "gzip")
+	probeResponse, err := transport.RoundTrip(probeRequest)
+	if err != nil {
+		return false, false, err
+	}
+	defer probeResponse.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(probeResponse.Body, 64<<10))
+	return probeResponse.ProtoMajor == 2, strings.EqualFold(probeResponse.Header.Get("Content-Encoding"), "gzip"), nil
+}
+
+// SummarizeCapabilities renders a one-line summary of capability probe results for logs.
+func SummarizeCapabilities(results []UpstreamCapabilities) string {
+	parts := make([]string, 0, len(results))
+	for _, result := range results {
+		if result.Err != nil {
+			parts = append(parts, fmt.Sprintf("%s=unknown(%v)", result.Target.Host, result.Err))
+			continue
+		}
+		protocol := "http/1.1"
+		if result.HTTP2 {
+			protocol = "h2"
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s,gzip=%t", result.Target.Host, protocol, result.Gzip))
+	}
+	return fmt.Sprintf("capability probe: %d targets [%s]", len(results), strings.Join(parts, " "))
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ClientNetworkPool sends clients whose address falls inside one of CIDRs to its own
+// upstream pool (e.g. internal clients to internal backends).
+type ClientNetworkPool struct {
+	Name    string
+	CIDRs   []string   // e.g. "10.0.0.0/8", "fd00::/8"
+	Targets []*url.URL // balanced with the proxy's strategy and health checks
+}
+
+// clientNetworkPool is a ClientNetworkPool with parsed networks and its own balancer.
+type clientNetworkPool struct {
+	name     string
+	networks []*net.IPNet
+	targets  []*url.URL
+	balancer Balancer
+	// cacheScope keeps this pool's cache entries apart from other pools' (name, or index).
+	cacheScope string
+}
+
+// SetClientNetworkPools configures split routing by client network. Pools are checked in
+// order before load balancing and the first pool containing the client address wins;
+// other clients use the default targets. The client address is the connection's remote
+// address, so X-Forwarded-For cannot be used to pick a pool. Pools route to different
+// backends, so each pool also gets its own cache entries. An empty list disables it.
+func (proxy *ReverseProxy) SetClientNetworkPools(pools []ClientNetworkPool) error {
+	parsed := make([]*clientNetworkPool, 0, len(pools))
+	for index, pool := range pools {
+		if len(pool.Targets) == 0 {
+			return fmt.Errorf("client network pool %q has no targets", pool.Name)
+		}
+		networkPool := &clientNetworkPool{name: pool.Name, targets: append([]*url.URL{}, pool.Targets...), cacheScope: pool.Name}
+		if networkPool.cacheScope == "" {
+			networkPool.cacheScope = fmt.Sprintf("#%d", index)
+		}
+		for _, cidr := range pool.CIDRs {
+			_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				return fmt.Errorf("client network pool %q: invalid CIDR %q: %w", pool.Name, cidr, err)
+			}
+			networkPool.networks = append(networkPool.networks, network)
+		}
+		if len(networkPool.networks) == 0 {
+			return fmt.Errorf("client network pool %q has no CIDRs", pool.Name)
+		}
+		parsed = append(parsed, networkPool)
+	}
+	proxy.networkPools = parsed
+	proxy.rebuildBalancer()
+	return nil
+}
+
+// balancerFor returns the balancer of the first client network pool containing the
+// request's client address, or the default balancer.
+func (proxy *ReverseProxy) balancerFor(req *http.Request) Balancer {
+	if pool := proxy.networkPoolFor(req); pool != nil {
+		return pool.balancer
+	}
+	return proxy.balancer
+}
+
+// networkPoolFor returns the first client network pool containing the request's client
+// address, or nil when the default targets serve it.
+func (proxy *ReverseProxy) networkPoolFor(req *http.Request) *clientNetworkPool {
+	if len(proxy.networkPools) == 0 {
+		return nil
+	}
+	clientIP := net.ParseIP(clientIPFromRequest(req))
+	if clientIP == nil {
+		return nil
+	}
+	for _, pool := range proxy.networkPools {
+		for _, network := range pool.networks {
+			if network.Contains(clientIP) {
+				return pool
+			}
+		}
+	}
+	return nil
+}
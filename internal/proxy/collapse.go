@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// collapser coalesces identical concurrent GETs on allowlisted paths into a single
+// upstream call, even when the response is not cacheable.
+type collapser struct {
+	group        *inflightGroup
+	pathPrefixes []string
+}
+
+// SetCollapseForwarding enables request collapsing for GET/HEAD requests whose path starts
+// with one of pathPrefixes: while one such request is in flight, identical requests wait
+// for it and receive the same response, which is not stored. Only paths serving the same
+// content to every client should be listed; requests with credentials or cookies are
+// never collapsed. Disabled (or no prefixes) turns collapsing off.
+func (proxy *ReverseProxy) SetCollapseForwarding(enabled bool, pathPrefixes []string) {
+	prefixes := make([]string, 0, len(pathPrefixes))
+	for _, prefix := range pathPrefixes {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if !enabled || len(prefixes) == 0 {
+		proxy.collapse = nil
+		return
+	}
+	proxy.collapse = &collapser{group: newInflightGroup(0), pathPrefixes: prefixes}
+}
+
+// collapseKeyFor returns the coalescing key for req, or "" when it must go upstream alone.
+// Like cache keys it is scoped to the client network pool, so clients routed to different
+// targets never share a response.
+func (proxy *ReverseProxy) collapseKeyFor(req *http.Request) string {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return ""
+	}
+	// Per-user or never-ending (SSE) responses must not be shared.
+	if req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != "" {
+		return ""
+	}
+	if strings.Contains(req.Header.Get("Accept"), "text/event-stream") {
+		return ""
+	}
+	for _, prefix := range proxy.collapse.pathPrefixes {
+		if strings.HasPrefix(req.URL.Path, prefix) {
+			upstreamTarget, _ := req.Context().Value(upstreamTargetCtxKey{}).(*url.URL)
+			return proxy.upstreamScopedKey(req, buildCacheKey(req, proxy.cacheKeyPrefix, proxy.normalizeQuery), upstreamTarget)
+		}
+	}
+	return ""
+}
+
+// serveCollapsed forwards the first request for key upstream and fans its response out
+// to every identical request that arrived while it was in flight. The upstream call is
+// not tied to the first client: it runs until it completes or the shared fetch timeout,
+// while each client's own X-Request-Timeout-Ms budget only bounds its wait.
+func (proxy *ReverseProxy) serveCollapsed(w http.ResponseWriter, req *http.Request, key string) {
+	waitCtx, cancel := proxy.sharedWaitContext(req)
+	defer cancel()
+	response, shared, err := proxy.collapse.group.do(waitCtx, key, "", proxy.sharedFetchTimeout(req), func(fetchCtx context.Context, capture http.ResponseWriter) {
+		proxy.handler.ServeHTTP(capture, req.WithContext(fetchCtx))
+	})
+	if shared {
+		// Only the leader's request goes upstream; a follower's pick is never acquired.
+		proxy.releaseTarget(req)
+	}
+	if err != nil {
+		proxy.writeSharedWaitError(w, req, err)
+		return
+	}
+	if shared {
+		w.Header().Set("X-Collapsed-Forward", "true")
+	}
+	response.writeTo(w)
+}
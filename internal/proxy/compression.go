@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+const (
+	// defaultCompressionMinSize skips tiny bodies where gzip overhead outweighs the savings.
+	defaultCompressionMinSize = 256
+	// defaultRequestDecompressMax caps decoded request bodies to defuse decompression bombs.
+	defaultRequestDecompressMax = 10 << 20
+)
+
+// SetCompression enables gzip compression of client responses for clients that accept it.
+// Bodies smaller than minSize bytes are sent as-is (minSize <= 0 uses 256).
+func (proxy *ReverseProxy) SetCompression(enabled bool, minSize int) {
+	if minSize <= 0 {
+		minSize = defaultCompressionMinSize
+	}
+	proxy.compressionEnabled = enabled
+	proxy.compressionMinSize = minSize
+}
+
+// SetCompressionBrotli also offers Brotli (br) to clients accepting it; br is preferred
+// over gzip unless the client weights gzip higher. Requires SetCompression to be enabled.
+func (proxy *ReverseProxy) SetCompressionBrotli(enabled bool) {
+	proxy.compressionBrotli = enabled
+}
+
+// SetStoreCompressed caches the representation actually sent on a MISS: when the proxy
+// compressed it, the entry holds the encoded body and its Content-Encoding, so HITs for the
+// same Accept-Encoding are served as-is instead of being compressed again. Each encoding is
+// its own cache variant (keys include Accept-Encoding) and counts against the per-resource
+// byte budget with its stored size.
+func (proxy *ReverseProxy) SetStoreCompressed(enabled bool) {
+	proxy.storeCompressed = enabled
+}
+
+// compressedVariant returns the header and body to cache for a response the proxy may
+// have compressed: upstreamHeader/body unchanged when clientHeader carries no new encoding,
+// else a copy with the client's Content-Encoding, Content-Length and Vary and clientBody.
+func compressedVariant(upstreamHeader, clientHeader http.Header, body, clientBody []byte) (http.Header, []byte) {
+	encoding := clientHeader.Get("Content-Encoding")
+	if encoding == "" || encoding == upstreamHeader.Get("Content-Encoding") {
+		return upstreamHeader, body
+	}
+	storedHeader := upstreamHeader.Clone()
+	storedHeader.Set("Content-Encoding", encoding)
+	storedHeader.Set("Content-Length", strconv.Itoa(len(clientBody)))
+	storedHeader["Vary"] = clientHeader.Values("Vary")
+	if etag := clientHeader.Get("ETag"); etag != "" {
+		storedHeader.Set("ETag", etag)
+	}
+	return storedHeader, clientBody
+}
+
+// weakenETag marks a strong ETag weak once the proxy re-encodes the body: the bytes sent
+// are no longer the representation the upstream tagged, so they must not pass strong
+// comparisons (e.g. If-Range) against the upstream's identity body.
+func weakenETag(header http.Header) {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// hasNoTransform reports whether Cache-Control carries no-transform, which forbids
+// intermediaries from changing the payload (compression, decompression, rewrites).
+func hasNoTransform(header http.Header) bool {
+	_, found := parseCacheControl(header.Get("Cache-Control"))["no-transform"]
+	return found
+}
+
+// acceptedWeight returns the q-value the client gave coding in Accept-Encoding (1 when
+// unweighted, 0 when absent or refused with q=0).
+func acceptedWeight(req *http.Request, coding string) float64 {
+	for _, part := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), coding) {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ToLower(strings.TrimSpace(params)), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil {
+				return weight
+			}
+		}
+		return 1
+	}
+	return 0
+}
+
+// negotiateEncoding picks the response coding for req: br (when enabled) or gzip, by the
+// client's weights with ties going to br; "" when the client accepts neither.
+func (proxy *ReverseProxy) negotiateEncoding(req *http.Request) string {
+	gzipWeight := acceptedWeight(req, "gzip")
+	if proxy.compressionBrotli {
+		if brWeight := acceptedWeight(req, "br"); brWeight > 0 && brWeight >= gzipWeight {
+			return "br"
+		}
+	}
+	if gzipWeight > 0 {
+		return "gzip"
+	}
+	return ""
+}
+
+// isCompressibleType limits compression to textual payloads.
+func isCompressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == "application/json", mediaType == "application/javascript",
+		mediaType == "application/xml", mediaType == "image/svg+xml",
+		strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	return false
+}
+
+// maybeCompress encodes body (br or gzip) for the client when compression is enabled and allowed.
+// It updates the client-bound header (Content-Encoding, Content-Length, Vary, a weak ETag)
+// and returns the body to write. Responses marked no-transform are never touched.
+func (proxy *ReverseProxy) maybeCompress(req *http.Request, clientHeader http.Header, statusCode int, body []byte) []byte {
+	if !proxy.compressionEnabled || req.Method == http.MethodHead || len(body) < proxy.compressionMinSize {
+		return body
+	}
+	if statusCode < 200 || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		return body
+	}
+	if hasNoTransform(clientHeader) || clientHeader.Get("Content-Encoding") != "" {
+		return body
+	}
+	encoding := proxy.negotiateEncoding(req)
+	if encoding == "" || !isCompressibleType(clientHeader.Get("Content-Type")) {
+		return body
+	}
+
+	compressed, err := encodeBody(encoding, body)
+	if err != nil {
+		return body
+	}
+
+	clientHeader.Set("Content-Encoding", encoding)
+	clientHeader.Set("Content-Length", strconv.Itoa(len(compressed)))
+	clientHeader.Add("Vary", "Accept-Encoding")
+	weakenETag(clientHeader)
+	imetrics.CompressedResponseInc(encoding)
+	return compressed
+}
+
+// encodeBody compresses body with encoding ("br" or "gzip").
+func encodeBody(encoding string, body []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	var encoder io.WriteCloser
+	if encoding == "br" {
+		encoder = brotli.NewWriterLevel(&compressed, brotli.DefaultCompression)
+	} else {
+		encoder = gzip.NewWriter(&compressed)
+	}
+	if _, err := encoder.Write(body); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// SetRequestDecompression enables decoding of gzip-encoded client request bodies before
+// cache hashing and forwarding. Decoded bodies above maxBytes are rejected (<= 0 uses 10 MiB).
+func (proxy *ReverseProxy) SetRequestDecompression(enabled bool, maxBytes int64) {
+	if maxBytes <= 0 {
+		maxBytes = defaultRequestDecompressMax
+	}
+	proxy.requestDecompress = enabled
+	proxy.requestDecompressMax = maxBytes
+}
+
+// hasGzipContentEncoding reports whether the body is gzip-encoded (and nothing else).
+func hasGzipContentEncoding(header http.Header) bool {
+	return strings.EqualFold(strings.TrimSpace(header.Get("Content-Encoding")), "gzip")
+}
+
+// errRequestBodyTooLarge marks decoded bodies exceeding the configured cap.
+var errRequestBodyTooLarge = errors.New("decoded request body too large")
+
+// decompressRequestBody replaces a gzip request body with its decoded form and fixes
+// Content-Encoding/Content-Length. On failure it returns the status to answer with:
+// 413 when the decoded body exceeds the cap, 400 for malformed gzip.
+func (proxy *ReverseProxy) decompressRequestBody(req *http.Request) (int, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return http.StatusOK, nil
+	}
+	gzipReader, err := gzip.NewReader(req.Body)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid gzip request body: %w", err)
+	}
+	defer gzipReader.Close()
+
+	// Read one byte past the cap so an oversize body is detected without decoding it all.
+	decoded, err := io.ReadAll(io.LimitReader(gzipReader, proxy.requestDecompressMax+1))
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid gzip request body: %w", err)
+	}
+	if int64(len(decoded)) > proxy.requestDecompressMax {
+		return http.StatusRequestEntityTooLarge, errRequestBodyTooLarge
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(decoded))
+	req.ContentLength = int64(len(decoded))
+	req.Header.Del("Content-Encoding")
+	req.Header.Set("Content-Length", strconv.Itoa(len(decoded)))
+	return http.StatusOK, nil
+}
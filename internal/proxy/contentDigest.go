@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// digestAlgorithms are the Digest (RFC 3230) algorithms checked; others are ignored.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha":     sha1.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// defaultContentDigestMax caps bodies buffered for checksum validation.
+const defaultContentDigestMax = 10 << 20
+
+var (
+	// errContentDigestMismatch marks request bodies that do not match their checksum header.
+	errContentDigestMismatch = errors.New("request body does not match its digest")
+	// errDigestBodyTooLarge marks checksummed bodies above the validation cap.
+	errDigestBodyTooLarge = errors.New("request body too large to validate its digest")
+)
+
+// SetValidateContentDigest enables checking the Content-MD5 and Digest request headers
+// against the received body; mismatching requests are rejected with 400 before forwarding.
+// The body is buffered to be checked, so checksummed bodies above maxBytes are rejected
+// with 413 (<= 0 uses 10 MiB).
+func (proxy *ReverseProxy) SetValidateContentDigest(enabled bool, maxBytes int64) {
+	if maxBytes <= 0 {
+		maxBytes = defaultContentDigestMax
+	}
+	proxy.validateContentDigest = enabled
+	proxy.validateContentDigestMax = maxBytes
+}
+
+// hasContentDigest reports whether the request carries a body checksum header.
+func hasContentDigest(header http.Header) bool {
+	return header.Get("Content-MD5") != "" || header.Get("Digest") != ""
+}
+
+// verifyContentDigest buffers the request body (up to the validation cap) and checks it
+// against Content-MD5 and every Digest entry with a supported algorithm. The buffered body
+// is put back on the request so cache hashing and forwarding reuse it instead of reading
+// the client again. On failure it returns the status to answer with: 413 over the cap,
+// 400 for a mismatch.
+func (proxy *ReverseProxy) verifyContentDigest(req *http.Request) (int, error) {
+	if req.ContentLength > proxy.validateContentDigestMax {
+		return http.StatusRequestEntityTooLarge, errDigestBodyTooLarge
+	}
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		// Read one byte past the cap so an oversize chunked body is detected early.
+		readBody, err := io.ReadAll(io.LimitReader(req.Body, proxy.validateContentDigestMax+1))
+		if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("read request body: %w", err)
+		}
+		if int64(len(readBody)) > proxy.validateContentDigestMax {
+			return http.StatusRequestEntityTooLarge, errDigestBodyTooLarge
+		}
+		body = readBody
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if value := strings.TrimSpace(req.Header.Get("Content-MD5")); value != "" {
+		sum := md5.Sum(body)
+		if !digestMatches(value, sum[:]) {
+			return http.StatusBadRequest, fmt.Errorf("%w (Content-MD5)", errContentDigestMismatch)
+		}
+	}
+	for _, entry := range strings.Split(strings.Join(req.Header.Values("Digest"), ","), ",") {
+		// Base64 values may end in '=' padding, so split on the first '=' only.
+		algorithm, value, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			continue
+		}
+		algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+		newHash, supported := digestAlgorithms[algorithm]
+		if !supported {
+			continue
+		}
+		hasher := newHash()
+		hasher.Write(body)
+		if !digestMatches(value, hasher.Sum(nil)) {
+			return http.StatusBadRequest, fmt.Errorf("%w (Digest %s)", errContentDigestMismatch, algorithm)
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// digestMatches compares a base64-encoded checksum with the computed sum.
+func digestMatches(encoded string, sum []byte) bool {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	return err == nil && bytes.Equal(decoded, sum)
+}
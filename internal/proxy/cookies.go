@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SetCookieCachePolicy controls how requests carrying cookies interact with the cache.
+// When ignoreCookieRequests is true, a request with any cookie outside allowedCookies is
+// treated as user-specific: it is only served from, or stored into, the cache when the
+// response is explicitly Cache-Control: public. Allowlisted cookies (e.g. analytics)
+// never affect cacheability.
+func (proxy *ReverseProxy) SetCookieCachePolicy(ignoreCookieRequests bool, allowedCookies []string) {
+	proxy.ignoreCookieRequests = ignoreCookieRequests
+	allowed := make(map[string]struct{}, len(allowedCookies))
+	for _, name := range allowedCookies {
+		if name = strings.TrimSpace(name); name != "" {
+			allowed[name] = struct{}{}
+		}
+	}
+	proxy.cacheNeutralCookies = allowed
+}
+
+// hasUserCookies reports whether the request carries a cookie that makes it user-specific.
+func (proxy *ReverseProxy) hasUserCookies(req *http.Request) bool {
+	if !proxy.ignoreCookieRequests {
+		return false
+	}
+	for _, cookie := range req.Cookies() {
+		if _, neutral := proxy.cacheNeutralCookies[cookie.Name]; !neutral {
+			return true
+		}
+	}
+	return false
+}
+
+// isPublicResponse reports whether the response explicitly allows shared caching.
+func isPublicResponse(header http.Header) bool {
+	_, public := parseCacheControl(header.Get("Cache-Control"))["public"]
+	return public
+}
+
+// cookiesPermitCache reports whether a request's cookies allow using a response with
+// the given headers from (or for) the shared cache.
+func (proxy *ReverseProxy) cookiesPermitCache(req *http.Request, responseHeader http.Header) bool {
+	return !proxy.hasUserCookies(req) || isPublicResponse(responseHeader)
+}
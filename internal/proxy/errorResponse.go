@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// errorEnvelope is the JSON body of proxy-generated errors when json_errors is on.
+type errorEnvelope struct {
+	Status    int    `json:"status"`
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// SetJSONErrors makes proxy-generated error responses (e.g. 405) use a JSON envelope
+// {"status","error","request_id"} instead of a plain-text body.
+func (proxy *ReverseProxy) SetJSONErrors(enabled bool) {
+	proxy.jsonErrors = enabled
+}
+
+// writeErrorBody writes a proxy-generated error as plain text, or as the JSON envelope
+// when enabled. Headers already set on w (Allow, X-Request-ID) are kept.
+func (proxy *ReverseProxy) writeErrorBody(w http.ResponseWriter, req *http.Request, status int, message string) {
+	if !proxy.jsonErrors {
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorEnvelope{
+		Status:    status,
+		Error:     message,
+		RequestID: getRequestID(req),
+	})
+}
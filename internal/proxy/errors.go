@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	applog "traefik-challenge-2/internal/log"
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+// Errors the proxy answers itself. writeError maps each of them (or an error wrapping one)
+// to the same status, body, headers, metric and log line wherever it is raised.
+var (
+	// ErrNoUpstream: every target is unhealthy or ejected (503 + Retry-After).
+	ErrNoUpstream = errors.New("no healthy upstream targets")
+	// ErrQueueFull: the admission queue has no room left (429).
+	ErrQueueFull = errors.New("queue full, try again later")
+	// ErrQueueTimeout: no concurrency slot freed up within the enqueue timeout (503).
+	ErrQueueTimeout = errors.New("timed out while waiting in queue")
+	// ErrQueueCanceled: the client went away while waiting in the queue (503).
+	ErrQueueCanceled = errors.New("request cancelled while waiting in queue")
+	// ErrUpstream: the upstream round trip failed; see UpstreamError for the details (502 by default).
+	ErrUpstream = errors.New("upstream request failed")
+)
+
+// UpstreamError is a failed upstream round trip. errors.Is(err, ErrUpstream) reports true for it.
+type UpstreamError struct {
+	Target string // upstream host
+	Class  string // error class (canceled, timeout, refused, reset, dns, tls, protocol)
+	Status int    // client-facing status (408, 502, 503 or 504)
+	Err    error
+}
+
+func (upstreamErr *UpstreamError) Error() string        { return upstreamErr.Err.Error() }
+func (upstreamErr *UpstreamError) Unwrap() error        { return upstreamErr.Err }
+func (upstreamErr *UpstreamError) Is(target error) bool { return target == ErrUpstream }
+
+// ErrorStatus returns the status a proxy error is answered with (500 for unknown errors).
+func ErrorStatus(err error) int {
+	var upstreamErr *UpstreamError
+	switch {
+	case errors.As(err, &upstreamErr) && upstreamErr.Status != 0:
+		return upstreamErr.Status
+	case errors.Is(err, ErrUpstream):
+		return http.StatusBadGateway
+	case errors.Is(err, ErrNoUpstream), errors.Is(err, ErrQueueTimeout), errors.Is(err, ErrQueueCanceled):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrQueueFull):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError answers req with err: status from ErrorStatus, X-Request-ID (when assigned),
+// Retry-After for "upstream down" 503s, proxy_requests_total and an error log line, then
+// the plain-text or JSON body. Client cancellations (408) get no body. Root requests with
+// no upstream get the default root response instead, when configured.
+func (proxy *ReverseProxy) writeError(w http.ResponseWriter, req *http.Request, err error) {
+	if errors.Is(err, ErrNoUpstream) && proxy.serveRootResponse(w, req) {
+		return
+	}
+	status := ErrorStatus(err)
+	upstreamHost := ""
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) {
+		upstreamHost = upstreamErr.Target
+	}
+
+	if requestID := getRequestID(req); requestID != "" {
+		w.Header().Set("X-Request-ID", requestID)
+	}
+	if status == http.StatusServiceUnavailable && (errors.Is(err, ErrNoUpstream) || errors.Is(err, ErrUpstream)) {
+		setRetryAfter(w.Header(), proxy.unavailableRetryAfter)
+	}
+
+	startTime, _ := req.Context().Value(startTimeCtxKey{}).(time.Time)
+	if startTime.IsZero() {
+		startTime = time.Now()
+	}
+	imetrics.ObserveProxyResponse(req.Method, status, "BYPASS", time.Since(startTime))
+	applog.LogProxyError(status, "BYPASS", upstreamHost, req, err)
+
+	switch {
+	case status == http.StatusRequestTimeout:
+		w.WriteHeader(status)
+	case upstreamErr != nil && status == http.StatusGatewayTimeout:
+		proxy.writeErrorBody(w, req, status, "upstream request timeout")
+	default:
+		proxy.writeErrorBody(w, req, status, err.Error())
+	}
+}
+
+// writePlainError is the error writer of queues built without a proxy (WithQueue): status
+// and plain-text body only.
+func writePlainError(w http.ResponseWriter, _ *http.Request, err error) {
+	http.Error(w, err.Error(), ErrorStatus(err))
+}
+
+// queueWaitError maps why a queued request stopped waiting to its typed error.
+func queueWaitError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrQueueTimeout
+	}
+	return ErrQueueCanceled
+}
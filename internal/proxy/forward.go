@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	applog "traefik-challenge-2/internal/log"
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+// Proxy modes accepted by SetMode.
+const (
+	ModeReverse = "reverse" // forward to the configured targets (default)
+	ModeForward = "forward" // explicit proxy: CONNECT tunnels and absolute-URI requests
+)
+
+const (
+	// connectDialTimeout bounds how long a CONNECT tunnel waits for the remote host.
+	connectDialTimeout = 10 * time.Second
+	// connectMetricLabel is the upstream label of tunnel metrics: the requested authorities
+	// are client-chosen and would make the label unbounded.
+	connectMetricLabel = "connect"
+	// forwardMetricLabel is the upstream label of absolute-URI requests in forward mode, whose
+	// origins are client-chosen for the same reason.
+	forwardMetricLabel = "forward"
+)
+
+// forwardOriginCtxKey carries the origin (scheme + host) of an absolute-URI request in forward mode.
+type forwardOriginCtxKey struct{}
+
+// SetMode selects reverse (default) or forward-proxy behavior. In forward mode CONNECT is
+// tunneled to the requested host and absolute-URI requests go to the origin they name
+// (cache and queue still apply); origin-form requests are rejected with 400.
+func (proxy *ReverseProxy) SetMode(mode string) {
+	proxy.forwardMode = strings.ToLower(strings.TrimSpace(mode)) == ModeForward
+}
+
+// connectDestination is one CONNECT allowlist entry; "*" matches any host or port and a
+// "*." host prefix any subdomain.
+type connectDestination struct {
+	host string
+	port string
+}
+
+// SetConnectAllowlist lists the host:port destinations CONNECT may tunnel to, e.g.
+// "api.example.com:443", "*.example.com:443" or "git.example.com:*". CONNECT to anything
+// else gets 403; an empty list denies every tunnel so forward mode is never an open relay.
+func (proxy *ReverseProxy) SetConnectAllowlist(destinations []string) {
+	var allowlist []connectDestination
+	for _, destination := range destinations {
+		host, port, err := net.SplitHostPort(strings.TrimSpace(destination))
+		if err != nil || host == "" || port == "" {
+			continue
+		}
+		allowlist = append(allowlist, connectDestination{host: strings.ToLower(host), port: port})
+	}
+	proxy.connectAllowlist = allowlist
+}
+
+// connectAllowed reports whether host:port matches an entry of the CONNECT allowlist.
+func (proxy *ReverseProxy) connectAllowed(host, port string) bool {
+	host = strings.ToLower(host)
+	for _, destination := range proxy.connectAllowlist {
+		if destination.port != "*" && destination.port != port {
+			continue
+		}
+		switch {
+		case destination.host == "*", destination.host == host:
+			return true
+		case strings.HasPrefix(destination.host, "*.") && strings.HasSuffix(host, destination.host[1:]):
+			return true
+		}
+	}
+	return false
+}
+
+// forwardOrigin returns the origin stashed for a forward-mode request, or nil.
+func forwardOrigin(req *http.Request) *url.URL {
+	origin, _ := req.Context().Value(forwardOriginCtxKey{}).(*url.URL)
+	return origin
+}
+
+// pickTarget chooses the upstream for req: the requested origin in forward mode,
+// otherwise the balancer's choice (peek=true does not advance its state).
+func (proxy *ReverseProxy) pickTarget(req *http.Request, peek bool) *url.URL {
+	if origin := forwardOrigin(req); origin != nil {
+		return origin
+	}
+	return proxy.balancerFor(req).Pick(peek)
+}
+
+// releaseTarget undoes pickTarget's reservation for a request answered without going
+// upstream itself (e.g. a collapsed follower), so least connections does not count it.
+func (proxy *ReverseProxy) releaseTarget(req *http.Request) {
+	if forwardOrigin(req) != nil {
+		return
+	}
+	if upstreamTarget, _ := req.Context().Value(upstreamTargetCtxKey{}).(*url.URL); upstreamTarget != nil {
+		releaseBalancerSelection(proxy.balancerFor(req), upstreamTarget)
+	}
+}
+
+// serveConnect opens a TCP tunnel to the authority named by a CONNECT request and relays
+// bytes in both directions until either side closes. Only allowlisted destinations are
+// dialed.
+func (proxy *ReverseProxy) serveConnect(w http.ResponseWriter, req *http.Request, startTime time.Time) {
+	authority := req.Host
+	host, port, err := net.SplitHostPort(authority)
+	if err != nil {
+		imetrics.ObserveProxyResponse(req.Method, http.StatusBadRequest, "BYPASS", time.Since(startTime))
+		http.Error(w, "CONNECT target must be host:port", http.StatusBadRequest)
+		return
+	}
+	if !proxy.connectAllowed(host, port) {
+		auditDeny(req, applog.AuditMethod, "CONNECT to "+authority+" not allowlisted")
+		imetrics.ObserveProxyResponse(req.Method, http.StatusForbidden, "REJECTED", time.Since(startTime))
+		http.Error(w, "CONNECT destination not allowed", http.StatusForbidden)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		imetrics.ObserveProxyResponse(req.Method, http.StatusInternalServerError, "BYPASS", time.Since(startTime))
+		http.Error(w, "tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+
+	dialer := net.Dialer{Timeout: connectDialTimeout}
+	remoteConn, err := dialer.DialContext(req.Context(), "tcp", authority)
+	if err != nil {
+		errorClass, statusCode := classifyUpstreamError(req.Context(), req.Context(), err)
+		imetrics.UpstreamErrorInc(connectMetricLabel, errorClass)
+		imetrics.ObserveProxyResponse(req.Method, statusCode, "BYPASS", time.Since(startTime))
+		applog.LogProxyError(statusCode, "BYPASS", authority, req, err)
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	defer remoteConn.Close()
+
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		applog.LogProxyError(http.StatusInternalServerError, "BYPASS", authority, req, err)
+		return
+	}
+	defer clientConn.Close()
+
+	if _, err := clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return
+	}
+	imetrics.ObserveProxyResponse(req.Method, http.StatusOK, "BYPASS", time.Since(startTime))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		// Bytes the client sent right after the CONNECT line are already buffered.
+		_, _ = io.Copy(remoteConn, clientBuf)
+		closeWrite(remoteConn)
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(clientConn, remoteConn)
+		closeWrite(clientConn)
+	}()
+	wg.Wait()
+}
+
+// closeWrite half-closes TCP connections so the peer sees EOF while replies can still arrive.
+func closeWrite(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.CloseWrite()
+		return
+	}
+	_ = conn.Close()
+}
+
+// errOriginFormInForwardMode is returned for origin-form targets when acting as a forward proxy.
+var errOriginFormInForwardMode = errors.New("forward proxy requires an absolute-URI request target")
+
+// withForwardOrigin records the origin of an absolute-URI request in the context.
+func withForwardOrigin(req *http.Request, origin *url.URL) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), forwardOriginCtxKey{}, origin))
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	applog "traefik-challenge-2/internal/log"
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+// isGRPCRequest reports whether the request is a gRPC call (application/grpc, application/grpc+proto, ...).
+func isGRPCRequest(req *http.Request) bool {
+	return strings.HasPrefix(strings.ToLower(req.Header.Get("Content-Type")), "application/grpc")
+}
+
+// newGRPCTransport returns a transport that speaks HTTP/2 end-to-end:
+// h2c (prior knowledge) for http:// upstreams and negotiated h2 for https:// upstreams.
+func newGRPCTransport() *http.Transport {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		Protocols:           protocols,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+}
+
+// serveGRPC streams a gRPC call to the upstream and relays the response body and trailers
+// (grpc-status/grpc-message) as they arrive. gRPC responses are never buffered or cached.
+func (proxy *ReverseProxy) serveGRPC(w http.ResponseWriter, req *http.Request, upstreamTarget *url.URL, startTime time.Time) {
+	releaseFunc := proxy.balancerFor(req).Acquire(upstreamTarget)
+	defer releaseFunc()
+
+	outboundReq := req.Clone(req.Context())
+	proxy.directRequest(outboundReq, upstreamTarget)
+	// gRPC requires "TE: trailers" end-to-end even though TE is otherwise hop-by-hop.
+	outboundReq.Header.Set("Te", "trailers")
+
+	imetrics.IncProxyUpstreamInflight(targetMetricLabel(req, upstreamTarget))
+	defer imetrics.DecProxyUpstreamInflight(targetMetricLabel(req, upstreamTarget))
+
+	upstreamResp, err := proxy.grpcTransport.RoundTrip(outboundReq)
+	if err != nil {
+		// Same classification, metrics, outlier accounting and error body as other upstream failures.
+		errorClass, statusCode := classifyUpstreamError(req.Context(), req.Context(), err)
+		statusCode = proxy.upstreamErrorStatus(errorClass, statusCode)
+		imetrics.UpstreamErrorInc(targetMetricLabel(req, upstreamTarget), errorClass)
+		imetrics.ObserveProxyUpstreamResponse(targetMetricLabel(req, upstreamTarget), req.Method, statusCode, time.Since(startTime))
+		if statusCode != http.StatusRequestTimeout {
+			proxy.recordUpstreamOutcome(req, upstreamTarget, true, time.Since(startTime))
+		}
+		proxy.writeError(w, req, &UpstreamError{Target: upstreamTarget.Host, Class: errorClass, Status: statusCode, Err: err})
+		return
+	}
+	defer upstreamResp.Body.Close()
+	proxy.recordUpstreamOutcome(req, upstreamTarget, upstreamResp.StatusCode >= http.StatusInternalServerError, time.Since(startTime))
+
+	copyHeader(w.Header(), sanitizeResponseHeaders(upstreamResp.Header))
+	w.Header().Set("X-Cache", "BYPASS")
+	proxy.stripClientHeaders(w.Header())
+	w.WriteHeader(upstreamResp.StatusCode)
+
+	// gRPC messages are flushed as soon as they are written.
+	if _, err := proxy.copyStream(w, upstreamResp.Body, 0); err != nil && err != io.EOF {
+		applog.LogProxyError(http.StatusBadGateway, "BYPASS", upstreamTarget.Host, req, err)
+	}
+
+	// Trailers are populated once the body has been fully read; relay them via TrailerPrefix.
+	for trailerName, trailerValues := range upstreamResp.Trailer {
+		for _, trailerValue := range trailerValues {
+			w.Header().Add(http.TrailerPrefix+trailerName, trailerValue)
+		}
+	}
+
+	imetrics.ObserveProxyUpstreamResponse(proxy.upstreamMetricLabel(req, upstreamResp.Header, upstreamTarget), req.Method, upstreamResp.StatusCode, time.Since(startTime))
+	imetrics.ObserveProxyResponse(req.Method, upstreamResp.StatusCode, "BYPASS", time.Since(startTime))
+}
@@ -1,11 +1,21 @@
 package proxy
 
 import (
+	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"sort"
 	"strings"
 )
 
+// Forwarding header modes accepted by SetForwardedHeaderMode.
+const (
+	ForwardedModeLegacy  = "legacy"  // X-Forwarded-For/Proto/Host only (default)
+	ForwardedModeRFC7239 = "rfc7239" // standardized Forwarded header only
+	ForwardedModeBoth    = "both"    // emit both header families
+)
+
 // Adds back missing helper used by directRequest.
 func schemeOf(req *http.Request) string {
 	if req.TLS != nil {
@@ -17,6 +27,55 @@ func schemeOf(req *http.Request) string {
 	return "http"
 }
 
+// clientIPFromRequest returns the client IP taken from the connection's remote address.
+func clientIPFromRequest(req *http.Request) string {
+	clientIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	return clientIP
+}
+
+// appendForwardedElement appends a "for=...;proto=...;host=..." element to any
+// existing Forwarded chain (RFC 7239), keeping earlier hops intact.
+func appendForwardedElement(header http.Header, clientIP, proto, host string) {
+	pairs := make([]string, 0, 3)
+	if clientIP != "" {
+		node := clientIP
+		if strings.Contains(clientIP, ":") {
+			// IPv6 addresses must be bracketed and quoted.
+			node = "[" + clientIP + "]"
+		}
+		pairs = append(pairs, "for="+quoteForwardedValue(node))
+	}
+	if proto != "" {
+		pairs = append(pairs, "proto="+quoteForwardedValue(proto))
+	}
+	if host != "" {
+		pairs = append(pairs, "host="+quoteForwardedValue(host))
+	}
+	if len(pairs) == 0 {
+		return
+	}
+	element := strings.Join(pairs, ";")
+	if existing := strings.Join(header.Values("Forwarded"), ", "); existing != "" {
+		element = existing + ", " + element
+	}
+	header.Set("Forwarded", element)
+}
+
+// quoteForwardedValue quotes a Forwarded parameter value unless it is a plain token.
+func quoteForwardedValue(value string) string {
+	for _, r := range value {
+		isToken := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+		if !isToken {
+			return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+		}
+	}
+	return value
+}
+
 // Copies headers from the source to the destination.
 func copyHeader(dst, src http.Header) {
 	for k, vv := range src {
@@ -60,6 +119,28 @@ func singleJoiningSlash(a, b string) string {
 	}
 }
 
+// joinURLPath joins the target and request paths on both their decoded and escaped
+// forms so encoded characters in the request path survive unchanged. The returned
+// RawPath is empty when the escaped form is just the default encoding of Path.
+func joinURLPath(target, requestURL *url.URL) (path, rawPath string) {
+	if target.RawPath == "" && requestURL.RawPath == "" {
+		return singleJoiningSlash(target.Path, requestURL.Path), ""
+	}
+	// Same joining rules as singleJoiningSlash, applied to the escaped paths.
+	escapedTarget := target.EscapedPath()
+	escapedRequest := requestURL.EscapedPath()
+	targetSlash := strings.HasSuffix(escapedTarget, "/")
+	requestSlash := strings.HasPrefix(escapedRequest, "/")
+	switch {
+	case targetSlash && requestSlash:
+		return target.Path + requestURL.Path[1:], escapedTarget + escapedRequest[1:]
+	case !targetSlash && !requestSlash:
+		return target.Path + "/" + requestURL.Path, escapedTarget + "/" + escapedRequest
+	default:
+		return target.Path + requestURL.Path, escapedTarget + escapedRequest
+	}
+}
+
 // SetAllowedMethods configures which HTTP methods are permitted (empty slice => allow all).
 func (proxy *ReverseProxy) SetAllowedMethods(methods []string) {
 	if len(methods) == 0 {
@@ -73,6 +154,125 @@ func (proxy *ReverseProxy) SetAllowedMethods(methods []string) {
 	proxy.allowedMethods = allowed
 }
 
+// SetForwardedHeaderMode selects which forwarding headers are sent upstream:
+// "legacy" (X-Forwarded-*), "rfc7239" (Forwarded) or "both". Unknown values fall back to legacy.
+func (proxy *ReverseProxy) SetForwardedHeaderMode(mode string) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case ForwardedModeRFC7239:
+		proxy.forwardedHeaderMode = ForwardedModeRFC7239
+	case ForwardedModeBoth:
+		proxy.forwardedHeaderMode = ForwardedModeBoth
+	default:
+		proxy.forwardedHeaderMode = ForwardedModeLegacy
+	}
+}
+
+// SetStripResponseHeaders configures extra response headers (beyond hop-by-hop) that are
+// removed before responding to clients, e.g. X-Powered-By or the internal X-Upstream.
+func (proxy *ReverseProxy) SetStripResponseHeaders(names []string) {
+	stripped := make([]string, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			stripped = append(stripped, http.CanonicalHeaderKey(name))
+		}
+	}
+	proxy.stripResponseHeaders = stripped
+}
+
+// stripClientHeaders removes the configured headers from a client-bound header map.
+// It returns a header view that still holds them so logs/metrics keep e.g. X-Upstream.
+func (proxy *ReverseProxy) stripClientHeaders(clientHeader http.Header) http.Header {
+	if len(proxy.stripResponseHeaders) == 0 {
+		return clientHeader
+	}
+	logHeader := clientHeader.Clone()
+	for _, name := range proxy.stripResponseHeaders {
+		clientHeader.Del(name)
+	}
+	return logHeader
+}
+
+// SetMethodHandling controls proxy-level handling of special methods: when handleOptions
+// is set, "OPTIONS *" is answered by the proxy with the allowed methods; when blockTrace is
+// set, TRACE is rejected with 405 instead of being forwarded (it can leak request headers).
+func (proxy *ReverseProxy) SetMethodHandling(handleOptions, blockTrace bool) {
+	proxy.handleOptions = handleOptions
+	proxy.blockTrace = blockTrace
+}
+
+// standardMethods is advertised for "OPTIONS *" when no allowlist is configured.
+var standardMethods = []string{
+	http.MethodConnect, http.MethodDelete, http.MethodGet, http.MethodHead,
+	http.MethodOptions, http.MethodPatch, http.MethodPost, http.MethodPut, http.MethodTrace,
+}
+
+// defaultAllowedSchemes are the schemes accepted in absolute-form request targets.
+func defaultAllowedSchemes() map[string]struct{} {
+	return map[string]struct{}{"http": {}, "https": {}}
+}
+
+// SetAllowedSchemes sets which schemes an absolute-form request target
+// ("GET http://host/path") may use; others are rejected with 400. Empty keeps http/https.
+func (proxy *ReverseProxy) SetAllowedSchemes(schemes []string) {
+	allowed := make(map[string]struct{}, len(schemes))
+	for _, scheme := range schemes {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+			allowed[scheme] = struct{}{}
+		}
+	}
+	if len(allowed) == 0 {
+		allowed = defaultAllowedSchemes()
+	}
+	proxy.allowedSchemes = allowed
+}
+
+// normalizeRequestTarget validates the request target form. Absolute-form targets with an
+// allowed scheme are reduced to origin-form (the host already lives in req.Host), so cache
+// keys and upstream URLs do not depend on how the client spelled the target. The asterisk
+// form is only valid for OPTIONS. In forward mode the target must be absolute-form and its
+// origin is recorded on the returned request.
+func (proxy *ReverseProxy) normalizeRequestTarget(req *http.Request) (*http.Request, error) {
+	if req.RequestURI == "*" && req.Method != http.MethodOptions {
+		return req, fmt.Errorf("asterisk request target is only valid for OPTIONS")
+	}
+	if !req.URL.IsAbs() {
+		if proxy.forwardMode && req.RequestURI != "*" {
+			return req, errOriginFormInForwardMode
+		}
+		return req, nil
+	}
+	scheme := strings.ToLower(req.URL.Scheme)
+	if _, allowed := proxy.allowedSchemes[scheme]; !allowed {
+		return req, fmt.Errorf("request scheme %q not allowed", req.URL.Scheme)
+	}
+	if proxy.forwardMode {
+		req = withForwardOrigin(req, &url.URL{Scheme: scheme, Host: req.URL.Host})
+	}
+	req.URL.Scheme = ""
+	req.URL.Host = ""
+	return req, nil
+}
+
+// advertisedMethods lists the methods the proxy accepts, for Allow headers.
+func (proxy *ReverseProxy) advertisedMethods() []string {
+	methods := proxy.listAllowedMethods()
+	if methods == nil {
+		methods = standardMethods
+	}
+	advertised := make([]string, 0, len(methods))
+	for _, method := range methods {
+		if proxy.blockTrace && method == http.MethodTrace {
+			continue
+		}
+		// CONNECT is rejected unless tunneling in forward mode.
+		if method == http.MethodConnect && !proxy.forwardMode {
+			continue
+		}
+		advertised = append(advertised, method)
+	}
+	return advertised
+}
+
 // listAllowedMethods returns a sorted slice (used for Allow header).
 func (proxy *ReverseProxy) listAllowedMethods() []string {
 	if proxy.allowedMethods == nil {
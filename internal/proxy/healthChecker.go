@@ -1,15 +1,37 @@
 package proxy
 
 import (
+	"context"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// healthProbeHTTPClient is a shared HTTP client for health probes with a short timeout.
+// healthProbeHTTPClient is a shared HTTP client for health probes; each probe bounds
+// itself with its own context deadline (healthProbeTimeout).
+var healthProbeHTTPClient = &http.Client{}
 
-var healthProbeHTTPClient = &http.Client{
-	Timeout: 500 * time.Millisecond,
+const defaultHealthProbeTimeout = 500 * time.Millisecond
+
+// healthProbeTimeout is the per-probe deadline in nanoseconds. Probes run on background
+// monitor goroutines, so it is read and written atomically.
+var healthProbeTimeout atomic.Int64
+
+func init() {
+	healthProbeTimeout.Store(int64(defaultHealthProbeTimeout))
+}
+
+// SetHealthProbeTimeout sets the deadline of each health probe, so a /healthz that is slow
+// to answer cannot stall probing. The body is never read: only the status decides health.
+// timeout <= 0 restores the default (500ms).
+func SetHealthProbeTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultHealthProbeTimeout
+	}
+	healthProbeTimeout.Store(int64(timeout))
 }
 
 func isTargetHealthy(targetURL *url.URL) bool {
@@ -23,7 +45,9 @@ func isTargetHealthy(targetURL *url.URL) bool {
 		Host:   targetURL.Host,
 		Path:   "/healthz",
 	}
-	healthRequest, err := http.NewRequest("GET", healthURL.String(), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(healthProbeTimeout.Load()))
+	defer cancel()
+	healthRequest, err := http.NewRequestWithContext(ctx, "GET", healthURL.String(), nil)
 	if err != nil {
 		return false
 	}
@@ -34,7 +58,135 @@ func isTargetHealthy(targetURL *url.URL) bool {
 	if err != nil {
 		return false
 	}
+	// The body is closed unread (the connection is not reused).
 	defer healthResponse.Body.Close()
 	// Consider 2xx/3xx as healthy.
 	return healthResponse.StatusCode >= 200 && healthResponse.StatusCode < 400
 }
+
+// healthMonitor probes every target in the background and caches the results, so the
+// balancer does not probe on the request path. Each target runs on its own schedule,
+// offset by a random jitter, so probes of many targets do not fire in lockstep.
+type healthMonitor struct {
+	interval time.Duration
+	jitter   time.Duration
+	probe    healthProbe
+	stop     chan struct{}
+	slots    chan struct{} // bounds probes in flight (nil = unbounded)
+
+	mu     sync.RWMutex
+	status map[string]bool // keyed by target URL string
+}
+
+// newHealthMonitor starts probing targets every interval, each probe shifted by a random
+// amount within jitter (jitter is capped at interval), with at most concurrency probes in
+// flight (<= 0 = unbounded).
+func newHealthMonitor(targets []*url.URL, interval, jitter time.Duration, concurrency int, probe healthProbe) *healthMonitor {
+	monitor := &healthMonitor{
+		interval: interval,
+		jitter:   min(max(jitter, 0), interval),
+		probe:    probe,
+		stop:     make(chan struct{}),
+		status:   make(map[string]bool, len(targets)),
+	}
+	if concurrency > 0 {
+		monitor.slots = make(chan struct{}, concurrency)
+	}
+	for _, target := range targets {
+		go monitor.watch(target)
+	}
+	return monitor
+}
+
+// randomDuration returns a uniformly distributed duration in [0, limit).
+func randomDuration(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(limit)))
+}
+
+// watch probes one target until the monitor is closed: first after a random offset within
+// jitter, then every interval give or take half the jitter.
+func (monitor *healthMonitor) watch(target *url.URL) {
+	timer := time.NewTimer(randomDuration(monitor.jitter))
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if monitor.slots != nil {
+				select {
+				case monitor.slots <- struct{}{}:
+				case <-monitor.stop:
+					return
+				}
+			}
+			healthy := monitor.probe(target)
+			if monitor.slots != nil {
+				<-monitor.slots
+			}
+			monitor.mu.Lock()
+			monitor.status[target.String()] = healthy
+			monitor.mu.Unlock()
+			timer.Reset(monitor.interval - monitor.jitter/2 + randomDuration(monitor.jitter))
+		case <-monitor.stop:
+			return
+		}
+	}
+}
+
+// healthy returns the last probe result for target, probing synchronously when the
+// target has not been checked yet.
+func (monitor *healthMonitor) healthy(target *url.URL) bool {
+	monitor.mu.RLock()
+	healthy, known := monitor.status[target.String()]
+	monitor.mu.RUnlock()
+	if known {
+		return healthy
+	}
+	return monitor.probe(target)
+}
+
+// close stops all probe loops.
+func (monitor *healthMonitor) close() {
+	close(monitor.stop)
+}
+
+// SetHealthCheckSchedule moves health probes off the request path: every target (backups
+// included) is probed in the background every interval, with each probe shifted randomly
+// within jitter to spread load on shared health endpoints. interval <= 0 keeps on-demand
+// probes at pick time.
+func (proxy *ReverseProxy) SetHealthCheckSchedule(interval, jitter time.Duration) {
+	proxy.healthCheckInterval = max(interval, 0)
+	proxy.healthCheckJitter = max(jitter, 0)
+	proxy.rebuildBalancer()
+}
+
+// SetHealthCheckConcurrency caps how many background health probes run at once so a large
+// fleet is not probed in one burst. limit <= 0 means unbounded.
+func (proxy *ReverseProxy) SetHealthCheckConcurrency(limit int) {
+	proxy.healthCheckConcurrency = max(limit, 0)
+	proxy.rebuildBalancer()
+}
+
+// allTargets lists every configured target: primaries, backups, then client network pools.
+func (proxy *ReverseProxy) allTargets() []*url.URL {
+	targets := append(append([]*url.URL{}, proxy.targets...), proxy.backupTargets...)
+	for _, pool := range proxy.networkPools {
+		targets = append(targets, pool.targets...)
+	}
+	return targets
+}
+
+// restartHealthMonitor replaces the background checker to match the current targets and
+// schedule (stopping it when disabled).
+func (proxy *ReverseProxy) restartHealthMonitor() {
+	if proxy.healthMonitor != nil {
+		proxy.healthMonitor.close()
+		proxy.healthMonitor = nil
+	}
+	if proxy.healthCheckInterval <= 0 || !proxy.healthChecksEnabled {
+		return
+	}
+	proxy.healthMonitor = newHealthMonitor(proxy.allTargets(), proxy.healthCheckInterval, proxy.healthCheckJitter, proxy.healthCheckConcurrency, isTargetHealthy)
+}
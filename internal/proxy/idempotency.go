@@ -0,0 +1,271 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	applog "traefik-challenge-2/internal/log"
+)
+
+const (
+	// defaultIdempotencyWindow is how long a completed response stays replayable when no window is configured.
+	defaultIdempotencyWindow = 10 * time.Second
+	// defaultSharedFetchTimeout bounds a shared (collapsed or idempotent) upstream call when no
+	// request timeout applies, since it no longer ends with the client that started it.
+	defaultSharedFetchTimeout = 30 * time.Second
+)
+
+// errFingerprintMismatch reports a key reused for a different request (another body).
+var errFingerprintMismatch = errors.New("key reused with a different request")
+
+// sharedFetchCtxKey marks the context of a shared upstream call, whose budget must not
+// come from whichever client happened to start it.
+type sharedFetchCtxKey struct{}
+
+// capturedResponse is a fully buffered response that can be replayed to several clients.
+type capturedResponse struct {
+	header     http.Header
+	statusCode int
+	body       []byte
+}
+
+// responseCapture is a minimal http.ResponseWriter that buffers status, headers and body.
+type responseCapture struct {
+	header     http.Header
+	statusCode int
+	body       []byte
+}
+
+func newResponseCapture() *responseCapture {
+	return &responseCapture{header: make(http.Header)}
+}
+
+func (capture *responseCapture) Header() http.Header { return capture.header }
+
+func (capture *responseCapture) WriteHeader(code int) {
+	if capture.statusCode == 0 {
+		capture.statusCode = code
+	}
+}
+
+func (capture *responseCapture) Write(b []byte) (int, error) {
+	if capture.statusCode == 0 {
+		capture.statusCode = http.StatusOK
+	}
+	capture.body = append(capture.body, b...)
+	return len(b), nil
+}
+
+// result freezes the captured response so it can be shared safely.
+func (capture *responseCapture) result() *capturedResponse {
+	statusCode := capture.statusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	return &capturedResponse{header: capture.header.Clone(), statusCode: statusCode, body: capture.body}
+}
+
+// writeTo replays the captured response onto a client writer. Captured headers replace
+// any the proxy already set (X-Cache, X-Request-ID) instead of adding a second value.
+func (captured *capturedResponse) writeTo(w http.ResponseWriter) {
+	for name, values := range captured.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(captured.statusCode)
+	_, _ = w.Write(captured.body)
+}
+
+// inflightCall tracks one execution shared by every request with the same key.
+type inflightCall struct {
+	done        chan struct{}
+	response    *capturedResponse
+	fingerprint string // body hash the execution was started with
+}
+
+// inflightGroup coalesces concurrent executions per key and optionally keeps
+// the finished result around for a retain window (so late retries are replayed too).
+type inflightGroup struct {
+	mu     sync.Mutex
+	calls  map[string]*inflightCall
+	retain time.Duration
+}
+
+func newInflightGroup(retain time.Duration) *inflightGroup {
+	return &inflightGroup{calls: make(map[string]*inflightCall), retain: retain}
+}
+
+// do runs execute once per key. Callers arriving while it runs (or within the retain
+// window afterwards) receive the same captured response; shared reports whether the
+// caller was one of those followers. The execution runs on a context detached from the
+// first caller and bounded by fetchTimeout, so a client that goes away does not fail the
+// call for everyone else. Every caller, the first included, stops waiting when its own
+// ctx ends and gets ctx.Err(). A caller whose fingerprint differs from the one the
+// execution started with gets errFingerprintMismatch instead of its response.
+func (group *inflightGroup) do(ctx context.Context, key, fingerprint string, fetchTimeout time.Duration, execute func(context.Context, http.ResponseWriter)) (response *capturedResponse, shared bool, err error) {
+	group.mu.Lock()
+	call, found := group.calls[key]
+	if !found {
+		call = &inflightCall{done: make(chan struct{}), fingerprint: fingerprint}
+		group.calls[key] = call
+		go group.run(ctx, key, call, fetchTimeout, execute)
+	}
+	group.mu.Unlock()
+	if call.fingerprint != fingerprint {
+		return nil, true, errFingerprintMismatch
+	}
+
+	select {
+	case <-call.done:
+		return call.response, found, nil
+	case <-ctx.Done():
+		return nil, found, ctx.Err()
+	}
+}
+
+// run executes call on a detached context and publishes its response. done is closed
+// in a defer so waiters are released even if execute panics (answered as 502).
+func (group *inflightGroup) run(ctx context.Context, key string, call *inflightCall, fetchTimeout time.Duration, execute func(context.Context, http.ResponseWriter)) {
+	capture := newResponseCapture()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			applog.Emit("error", "proxy", map[string]string{"component": "inflight"},
+				fmt.Sprintf("shared upstream call for %s panicked: %v", key, recovered))
+			capture = newResponseCapture()
+			capture.WriteHeader(http.StatusBadGateway)
+		}
+		call.response = capture.result()
+		close(call.done)
+
+		forget := func() {
+			group.mu.Lock()
+			if group.calls[key] == call {
+				delete(group.calls, key)
+			}
+			group.mu.Unlock()
+		}
+		if group.retain > 0 {
+			time.AfterFunc(group.retain, forget)
+		} else {
+			forget()
+		}
+	}()
+
+	fetchCtx, cancel := context.WithTimeout(context.WithValue(context.WithoutCancel(ctx), sharedFetchCtxKey{}, true), fetchTimeout)
+	defer cancel()
+	execute(fetchCtx, capture)
+}
+
+// sharedFetchTimeout returns the bound of a shared upstream call for req: the selected
+// target's request timeout, or defaultSharedFetchTimeout when none is configured.
+func (proxy *ReverseProxy) sharedFetchTimeout(req *http.Request) time.Duration {
+	upstreamTarget, _ := req.Context().Value(upstreamTargetCtxKey{}).(*url.URL)
+	if upstreamTarget != nil {
+		if timeout := proxy.requestTimeoutFor(upstreamTarget); timeout > 0 {
+			return timeout
+		}
+	}
+	return defaultSharedFetchTimeout
+}
+
+// sharedWaitContext bounds how long req waits for a shared upstream call by its own
+// client-requested budget (measured from arrival). The call itself is not shortened.
+func (proxy *ReverseProxy) sharedWaitContext(req *http.Request) (context.Context, context.CancelFunc) {
+	budget := proxy.clientTimeout(req, 0)
+	if budget <= 0 {
+		return context.WithCancel(req.Context())
+	}
+	startTime, _ := req.Context().Value(startTimeCtxKey{}).(time.Time)
+	if startTime.IsZero() {
+		startTime = time.Now()
+	}
+	return context.WithDeadline(req.Context(), startTime.Add(budget))
+}
+
+// writeSharedWaitError answers a client that stopped waiting for a shared upstream call:
+// 504 when its own budget ran out, no body when it went away.
+func (proxy *ReverseProxy) writeSharedWaitError(w http.ResponseWriter, req *http.Request, err error) {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		w.WriteHeader(http.StatusRequestTimeout)
+		return
+	}
+	upstreamHost := ""
+	if upstreamTarget, _ := req.Context().Value(upstreamTargetCtxKey{}).(*url.URL); upstreamTarget != nil {
+		upstreamHost = upstreamTarget.Host
+	}
+	proxy.writeError(w, req, &UpstreamError{Target: upstreamHost, Class: upstreamErrTimeout, Status: http.StatusGatewayTimeout, Err: err})
+}
+
+// SetIdempotency enables de-duplication of unsafe requests carrying an Idempotency-Key header.
+// Concurrent requests with the same key share one upstream execution, and the result is
+// replayed to retries for the given window (non-positive -> 10s).
+func (proxy *ReverseProxy) SetIdempotency(enabled bool, window time.Duration) {
+	if !enabled {
+		proxy.idempotency = nil
+		return
+	}
+	if window <= 0 {
+		window = defaultIdempotencyWindow
+	}
+	proxy.idempotency = newInflightGroup(window)
+}
+
+// idempotencyKeyFor returns the de-duplication key for a request, or "" when the
+// request is not eligible (safe method or no Idempotency-Key header). Keys are scoped to
+// the client (its Authorization credentials, else its IP) so one client can never be
+// replayed another client's response by guessing or reusing its key.
+func idempotencyKeyFor(req *http.Request) string {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return ""
+	}
+	idempotencyKey := strings.TrimSpace(req.Header.Get("Idempotency-Key"))
+	if idempotencyKey == "" {
+		return ""
+	}
+	clientScope := "ip=" + clientIPFromRequest(req)
+	if authorization := req.Header.Get("Authorization"); authorization != "" {
+		sum := sha256.Sum256([]byte(authorization))
+		clientScope = "auth=" + hex.EncodeToString(sum[:])
+	}
+	return req.Method + " " + req.Host + req.URL.RequestURI() + "|" + clientScope + "|ik=" + idempotencyKey
+}
+
+// serveIdempotent forwards the request through the upstream handler at most once per
+// idempotency key and writes the (possibly replayed) response to the client. A key reused
+// with a different body is answered 422; bodies too large to hash are forwarded alone.
+func (proxy *ReverseProxy) serveIdempotent(w http.ResponseWriter, req *http.Request, key string) {
+	bodyHash, err := proxy.hashRequestBody(req)
+	if err != nil {
+		proxy.handler.ServeHTTP(w, req)
+		return
+	}
+	waitCtx, cancel := proxy.sharedWaitContext(req)
+	defer cancel()
+	response, shared, err := proxy.idempotency.do(waitCtx, key, bodyHash, proxy.sharedFetchTimeout(req), func(fetchCtx context.Context, capture http.ResponseWriter) {
+		proxy.handler.ServeHTTP(capture, req.WithContext(fetchCtx))
+	})
+	if shared {
+		// Replays and rejections never go upstream, so their pick is never acquired.
+		proxy.releaseTarget(req)
+	}
+	if errors.Is(err, errFingerprintMismatch) {
+		proxy.writeErrorBody(w, req, http.StatusUnprocessableEntity, "idempotency key reused with a different request body")
+		return
+	}
+	if err != nil {
+		proxy.writeSharedWaitError(w, req, err)
+		return
+	}
+	if shared {
+		w.Header().Set("X-Idempotent-Replay", "true")
+	}
+	response.writeTo(w)
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	applog "traefik-challenge-2/internal/log"
+)
+
+const (
+	defaultKeepaliveMethod = http.MethodHead
+	defaultKeepalivePath   = "/"
+
+	// keepaliveMaxBody bounds how much of a keepalive response is drained so the
+	// connection can return to the pool without reading a large body.
+	keepaliveMaxBody = 4 << 10
+)
+
+// upstreamKeepalive sends a lightweight request to every target each interval through the
+// proxy's own transport, keeping its idle connections warm for bursty traffic. Unlike health
+// probes, results never affect target selection; failures are only logged at debug level.
+type upstreamKeepalive struct {
+	client   *http.Client
+	targets  []*url.URL
+	interval time.Duration
+	method   string
+	path     string
+	stopOnce sync.Once
+	stop     chan struct{}
+	// applyHeaders adds the per-target upstream headers (credentials) a real request would carry.
+	applyHeaders func(*http.Request, *url.URL)
+}
+
+// SetUpstreamKeepalive sends method path to every target (backups and client network pools
+// included) each interval, separately from health checks. The path is joined to the target's
+// base path and the target's upstream headers are applied, as for proxied requests.
+// interval <= 0 disables it; an empty method or path defaults to HEAD /.
+func (proxy *ReverseProxy) SetUpstreamKeepalive(interval time.Duration, method, path string) {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		method = defaultKeepaliveMethod
+	}
+	path = strings.TrimSpace(path)
+	if path == "" {
+		path = defaultKeepalivePath
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	proxy.keepaliveInterval = max(interval, 0)
+	proxy.keepaliveMethod, proxy.keepalivePath = method, path
+	proxy.restartKeepalive()
+}
+
+// restartKeepalive replaces the keepalive loop to match the current targets and settings.
+func (proxy *ReverseProxy) restartKeepalive() {
+	proxy.keepalive.close()
+	proxy.keepalive = nil
+	if proxy.keepaliveInterval <= 0 {
+		return
+	}
+	keepalive := &upstreamKeepalive{
+		client:       &http.Client{Transport: proxy.transport},
+		targets:      proxy.allTargets(),
+		interval:     proxy.keepaliveInterval,
+		method:       proxy.keepaliveMethod,
+		path:         proxy.keepalivePath,
+		stop:         make(chan struct{}),
+		applyHeaders: proxy.applyUpstreamHeaders,
+	}
+	go keepalive.run()
+	proxy.keepalive = keepalive
+}
+
+func (keepalive *upstreamKeepalive) run() {
+	ticker := time.NewTicker(keepalive.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, target := range keepalive.targets {
+				keepalive.ping(target)
+			}
+		case <-keepalive.stop:
+			return
+		}
+	}
+}
+
+// ping sends one keepalive request to target, bounded by the interval.
+func (keepalive *upstreamKeepalive) ping(target *url.URL) {
+	scheme := target.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	pingURL := &url.URL{Scheme: scheme, Host: target.Host, Path: singleJoiningSlash(target.Path, keepalive.path)}
+	ctx, cancel := context.WithTimeout(context.Background(), keepalive.interval)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, keepalive.method, pingURL.String(), nil)
+	if err != nil {
+		return
+	}
+	keepalive.applyHeaders(request, target)
+	response, err := keepalive.client.Do(request)
+	if err != nil {
+		applog.Emit("debug", "proxy", map[string]string{"component": "keepalive"},
+			"upstream keepalive "+keepalive.method+" "+pingURL.String()+" failed: "+err.Error())
+		return
+	}
+	// Drain a bounded amount so the connection goes back to the idle pool.
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, keepaliveMaxBody))
+	_ = response.Body.Close()
+}
+
+// close stops the loop; safe to call more than once and on a nil keepalive.
+func (keepalive *upstreamKeepalive) close() {
+	if keepalive == nil {
+		return
+	}
+	keepalive.stopOnce.Do(func() { close(keepalive.stop) })
+}
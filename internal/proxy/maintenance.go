@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+// defaultMaintenanceMessage is the 503 body used when no message is configured.
+const defaultMaintenanceMessage = "service under maintenance"
+
+// maintenanceMode answers all proxied traffic with 503 while enabled. The flag is flipped at
+// runtime through MaintenanceHandler; the response itself is fixed at startup.
+type maintenanceMode struct {
+	enabled    atomic.Bool
+	retryAfter time.Duration // advertised in Retry-After (0 = header omitted)
+	message    string
+}
+
+// maintenanceStatus is the JSON body accepted and returned by MaintenanceHandler.
+type maintenanceStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+// SetMaintenanceResponse configures the 503 sent while maintenance mode is on. retryAfter is
+// rounded up to whole seconds for Retry-After (<= 0 omits the header); an empty message
+// uses a generic one.
+func (proxy *ReverseProxy) SetMaintenanceResponse(retryAfter time.Duration, message string) {
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	proxy.maintenance.retryAfter = max(retryAfter, 0)
+	proxy.maintenance.message = message
+}
+
+// SetMaintenance turns maintenance mode on or off; safe to call while serving.
+func (proxy *ReverseProxy) SetMaintenance(enabled bool) {
+	proxy.maintenance.enabled.Store(enabled)
+}
+
+// MaintenanceEnabled reports whether maintenance mode is currently on.
+func (proxy *ReverseProxy) MaintenanceEnabled() bool {
+	return proxy.maintenance.enabled.Load()
+}
+
+// serveMaintenance answers a proxied request with the configured maintenance 503.
+func (proxy *ReverseProxy) serveMaintenance(w http.ResponseWriter, req *http.Request, startTime time.Time) {
+	if requestID := getRequestID(req); requestID != "" {
+		w.Header().Set("X-Request-ID", requestID)
+	}
+	setRetryAfter(w.Header(), proxy.maintenance.retryAfter)
+	w.Header().Set("Cache-Control", "no-store")
+	imetrics.ObserveProxyResponse(req.Method, http.StatusServiceUnavailable, "BYPASS", time.Since(startTime))
+	message := proxy.maintenance.message
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	http.Error(w, message, http.StatusServiceUnavailable)
+}
+
+// MaintenanceHandler reports (GET) or toggles (POST {"enabled":true|false}) maintenance mode.
+func (proxy *ReverseProxy) MaintenanceHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var requested maintenanceStatus
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&requested); err != nil {
+				http.Error(w, "invalid body, want {\"enabled\":true|false}", http.StatusBadRequest)
+				return
+			}
+			proxy.SetMaintenance(requested.Enabled)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(maintenanceStatus{Enabled: proxy.MaintenanceEnabled()})
+	})
+}
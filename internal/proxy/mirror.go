@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+const (
+	// Defaults for the shadow-traffic worker pool.
+	defaultMirrorWorkers   = 4
+	defaultMirrorQueueSize = 64
+	// defaultMirrorMaxBodyBytes is the largest request body copied to the mirror by default.
+	defaultMirrorMaxBodyBytes = 1 << 20
+	// mirrorRequestTimeout bounds each shadow request so stuck mirrors free their worker.
+	mirrorRequestTimeout = 5 * time.Second
+)
+
+// mirrorPool sends shadow copies of requests to a mirror target using a fixed number
+// of workers fed by a bounded queue. When the queue is full the copy is dropped, so
+// shadow traffic can never slow down or pile up behind primary serving.
+type mirrorPool struct {
+	target       *url.URL
+	transport    http.RoundTripper
+	maxBodyBytes int64
+	jobs         chan *http.Request
+	stopOnce     sync.Once
+	stop         chan struct{}
+}
+
+func newMirrorPool(target *url.URL, transport http.RoundTripper, workers, queueSize int, maxBodyBytes int64) *mirrorPool {
+	if workers <= 0 {
+		workers = defaultMirrorWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultMirrorQueueSize
+	}
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultMirrorMaxBodyBytes
+	}
+	pool := &mirrorPool{
+		target:       target,
+		transport:    transport,
+		maxBodyBytes: maxBodyBytes,
+		jobs:         make(chan *http.Request, queueSize),
+		stop:         make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		go pool.worker()
+	}
+	return pool
+}
+
+// submit enqueues a prepared mirror request without blocking; it reports false (and
+// counts a drop) when the pool is saturated.
+func (pool *mirrorPool) submit(mirrorReq *http.Request) bool {
+	select {
+	case pool.jobs <- mirrorReq:
+		return true
+	default:
+		imetrics.MirrorDroppedInc()
+		return false
+	}
+}
+
+// worker sends queued mirror requests and discards their responses until the pool is closed.
+func (pool *mirrorPool) worker() {
+	for {
+		select {
+		case mirrorReq := <-pool.jobs:
+			pool.send(mirrorReq)
+		case <-pool.stop:
+			return
+		}
+	}
+}
+
+// send performs one mirror request, bounded by mirrorRequestTimeout.
+func (pool *mirrorPool) send(mirrorReq *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorRequestTimeout)
+	defer cancel()
+	mirrorResp, err := pool.transport.RoundTrip(mirrorReq.WithContext(ctx))
+	if err == nil {
+		_, _ = io.Copy(io.Discard, mirrorResp.Body)
+		mirrorResp.Body.Close()
+	}
+}
+
+// close stops the workers (pending copies are dropped); safe on a nil pool and to repeat.
+func (pool *mirrorPool) close() {
+	if pool == nil {
+		return
+	}
+	pool.stopOnce.Do(func() { close(pool.stop) })
+}
+
+// SetMirror enables shadow traffic: every proxied request is also sent to target by a
+// bounded worker pool (workers/queueSize <= 0 use defaults). Requests whose body exceeds
+// maxBodyBytes (<= 0 -> 1 MiB) are not mirrored. A nil target disables mirroring; the
+// previous pool's workers are stopped either way.
+func (proxy *ReverseProxy) SetMirror(target *url.URL, workers, queueSize int, maxBodyBytes int64) {
+	proxy.mirror.close()
+	if target == nil {
+		proxy.mirror = nil
+		return
+	}
+	proxy.mirror = newMirrorPool(target, proxy.transport, workers, queueSize, maxBodyBytes)
+}
+
+// mirrorRequest prepares a detached copy of req (with its own body buffer) and hands
+// it to the mirror pool. The original request body is restored for primary serving.
+// Bodies above the pool's limit are never buffered whole: the request is not mirrored.
+func (proxy *ReverseProxy) mirrorRequest(req *http.Request) {
+	var bodyBytes []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		maxBodyBytes := proxy.mirror.maxBodyBytes
+		if req.ContentLength > maxBodyBytes {
+			return
+		}
+		// Read one byte past the cap so an oversize body of unknown length is detected.
+		readBytes, err := io.ReadAll(io.LimitReader(req.Body, maxBodyBytes+1))
+		if err != nil {
+			return
+		}
+		if int64(len(readBytes)) > maxBodyBytes {
+			// Replay the bytes already read, then stream the rest from the client.
+			req.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(readBytes), req.Body), req.Body}
+			return
+		}
+		bodyBytes = readBytes
+		req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	}
+
+	mirrorReq := req.Clone(context.Background())
+	mirrorReq.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	mirrorReq.ContentLength = int64(len(bodyBytes))
+	proxy.directRequest(mirrorReq, proxy.mirror.target)
+	proxy.mirror.submit(mirrorReq)
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SetRewriteMountedPaths makes targets with a path (e.g. http://backend/svc) behave as if
+// mounted at the client's root: requests are already forwarded under the target path
+// (/x -> /svc/x), and with this enabled responses get the prefix stripped again from
+// Location (/svc/y -> /y; absolute URLs on the target host become client-relative) and
+// from Set-Cookie Path attributes. Targets without a path are unaffected.
+func (proxy *ReverseProxy) SetRewriteMountedPaths(enabled bool) {
+	proxy.rewriteMountedPaths = enabled
+}
+
+// rewriteMountedResponse strips upstreamTarget's path prefix from the redirect and cookie
+// paths in header (in place).
+func (proxy *ReverseProxy) rewriteMountedResponse(header http.Header, upstreamTarget *url.URL) {
+	if !proxy.rewriteMountedPaths {
+		return
+	}
+	prefix := strings.TrimRight(upstreamTarget.Path, "/")
+	if prefix == "" {
+		return
+	}
+	if location := header.Get("Location"); location != "" {
+		if rewritten, ok := unmountLocation(location, prefix, upstreamTarget); ok {
+			header.Set("Location", rewritten)
+		}
+	}
+	if cookies := header.Values("Set-Cookie"); len(cookies) > 0 {
+		header.Del("Set-Cookie")
+		for _, cookie := range cookies {
+			header.Add("Set-Cookie", unmountCookiePath(cookie, prefix))
+		}
+	}
+}
+
+// unmountLocation rewrites a Location pointing into the mount (a path under prefix, or an
+// absolute URL on the target host) to the client-visible path.
+func unmountLocation(location, prefix string, upstreamTarget *url.URL) (string, bool) {
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return "", false
+	}
+	if parsed.IsAbs() || parsed.Host != "" {
+		if !strings.EqualFold(parsed.Host, upstreamTarget.Host) {
+			return "", false
+		}
+		// Drop the upstream origin so the client resolves the path against the proxy.
+		parsed.Scheme, parsed.Host, parsed.User = "", "", nil
+	}
+	if !strings.HasPrefix(parsed.Path, "/") {
+		return "", false
+	}
+	unmounted, ok := stripMountPrefix(parsed.Path, prefix)
+	if !ok {
+		return "", false
+	}
+	parsed.Path, parsed.RawPath = unmounted, ""
+	return parsed.String(), true
+}
+
+// unmountCookiePath strips prefix from the Path attribute of a Set-Cookie value.
+func unmountCookiePath(cookie, prefix string) string {
+	attributes := strings.Split(cookie, ";")
+	for index, attribute := range attributes {
+		name, value, found := strings.Cut(strings.TrimSpace(attribute), "=")
+		if !found || !strings.EqualFold(name, "path") {
+			continue
+		}
+		if unmounted, ok := stripMountPrefix(strings.TrimSpace(value), prefix); ok {
+			attributes[index] = " " + name + "=" + unmounted
+		}
+	}
+	return strings.Join(attributes, ";")
+}
+
+// stripMountPrefix maps prefix itself to "/" and prefix+"/rest" to "/rest".
+func stripMountPrefix(path, prefix string) (string, bool) {
+	if path == prefix {
+		return "/", true
+	}
+	if strings.HasPrefix(path, prefix+"/") {
+		return path[len(prefix):], true
+	}
+	return "", false
+}
@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+// defaultMaxEjectionPercent caps passive ejection at half of the targets.
+const defaultMaxEjectionPercent = 50
+
+// outlierDetector passively ejects targets that fail consecutiveFailures requests in a row
+// (transport errors or 5xx) for ejectionTime, without waiting for a health probe. At most
+// maxEjectionPercent of poolSize targets are ejected at once.
+type outlierDetector struct {
+	consecutiveFailures int
+	ejectionTime        time.Duration
+	maxEjectionPercent  int
+
+	mu       sync.Mutex
+	poolSize int                      // distinct targets the proxy balances over
+	targets  map[string]*outlierState // keyed by target URL string
+}
+
+// outlierState tracks one target's failure streak and ejection history.
+type outlierState struct {
+	failures     int
+	ejectedUntil time.Time
+	ejections    int64
+}
+
+// SetOutlierDetection ejects a target from balancing for ejectionTime after
+// consecutiveFailures failed requests in a row (transport errors or 5xx responses).
+// Ejection applies even when active health checks are off. No more than
+// maxEjectionPercent of the targets are ejected at once (rounded down, so a single target
+// is never ejected below 100); only at 100 can every target go and the backup pool (if any)
+// take over. maxEjectionPercent <= 0 or > 100 uses 50; consecutiveFailures <= 0 disables it.
+func (proxy *ReverseProxy) SetOutlierDetection(consecutiveFailures int, ejectionTime time.Duration, maxEjectionPercent int) {
+	if maxEjectionPercent <= 0 || maxEjectionPercent > 100 {
+		maxEjectionPercent = defaultMaxEjectionPercent
+	}
+	if consecutiveFailures <= 0 || ejectionTime <= 0 {
+		proxy.outliers = nil
+	} else {
+		proxy.outliers = &outlierDetector{
+			consecutiveFailures: consecutiveFailures,
+			ejectionTime:        ejectionTime,
+			maxEjectionPercent:  maxEjectionPercent,
+			targets:             make(map[string]*outlierState),
+		}
+	}
+	proxy.rebuildBalancer()
+}
+
+// outlierPoolSize counts the distinct targets outlier detection covers: primaries,
+// backups and client network pools.
+func (proxy *ReverseProxy) outlierPoolSize() int {
+	seen := make(map[string]struct{})
+	count := func(targets []*url.URL) {
+		for _, target := range targets {
+			seen[target.String()] = struct{}{}
+		}
+	}
+	count(proxy.targets)
+	count(proxy.backupTargets)
+	for _, pool := range proxy.networkPools {
+		count(pool.targets)
+	}
+	return len(seen)
+}
+
+// setPoolSize records how many targets the ejection cap is measured against.
+func (detector *outlierDetector) setPoolSize(size int) {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+	detector.poolSize = size
+}
+
+// recordUpstreamOutcome feeds a finished upstream round trip into outlier detection and
+// latency-aware balancers. latency runs up to the response headers, before anything is
+// written to the client. Forward-mode origins are not balanced and are ignored.
+func (proxy *ReverseProxy) recordUpstreamOutcome(req *http.Request, target *url.URL, failed bool, latency time.Duration) {
+	if forwardOrigin(req) != nil {
+		return
+	}
+	observeBalancerLatency(proxy.balancerFor(req), target, latency, failed)
+	if proxy.outliers == nil {
+		return
+	}
+	proxy.outliers.record(target, failed, time.Now())
+}
+
+// record updates target's failure streak and ejects it once the streak reaches the threshold.
+func (detector *outlierDetector) record(target *url.URL, failed bool, now time.Time) {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+	state := detector.targets[target.String()]
+	if state == nil {
+		state = &outlierState{}
+		detector.targets[target.String()] = state
+	}
+	if !failed {
+		state.failures = 0
+		return
+	}
+	state.failures++
+	if state.failures < detector.consecutiveFailures || now.Before(state.ejectedUntil) {
+		return
+	}
+	// Over the cap the target stays in rotation; its streak is kept so it is ejected as
+	// soon as another target returns.
+	if detector.ejectedCount(now) >= detector.poolSize*detector.maxEjectionPercent/100 {
+		return
+	}
+	state.failures = 0
+	state.ejectedUntil = now.Add(detector.ejectionTime)
+	state.ejections++
+	imetrics.UpstreamEjectionInc(target.Host)
+}
+
+// ejectedCount returns how many targets are ejected at now. Callers hold detector.mu.
+func (detector *outlierDetector) ejectedCount(now time.Time) int {
+	ejected := 0
+	for _, state := range detector.targets {
+		if now.Before(state.ejectedUntil) {
+			ejected++
+		}
+	}
+	return ejected
+}
+
+// ejected reports whether target is currently ejected.
+func (detector *outlierDetector) ejected(target *url.URL) bool {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+	state := detector.targets[target.String()]
+	return state != nil && time.Now().Before(state.ejectedUntil)
+}
+
+// snapshot returns a copy of target's state (zero value when never seen).
+func (detector *outlierDetector) snapshot(target *url.URL) outlierState {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+	if state := detector.targets[target.String()]; state != nil {
+		return *state
+	}
+	return outlierState{}
+}
+
+// targetProbe returns how balancers judge targets: background health results or on-demand
+// probes, filtered by passive ejection. nil keeps the balancers' default probe.
+func (proxy *ReverseProxy) targetProbe() healthProbe {
+	var probe healthProbe
+	switch {
+	case proxy.healthMonitor != nil:
+		probe = proxy.healthMonitor.healthy
+	case proxy.healthChecksEnabled:
+		probe = isTargetHealthy
+	}
+	outliers := proxy.outliers
+	if outliers == nil {
+		return probe
+	}
+	return func(target *url.URL) bool {
+		if outliers.ejected(target) {
+			return false
+		}
+		return probe == nil || probe(target)
+	}
+}
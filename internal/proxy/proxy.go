@@ -3,15 +3,14 @@ package proxy
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
-	"fmt"
+	"errors"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	applog "traefik-challenge-2/internal/log"
@@ -23,21 +22,146 @@ type ReverseProxy struct {
 	target *url.URL
 	// All upstream destinations (used by the balancer).
 	targets []*url.URL
+	// Backup destinations used only when every primary target is unavailable.
+	backupTargets []*url.URL
 	// HTTP transport used to communicate with upstreams.
 	transport *http.Transport
+	// HTTP/2-only transport (h2c for http targets) used for gRPC streaming.
+	grpcTransport *http.Transport
 	// Cache implementation (interface) used to store cacheable responses.
 	cache Cache
 	// Global toggle to enable/disable the caching layer.
 	cacheOn bool
+	// Namespace prepended to every cache key (isolates tenants sharing a cache).
+	cacheKeyPrefix string
+	// Sort query parameters in cache keys (the upstream still gets the original order).
+	normalizeQuery bool
+	// Optional caller-supplied keying; replaces buildCacheKey/isCacheableRequest when set.
+	cacheKeyFunc CacheKeyFunc
 	// Handler used for the upstream path; may be wrapped (e.g., by a queue).
 	handler http.Handler
+	// Queue warm-up gate (nil unless the queue has a warm-up window); restarted on purge.
+	warmup *warmupGate
 	// Optional request method allowlist; nil means allow all.
 	allowedMethods map[string]struct{}
 	// Load balancer strategy/instance used to pick/track upstreams.
-	balancer Balancer
+	balancer   Balancer
 	lbStrategy string
+	// Pools selected by client network before balancing (first match wins).
+	networkPools []*clientNetworkPool
+	// Passive outlier ejection from request outcomes (nil when disabled).
+	outliers *outlierDetector
 	// Whether active health checks are enabled in the balancer.
 	healthChecksEnabled bool
+	// Background health checking (nil monitor = probe on demand at pick time).
+	healthCheckInterval    time.Duration
+	healthCheckJitter      time.Duration
+	healthCheckConcurrency int
+	healthMonitor          *healthMonitor
+	// Periodic warmup requests to every target (nil = disabled).
+	keepaliveInterval time.Duration
+	keepaliveMethod   string
+	keepalivePath     string
+	keepalive         *upstreamKeepalive
+	// Which forwarding headers are emitted upstream (legacy/rfc7239/both).
+	forwardedHeaderMode string
+	// Extra response headers removed before responding to clients (canonical names).
+	stripResponseHeaders []string
+	// Requests with cookies (outside the neutral allowlist) only use public cache entries.
+	ignoreCookieRequests bool
+	cacheNeutralCookies  map[string]struct{}
+	// Whether HEAD requests may be served from cached GET entries.
+	shareHeadGet bool
+	// Path prefixes whose misses may be served from the query-stripped entry.
+	queryFallbackPaths []string
+	// Whether cache keys include the selected upstream host.
+	perUpstreamKey bool
+	// Debug: echo the computed cache key to clients in X-Cache-Key.
+	exposeCacheKey bool
+	// Debug: add X-Upstream-Response-Time (ms) to responses fetched from an upstream.
+	exposeUpstreamTime bool
+	// Hard limit on serving expired entries (stale-while-revalidate/stale-if-error); 0 = never.
+	maxStale time.Duration
+	// Keys with a background stale-while-revalidate refresh in flight.
+	revalidating sync.Map
+	// Keep percent-encoded path bytes (e.g. %2F) intact when joining with the target path.
+	preserveEncodedPath bool
+	// Strip a target's path prefix from response Location and Set-Cookie paths.
+	rewriteMountedPaths bool
+	// Trailing-slash canonicalization ("" = off, "strip", "add") for cache keys, and
+	// optionally for the forwarded path.
+	trailingSlashMode    string
+	trailingSlashForward bool
+	// Longest accepted request URI (path + query) in bytes; 0 = unlimited.
+	maxURILength int
+	// Gzip compression of client responses (skipped for no-transform).
+	compressionEnabled bool
+	compressionBrotli  bool
+	compressionMinSize int
+	// Store the compressed body negotiated on MISS so HITs are served without re-compressing.
+	storeCompressed bool
+	// Gzip request body decoding and its decoded-size cap.
+	requestDecompress    bool
+	requestDecompressMax int64
+	// Reject request bodies that do not match their Content-MD5/Digest header, and the
+	// largest body buffered to check them.
+	validateContentDigest    bool
+	validateContentDigestMax int64
+	// Caps concurrent body buffering/hashing for cache keys (nil = unlimited).
+	bodyHashSlots chan struct{}
+	// Largest body buffered for cache-key hashing; larger bodies stream uncached (0 = no cap).
+	maxBodyHashBytes int64
+	// Incoming trace headers adopted as X-Request-ID when the client sent none.
+	traceIDHeaders []string
+	// Proxy-generated errors use a JSON envelope instead of plain text.
+	jsonErrors bool
+	// Response header labelling per-upstream metrics and its value allowlist (nil = any value).
+	upstreamLabelHeader  string
+	upstreamLabelAllowed map[string]struct{}
+	// Host allowlist (canonical hosts); nil accepts any Host.
+	allowedHosts map[string]struct{}
+	// Fixed response for "/" when no upstream is available (nil = generic error).
+	rootResponse       http.Handler
+	rootResponseStatus int
+	// Runtime-togglable maintenance 503 for all proxied traffic.
+	maintenance maintenanceMode
+	// End-to-end budget for a request (0 = none) and the header advertising what remains.
+	requestTimeout       time.Duration
+	requestTimeoutHeader string
+	// Client-requested budget header (ms) and its server-side cap (0 = header ignored).
+	clientTimeoutHeader string
+	clientTimeoutMax    time.Duration
+	// Per-target overrides of requestTimeout (rich target config).
+	upstreamTimeouts []upstreamTimeout
+	// Per-target static weights for weighted strategies (rich target config).
+	upstreamWeights []upstreamWeight
+	// Per-target headers injected into outbound requests (rich target config).
+	upstreamHeaders []upstreamHeaderSet
+	// Retry-After on "no upstream" 503s; whether refused connections answer 502 instead of 503.
+	unavailableRetryAfter time.Duration
+	refusedAsBadGateway   bool
+	// "OPTIONS *" answered locally; TRACE rejected instead of forwarded.
+	handleOptions bool
+	blockTrace    bool
+	// Schemes accepted in absolute-form request targets (lower-case).
+	allowedSchemes map[string]struct{}
+	// Explicit forward-proxy mode: CONNECT tunnels and absolute-URI origins.
+	forwardMode bool
+	// Destinations CONNECT may tunnel to (empty denies every tunnel).
+	connectAllowlist []connectDestination
+	// Copy buffer size and max flush latency for streamed responses (SSE, gRPC).
+	streamBufferBytes   int
+	streamFlushInterval time.Duration
+	// Relay unknown-length (chunked) responses that will not be cached without buffering.
+	streamChunked bool
+	// Most upstream body bytes buffered per response; larger bodies are streamed (0 = no cap).
+	maxUpstreamBodyBytes int64
+	// Optional shadow-traffic pool (nil when mirroring is disabled).
+	mirror *mirrorPool
+	// Optional Idempotency-Key de-duplication (nil when disabled).
+	idempotency *inflightGroup
+	// Optional collapsing of identical concurrent GETs (nil when disabled).
+	collapse *collapser
 }
 
 // Creates a new ReverseProxy instance with the specified target, cache, and cache toggle.
@@ -53,18 +177,24 @@ func NewReverseProxy(target *url.URL, cache Cache, cacheOn bool) *ReverseProxy {
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 	proxyInstance := &ReverseProxy{
-		target:    target,
-		targets:   []*url.URL{target},
-		transport: transport,
-		cache:     cache,
-		cacheOn:   cacheOn,
+		target:        target,
+		targets:       []*url.URL{target},
+		transport:     transport,
+		grpcTransport: newGRPCTransport(),
+		cache:         cache,
+		cacheOn:       cacheOn,
 		// defaults
-		lbStrategy:          "rr",
-		healthChecksEnabled: true,
+		lbStrategy:           "rr",
+		healthChecksEnabled:  true,
+		forwardedHeaderMode:  ForwardedModeLegacy,
+		ignoreCookieRequests: true,
+		handleOptions:        true,
+		blockTrace:           true,
+		allowedSchemes:       defaultAllowedSchemes(),
 	}
 	// Default handler (queued wrapper may be added later); upstream only.
 	proxyInstance.handler = http.HandlerFunc(proxyInstance.serveUpstream)
-	proxyInstance.balancer = newBalancer(proxyInstance.lbStrategy, proxyInstance.targets, proxyInstance.healthChecksEnabled)
+	proxyInstance.rebuildBalancer()
 	return proxyInstance
 }
 
@@ -75,20 +205,226 @@ func NewReverseProxyMulti(targets []*url.URL, cache Cache, cacheOn bool) *Revers
 	}
 	proxyInstance := NewReverseProxy(targets[0], cache, cacheOn)
 	proxyInstance.targets = append([]*url.URL{}, targets...)
-	proxyInstance.balancer = newBalancer(proxyInstance.lbStrategy, proxyInstance.targets, proxyInstance.healthChecksEnabled)
+	proxyInstance.rebuildBalancer()
 	return proxyInstance
 }
 
 // Enable bounded queue + concurrency cap by wrapping with queue.WithQueue (only used on upstream path).
 func (proxy *ReverseProxy) WithQueue(cfg QueueConfig) *ReverseProxy {
-	proxy.handler = WithQueue(http.HandlerFunc(proxy.serveUpstream), cfg)
+	proxy.handler, proxy.warmup = newQueueHandler(http.HandlerFunc(proxy.serveUpstream), cfg, proxy.writeError)
 	return proxy
 }
 
+// SetCacheKeyPrefix sets a namespace prepended to every cache key so several proxies
+// (tenants/environments) can share one cache without colliding. A non-empty prefix is
+// followed by "|", so "prod" never matches (or purges) the keys of "prod-eu".
+func (proxy *ReverseProxy) SetCacheKeyPrefix(prefix string) {
+	if prefix != "" {
+		prefix += "|"
+	}
+	proxy.cacheKeyPrefix = prefix
+}
+
+// SetNormalizeQuery makes "?b=2&a=1" and "?a=1&b=2" share a cache entry by sorting query
+// parameters in the cache key. Only the key is affected: the upstream always receives the
+// query exactly as the client sent it, since some backends are order-sensitive.
+func (proxy *ReverseProxy) SetNormalizeQuery(enabled bool) {
+	proxy.normalizeQuery = enabled
+}
+
+// CacheKeyFunc computes the cache key for a request; returning false keeps the request
+// out of the cache (no lookup, no store).
+type CacheKeyFunc func(*http.Request) (string, bool)
+
+// SetCacheKeyFunc replaces the built-in request keying and cacheability rules with keyFunc.
+// The function sees the client-facing host; the key prefix and body hash are still appended
+// around its key, and client no-cache directives are still honored. nil restores the default.
+func (proxy *ReverseProxy) SetCacheKeyFunc(keyFunc CacheKeyFunc) {
+	proxy.cacheKeyFunc = keyFunc
+}
+
+// cacheKeyFor returns the cache key for req and whether the request may use the cache.
+func (proxy *ReverseProxy) cacheKeyFor(req *http.Request) (string, bool) {
+	if proxy.cacheKeyFunc != nil {
+		cacheKey, ok := proxy.cacheKeyFunc(req)
+		if !ok || cacheKey == "" {
+			return "", false
+		}
+		return proxy.cacheKeyPrefix + cacheKey, true
+	}
+	if !isCacheableRequest(req) {
+		return "", false
+	}
+	return buildCacheKey(req, proxy.cacheKeyPrefix, proxy.normalizeQuery), true
+}
+
+// PurgeCache removes this proxy's cached entries. With a key prefix only the
+// prefixed namespace (prefix plus its "|" separator) is removed; otherwise the whole
+// cache is purged.
+func (proxy *ReverseProxy) PurgeCache() {
+	// A purged cache is cold again: restart the queue warm-up window, if configured.
+	if proxy.warmup != nil {
+		proxy.warmup.restart()
+	}
+	if proxy.cacheKeyPrefix != "" {
+		proxy.cache.DeletePrefix(proxy.cacheKeyPrefix)
+		return
+	}
+	proxy.cache.Purge()
+}
+
+// SetRequestTimeout bounds each proxied request (measured from arrival, queue wait included).
+// The remaining budget becomes the outbound context deadline and is advertised in headerName
+// (milliseconds) so backends can shed work early. timeout <= 0 disables it.
+func (proxy *ReverseProxy) SetRequestTimeout(timeout time.Duration, headerName string) {
+	proxy.requestTimeout = max(timeout, 0)
+	proxy.requestTimeoutHeader = strings.TrimSpace(headerName)
+}
+
+// SetClientTimeout lets clients shorten their own budget with headerName (milliseconds,
+// e.g. "X-Request-Timeout-Ms: 250"). Values above maxTimeout are clamped to it and the
+// result never extends the server-side request timeout. maxTimeout <= 0 ignores the header.
+func (proxy *ReverseProxy) SetClientTimeout(headerName string, maxTimeout time.Duration) {
+	proxy.clientTimeoutHeader = strings.TrimSpace(headerName)
+	proxy.clientTimeoutMax = max(maxTimeout, 0)
+}
+
+// clientTimeout combines the client-requested budget of req (clamped to the server cap)
+// with serverTimeout: the shorter one wins, and 0 means no budget at all. Shared upstream
+// calls (collapsed or idempotent) ignore the header of the client that started them.
+func (proxy *ReverseProxy) clientTimeout(req *http.Request, serverTimeout time.Duration) time.Duration {
+	if proxy.clientTimeoutMax <= 0 || proxy.clientTimeoutHeader == "" {
+		return serverTimeout
+	}
+	if shared, _ := req.Context().Value(sharedFetchCtxKey{}).(bool); shared {
+		return serverTimeout
+	}
+	millis, err := strconv.ParseInt(strings.TrimSpace(req.Header.Get(proxy.clientTimeoutHeader)), 10, 64)
+	if err != nil || millis <= 0 {
+		return serverTimeout
+	}
+	requested := proxy.clientTimeoutMax
+	if millis < proxy.clientTimeoutMax.Milliseconds() {
+		requested = time.Duration(millis) * time.Millisecond
+	}
+	if serverTimeout > 0 && serverTimeout < requested {
+		return serverTimeout
+	}
+	return requested
+}
+
+// upstreamTimeout is a request timeout override for one upstream target.
+type upstreamTimeout struct {
+	target  *url.URL
+	timeout time.Duration
+}
+
+// SetUpstreamTimeout overrides the request timeout for one upstream, for backends whose
+// latency profile differs from the rest. timeout <= 0 removes the override so the global
+// request timeout applies again.
+func (proxy *ReverseProxy) SetUpstreamTimeout(target *url.URL, timeout time.Duration) {
+	overrides := make([]upstreamTimeout, 0, len(proxy.upstreamTimeouts)+1)
+	for _, override := range proxy.upstreamTimeouts {
+		if !sameUpstream(override.target, target) {
+			overrides = append(overrides, override)
+		}
+	}
+	if timeout > 0 {
+		overrides = append(overrides, upstreamTimeout{target: target, timeout: timeout})
+	}
+	proxy.upstreamTimeouts = overrides
+}
+
+// requestTimeoutFor returns the timeout applying to requests sent to upstreamTarget.
+func (proxy *ReverseProxy) requestTimeoutFor(upstreamTarget *url.URL) time.Duration {
+	for _, override := range proxy.upstreamTimeouts {
+		if sameUpstream(override.target, upstreamTarget) {
+			return override.timeout
+		}
+	}
+	return proxy.requestTimeout
+}
+
+// SetShareHeadGet lets HEAD requests be answered from cached GET responses (headers only).
+func (proxy *ReverseProxy) SetShareHeadGet(enabled bool) {
+	proxy.shareHeadGet = enabled
+}
+
+// SetPerUpstreamCacheKey folds the selected upstream host into cache keys, for deployments
+// where upstreams serve different content for the same path. Off by default: all upstreams
+// share entries keyed on the client-facing host.
+func (proxy *ReverseProxy) SetPerUpstreamCacheKey(enabled bool) {
+	proxy.perUpstreamKey = enabled
+}
+
+// SetExposeCacheKey makes responses carry the computed cache key (prefix, Vary dimensions,
+// body hash, upstream scope) in an X-Cache-Key header. Debugging aid; keep it off in production.
+func (proxy *ReverseProxy) SetExposeCacheKey(enabled bool) {
+	proxy.exposeCacheKey = enabled
+}
+
+// setCacheKeyHeader writes X-Cache-Key when exposing keys is enabled.
+func (proxy *ReverseProxy) setCacheKeyHeader(w http.ResponseWriter, cacheKey string) {
+	if proxy.exposeCacheKey && cacheKey != "" {
+		w.Header().Set("X-Cache-Key", cacheKey)
+	}
+}
+
+// SetExposeUpstreamTime makes responses fetched from an upstream carry the upstream's
+// response time in whole milliseconds in X-Upstream-Response-Time. Cache hits have none.
+func (proxy *ReverseProxy) SetExposeUpstreamTime(enabled bool) {
+	proxy.exposeUpstreamTime = enabled
+}
+
+// setUpstreamTimeHeader writes X-Upstream-Response-Time when exposing it is enabled.
+func (proxy *ReverseProxy) setUpstreamTimeHeader(w http.ResponseWriter, upstreamDuration time.Duration) {
+	if proxy.exposeUpstreamTime {
+		w.Header().Set("X-Upstream-Response-Time", strconv.FormatInt(upstreamDuration.Milliseconds(), 10))
+	}
+}
+
+// upstreamScopedKey appends the client network pool serving req (pools route to different
+// backends) and, when per-upstream keys are enabled, the upstream host to cacheKey.
+func (proxy *ReverseProxy) upstreamScopedKey(req *http.Request, cacheKey string, upstreamTarget *url.URL) string {
+	if pool := proxy.networkPoolFor(req); pool != nil {
+		cacheKey += "|pool=" + pool.cacheScope
+	}
+	if !proxy.perUpstreamKey || upstreamTarget == nil {
+		return cacheKey
+	}
+	return cacheKey + "|up=" + upstreamTarget.Host
+}
+
+// SetPreserveEncodedPath forwards the request path with its original percent-encoding
+// (e.g. %2F stays %2F) instead of re-encoding the decoded path.
+func (proxy *ReverseProxy) SetPreserveEncodedPath(enabled bool) {
+	proxy.preserveEncodedPath = enabled
+}
+
+// SetMaxURILength rejects requests whose URI (path plus query) exceeds maxLength bytes
+// with 414 before any cache or upstream work. maxLength <= 0 disables the limit.
+func (proxy *ReverseProxy) SetMaxURILength(maxLength int) {
+	proxy.maxURILength = max(maxLength, 0)
+}
+
+// requestURILength returns the length of the request URI as received (path + query).
+func requestURILength(req *http.Request) int {
+	if req.RequestURI != "" {
+		return len(req.RequestURI)
+	}
+	return len(req.URL.RequestURI())
+}
+
 // Handles incoming HTTP requests and routes them to the appropriate target.
 // Flow:
+//   - Default X-Cache to BYPASS
+//   - Reject overlong URIs (414)
 //   - Special-case /healthz
+//   - Reject hosts outside allowed_hosts (421)
+//   - Answer 503 while maintenance mode is on
+//   - Reject TRACE / answer "OPTIONS *" locally (configurable)
 //   - Enforce allowed methods (405)
+//   - Stream gRPC calls (never cached)
 //   - Optionally compute a cache key and try to serve a HIT
 //   - Select upstream; if none healthy -> 503
 //   - Forward upstream (queued handler may wrap); observe/log/optionally cache
@@ -96,9 +432,26 @@ func (proxy *ReverseProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// Record the start time for end-to-end latency metrics and logging.
 	startTime := time.Now()
 	req = req.WithContext(context.WithValue(req.Context(), startTimeCtxKey{}, startTime))
+	// Reuse the caller's trace ID (B3, X-Amzn-Trace-Id, ...) as the request ID when configured.
+	proxy.adoptTraceID(req)
+	// Every response reports a cache outcome: BYPASS unless a cache path (HIT/MISS/STALE)
+	// overrides it, so error and rejection paths are never missing X-Cache.
+	w.Header().Set("X-Cache", "BYPASS")
+
+	// Overlong URIs are rejected before they reach cache keys, logs, or upstreams.
+	if proxy.maxURILength > 0 && requestURILength(req) > proxy.maxURILength {
+		if requestID := getRequestID(req); requestID != "" {
+			w.Header().Set("X-Request-ID", requestID)
+		}
+		imetrics.ObserveProxyResponse(req.Method, http.StatusRequestURITooLong, "BYPASS", time.Since(startTime))
+		http.Error(w, "uri too long", http.StatusRequestURITooLong)
+		return
+	}
 
 	// Health check endpoint (bypass queue, cache, and upstream).
 	if req.URL.Path == "/healthz" {
+		// The proxy's own liveness answer has no cache outcome.
+		w.Header().Del("X-Cache")
 		if requestID := getRequestID(req); requestID != "" {
 			w.Header().Set("X-Request-ID", requestID)
 		}
@@ -107,117 +460,234 @@ func (proxy *ReverseProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Enforce allowed methods (after health check).
+	// Host allowlist: checked before the Host can reach cache keys or upstreams.
+	if !proxy.hostAllowed(req) {
+		proxy.rejectMisdirected(w, req, startTime)
+		return
+	}
+
+	// Maintenance mode: everything except the health check gets the configured 503.
+	if proxy.maintenance.enabled.Load() {
+		proxy.serveMaintenance(w, req, startTime)
+		return
+	}
+
+	// TRACE reflects the request (including credentials) back; reject it unless allowed.
+	if proxy.blockTrace && req.Method == http.MethodTrace {
+		proxy.rejectDisallowedMethod(w, req, startTime)
+		return
+	}
+
+	// CONNECT asks for a forward-proxy tunnel, which only forward mode provides; the method
+	// allowlist applies to it like to any other method.
+	if req.Method == http.MethodConnect {
+		_, connectListed := proxy.allowedMethods[http.MethodConnect]
+		if proxy.forwardMode && (proxy.allowedMethods == nil || connectListed) {
+			proxy.serveConnect(w, req, startTime)
+			return
+		}
+		proxy.rejectDisallowedMethod(w, req, startTime)
+		return
+	}
+
+	// Only origin-form targets are forwarded; absolute-form is accepted for allowed schemes.
+	req, err := proxy.normalizeRequestTarget(req)
+	if err != nil {
+		if requestID := getRequestID(req); requestID != "" {
+			w.Header().Set("X-Request-ID", requestID)
+		}
+		imetrics.ObserveProxyResponse(req.Method, http.StatusBadRequest, "BYPASS", time.Since(startTime))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Canonical trailing slash for the forwarded path too (cache keys are normalized below).
+	if proxy.trailingSlashForward {
+		proxy.normalizeTrailingSlash(req)
+	}
+
+	// "OPTIONS *" asks about the server itself, not a resource: answer it here.
+	if proxy.handleOptions && req.Method == http.MethodOptions && (req.RequestURI == "*" || req.URL.Path == "*") {
+		w.Header().Set("Allow", strings.Join(proxy.advertisedMethods(), ", "))
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusOK)
+		imetrics.ObserveProxyResponse(req.Method, http.StatusOK, "BYPASS", time.Since(startTime))
+		return
+	}
+
+	// Enforce allowed methods (after health check). The allowlist governs what is forwarded
+	// upstream: with share_head_get a disallowed HEAD may still be answered from a cached GET
+	// and is only refused when it would have to go upstream.
+	headFromCacheOnly := false
 	if proxy.allowedMethods != nil {
 		if _, ok := proxy.allowedMethods[req.Method]; !ok {
-			if allow := proxy.listAllowedMethods(); len(allow) > 0 {
-				w.Header().Set("Allow", strings.Join(allow, ", "))
+			if req.Method != http.MethodHead || !proxy.shareHeadGet || !proxy.cacheOn {
+				proxy.rejectDisallowedMethod(w, req, startTime)
+				return
 			}
+			headFromCacheOnly = true
+		}
+	}
+
+	// Check client checksums against the body as sent (before any gzip decoding).
+	if proxy.validateContentDigest && hasContentDigest(req.Header) {
+		if status, err := proxy.verifyContentDigest(req); err != nil {
 			if requestID := getRequestID(req); requestID != "" {
 				w.Header().Set("X-Request-ID", requestID)
 			}
-			imetrics.ObserveProxyResponse(req.Method, http.StatusMethodNotAllowed, "BYPASS", time.Since(startTime))
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			imetrics.ObserveProxyResponse(req.Method, status, "BYPASS", time.Since(startTime))
+			applog.LogProxyError(status, "BYPASS", "", req, err)
+			http.Error(w, err.Error(), status)
 			return
 		}
 	}
 
-	// Pre-select a target to build upstream-shaped cache keys consistently.
-	selectedTarget := proxy.balancer.Pick(true)
+	// Decode gzip request bodies before they are hashed for the cache or forwarded.
+	if proxy.requestDecompress && hasGzipContentEncoding(req.Header) {
+		if status, err := proxy.decompressRequestBody(req); err != nil {
+			if requestID := getRequestID(req); requestID != "" {
+				w.Header().Set("X-Request-ID", requestID)
+			}
+			imetrics.ObserveProxyResponse(req.Method, status, "BYPASS", time.Since(startTime))
+			applog.LogProxyError(status, "BYPASS", "", req, err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
 
+	// gRPC calls are streamed end-to-end over HTTP/2 and never cached.
+	if isGRPCRequest(req) {
+		upstreamTarget := proxy.pickTarget(req, false)
+		if upstreamTarget == nil {
+			proxy.writeError(w, req, ErrNoUpstream)
+			return
+		}
+		w.Header().Set("X-Request-ID", ensureRequestID(req))
+		applog.LogProxyRequest(req)
+		proxy.serveGRPC(w, req, upstreamTarget, startTime)
+		return
+	}
+
+	// Without a cache there is nothing to key or look up: skip the preview pick, body
+	// hashing and request clone, and pick the upstream once below.
 	if proxy.cacheOn && req != nil {
+		// Pre-select a target to build upstream-shaped cache keys consistently.
+		selectedTarget := proxy.pickTarget(req, true)
+
 		// Read & buffer body (if any) so it can be hashed and reused downstream.
-		var bodyHash string
-		if req.Body != nil {
-			if bodyBytes, err := io.ReadAll(req.Body); err == nil {
-				if len(bodyBytes) > 0 {
-					sum := sha256.Sum256(bodyBytes)
-					bodyHash = hex.EncodeToString(sum[:])
-				}
-				// Restore body for further handling
-				req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-			}
+		keyBuildStart := time.Now()
+		bodyHash, err := proxy.hashRequestBody(req)
+		if errors.Is(err, errBodyHashAbandoned) {
+			// Client went away while waiting for a hashing slot.
+			imetrics.ObserveProxyResponse(req.Method, http.StatusServiceUnavailable, "BYPASS", time.Since(startTime))
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
 		}
+		// Bodies above max_body_hash_bytes cannot be keyed, so their requests skip the cache.
+		bodyHashed := err == nil
 
 		// Clone for cache key calculation and upstream URL rewriting.
 		cacheProbeReq := req.Clone(req.Context())
 		if selectedTarget != nil {
 			proxy.directRequest(cacheProbeReq, selectedTarget)
 		}
+		proxy.normalizeTrailingSlash(cacheProbeReq)
 
-		if isCacheableRequest(cacheProbeReq) && !clientNoCache(cacheProbeReq) {
-			// Build cache key based on client-facing URL/host so different upstreams share cache objects.
-			originalClientHost := req.Host
-			upstreamReqHost := cacheProbeReq.Host
-			upstreamURLHost := cacheProbeReq.URL.Host
-			cacheProbeReq.Host = originalClientHost
-			cacheProbeReq.URL.Host = originalClientHost
-			cacheKey := buildCacheKey(cacheProbeReq)
-			// Restore upstream host fields for any later use.
-			cacheProbeReq.Host = upstreamReqHost
-			cacheProbeReq.URL.Host = upstreamURLHost
+		// Build cache key based on client-facing URL/host so different upstreams share cache objects.
+		originalClientHost := req.Host
+		upstreamReqHost := cacheProbeReq.Host
+		upstreamURLHost := cacheProbeReq.URL.Host
+		cacheProbeReq.Host = originalClientHost
+		cacheProbeReq.URL.Host = originalClientHost
+		cacheKey, cacheable := proxy.cacheKeyFor(cacheProbeReq)
+		fallbackKey := proxy.queryFallbackKey(cacheProbeReq, req.URL.Path)
+		// Restore upstream host fields for any later use.
+		cacheProbeReq.Host = upstreamReqHost
+		cacheProbeReq.URL.Host = upstreamURLHost
+		imetrics.ObserveCacheKeyBuild(time.Since(keyBuildStart))
 
+		if cacheable && bodyHashed && !clientNoCache(cacheProbeReq) {
 			if bodyHash != "" {
 				cacheKey += "|bh=" + bodyHash
 			}
-			// Stash key in context for reuse on MISS.
+			// Stash key in context for reuse on MISS (scoped to the actual upstream there).
 			req = req.WithContext(context.WithValue(req.Context(), cacheKeyCtxKey{}, cacheKey))
+			cacheKey = proxy.upstreamScopedKey(req, cacheKey, selectedTarget)
 
 			// Attempt a cache HIT.
-			if cachedEntry, found, isStale := proxy.cache.Get(cacheKey); found && !isStale {
-				// Prefer the original request ID that produced this cache entry.
-				requestID := strings.TrimSpace(cachedEntry.RequestID)
-				if requestID == "" {
-					requestID = ensureRequestID(req)
-				} else {
-					req.Header.Set("X-Request-ID", requestID)
+			if cachedEntry, found, isStale := proxy.cache.Get(cacheKey); found && proxy.cookiesPermitCache(req, cachedEntry.Header) {
+				if !isStale {
+					// A fresh entry that expires before the client's min-fresh is treated as a MISS.
+					if freshFor(cachedEntry, time.Now()) >= clientMinFresh(req) {
+						proxy.setCacheKeyHeader(w, cacheKey)
+						proxy.serveCacheHit(w, req, cachedEntry, startTime, false)
+						return
+					}
+				} else if proxy.canServeStale(cachedEntry, staleWhileRevalidate, time.Now()) {
+					// Expired but within stale-while-revalidate (and max_stale): answer now, refresh behind.
+					proxy.revalidateInBackground(req, cacheKey)
+					imetrics.StaleServedInc(staleWhileRevalidate)
+					proxy.setCacheKeyHeader(w, cacheKey)
+					proxy.serveCachedEntry(w, req, cachedEntry, startTime, false, "STALE")
+					return
+				} else if proxy.canServeClientStale(req, cachedEntry, time.Now()) {
+					// The client accepts this much staleness (max-stale): answer without revalidating.
+					imetrics.StaleServedInc(requestMaxStale)
+					proxy.setCacheKeyHeader(w, cacheKey)
+					proxy.serveCachedEntry(w, req, cachedEntry, startTime, false, "STALE")
+					return
 				}
-				w.Header().Set("X-Request-ID", requestID)
+			}
 
-				// Log cache hit
-				applog.LogProxyRequestCacheHit(req)
+			// HEAD may be answered from a stored GET entry (headers only).
+			// Custom key functions define their own key layout, so the mapping only applies to built-in keys.
+			if proxy.shareHeadGet && req.Method == http.MethodHead && proxy.cacheKeyFunc == nil {
+				getCacheKey := headToGetCacheKey(cacheKey, proxy.cacheKeyPrefix)
+				if cachedEntry, found, isStale := proxy.cache.Get(getCacheKey); found && !isStale && proxy.cookiesPermitCache(req, cachedEntry.Header) &&
+					freshFor(cachedEntry, time.Now()) >= clientMinFresh(req) {
+					proxy.setCacheKeyHeader(w, getCacheKey)
+					proxy.serveCacheHit(w, req, cachedEntry, startTime, true)
+					return
+				}
+			}
 
-				// Write cached response
-				copyHeader(w.Header(), cachedEntry.Header)
-				w.Header().Set("X-Cache", "HIT")
-				ageSeconds := int(time.Since(cachedEntry.StoredAt).Seconds())
-				if ageSeconds < 0 {
-					ageSeconds = 0
+			// On configured paths, a miss may be answered by the entry stored without the query.
+			if fallbackKey != "" {
+				if bodyHash != "" {
+					fallbackKey += "|bh=" + bodyHash
+				}
+				fallbackKey = proxy.upstreamScopedKey(req, fallbackKey, selectedTarget)
+				if cachedEntry, found, isStale := proxy.cache.Get(fallbackKey); found && !isStale && proxy.cookiesPermitCache(req, cachedEntry.Header) &&
+					freshFor(cachedEntry, time.Now()) >= clientMinFresh(req) {
+					proxy.setCacheKeyHeader(w, fallbackKey)
+					proxy.serveCacheHit(w, req, cachedEntry, startTime, false)
+					return
 				}
-				w.Header().Set("Age", strconv.Itoa(ageSeconds))
-
-				w.WriteHeader(cachedEntry.StatusCode)
-				_, _ = w.Write(cachedEntry.Body)
-
-				// Observe HIT metrics
-				imetrics.ObserveProxyResponse(req.Method, cachedEntry.StatusCode, "HIT", time.Since(startTime))
-
-				// Log response
-				applog.LogProxyResponseCacheHit(
-					cachedEntry.StatusCode,
-					len(cachedEntry.Body),
-					time.Since(startTime),
-					w.Header(),
-					req,
-					w,
-					false,
-					"",
-				)
-				return
 			}
 		}
 	}
 
-	// No HIT, advance balancer state to choose actual upstream.
-	selectedTarget = proxy.balancer.Pick(false)
-	if selectedTarget == nil {
-		// No healthy upstreams.
+	// only-if-cached: nothing usable was stored, so answer 504 instead of going upstream.
+	if clientOnlyIfCached(req) {
 		if requestID := getRequestID(req); requestID != "" {
 			w.Header().Set("X-Request-ID", requestID)
 		}
-		imetrics.ObserveProxyResponse(req.Method, http.StatusServiceUnavailable, "BYPASS", time.Since(startTime))
-		applog.LogProxyError(http.StatusServiceUnavailable, "BYPASS", "", req, fmt.Errorf("no healthy upstream targets"))
-		http.Error(w, "no healthy upstream targets", http.StatusServiceUnavailable)
+		w.Header().Set("X-Cache", "MISS")
+		imetrics.ObserveProxyResponse(req.Method, http.StatusGatewayTimeout, "MISS", time.Since(startTime))
+		proxy.writeErrorBody(w, req, http.StatusGatewayTimeout, "no cached response (only-if-cached)")
+		return
+	}
+
+	// A HEAD admitted only for cache lookups must not reach the upstream.
+	if headFromCacheOnly {
+		proxy.rejectDisallowedMethod(w, req, startTime)
+		return
+	}
+
+	// No HIT, advance balancer state to choose actual upstream.
+	selectedTarget := proxy.pickTarget(req, false)
+	if selectedTarget == nil {
+		// No healthy upstreams.
+		proxy.writeError(w, req, ErrNoUpstream)
 		return
 	}
 
@@ -228,11 +698,111 @@ func (proxy *ReverseProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// MISS/BYPASS request log before forwarding upstream.
 	applog.LogProxyRequest(req)
 
+	// Shadow a copy to the mirror target (best effort, never blocks).
+	if proxy.mirror != nil {
+		proxy.mirrorRequest(req)
+	}
+
 	// Store chosen target for reuse by upstream path (and potential queue wrapper).
 	req = req.WithContext(context.WithValue(req.Context(), upstreamTargetCtxKey{}, selectedTarget))
+
+	// Coalesce double-submitted unsafe requests sharing an Idempotency-Key.
+	if proxy.idempotency != nil {
+		if idempotencyKey := idempotencyKeyFor(req); idempotencyKey != "" {
+			proxy.serveIdempotent(w, req, idempotencyKey)
+			return
+		}
+	}
+	// Collapse identical concurrent GETs on allowlisted paths into one upstream call.
+	if proxy.collapse != nil {
+		if collapseKey := proxy.collapseKeyFor(req); collapseKey != "" {
+			proxy.serveCollapsed(w, req, collapseKey)
+			return
+		}
+	}
 	proxy.handler.ServeHTTP(w, req)
 }
 
+// rejectDisallowedMethod answers 405 for methods outside the allowlist, blocked TRACE and
+// CONNECT outside forward mode. The response always carries Allow and X-Request-ID and is
+// counted under the "REJECTED" cache label so it does not inflate BYPASS.
+func (proxy *ReverseProxy) rejectDisallowedMethod(w http.ResponseWriter, req *http.Request, startTime time.Time) {
+	w.Header().Set("Allow", strings.Join(proxy.advertisedMethods(), ", "))
+	w.Header().Set("X-Request-ID", ensureRequestID(req))
+	auditDeny(req, applog.AuditMethod, "method "+req.Method+" not allowed")
+	imetrics.ObserveProxyResponse(req.Method, http.StatusMethodNotAllowed, "REJECTED", time.Since(startTime))
+	proxy.writeErrorBody(w, req, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// serveCacheHit writes a cached response to the client and records HIT logs/metrics.
+// When headersOnly is set (HEAD served from a GET entry) the body is omitted.
+func (proxy *ReverseProxy) serveCacheHit(w http.ResponseWriter, req *http.Request, cachedEntry *CachedResponse, startTime time.Time, headersOnly bool) {
+	proxy.serveCachedEntry(w, req, cachedEntry, startTime, headersOnly, "HIT")
+}
+
+// serveCachedEntry writes a cached response labelled cacheState (HIT or STALE) in
+// X-Cache, metrics and logs.
+func (proxy *ReverseProxy) serveCachedEntry(w http.ResponseWriter, req *http.Request, cachedEntry *CachedResponse, startTime time.Time, headersOnly bool, cacheState string) {
+	// Prefer the original request ID that produced this cache entry.
+	requestID := strings.TrimSpace(cachedEntry.RequestID)
+	if requestID == "" {
+		requestID = ensureRequestID(req)
+	} else {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	w.Header().Set("X-Request-ID", requestID)
+
+	// Log cache hit
+	applog.LogProxyRequestCacheHit(req)
+
+	// Write cached response
+	copyHeader(w.Header(), cachedEntry.Header)
+	w.Header().Set("X-Cache", cacheState)
+	ageSeconds := int(time.Since(cachedEntry.StoredAt).Seconds())
+	if ageSeconds < 0 {
+		ageSeconds = 0
+	}
+	w.Header().Set("Age", strconv.Itoa(ageSeconds))
+
+	statusCode := cachedEntry.StatusCode
+	var clientBody []byte
+	switch {
+	case notModifiedSince(req, cachedEntry):
+		// The client's copy is current: revalidate with headers only.
+		statusCode = http.StatusNotModified
+		w.Header().Del("Content-Length")
+	case headersOnly:
+		// Advertise the GET representation length, as a HEAD response would.
+		if w.Header().Get("Content-Length") == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(cachedEntry.Body)))
+		}
+	default:
+		clientBody = proxy.maybeCompress(req, w.Header(), cachedEntry.StatusCode, cachedEntry.Body)
+	}
+	logHeaders := proxy.stripClientHeaders(w.Header())
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(clientBody)
+	bytesWritten := len(clientBody)
+
+	// Observe HIT/STALE metrics
+	imetrics.ObserveProxyResponse(req.Method, statusCode, cacheState, time.Since(startTime))
+	if cacheState == "HIT" {
+		imetrics.CacheHitServedInc()
+	}
+
+	// Log response
+	applog.LogProxyResponseCacheHit(
+		statusCode,
+		bytesWritten,
+		time.Since(startTime),
+		logHeaders,
+		req,
+		w,
+		false,
+		"",
+	)
+}
+
 // Core upstream path (no cache-hit logic; queue may wrap this).
 // Responsible for: rewriting request, forwarding, collecting metrics, and optionally caching response.
 func (proxy *ReverseProxy) serveUpstream(w http.ResponseWriter, req *http.Request) {
@@ -253,84 +823,131 @@ func (proxy *ReverseProxy) serveUpstream(w http.ResponseWriter, req *http.Reques
 		}
 	}
 	if upstreamTarget == nil {
-		upstreamTarget = proxy.balancer.Pick(false)
+		upstreamTarget = proxy.balancerFor(req).Pick(false)
 	}
 	if upstreamTarget == nil {
-		imetrics.ObserveProxyResponse(req.Method, http.StatusServiceUnavailable, "BYPASS", time.Since(endToEndStart))
-		http.Error(w, "no healthy upstream targets", http.StatusServiceUnavailable)
+		proxy.writeError(w, req, ErrNoUpstream)
 		return
 	}
 
 	// Acquire increments active in-flight counters for the selected upstream.
-	releaseFunc := proxy.balancer.Acquire(upstreamTarget)
+	releaseFunc := proxy.balancerFor(req).Acquire(upstreamTarget)
 	defer releaseFunc()
 
+	// Apply the request budget (measured from ServeHTTP start) to the outbound context.
+	// The selected upstream's own timeout, when configured, replaces the global one; a
+	// client-requested budget may shorten it further.
+	upstreamCtx := ctx
+	requestTimeout := proxy.clientTimeout(req, proxy.requestTimeoutFor(upstreamTarget))
+	if requestTimeout > 0 {
+		var cancel context.CancelFunc
+		upstreamCtx, cancel = context.WithDeadline(ctx, endToEndStart.Add(requestTimeout))
+		defer cancel()
+	}
+
 	// Clone and rewrite the outbound request for the selected upstream.
-	outboundReq := req.Clone(ctx)
+	outboundReq := req.Clone(upstreamCtx)
 	proxy.directRequest(outboundReq, upstreamTarget)
+	if deadline, ok := upstreamCtx.Deadline(); ok && requestTimeout > 0 && proxy.requestTimeoutHeader != "" {
+		// Tell cooperative backends how much of the budget is left.
+		outboundReq.Header.Set(proxy.requestTimeoutHeader, strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 0), 10))
+	}
 
 	// In-flight upstream metric (per target).
-	imetrics.IncProxyUpstreamInflight(upstreamTarget.Host)
-	defer imetrics.DecProxyUpstreamInflight(upstreamTarget.Host)
+	imetrics.IncProxyUpstreamInflight(targetMetricLabel(req, upstreamTarget))
+	defer imetrics.DecProxyUpstreamInflight(targetMetricLabel(req, upstreamTarget))
 
 	// Forward request to upstream
 	upstreamResp, err := proxy.transport.RoundTrip(outboundReq)
 	if err != nil {
-		statusCode := http.StatusBadGateway
-		if ctx.Err() != nil {
-			statusCode = http.StatusRequestTimeout
+		// Distinguish client cancellation, timeouts, refused connections, resets, DNS and TLS failures.
+		errorClass, statusCode := classifyUpstreamError(ctx, upstreamCtx, err)
+		statusCode = proxy.upstreamErrorStatus(errorClass, statusCode)
+		imetrics.UpstreamErrorInc(targetMetricLabel(req, upstreamTarget), errorClass)
+		imetrics.ObserveProxyUpstreamResponse(targetMetricLabel(req, upstreamTarget), req.Method, statusCode, time.Since(upstreamStartTime))
+		// Client cancellations say nothing about the upstream's health.
+		if statusCode != http.StatusRequestTimeout {
+			proxy.recordUpstreamOutcome(req, upstreamTarget, true, time.Since(upstreamStartTime))
 		}
-		imetrics.ObserveProxyUpstreamResponse(upstreamTarget.Host, req.Method, statusCode, time.Since(upstreamStartTime))
-		// Also observe final proxy response (bypass cache)
-		imetrics.ObserveProxyResponse(req.Method, statusCode, "BYPASS", time.Since(endToEndStart))
-
-		applog.LogProxyError(statusCode, "BYPASS", upstreamTarget.Host, req, err)
-
-		select {
-		case <-ctx.Done():
-			w.WriteHeader(http.StatusRequestTimeout)
-		default:
-			http.Error(w, err.Error(), http.StatusBadGateway)
+		// Fall back to an expired entry that allows stale-if-error (bounded by max_stale).
+		if statusCode != http.StatusRequestTimeout && proxy.serveStaleOnError(w, req, upstreamTarget, endToEndStart) {
+			return
 		}
+		proxy.writeError(w, req, &UpstreamError{Target: upstreamTarget.Host, Class: errorClass, Status: statusCode, Err: err})
 		return
 	}
 	defer upstreamResp.Body.Close()
+	proxy.recordUpstreamOutcome(req, upstreamTarget, upstreamResp.StatusCode >= http.StatusInternalServerError, time.Since(upstreamStartTime))
 
-	// Read upstream response entirely (buffer for potential caching).
-	responseBody, readErr := io.ReadAll(upstreamResp.Body)
+	// Server-sent events never complete: relay them as they arrive instead of buffering.
+	if isEventStream(upstreamResp.Header) {
+		proxy.serveStream(w, req, upstreamResp, upstreamTarget, upstreamStartTime, endToEndStart)
+		return
+	}
+	// With chunked passthrough, an unknown-length response that will not be stored (and cannot
+	// be replaced by a stale-if-error entry) keeps its chunked transfer instead of being buffered.
+	if proxy.streamChunked && upstreamResp.ContentLength < 0 &&
+		!(upstreamResp.StatusCode >= http.StatusInternalServerError && proxy.maxStale > 0) {
+		if _, cacheable := proxy.responseCacheTTL(req, outboundReq, upstreamResp.StatusCode, upstreamResp.Header); !cacheable {
+			proxy.serveStream(w, req, upstreamResp, upstreamTarget, upstreamStartTime, endToEndStart)
+			return
+		}
+	}
+
+	// Read upstream response entirely (buffer for potential caching), up to max_upstream_body_bytes.
+	responseBody, readErr := proxy.readUpstreamBody(upstreamResp.Body)
 	if readErr != nil {
-		http.Error(w, readErr.Error(), http.StatusBadGateway)
+		proxy.writeError(w, req, &UpstreamError{Target: upstreamTarget.Host, Class: upstreamErrReset, Status: http.StatusBadGateway, Err: readErr})
+		return
+	}
+	if proxy.maxUpstreamBodyBytes > 0 && int64(len(responseBody)) > proxy.maxUpstreamBodyBytes {
+		// Too large to buffer: nothing has been written yet, so relay what was read and stream the rest.
+		upstreamResp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(responseBody), upstreamResp.Body))
+		proxy.serveStream(w, req, upstreamResp, upstreamTarget, upstreamStartTime, endToEndStart)
 		return
 	}
 
 	// Use raw upstream headers for cacheability/TTL decisions,
 	rawUpstreamHeaders := upstreamResp.Header.Clone()
 	sanitizedHeaders := sanitizeResponseHeaders(rawUpstreamHeaders)
+	proxy.rewriteMountedResponse(sanitizedHeaders, upstreamTarget)
 	statusCode := upstreamResp.StatusCode
 
-	// Determine X-Cache header value
-	isRequestEligibleForCache := proxy.cacheOn && isCacheableRequest(outboundReq) && !clientNoCache(outboundReq)
-	cacheTTL, isCacheableResponse := isCacheableResponse(respWithBody(statusCode, rawUpstreamHeaders))
+	// Upstream server errors may be masked by a stale-if-error entry (bounded by max_stale).
+	if statusCode >= http.StatusInternalServerError && proxy.serveStaleOnError(w, req, upstreamTarget, endToEndStart) {
+		imetrics.ObserveProxyUpstreamResponse(targetMetricLabel(req, upstreamTarget), req.Method, statusCode, time.Since(upstreamStartTime))
+		return
+	}
+
+	// Determine X-Cache header value. Only requests keyed during the lookup phase are stored:
+	// a missing key means the request was not cacheable (or its body was too large to hash).
+	requestCacheKey, _ := req.Context().Value(cacheKeyCtxKey{}).(string)
 	xCacheState := "BYPASS"
-	if isRequestEligibleForCache && isCacheableResponse {
+	cacheTTL, cacheable := proxy.responseCacheTTL(req, outboundReq, statusCode, rawUpstreamHeaders)
+	if cacheable {
 		xCacheState = "MISS"
 	}
 
-	// Write headers and body to the client
+	// Upstream time covers the round trip and reading the body, not writing it to the client.
+	upstreamDuration := time.Since(upstreamStartTime)
+
+	// Write headers and body to the client (compressed when negotiated)
 	copyHeader(w.Header(), sanitizedHeaders)
+	clientBody := proxy.maybeCompress(req, w.Header(), statusCode, responseBody)
 	if _, ok := w.Header()["Content-Length"]; !ok {
-		w.Header().Set("Content-Length", strconv.Itoa(len(responseBody)))
+		w.Header().Set("Content-Length", strconv.Itoa(len(clientBody)))
 	}
 	w.Header().Set("X-Cache", xCacheState)
+	if contextCacheKey, _ := req.Context().Value(cacheKeyCtxKey{}).(string); contextCacheKey != "" {
+		proxy.setCacheKeyHeader(w, proxy.upstreamScopedKey(req, contextCacheKey, upstreamTarget))
+	}
+	proxy.setUpstreamTimeHeader(w, upstreamDuration)
+	logHeaders := proxy.stripClientHeaders(w.Header())
 	w.WriteHeader(statusCode)
-	_, _ = w.Write(responseBody)
+	_, _ = w.Write(clientBody)
 
-	// Per-upstream observation
-	upstreamLabel := rawUpstreamHeaders.Get("X-Upstream")
-	if strings.TrimSpace(upstreamLabel) == "" {
-		upstreamLabel = upstreamTarget.Host
-	}
-	upstreamDuration := time.Since(upstreamStartTime)
+	// Per-upstream observation, labelled by the configured response header (default X-Upstream)
+	upstreamLabel := proxy.upstreamMetricLabel(req, rawUpstreamHeaders, upstreamTarget)
 	imetrics.ObserveProxyUpstreamResponse(upstreamLabel, req.Method, statusCode, upstreamDuration)
 
 	// End-to-end proxy response (MISS or BYPASS)
@@ -341,7 +958,7 @@ func (proxy *ReverseProxy) serveUpstream(w http.ResponseWriter, req *http.Reques
 		statusCode,
 		len(responseBody),
 		upstreamDuration,
-		w.Header(),
+		logHeaders,
 		req,
 		w,
 		false,
@@ -349,45 +966,75 @@ func (proxy *ReverseProxy) serveUpstream(w http.ResponseWriter, req *http.Reques
 	)
 
 	// Cache the response if eligible (on MISS)
-	if isRequestEligibleForCache && isCacheableResponse {
-		// Reuse precomputed key (with body hash) if available
-		cacheKey, _ := req.Context().Value(cacheKeyCtxKey{}).(string)
-		if cacheKey == "" {
-			// Fallback (no body hash) — should rarely happen
-			cacheKey = buildCacheKey(outboundReq)
+	if xCacheState == "MISS" {
+		// Reuse precomputed key (with body hash)
+		cacheKey := proxy.upstreamScopedKey(req, requestCacheKey, upstreamTarget)
+		storedHeader, storedBody := sanitizedHeaders, responseBody
+		if proxy.storeCompressed {
+			storedHeader, storedBody = compressedVariant(sanitizedHeaders, w.Header(), responseBody, clientBody)
 		}
 		proxy.cache.Set(cacheKey, &CachedResponse{
 			StatusCode: statusCode,
-			Header:     sanitizedHeaders,
-			Body:       responseBody,
+			Header:     storedHeader,
+			Body:       storedBody,
 			StoredAt:   time.Now(),
 			RequestID:  getRequestID(req),
 		}, cacheTTL)
 	}
 }
 
+// responseCacheTTL reports whether an upstream response to req may be stored, and its TTL.
+// Only requests keyed during the lookup phase are eligible; response cacheability is only
+// evaluated for requests that may be stored.
+func (proxy *ReverseProxy) responseCacheTTL(req, outboundReq *http.Request, statusCode int, upstreamHeader http.Header) (time.Duration, bool) {
+	requestCacheKey, _ := req.Context().Value(cacheKeyCtxKey{}).(string)
+	if !proxy.cacheOn || requestCacheKey == "" || clientNoCache(outboundReq) || !proxy.cookiesPermitCache(outboundReq, upstreamHeader) {
+		return 0, false
+	}
+	// Responses varying on headers outside the built-in key would let one client's headers
+	// decide what everyone else is served (a custom key function owns its own dimensions).
+	if proxy.cacheKeyFunc == nil && !varyWithinKey(upstreamHeader) {
+		return 0, false
+	}
+	return isCacheableResponse(respWithBody(statusCode, upstreamHeader))
+}
+
 // Rewrites the request URL, path, and hop-by-hop headers before sending to the upstream.
 func (proxy *ReverseProxy) directRequest(outReq *http.Request, upstreamTarget *url.URL) {
 	// Rewrite URL & path
 	outReq.URL.Scheme = upstreamTarget.Scheme
 	outReq.URL.Host = upstreamTarget.Host
-	outReq.URL.Path = singleJoiningSlash(upstreamTarget.Path, outReq.URL.Path)
+	if proxy.preserveEncodedPath {
+		outReq.URL.Path, outReq.URL.RawPath = joinURLPath(upstreamTarget, outReq.URL)
+	} else {
+		outReq.URL.Path = singleJoiningSlash(upstreamTarget.Path, outReq.URL.Path)
+	}
 
 	// Remove hop-by-hop headers (per RFC 7230)
 	for _, hopHeader := range hopHeaders {
 		outReq.Header.Del(hopHeader)
 	}
 
-	// Set X-Forwarded-* headers and Host
-	if clientIP, _, err := net.SplitHostPort(outReq.RemoteAddr); err == nil && clientIP != "" {
-		xff := outReq.Header.Get("X-Forwarded-For")
-		if xff == "" {
-			outReq.Header.Set("X-Forwarded-For", clientIP)
-		} else {
-			outReq.Header.Set("X-Forwarded-For", xff+", "+clientIP)
+	// Headers configured for this target only (e.g. backend auth tokens)
+	proxy.applyUpstreamHeaders(outReq, upstreamTarget)
+
+	// Set X-Forwarded-* and/or Forwarded headers, then Host
+	clientIP := clientIPFromRequest(outReq)
+	proto := schemeOf(outReq)
+	if proxy.forwardedHeaderMode != ForwardedModeRFC7239 {
+		if clientIP != "" {
+			xff := outReq.Header.Get("X-Forwarded-For")
+			if xff == "" {
+				outReq.Header.Set("X-Forwarded-For", clientIP)
+			} else {
+				outReq.Header.Set("X-Forwarded-For", xff+", "+clientIP)
+			}
 		}
+		outReq.Header.Set("X-Forwarded-Proto", proto)
+		outReq.Header.Set("X-Forwarded-Host", outReq.Host)
+	}
+	if proxy.forwardedHeaderMode == ForwardedModeRFC7239 || proxy.forwardedHeaderMode == ForwardedModeBoth {
+		appendForwardedElement(outReq.Header, clientIP, proto, outReq.Host)
 	}
-	outReq.Header.Set("X-Forwarded-Proto", schemeOf(outReq))
-	outReq.Header.Set("X-Forwarded-Host", outReq.Host)
 	outReq.Host = upstreamTarget.Host
 }
@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SetCacheQueryFallback lets requests under the given path prefixes fall back to the entry
+// stored for the same URL without its query string when the exact key misses, so tracking
+// parameters (utm_*, fbclid, ...) that do not change the content still hit the cache.
+// Prefixes match whole segments: "/articles" covers "/articles/1" but not "/articles-private".
+// Only fresh entries are served this way. An empty list disables the fallback.
+func (proxy *ReverseProxy) SetCacheQueryFallback(pathPrefixes []string) {
+	var prefixes []string
+	for _, prefix := range pathPrefixes {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	proxy.queryFallbackPaths = prefixes
+}
+
+// queryFallbackKey returns the query-stripped cache key for probeReq (already keyed on the
+// client-facing host), or "" when clientPath is not configured for the fallback or there is
+// no query to strip. Custom key functions define their own layout, so they never fall back.
+func (proxy *ReverseProxy) queryFallbackKey(probeReq *http.Request, clientPath string) string {
+	if len(proxy.queryFallbackPaths) == 0 || proxy.cacheKeyFunc != nil || probeReq.URL.RawQuery == "" {
+		return ""
+	}
+	for _, prefix := range proxy.queryFallbackPaths {
+		if pathUnderPrefix(clientPath, prefix) {
+			strippedReq := *probeReq
+			strippedURL := *probeReq.URL
+			strippedURL.RawQuery = ""
+			strippedReq.URL = &strippedURL
+			return buildCacheKey(&strippedReq, proxy.cacheKeyPrefix, proxy.normalizeQuery)
+		}
+	}
+	return ""
+}
+
+// pathUnderPrefix reports whether path is prefix or lies below it on a segment boundary.
+func pathUnderPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -2,12 +2,13 @@ package proxy
 
 import (
 	"context"
-	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
+	applog "traefik-challenge-2/internal/log"
 	imetrics "traefik-challenge-2/internal/metrics"
 )
 
@@ -16,19 +17,116 @@ import (
 // - MaxConcurrent: maximum number of requests processed concurrently.
 // - EnqueueTimeout: maximum time a request is allowed to wait before being rejected.
 // - QueueWaitHeader: if true, emits headers with queue/concurrency metadata.
+// - WarmupWindow: how long the concurrency limit ramps up after start or a cache purge (0 = off).
+// - WarmupFraction: share of MaxConcurrent admitted at the start of the window (default 0.1).
+// - MethodLimits: optional per-method concurrency caps, e.g. {"POST": 10}.
 type QueueConfig struct {
 	MaxQueue        int
 	MaxConcurrent   int
 	EnqueueTimeout  time.Duration
 	QueueWaitHeader bool
+	// WarmupWindow: after start (or a cache purge) the concurrency limit starts at
+	// WarmupFraction of MaxConcurrent and ramps linearly to the full limit over this
+	// window, so a cold cache cannot stampede upstreams.
+	WarmupWindow   time.Duration
+	WarmupFraction float64
+	// MethodLimits are enforced before the global slot is acquired, so write-heavy methods
+	// can be held tighter than reads without their waiters starving other methods.
+	// Missing methods are only bound by MaxConcurrent.
+	MethodLimits map[string]int
 }
 
+const (
+	defaultWarmupFraction = 0.1
+	// warmupPollInterval is how often a queued request re-checks the warm-up limit.
+	warmupPollInterval = 5 * time.Millisecond
+)
+
+// warmupGate caps concurrently active requests below MaxConcurrent for a while after
+// the cache went cold, raising the cap linearly until the window has elapsed.
+type warmupGate struct {
+	window        time.Duration
+	baseLimit     int64
+	maxConcurrent int64
+	coldSince     atomic.Int64 // unix nanos of the last start/purge
+	active        atomic.Int64
+}
+
+func newWarmupGate(cfg QueueConfig) *warmupGate {
+	if cfg.WarmupWindow <= 0 {
+		return nil
+	}
+	fraction := cfg.WarmupFraction
+	if fraction <= 0 || fraction > 1 {
+		fraction = defaultWarmupFraction
+	}
+	gate := &warmupGate{
+		window:        cfg.WarmupWindow,
+		baseLimit:     max(1, int64(float64(cfg.MaxConcurrent)*fraction)),
+		maxConcurrent: int64(cfg.MaxConcurrent),
+	}
+	gate.restart()
+	return gate
+}
+
+// restart begins a new warm-up window (cold start or cache purge).
+func (gate *warmupGate) restart() {
+	gate.coldSince.Store(time.Now().UnixNano())
+}
+
+// limit returns the concurrency cap in effect at now.
+func (gate *warmupGate) limit(now time.Time) int64 {
+	elapsed := now.Sub(time.Unix(0, gate.coldSince.Load()))
+	if elapsed >= gate.window {
+		return gate.maxConcurrent
+	}
+	return gate.baseLimit + (gate.maxConcurrent-gate.baseLimit)*int64(elapsed)/int64(gate.window)
+}
+
+// tryAcquire takes an active slot if the current cap allows it.
+func (gate *warmupGate) tryAcquire() bool {
+	for {
+		current := gate.active.Load()
+		if current >= gate.limit(time.Now()) {
+			return false
+		}
+		if gate.active.CompareAndSwap(current, current+1) {
+			return true
+		}
+	}
+}
+
+// acquire waits for a warm-up slot until ctx is done.
+func (gate *warmupGate) acquire(ctx context.Context) bool {
+	for !gate.tryAcquire() {
+		select {
+		case <-time.After(warmupPollInterval):
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+func (gate *warmupGate) release() { gate.active.Add(-1) }
+
 // WithQueue wraps an http.Handler with a bounded waiting queue and a bounded
 // concurrency limiter. Requests first try to enter the queue (bounded by MaxQueue).
 // Once queued, they race to acquire an "active slot" (bounded by MaxConcurrent).
 // While waiting, they can be canceled by the client or rejected after EnqueueTimeout.
 // Metrics are emitted for queue depth, rejections, timeouts, and wait durations.
+// Ordering across connections is not guaranteed, but pipelined HTTP/1.1 requests stay in
+// order: net/http does not start a connection's next request until the handler for the
+// previous one has returned, so they never wait in the queue side by side.
 func WithQueue(next http.Handler, cfg QueueConfig) http.Handler {
+	queueHandler, _ := newQueueHandler(next, cfg, writePlainError)
+	return queueHandler
+}
+
+// newQueueHandler builds the queue handler and returns its warm-up gate (nil when disabled)
+// so the owner can restart the warm-up window, e.g. after a cache purge. Rejections are
+// answered through writeError.
+func newQueueHandler(next http.Handler, cfg QueueConfig, writeError func(http.ResponseWriter, *http.Request, error)) (http.Handler, *warmupGate) {
 	if cfg.MaxQueue <= 0 {
 		cfg.MaxQueue = 1024
 	}
@@ -48,6 +146,17 @@ func WithQueue(next http.Handler, cfg QueueConfig) http.Handler {
 	// queueDepth holds the current number of queued (not active) requests.
 	var queueDepth int64
 
+	// Optional warm-up cap applied on top of MaxConcurrent after a cold start/purge.
+	warmup := newWarmupGate(cfg)
+
+	// Optional per-method semaphores (read-only after construction).
+	methodSlots := make(map[string]chan struct{}, len(cfg.MethodLimits))
+	for method, limit := range cfg.MethodLimits {
+		if limit > 0 {
+			methodSlots[strings.ToUpper(strings.TrimSpace(method))] = make(chan struct{}, limit)
+		}
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		enqueueStart := time.Now()
 
@@ -57,7 +166,8 @@ func WithQueue(next http.Handler, cfg QueueConfig) http.Handler {
 			// Admitted into the queue.
 		default:
 			imetrics.QueueRejectedInc()
-			http.Error(w, "queue full, try again later", http.StatusTooManyRequests)
+			auditDeny(r, applog.AuditRateLimit, "admission queue full")
+			writeError(w, r, ErrQueueFull)
 			return
 		}
 
@@ -80,14 +190,37 @@ func WithQueue(next http.Handler, cfg QueueConfig) http.Handler {
 		acquireCtx, cancelAcquire := context.WithCancel(reqCtx)
 		defer cancelAcquire()
 
+		methodSlotsCh := methodSlots[r.Method]
+
 		activeGrantedCh := make(chan struct{}, 1)
 		go func() {
+			// Wait for the per-method cap first, so a method at its limit never holds a
+			// global or warm-up slot that other methods could use.
+			if methodSlotsCh != nil {
+				select {
+				case methodSlotsCh <- struct{}{}:
+				case <-acquireCtx.Done():
+					return
+				}
+			}
+			releaseMethodSlot := func() {
+				if methodSlotsCh != nil {
+					<-methodSlotsCh
+				}
+			}
 			// Only acquire if not canceled by timeout or client.
 			select {
 			case activeSlotsCh <- struct{}{}:
+				// While warming up, also wait for the reduced cap; give the slots back if abandoned.
+				if warmup != nil && !warmup.acquire(acquireCtx) {
+					<-activeSlotsCh
+					releaseMethodSlot()
+					return
+				}
 				activeGrantedCh <- struct{}{}
 			case <-acquireCtx.Done():
 				// Canceled before acquiring an active slot.
+				releaseMethodSlot()
 			}
 		}()
 
@@ -100,7 +233,7 @@ func WithQueue(next http.Handler, cfg QueueConfig) http.Handler {
 			// Client canceled while waiting in the queue.
 			cancelAcquire()
 			imetrics.QueueWaitObserve(time.Since(enqueueStart))
-			failQueue(w, reqCtx.Err())
+			failQueue(w, r, reqCtx.Err(), writeError)
 			return
 
 		case <-enqueueTimer.C:
@@ -108,7 +241,7 @@ func WithQueue(next http.Handler, cfg QueueConfig) http.Handler {
 			cancelAcquire()
 			imetrics.QueueTimeoutsInc()
 			imetrics.QueueWaitObserve(time.Since(enqueueStart))
-			failQueue(w, context.DeadlineExceeded)
+			failQueue(w, r, context.DeadlineExceeded, writeError)
 			return
 
 		case <-activeGrantedCh:
@@ -123,6 +256,12 @@ func WithQueue(next http.Handler, cfg QueueConfig) http.Handler {
 
 		// Release active slot once request is served.
 		defer func() { <-activeSlotsCh }()
+		if warmup != nil {
+			defer warmup.release()
+		}
+		if methodSlotsCh != nil {
+			defer func() { <-methodSlotsCh }()
+		}
 
 		// Optional observability headers.
 		if cfg.QueueWaitHeader {
@@ -136,15 +275,10 @@ func WithQueue(next http.Handler, cfg QueueConfig) http.Handler {
 		imetrics.QueueWaitObserve(time.Since(enqueueStart))
 
 		next.ServeHTTP(w, r)
-	})
+	}), warmup
 }
 
-// failQueue maps queue wait errors to an HTTP response.
-func failQueue(w http.ResponseWriter, err error) {
-	httpStatus := http.StatusServiceUnavailable
-	errorMsg := "request cancelled while waiting in queue"
-	if errors.Is(err, context.DeadlineExceeded) {
-		errorMsg = "timed out while waiting in queue"
-	}
-	http.Error(w, errorMsg, httpStatus)
+// failQueue answers a request that stopped waiting in the queue (timeout or client cancel).
+func failQueue(w http.ResponseWriter, r *http.Request, err error, writeError func(http.ResponseWriter, *http.Request, error)) {
+	writeError(w, r, queueWaitError(err))
 }
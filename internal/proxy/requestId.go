@@ -26,5 +26,49 @@ func getRequestID(req *http.Request) string {
 	return strings.TrimSpace(req.Header.Get("X-Request-ID"))
 }
 
+// SetTraceIDHeaders lists incoming trace headers (e.g. X-B3-TraceId, X-Amzn-Trace-Id, b3)
+// whose value is adopted as the request ID when the client sent no X-Request-ID. The first
+// header present wins; the trace header itself is forwarded upstream unchanged.
+func (proxy *ReverseProxy) SetTraceIDHeaders(names []string) {
+	headers := make([]string, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			headers = append(headers, http.CanonicalHeaderKey(name))
+		}
+	}
+	proxy.traceIDHeaders = headers
+}
 
+// adoptTraceID copies the first configured trace header into X-Request-ID so logs,
+// responses and upstreams share the caller's correlation ID instead of a generated one.
+func (proxy *ReverseProxy) adoptTraceID(req *http.Request) {
+	if len(proxy.traceIDHeaders) == 0 || getRequestID(req) != "" {
+		return
+	}
+	for _, name := range proxy.traceIDHeaders {
+		if traceID := traceIDFromHeader(name, req.Header.Get(name)); traceID != "" {
+			req.Header.Set("X-Request-ID", traceID)
+			return
+		}
+	}
+}
 
+// traceIDFromHeader extracts the trace ID from a trace header value: the Root field of
+// X-Amzn-Trace-Id ("Root=1-...;Parent=...;Sampled=1"), the first field of single-header
+// B3 ("traceid-spanid-sampled"), or the whole value for anything else.
+func traceIDFromHeader(name, value string) string {
+	value = strings.TrimSpace(value)
+	switch name {
+	case "X-Amzn-Trace-Id":
+		for _, field := range strings.Split(value, ";") {
+			if key, root, found := strings.Cut(strings.TrimSpace(field), "="); found && strings.EqualFold(key, "Root") {
+				return strings.TrimSpace(root)
+			}
+		}
+		return ""
+	case "B3":
+		traceID, _, _ := strings.Cut(value, "-")
+		return traceID
+	}
+	return value
+}
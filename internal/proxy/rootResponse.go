@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+// SetDefaultRootResponse answers requests for "/" with a fixed status and body when no
+// upstream can serve them, instead of the generic "no healthy upstream targets" error, so
+// health checkers and people opening the proxy in a browser get a clear signal. status 0
+// disables it. A static route for "/" still takes precedence (it never reaches the proxy).
+func (proxy *ReverseProxy) SetDefaultRootResponse(status int, contentType, body string) {
+	if status == 0 {
+		proxy.rootResponse = nil
+		return
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType([]byte(body))
+	}
+	proxy.rootResponse = StaticResponse(status, contentType, []byte(body))
+	proxy.rootResponseStatus = status
+}
+
+// serveRootResponse writes the default root response for root requests that found no
+// upstream. It reports false when the response is disabled or req is not for "/".
+func (proxy *ReverseProxy) serveRootResponse(w http.ResponseWriter, req *http.Request) bool {
+	if proxy.rootResponse == nil || req.URL == nil || req.URL.Path != "/" {
+		return false
+	}
+	startTime, _ := req.Context().Value(startTimeCtxKey{}).(time.Time)
+	if startTime.IsZero() {
+		startTime = time.Now()
+	}
+	if requestID := getRequestID(req); requestID != "" {
+		w.Header().Set("X-Request-ID", requestID)
+	}
+	proxy.rootResponse.ServeHTTP(w, req)
+	imetrics.ObserveProxyResponse(req.Method, proxy.rootResponseStatus, "STATIC", time.Since(startTime))
+	return true
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// RouteMatch describes which requests a rule applies to. Empty fields match anything;
+// all non-empty fields must match.
+type RouteMatch struct {
+	Methods    []string // e.g. GET, HEAD (case-insensitive)
+	Host       string   // glob on the request host without port, e.g. "*.example.com"
+	Path       string   // exact path match
+	PathPrefix string   // path prefix match (ignored when Path is set)
+}
+
+// RouteRule dispatches matching requests to the handler registered under Handler.
+type RouteRule struct {
+	Name    string
+	Match   RouteMatch
+	Handler string
+}
+
+// Router evaluates ordered rules (first match wins) and dispatches to named handlers
+// such as the proxy pool or a static responder. Unmatched requests go to the default.
+// Rules and handlers are configured at startup and must not change while serving.
+type Router struct {
+	rules          []RouteRule
+	methodSets     []map[string]struct{}
+	handlers       map[string]http.Handler
+	defaultHandler http.Handler
+}
+
+// NewRouter creates a router that falls through to defaultHandler.
+func NewRouter(defaultHandler http.Handler) *Router {
+	return &Router{
+		handlers:       make(map[string]http.Handler),
+		defaultHandler: defaultHandler,
+	}
+}
+
+// Handle registers a named handler that rules can dispatch to.
+func (router *Router) Handle(name string, handler http.Handler) {
+	router.handlers[name] = handler
+}
+
+// AddRule appends a rule; rules are evaluated in the order they were added.
+// It fails when the handler is unknown or the host glob is malformed.
+func (router *Router) AddRule(rule RouteRule) error {
+	if _, found := router.handlers[rule.Handler]; !found {
+		return fmt.Errorf("router: rule %q references unknown handler %q", rule.Name, rule.Handler)
+	}
+	if rule.Match.Host != "" {
+		if _, err := path.Match(strings.ToLower(rule.Match.Host), ""); err != nil {
+			return fmt.Errorf("router: rule %q has invalid host pattern %q: %w", rule.Name, rule.Match.Host, err)
+		}
+	}
+	var methodSet map[string]struct{}
+	if len(rule.Match.Methods) > 0 {
+		methodSet = make(map[string]struct{}, len(rule.Match.Methods))
+		for _, method := range rule.Match.Methods {
+			methodSet[strings.ToUpper(strings.TrimSpace(method))] = struct{}{}
+		}
+	}
+	router.rules = append(router.rules, rule)
+	router.methodSets = append(router.methodSets, methodSet)
+	return nil
+}
+
+// Match returns the first rule matching req.
+func (router *Router) Match(req *http.Request) (RouteRule, bool) {
+	requestHost := strings.ToLower(req.Host)
+	if host, _, err := net.SplitHostPort(requestHost); err == nil {
+		requestHost = host
+	}
+	for i, rule := range router.rules {
+		if methodSet := router.methodSets[i]; methodSet != nil {
+			if _, found := methodSet[req.Method]; !found {
+				continue
+			}
+		}
+		if rule.Match.Host != "" {
+			if matched, _ := path.Match(strings.ToLower(rule.Match.Host), requestHost); !matched {
+				continue
+			}
+		}
+		switch {
+		case rule.Match.Path != "":
+			if req.URL.Path != rule.Match.Path {
+				continue
+			}
+		case rule.Match.PathPrefix != "":
+			if !strings.HasPrefix(req.URL.Path, rule.Match.PathPrefix) {
+				continue
+			}
+		}
+		return rule, true
+	}
+	return RouteRule{}, false
+}
+
+// ServeHTTP dispatches to the first matching rule's handler, or the default handler.
+func (router *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if rule, found := router.Match(req); found {
+		router.handlers[rule.Handler].ServeHTTP(w, req)
+		return
+	}
+	if router.defaultHandler == nil {
+		http.NotFound(w, req)
+		return
+	}
+	router.defaultHandler.ServeHTTP(w, req)
+}
+
+// StaticResponse returns a handler that always answers with a fixed status, content type
+// and body (body omitted for HEAD), without touching any upstream.
+func StaticResponse(statusCode int, contentType string, body []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(statusCode)
+		if req.Method != http.MethodHead {
+			_, _ = w.Write(body)
+		}
+	})
+}
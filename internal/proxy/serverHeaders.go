@@ -0,0 +1,19 @@
+package proxy
+
+import "net/http"
+
+// serverHeaderValue is the Server header sent on every response.
+const serverHeaderValue = "FCReverseProxy/3.0"
+
+// WithProxyHeaders adds the Server header to every response and, when servedBy is not
+// empty, an X-Served-By header naming the instance that answered (useful behind several
+// replicas).
+func WithProxyHeaders(next http.Handler, servedBy string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", serverHeaderValue)
+		if servedBy != "" {
+			w.Header().Set("X-Served-By", servedBy)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
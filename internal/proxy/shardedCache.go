@@ -0,0 +1,116 @@
+package proxy
+
+import "time"
+
+// shardedLRUCache spreads keys over independent LRU shards, each with its own lock,
+// list and map, so concurrent lookups on different keys do not contend. Capacity and
+// LRU ordering are per shard: the least recently used entry of the key's shard is evicted.
+type shardedLRUCache struct {
+	shards  []*lruCache
+	sweeper *cacheSweeper // one janitor walks every shard; nil when disabled
+}
+
+// NewShardedLRUCache creates a cache of `shards` LRU shards sharing maxEntries between
+// them (shards <= 1 returns the single-lock LRU cache).
+func NewShardedLRUCache(shards, maxEntries int) Cache {
+	return NewShardedLRUCacheWithOptions(shards, LRUCacheOptions{MaxEntries: maxEntries})
+}
+
+// NewShardedLRUCacheWithOptions is NewShardedLRUCache with eviction-pressure reporting;
+// the eviction rate is measured across all shards together.
+func NewShardedLRUCacheWithOptions(shards int, opts LRUCacheOptions) Cache {
+	if shards <= 1 {
+		return NewLRUCacheWithOptions(opts)
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1024
+	}
+	// Round up so the total capacity is never below maxEntries.
+	perShard := max(1, (opts.MaxEntries+shards-1)/shards)
+	pressure := newEvictionPressure(opts)
+	cache := &shardedLRUCache{shards: make([]*lruCache, shards)}
+	for i := range cache.shards {
+		cache.shards[i] = newLRUShard(perShard, pressure)
+		cache.shards[i].setMaxBytesPerKey(opts.MaxBytesPerKey)
+	}
+	cache.sweeper = startCacheSweeper(cache.shards, opts.SweepInterval, opts.SweepRetain)
+	return cache
+}
+
+// shardFor maps a key to its shard with FNV-1a (inlined to avoid allocating per lookup).
+// All variants of a resource hash to the same shard so its byte budget sees all of them.
+func (cache *shardedLRUCache) shardFor(cacheKey string) *lruCache {
+	cacheKey = variantBaseKey(cacheKey)
+	const (
+		fnvOffset32 = 2166136261
+		fnvPrime32  = 16777619
+	)
+	hash := uint32(fnvOffset32)
+	for i := 0; i < len(cacheKey); i++ {
+		hash ^= uint32(cacheKey[i])
+		hash *= fnvPrime32
+	}
+	return cache.shards[hash%uint32(len(cache.shards))]
+}
+
+func (cache *shardedLRUCache) Get(cacheKey string) (*CachedResponse, bool, bool) {
+	return cache.shardFor(cacheKey).Get(cacheKey)
+}
+
+func (cache *shardedLRUCache) Set(cacheKey string, response *CachedResponse, ttl time.Duration) {
+	cache.shardFor(cacheKey).Set(cacheKey, response, ttl)
+}
+
+func (cache *shardedLRUCache) Delete(cacheKey string) {
+	cache.shardFor(cacheKey).Delete(cacheKey)
+}
+
+func (cache *shardedLRUCache) DeletePrefix(prefix string) int {
+	removed := 0
+	for _, shard := range cache.shards {
+		removed += shard.DeletePrefix(prefix)
+	}
+	return removed
+}
+
+func (cache *shardedLRUCache) Purge() {
+	for _, shard := range cache.shards {
+		shard.Purge()
+	}
+}
+
+// Stats sums the statistics of all shards.
+func (cache *shardedLRUCache) Stats() CacheStats {
+	var total CacheStats
+	for _, shard := range cache.shards {
+		shardStats := shard.Stats()
+		total.Entries += shardStats.Entries
+		total.Hits += shardStats.Hits
+		total.Misses += shardStats.Misses
+		total.Stores += shardStats.Stores
+		total.Evictions += shardStats.Evictions
+		total.Expired += shardStats.Expired
+	}
+	return total
+}
+
+// Close stops the background sweeper, if any. The cache stays usable.
+func (cache *shardedLRUCache) Close() error {
+	cache.sweeper.close()
+	return nil
+}
+
+// List pages over the shards in order; entries are most recently used first within
+// each shard, not globally.
+func (cache *shardedLRUCache) List(limit, offset int) ([]CacheEntryInfo, int) {
+	var all []CacheEntryInfo
+	for _, shard := range cache.shards {
+		shardEntries, _ := shard.List(shard.maxEntries, 0)
+		all = append(all, shardEntries...)
+	}
+	total := len(all)
+	if limit <= 0 || offset < 0 || offset >= total {
+		return []CacheEntryInfo{}, total
+	}
+	return all[offset:min(offset+limit, total)], total
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+// Cache-Control extensions (RFC 5861) that let expired entries be served.
+const (
+	staleWhileRevalidate = "stale-while-revalidate"
+	staleIfError         = "stale-if-error"
+)
+
+// requestMaxStale is the client request directive (RFC 9111) accepting expired responses.
+const requestMaxStale = "max-stale"
+
+// SetMaxStale sets the hard limit on how long past expiry a cached entry may still be
+// served under an upstream's stale-while-revalidate / stale-if-error directives, whatever
+// windows those directives grant. 0 disables stale serving.
+func (proxy *ReverseProxy) SetMaxStale(maxStale time.Duration) {
+	proxy.maxStale = max(maxStale, 0)
+}
+
+// staleDirectiveWindow returns the window a stale-* directive in header grants (0 when absent).
+func staleDirectiveWindow(header http.Header, directive string) time.Duration {
+	value, found := parseCacheControl(header.Get("Cache-Control"))[directive]
+	if !found {
+		return 0
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// canServeStale reports whether an expired entry may be served for directive at now:
+// its staleness must fit both the entry's own window and the global max_stale limit.
+func (proxy *ReverseProxy) canServeStale(entry *CachedResponse, directive string, now time.Time) bool {
+	if proxy.maxStale <= 0 || entry == nil {
+		return false
+	}
+	allowance := min(staleDirectiveWindow(entry.Header, directive), proxy.maxStale)
+	return now.Sub(entry.ExpiresAt) <= allowance
+}
+
+// clientStaleTolerance returns how far past expiry the client accepts a response, from its
+// Cache-Control max-stale[=seconds] (a bare max-stale accepts any staleness), and whether
+// the directive was sent at all.
+func clientStaleTolerance(req *http.Request) (time.Duration, bool) {
+	value, found := parseCacheControl(req.Header.Get("Cache-Control"))[requestMaxStale]
+	if !found {
+		return 0, false
+	}
+	if value == "" {
+		return time.Duration(math.MaxInt64), true
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// canServeClientStale reports whether an expired entry may be served to a client that sent
+// max-stale: its staleness must fit the client's tolerance and max_stale, and the upstream
+// must not have required revalidation (must-revalidate / proxy-revalidate).
+func (proxy *ReverseProxy) canServeClientStale(req *http.Request, entry *CachedResponse, now time.Time) bool {
+	if proxy.maxStale <= 0 || entry == nil {
+		return false
+	}
+	tolerance, sent := clientStaleTolerance(req)
+	if !sent {
+		return false
+	}
+	directives := parseCacheControl(entry.Header.Get("Cache-Control"))
+	if _, mustRevalidate := directives["must-revalidate"]; mustRevalidate {
+		return false
+	}
+	if _, proxyRevalidate := directives["proxy-revalidate"]; proxyRevalidate {
+		return false
+	}
+	return now.Sub(entry.ExpiresAt) <= min(tolerance, proxy.maxStale)
+}
+
+// revalidateInBackground refreshes an entry served stale by replaying req upstream.
+// Only one refresh per key runs at a time; its response replaces the entry when cacheable.
+func (proxy *ReverseProxy) revalidateInBackground(req *http.Request, cacheKey string) {
+	if _, running := proxy.revalidating.LoadOrStore(cacheKey, struct{}{}); running {
+		return
+	}
+	// The refresh outlives the client request but keeps its context values (cache key).
+	refreshReq := req.Clone(context.WithoutCancel(req.Context()))
+	go func() {
+		defer proxy.revalidating.Delete(cacheKey)
+		proxy.handler.ServeHTTP(newResponseCapture(), refreshReq)
+	}()
+}
+
+// serveStaleOnError answers from an expired entry when the upstream failed and the entry
+// allows stale-if-error within max_stale. It reports whether a response was written.
+func (proxy *ReverseProxy) serveStaleOnError(w http.ResponseWriter, req *http.Request, upstreamTarget *url.URL, startTime time.Time) bool {
+	if proxy.maxStale <= 0 {
+		return false
+	}
+	cacheKey, _ := req.Context().Value(cacheKeyCtxKey{}).(string)
+	if cacheKey == "" {
+		return false
+	}
+	cacheKey = proxy.upstreamScopedKey(req, cacheKey, upstreamTarget)
+	cachedEntry, found, isStale := proxy.cache.Get(cacheKey)
+	if !found || !isStale || !proxy.canServeStale(cachedEntry, staleIfError, time.Now()) || !proxy.cookiesPermitCache(req, cachedEntry.Header) {
+		return false
+	}
+	imetrics.StaleServedInc(staleIfError)
+	proxy.setCacheKeyHeader(w, cacheKey)
+	proxy.serveCachedEntry(w, req, cachedEntry, startTime, false, "STALE")
+	return true
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultStartupProbeTimeout bounds each per-target reachability probe.
+const defaultStartupProbeTimeout = 2 * time.Second
+
+// StartupProbeResult reports the outcome of probing one target at startup.
+type StartupProbeResult struct {
+	Target     *url.URL
+	Reachable  bool
+	StatusCode int           // status of GET /healthz when reachable
+	Latency    time.Duration // time until the response (or failure)
+	Err        error         // transport error when unreachable
+}
+
+// StartupProbeOptions tunes StartupSelfTestWithOptions.
+type StartupProbeOptions struct {
+	Timeout           time.Duration // per-target probe timeout (default 2s)
+	Concurrency       int           // probes in flight at once (<= 0 = all targets at once)
+	Deadline          time.Duration // budget for the whole self-test (0 = none)
+	RequireOneHealthy bool          // return an error when no target responds
+}
+
+// StartupSelfTest probes GET /healthz on every target once, one target at a time. Any HTTP
+// response counts as reachable. When requireOneHealthy is set and no target is reachable,
+// an error is returned so the caller can fail fast before accepting traffic.
+func StartupSelfTest(targets []*url.URL, timeout time.Duration, requireOneHealthy bool) ([]StartupProbeResult, error) {
+	return StartupSelfTestWithOptions(targets, StartupProbeOptions{Timeout: timeout, Concurrency: 1, RequireOneHealthy: requireOneHealthy})
+}
+
+// StartupSelfTestWithOptions probes every target once with at most opts.Concurrency probes
+// in flight. When opts.Deadline passes, probes still running are abandoned and targets not
+// yet probed are reported unreachable, so a large unreachable fleet cannot hang startup.
+// Results keep the order of targets.
+func StartupSelfTestWithOptions(targets []*url.URL, opts StartupProbeOptions) ([]StartupProbeResult, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultStartupProbeTimeout
+	}
+	probeClient := &http.Client{Timeout: timeout}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 || concurrency > len(targets) {
+		concurrency = max(len(targets), 1)
+	}
+	ctx := context.Background()
+	if opts.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Deadline)
+		defer cancel()
+	}
+
+	results := make([]StartupProbeResult, len(targets))
+	slots := make(chan struct{}, concurrency)
+	var probes sync.WaitGroup
+	for index, target := range targets {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[index] = StartupProbeResult{Target: target, Err: fmt.Errorf("not probed: %w", ctx.Err())}
+			continue
+		}
+		probes.Add(1)
+		go func() {
+			defer probes.Done()
+			defer func() { <-slots }()
+			results[index] = probeTargetOnce(ctx, probeClient, target)
+		}()
+	}
+	probes.Wait()
+
+	reachableCount := 0
+	for _, result := range results {
+		if result.Reachable {
+			reachableCount++
+		}
+	}
+	if opts.RequireOneHealthy && reachableCount == 0 {
+		return results, fmt.Errorf("startup probe: none of %d targets reachable", len(targets))
+	}
+	return results, nil
+}
+
+// probeTargetOnce issues a single GET /healthz against target.
+func probeTargetOnce(ctx context.Context, probeClient *http.Client, target *url.URL) StartupProbeResult {
+	result := StartupProbeResult{Target: target}
+	scheme := target.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	healthURL := &url.URL{Scheme: scheme, Host: target.Host, Path: "/healthz"}
+
+	probeStart := time.Now()
+	probeRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL.String(), nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	probeResponse, err := probeClient.Do(probeRequest)
+	result.Latency = time.Since(probeStart)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer probeResponse.Body.Close()
+	result.Reachable = true
+	result.StatusCode = probeResponse.StatusCode
+	return result
+}
+
+// SummarizeStartupProbe renders a one-line summary of probe results for logs.
+func SummarizeStartupProbe(results []StartupProbeResult) string {
+	reachableCount := 0
+	parts := make([]string, 0, len(results))
+	for _, result := range results {
+		if result.Reachable {
+			reachableCount++
+			parts = append(parts, fmt.Sprintf("%s=up(%d,%s)", result.Target.Host, result.StatusCode, result.Latency.Round(time.Millisecond)))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s=down(%v)", result.Target.Host, result.Err))
+		}
+	}
+	return fmt.Sprintf("startup probe: %d/%d targets reachable [%s]", reachableCount, len(results), strings.Join(parts, " "))
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+// StaticRoute answers a path directly from the proxy with a fixed response. When File is
+// set the body is loaded from disk once at startup (and the content type is inferred from
+// its extension unless ContentType is given).
+type StaticRoute struct {
+	Path        string
+	Status      int // 0 means 200
+	ContentType string
+	Body        string
+	File        string
+}
+
+// NewStaticRouter returns a Router serving routes directly (exact path match) and
+// forwarding everything else to next. When next is a *ReverseProxy, static routes go
+// through its admission checks (allowed_hosts, maintenance mode, TRACE blocking and the
+// method allowlist) before answering. It fails if a route is invalid or its file is unreadable.
+func NewStaticRouter(routes []StaticRoute, next http.Handler) (*Router, error) {
+	router := NewRouter(next)
+	reverseProxy, _ := next.(*ReverseProxy)
+	for i, route := range routes {
+		if !strings.HasPrefix(route.Path, "/") {
+			return nil, fmt.Errorf("static route %d: path %q must start with /", i, route.Path)
+		}
+		statusCode := route.Status
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		if statusCode < 100 || statusCode > 599 {
+			return nil, fmt.Errorf("static route %s: invalid status %d", route.Path, route.Status)
+		}
+
+		body := []byte(route.Body)
+		contentType := route.ContentType
+		if route.File != "" {
+			fileBody, err := os.ReadFile(route.File)
+			if err != nil {
+				return nil, fmt.Errorf("static route %s: %w", route.Path, err)
+			}
+			body = fileBody
+			if contentType == "" {
+				contentType = mime.TypeByExtension(filepath.Ext(route.File))
+			}
+		}
+		if contentType == "" {
+			contentType = http.DetectContentType(body)
+		}
+
+		handlerName := "static:" + route.Path
+		var handler http.Handler = observeStatic(statusCode, StaticResponse(statusCode, contentType, body))
+		if reverseProxy != nil {
+			handler = reverseProxy.admitStatic(handler)
+		}
+		router.Handle(handlerName, handler)
+		if err := router.AddRule(RouteRule{Name: handlerName, Match: RouteMatch{Path: route.Path}, Handler: handlerName}); err != nil {
+			return nil, err
+		}
+	}
+	return router, nil
+}
+
+// admitStatic applies the admission checks ServeHTTP runs before any response is produced,
+// so a static path is not a way around the host allowlist, maintenance mode or the method
+// allowlist.
+func (proxy *ReverseProxy) admitStatic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		startTime := time.Now()
+		if !proxy.hostAllowed(req) {
+			proxy.rejectMisdirected(w, req, startTime)
+			return
+		}
+		if proxy.maintenance.enabled.Load() {
+			proxy.serveMaintenance(w, req, startTime)
+			return
+		}
+		if proxy.blockTrace && req.Method == http.MethodTrace {
+			proxy.rejectDisallowedMethod(w, req, startTime)
+			return
+		}
+		if proxy.allowedMethods != nil {
+			if _, ok := proxy.allowedMethods[req.Method]; !ok {
+				proxy.rejectDisallowedMethod(w, req, startTime)
+				return
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// observeStatic records proxy metrics for responses served without an upstream.
+func observeStatic(statusCode int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		startTime := time.Now()
+		next.ServeHTTP(w, req)
+		imetrics.ObserveProxyResponse(req.Method, statusCode, "STATIC", time.Since(startTime))
+	})
+}
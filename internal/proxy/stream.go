@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	applog "traefik-challenge-2/internal/log"
+	imetrics "traefik-challenge-2/internal/metrics"
+)
+
+// defaultStreamBufferBytes is the copy buffer used when streaming response bodies.
+const defaultStreamBufferBytes = 32 << 10
+
+// SetStreaming configures how streamed responses (server-sent events, gRPC) are relayed:
+// bufferBytes sizes the copy buffer (<= 0 uses 32 KiB) and flushInterval bounds how long
+// written data may sit unflushed (0 flushes after every write).
+func (proxy *ReverseProxy) SetStreaming(bufferBytes int, flushInterval time.Duration) {
+	if bufferBytes <= 0 {
+		bufferBytes = defaultStreamBufferBytes
+	}
+	proxy.streamBufferBytes = bufferBytes
+	proxy.streamFlushInterval = max(flushInterval, 0)
+}
+
+// SetStreamChunked makes upstream responses without Content-Length (chunked) that will not
+// be cached stream to the client with chunked transfer instead of being buffered to
+// compute a Content-Length. Such responses are not compressed by the proxy.
+func (proxy *ReverseProxy) SetStreamChunked(enabled bool) {
+	proxy.streamChunked = enabled
+}
+
+// SetMaxUpstreamBodyBytes caps how much of an upstream body is buffered (for caching or
+// Content-Length). A body growing past the cap is not cached: the bytes read so far and the
+// remainder are streamed to the client with X-Cache: BYPASS. maxBytes <= 0 removes the cap.
+func (proxy *ReverseProxy) SetMaxUpstreamBodyBytes(maxBytes int64) {
+	proxy.maxUpstreamBodyBytes = max(maxBytes, 0)
+}
+
+// readUpstreamBody buffers body, stopping one byte past maxUpstreamBodyBytes (when set) so
+// callers can tell an oversized body from one exactly at the cap.
+func (proxy *ReverseProxy) readUpstreamBody(body io.Reader) ([]byte, error) {
+	if proxy.maxUpstreamBodyBytes <= 0 {
+		return io.ReadAll(body)
+	}
+	return io.ReadAll(io.LimitReader(body, proxy.maxUpstreamBodyBytes+1))
+}
+
+// isEventStream reports whether the upstream answered with server-sent events, which
+// never end on their own and therefore cannot be buffered.
+func isEventStream(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// serveStream relays an upstream response to the client as it arrives instead of
+// buffering it. Streamed responses are never cached.
+func (proxy *ReverseProxy) serveStream(w http.ResponseWriter, req *http.Request, upstreamResp *http.Response, upstreamTarget *url.URL, upstreamStartTime, endToEndStart time.Time) {
+	responseHeaders := sanitizeResponseHeaders(upstreamResp.Header)
+	proxy.rewriteMountedResponse(responseHeaders, upstreamTarget)
+	copyHeader(w.Header(), responseHeaders)
+	w.Header().Set("X-Cache", "BYPASS")
+	// Length is unknown up front; let the server chunk the body.
+	w.Header().Del("Content-Length")
+	// Streams only know the time to the response headers.
+	proxy.setUpstreamTimeHeader(w, time.Since(upstreamStartTime))
+	logHeaders := proxy.stripClientHeaders(w.Header())
+	w.WriteHeader(upstreamResp.StatusCode)
+
+	bytesWritten, err := proxy.copyStream(w, upstreamResp.Body, proxy.streamFlushInterval)
+	if err != nil && err != io.EOF {
+		applog.LogProxyError(upstreamResp.StatusCode, "BYPASS", upstreamTarget.Host, req, err)
+	}
+
+	imetrics.ObserveProxyUpstreamResponse(proxy.upstreamMetricLabel(req, upstreamResp.Header, upstreamTarget), req.Method, upstreamResp.StatusCode, time.Since(upstreamStartTime))
+	imetrics.ObserveProxyResponse(req.Method, upstreamResp.StatusCode, "BYPASS", time.Since(endToEndStart))
+
+	// Access log once the stream has ended, covering its full duration and size.
+	applog.LogProxyResponseCacheHit(
+		upstreamResp.StatusCode,
+		int(bytesWritten),
+		time.Since(upstreamStartTime),
+		logHeaders,
+		req,
+		w,
+		false,
+		"",
+	)
+}
+
+// copyStream copies src to w with the configured buffer size, flushing according to
+// flushInterval (0 = after every write). It returns the bytes written and the first read
+// or write error.
+func (proxy *ReverseProxy) copyStream(w http.ResponseWriter, src io.Reader, flushInterval time.Duration) (int64, error) {
+	bufferBytes := proxy.streamBufferBytes
+	if bufferBytes <= 0 {
+		bufferBytes = defaultStreamBufferBytes
+	}
+	flusher, _ := w.(http.Flusher)
+	var dst io.Writer = w
+	if flusher != nil {
+		latencyWriter := &maxLatencyWriter{dst: w, flusher: flusher, latency: flushInterval}
+		defer latencyWriter.stop()
+		dst = latencyWriter
+	}
+
+	var bytesWritten int64
+	buffer := make([]byte, bufferBytes)
+	for {
+		readCount, readErr := src.Read(buffer)
+		if readCount > 0 {
+			written, writeErr := dst.Write(buffer[:readCount])
+			bytesWritten += int64(written)
+			if writeErr != nil {
+				return bytesWritten, writeErr
+			}
+		}
+		if readErr != nil {
+			return bytesWritten, readErr
+		}
+	}
+}
+
+// maxLatencyWriter flushes written data no later than latency after it was written,
+// so slow trickles (SSE heartbeats) reach the client without a flush per write.
+type maxLatencyWriter struct {
+	dst     io.Writer
+	flusher http.Flusher
+	latency time.Duration
+
+	mu           sync.Mutex // guards dst/flusher and the fields below
+	flushPending bool
+	stopped      bool
+	timer        *time.Timer
+}
+
+func (writer *maxLatencyWriter) Write(p []byte) (int, error) {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	written, err := writer.dst.Write(p)
+	if writer.latency <= 0 {
+		writer.flusher.Flush()
+		return written, err
+	}
+	if writer.flushPending {
+		return written, err
+	}
+	if writer.timer == nil {
+		writer.timer = time.AfterFunc(writer.latency, writer.delayedFlush)
+	} else {
+		writer.timer.Reset(writer.latency)
+	}
+	writer.flushPending = true
+	return written, err
+}
+
+func (writer *maxLatencyWriter) delayedFlush() {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	if !writer.flushPending || writer.stopped {
+		return
+	}
+	writer.flusher.Flush()
+	writer.flushPending = false
+}
+
+// stop flushes anything still pending and disarms the timer.
+func (writer *maxLatencyWriter) stop() {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	if writer.flushPending {
+		writer.flusher.Flush()
+		writer.flushPending = false
+	}
+	writer.stopped = true
+	if writer.timer != nil {
+		writer.timer.Stop()
+	}
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Trailing-slash normalization modes (proxy.normalize_trailing_slash).
+const (
+	TrailingSlashOff   = "off"   // "/a" and "/a/" stay distinct
+	TrailingSlashStrip = "strip" // "/a/" -> "/a"
+	TrailingSlashAdd   = "add"   // "/a" -> "/a/" (file-like last segments such as "/a.css" are left alone)
+)
+
+// SetTrailingSlashNormalization canonicalizes the trailing slash of request paths so
+// "/api/items" and "/api/items/" share one cache entry. The root path is never changed.
+// With forward=true the normalized path is also what gets forwarded. With forward=false
+// only cache keys are normalized and the upstream still receives the path as sent, so
+// whichever form is fetched first is served for both: only use it when the upstream
+// answers both forms identically (a redirect from one form to the other would be replayed
+// for its own target). Unknown modes behave as "off".
+func (proxy *ReverseProxy) SetTrailingSlashNormalization(mode string, forward bool) {
+	switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+	case TrailingSlashStrip, TrailingSlashAdd:
+		proxy.trailingSlashMode = mode
+	default:
+		proxy.trailingSlashMode = ""
+	}
+	proxy.trailingSlashForward = forward
+}
+
+// normalizeTrailingSlash rewrites req.URL's path (decoded and raw forms) per the configured mode.
+func (proxy *ReverseProxy) normalizeTrailingSlash(req *http.Request) {
+	if proxy.trailingSlashMode == "" {
+		return
+	}
+	req.URL.Path = applyTrailingSlash(req.URL.Path, proxy.trailingSlashMode)
+	if req.URL.RawPath != "" {
+		req.URL.RawPath = applyTrailingSlash(req.URL.RawPath, proxy.trailingSlashMode)
+	}
+}
+
+// applyTrailingSlash returns p with its trailing slash stripped or added per mode.
+func applyTrailingSlash(p, mode string) string {
+	if p == "/" || !strings.HasPrefix(p, "/") {
+		return p
+	}
+	switch mode {
+	case TrailingSlashStrip:
+		if trimmed := strings.TrimRight(p, "/"); trimmed != "" {
+			return trimmed
+		}
+		return "/"
+	case TrailingSlashAdd:
+		if strings.HasSuffix(p, "/") || strings.Contains(path.Base(p), ".") {
+			return p
+		}
+		return p + "/"
+	}
+	return p
+}
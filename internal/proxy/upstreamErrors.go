@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Upstream error classes reported in proxy_upstream_errors_total{class}.
+const (
+	upstreamErrCanceled = "canceled" // client went away
+	upstreamErrTimeout  = "timeout"  // request budget or dial/read deadline exceeded
+	upstreamErrRefused  = "refused"  // nothing listening on the upstream port
+	upstreamErrReset    = "reset"    // connection reset or closed mid-exchange
+	upstreamErrDNS      = "dns"      // upstream host could not be resolved
+	upstreamErrTLS      = "tls"      // handshake or certificate verification failed
+	upstreamErrProtocol = "protocol" // anything else (malformed response, ...)
+)
+
+// SetUpstreamUnavailable configures how "upstream down" is reported. 503 responses for
+// no healthy/ejected target (and for refused connections when they map to 503) carry
+// Retry-After rounded up to whole seconds (<= 0 omits it). refusedStatus is the status for
+// a connection refused by the selected upstream: 503 (down, retry later; the default) or
+// 502 (treat it as an upstream error). Other transport failures are always 502, timeouts 504.
+func (proxy *ReverseProxy) SetUpstreamUnavailable(retryAfter time.Duration, refusedStatus int) {
+	proxy.unavailableRetryAfter = max(retryAfter, 0)
+	proxy.refusedAsBadGateway = refusedStatus == http.StatusBadGateway
+}
+
+// setRetryAfter advertises retryAfter in whole seconds, rounded up (<= 0 leaves it unset).
+func setRetryAfter(header http.Header, retryAfter time.Duration) {
+	if retryAfter > 0 {
+		seconds := int64((retryAfter + time.Second - 1) / time.Second)
+		header.Set("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+}
+
+// upstreamErrorStatus applies the configured refused-connection mapping to the status
+// chosen by classifyUpstreamError.
+func (proxy *ReverseProxy) upstreamErrorStatus(errorClass string, statusCode int) int {
+	if errorClass == upstreamErrRefused && proxy.refusedAsBadGateway {
+		return http.StatusBadGateway
+	}
+	return statusCode
+}
+
+// classifyUpstreamError maps a RoundTrip error to an error class and the status returned
+// to the client: 408 when the client canceled, 504 on timeouts, 503 when the upstream
+// refused the connection (it is down, retrying elsewhere may help), 502 otherwise.
+func classifyUpstreamError(clientCtx, upstreamCtx context.Context, err error) (string, int) {
+	if clientCtx.Err() != nil {
+		return upstreamErrCanceled, http.StatusRequestTimeout
+	}
+	if upstreamCtx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+		return upstreamErrTimeout, http.StatusGatewayTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return upstreamErrRefused, http.StatusServiceUnavailable
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return upstreamErrReset, http.StatusBadGateway
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return upstreamErrDNS, http.StatusBadGateway
+	}
+	var (
+		recordHeaderErr  tls.RecordHeaderError
+		certVerifyErr    *tls.CertificateVerificationError
+		unknownAuthority x509.UnknownAuthorityError
+		hostnameErr      x509.HostnameError
+		certInvalidErr   x509.CertificateInvalidError
+	)
+	if errors.As(err, &recordHeaderErr) || errors.As(err, &certVerifyErr) || errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &certInvalidErr) {
+		return upstreamErrTLS, http.StatusBadGateway
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return upstreamErrTimeout, http.StatusGatewayTimeout
+	}
+	return upstreamErrProtocol, http.StatusBadGateway
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// upstreamHeaderSet is a set of headers added to every request sent to one target.
+type upstreamHeaderSet struct {
+	target *url.URL
+	header http.Header
+}
+
+// SetUpstreamHeaders sets headers (e.g. an API key) injected only into requests sent to
+// target, replacing any earlier set for it. Empty headers remove the override. The values
+// are set on the outbound clone only, so they never show up in the logged client request.
+func (proxy *ReverseProxy) SetUpstreamHeaders(target *url.URL, headers map[string]string) {
+	sets := make([]upstreamHeaderSet, 0, len(proxy.upstreamHeaders)+1)
+	for _, set := range proxy.upstreamHeaders {
+		if !sameUpstream(set.target, target) {
+			sets = append(sets, set)
+		}
+	}
+	if len(headers) > 0 {
+		header := make(http.Header, len(headers))
+		for name, value := range headers {
+			header.Set(name, value)
+		}
+		sets = append(sets, upstreamHeaderSet{target: target, header: header})
+	}
+	proxy.upstreamHeaders = sets
+}
+
+// applyUpstreamHeaders sets the headers configured for upstreamTarget on outReq,
+// overriding any client-sent values of the same names.
+func (proxy *ReverseProxy) applyUpstreamHeaders(outReq *http.Request, upstreamTarget *url.URL) {
+	for _, set := range proxy.upstreamHeaders {
+		if !sameUpstream(set.target, upstreamTarget) {
+			continue
+		}
+		for name, values := range set.header {
+			outReq.Header[name] = append([]string(nil), values...)
+		}
+		return
+	}
+}
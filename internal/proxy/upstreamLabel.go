@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultUpstreamLabelHeader is the response header naming the upstream in per-upstream metrics.
+const defaultUpstreamLabelHeader = "X-Upstream"
+
+// otherUpstreamLabel replaces label values outside the configured allowlist.
+const otherUpstreamLabel = "other"
+
+// SetUpstreamLabel selects the response header whose value labels per-upstream metrics
+// (proxy_upstream_requests_total and friends), e.g. "X-Backend-Pool"; empty keeps
+// X-Upstream. Responses without the header are labelled with the target host. Values are
+// used as sent; when allowed is non-empty, they are matched case-insensitively, reported as
+// the lowercased allowlist entry, and values outside it collapse to "other" so a
+// misbehaving backend cannot explode metric cardinality.
+func (proxy *ReverseProxy) SetUpstreamLabel(headerName string, allowed []string) {
+	headerName = strings.TrimSpace(headerName)
+	if headerName == "" {
+		headerName = defaultUpstreamLabelHeader
+	}
+	var allowedLabels map[string]struct{}
+	for _, value := range allowed {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			if allowedLabels == nil {
+				allowedLabels = make(map[string]struct{}, len(allowed))
+			}
+			allowedLabels[value] = struct{}{}
+		}
+	}
+	proxy.upstreamLabelHeader = headerName
+	proxy.upstreamLabelAllowed = allowedLabels
+}
+
+// targetMetricLabel returns the per-upstream metrics label of a request sent to
+// upstreamTarget before any response exists: the target host, or "forward" for
+// forward-mode origins.
+func targetMetricLabel(req *http.Request, upstreamTarget *url.URL) string {
+	if forwardOrigin(req) != nil {
+		return forwardMetricLabel
+	}
+	return upstreamTarget.Host
+}
+
+// upstreamMetricLabel returns the per-upstream metrics label of a response from upstreamTarget.
+// Forward-mode responses are always labelled "forward": neither their origin nor its headers
+// are under the operator's control.
+func (proxy *ReverseProxy) upstreamMetricLabel(req *http.Request, upstreamHeader http.Header, upstreamTarget *url.URL) string {
+	if forwardOrigin(req) != nil {
+		return forwardMetricLabel
+	}
+	headerName := proxy.upstreamLabelHeader
+	if headerName == "" {
+		headerName = defaultUpstreamLabelHeader
+	}
+	label := upstreamHeader.Get(headerName)
+	if strings.TrimSpace(label) == "" {
+		return upstreamTarget.Host
+	}
+	if proxy.upstreamLabelAllowed != nil {
+		normalized := strings.ToLower(strings.TrimSpace(label))
+		if _, ok := proxy.upstreamLabelAllowed[normalized]; !ok {
+			return otherUpstreamLabel
+		}
+		return normalized
+	}
+	return label
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"container/list"
+	"strings"
+)
+
+// variantBaseKey returns the part of a cache key naming the resource, before the
+// Accept/Accept-Encoding dimensions that tell its variants apart. Keys from a custom
+// key function without those dimensions are their own resource.
+func variantBaseKey(cacheKey string) string {
+	if index := strings.Index(cacheKey, "|a="); index >= 0 {
+		return cacheKey[:index]
+	}
+	return cacheKey
+}
+
+// variantGroup indexes the cached variants of one resource, so the byte budget is
+// enforced without scanning the whole LRU list.
+type variantGroup struct {
+	bytes    int        // body bytes held by all variants
+	variants *list.List // cache list elements, most recently used first
+}
+
+// addVariant records a newly inserted element under its resource (no-op when no
+// per-resource budget is configured). Callers hold cache.mu.
+func (cache *lruCache) addVariant(element *list.Element) {
+	if cache.maxBytesPerKey <= 0 {
+		return
+	}
+	entry := element.Value.(*lruEntry)
+	baseKey := variantBaseKey(entry.key)
+	group := cache.resources[baseKey]
+	if group == nil {
+		group = &variantGroup{variants: list.New()}
+		cache.resources[baseKey] = group
+	}
+	entry.group = group
+	entry.variant = group.variants.PushFront(element)
+	group.bytes += len(entry.val.Body)
+}
+
+// touchVariant marks entry as the most recently used variant of its resource.
+func (cache *lruCache) touchVariant(entry *lruEntry) {
+	if entry.group != nil {
+		entry.group.variants.MoveToFront(entry.variant)
+	}
+}
+
+// resizeVariant adds delta to the bytes held by entry's resource.
+func (cache *lruCache) resizeVariant(entry *lruEntry, delta int) {
+	if entry.group != nil {
+		entry.group.bytes += delta
+	}
+}
+
+// removeVariant drops entry from its resource, forgetting the resource once it has no
+// variants left. Callers hold cache.mu.
+func (cache *lruCache) removeVariant(entry *lruEntry) {
+	group := entry.group
+	if group == nil {
+		return
+	}
+	group.variants.Remove(entry.variant)
+	group.bytes -= len(entry.val.Body)
+	entry.group, entry.variant = nil, nil
+	if group.variants.Len() == 0 {
+		delete(cache.resources, variantBaseKey(entry.key))
+	}
+}
+
+// enforceVariantBudget evicts the least recently used variants of kept's resource until
+// the resource fits its byte budget again. kept (the entry just stored) is never evicted,
+// so a single variant larger than the budget stays cached on its own. Callers hold cache.mu.
+func (cache *lruCache) enforceVariantBudget(kept *list.Element) {
+	group := kept.Value.(*lruEntry).group
+	if group == nil {
+		return
+	}
+	for variant := group.variants.Back(); variant != nil && group.bytes > cache.maxBytesPerKey; {
+		previous := variant.Prev()
+		if element := variant.Value.(*list.Element); element != kept {
+			cache.removeElement(element)
+		}
+		variant = previous
+	}
+}
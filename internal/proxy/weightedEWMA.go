@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"math"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// ewmaSmoothing is the weight of the newest latency sample in a target's EWMA.
+	ewmaSmoothing = 0.3
+	// minEffectiveShare keeps a slow target at this fraction of its static weight so it
+	// still sees some traffic and can recover once it speeds up.
+	minEffectiveShare = 0.05
+	// A failed round trip counts as a sample of ewmaFailureFactor times the current EWMA
+	// (at least ewmaFailureFloor seconds), so fast-failing targets do not attract traffic.
+	ewmaFailureFactor = 4.0
+	ewmaFailureFloor  = 1.0
+)
+
+// ----- Weighted round robin with latency EWMA (wrr_ewma) -----
+
+type wrrEWMAState struct {
+	upstreamURL   *url.URL
+	staticWeight  float64 // configured weight (default 1)
+	currentWeight float64 // smooth weighted round-robin accumulator
+	latencyEWMA   float64 // seconds; 0 until the first request finishes
+}
+
+// wrrEWMABalancer runs smooth weighted round robin. Effective weights start at the static
+// weights and, once latencies are observed, are scaled by fastestEWMA/targetEWMA so
+// traffic shifts toward faster targets. Latency is the upstream time to response headers
+// reported through observeLatency, so slow clients never make a target look slow.
+type wrrEWMABalancer struct {
+	mu                  sync.Mutex
+	targetStates        []*wrrEWMAState
+	healthChecksEnabled bool
+	isHealthy           healthProbe
+}
+
+func NewWeightedEWMABalancer(upstreamTargets []*url.URL, healthChecksEnabled bool) Balancer {
+	targetStates := make([]*wrrEWMAState, 0, len(upstreamTargets))
+	for _, u := range upstreamTargets {
+		targetStates = append(targetStates, &wrrEWMAState{upstreamURL: u, staticWeight: 1})
+	}
+	return &wrrEWMABalancer{targetStates: targetStates, healthChecksEnabled: healthChecksEnabled, isHealthy: isTargetHealthy}
+}
+
+func (b *wrrEWMABalancer) Pick(previewOnly bool) *url.URL {
+	// Probe health outside the lock: on-demand probes do network I/O.
+	candidates := make([]*wrrEWMAState, 0, len(b.targetStates))
+	for _, st := range b.targetStates {
+		if !previewOnly && b.healthChecksEnabled && !b.isHealthy(st.upstreamURL) {
+			continue
+		}
+		candidates = append(candidates, st)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fastest := b.fastestEWMA()
+	var best *wrrEWMAState
+	bestScore, totalWeight := math.Inf(-1), 0.0
+	for _, st := range candidates {
+		weight := st.effectiveWeight(fastest)
+		totalWeight += weight
+		if score := st.currentWeight + weight; score > bestScore {
+			best, bestScore = st, score
+		}
+	}
+	// Preview reports the next choice without advancing the accumulators.
+	if previewOnly {
+		return best.upstreamURL
+	}
+	for _, st := range candidates {
+		st.currentWeight += st.effectiveWeight(fastest)
+	}
+	best.currentWeight -= totalWeight
+	return best.upstreamURL
+}
+
+// fastestEWMA returns the lowest observed latency EWMA (0 when nothing was observed yet).
+// Callers hold b.mu.
+func (b *wrrEWMABalancer) fastestEWMA() float64 {
+	fastest := 0.0
+	for _, st := range b.targetStates {
+		if st.latencyEWMA > 0 && (fastest == 0 || st.latencyEWMA < fastest) {
+			fastest = st.latencyEWMA
+		}
+	}
+	return fastest
+}
+
+// effectiveWeight scales the static weight by how much slower than the fastest target
+// this one is; targets without samples keep their static weight.
+func (st *wrrEWMAState) effectiveWeight(fastest float64) float64 {
+	if fastest == 0 || st.latencyEWMA == 0 {
+		return st.staticWeight
+	}
+	return st.staticWeight * max(fastest/st.latencyEWMA, minEffectiveShare)
+}
+
+// Acquire tracks nothing: latency samples arrive through observeLatency.
+func (b *wrrEWMABalancer) Acquire(*url.URL) func() { return func() {} }
+
+// observeLatency folds one round trip to targetURL into its EWMA. Failures add a penalty
+// sample instead of their (often very short) duration.
+func (b *wrrEWMABalancer) observeLatency(targetURL *url.URL, latency time.Duration, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, st := range b.targetStates {
+		if !sameUpstream(st.upstreamURL, targetURL) {
+			continue
+		}
+		sample := latency.Seconds()
+		if failed {
+			sample = max(st.latencyEWMA*ewmaFailureFactor, ewmaFailureFloor)
+		}
+		if st.latencyEWMA == 0 {
+			st.latencyEWMA = sample
+			return
+		}
+		st.latencyEWMA = ewmaSmoothing*sample + (1-ewmaSmoothing)*st.latencyEWMA
+		return
+	}
+}
+
+// observeBalancerLatency hands a finished round trip to balancers that weigh latency;
+// others are left alone.
+func observeBalancerLatency(balancer Balancer, targetURL *url.URL, latency time.Duration, failed bool) {
+	if aware, ok := balancer.(interface {
+		observeLatency(*url.URL, time.Duration, bool)
+	}); ok {
+		aware.observeLatency(targetURL, latency, failed)
+	}
+}
+
+func (b *wrrEWMABalancer) Targets() []*url.URL {
+	out := make([]*url.URL, 0, len(b.targetStates))
+	for _, st := range b.targetStates {
+		out = append(out, st.upstreamURL)
+	}
+	return out
+}
+func (b *wrrEWMABalancer) Strategy() string { return "wrr_ewma" }
+
+func (b *wrrEWMABalancer) setHealthProbe(probe healthProbe) { b.isHealthy = probe }
+
+// setWeights applies static weights (targets without one keep weight 1).
+func (b *wrrEWMABalancer) setWeights(weightOf func(*url.URL) int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, st := range b.targetStates {
+		if weight := weightOf(st.upstreamURL); weight > 0 {
+			st.staticWeight = float64(weight)
+		}
+	}
+}
+
+// setBalancerWeights hands static target weights to balancers that use them; others are
+// left alone.
+func setBalancerWeights(balancer Balancer, weightOf func(*url.URL) int) {
+	if aware, ok := balancer.(interface{ setWeights(func(*url.URL) int) }); ok {
+		aware.setWeights(weightOf)
+	}
+}
+
+// upstreamWeight is a static balancing weight for one upstream target.
+type upstreamWeight struct {
+	target *url.URL
+	weight int
+}
+
+// SetUpstreamWeight sets the static weight of one upstream for weighted strategies
+// (wrr_ewma). weight <= 0 removes the override so the target weighs 1 again.
+func (proxy *ReverseProxy) SetUpstreamWeight(target *url.URL, weight int) {
+	weights := make([]upstreamWeight, 0, len(proxy.upstreamWeights)+1)
+	for _, override := range proxy.upstreamWeights {
+		if !sameUpstream(override.target, target) {
+			weights = append(weights, override)
+		}
+	}
+	if weight > 0 {
+		weights = append(weights, upstreamWeight{target: target, weight: weight})
+	}
+	proxy.upstreamWeights = weights
+	proxy.rebuildBalancer()
+}
+
+// weightFor returns the static weight configured for upstreamTarget (0 = default).
+func (proxy *ReverseProxy) weightFor(upstreamTarget *url.URL) int {
+	for _, override := range proxy.upstreamWeights {
+		if sameUpstream(override.target, upstreamTarget) {
+			return override.weight
+		}
+	}
+	return 0
+}
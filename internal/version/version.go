@@ -0,0 +1,83 @@
+// Package version exposes build metadata (version, commit, build date, Go version).
+// Version/Commit/BuildDate are meant to be injected at link time, e.g.:
+//
+//	go build -ldflags "-X traefik-challenge-2/internal/version.Version=v1.2.3 \
+//	  -X traefik-challenge-2/internal/version.Commit=$(git rev-parse HEAD)" ./cmd/server
+//
+// When not injected, the commit and build date fall back to the VCS stamp embedded
+// by the Go toolchain (runtime/debug.ReadBuildInfo).
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Link-time injected build variables.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info is the build metadata reported by -version and /admin/version.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	Modified  bool   `json:"modified"` // working tree had uncommitted changes at build time
+}
+
+// Get returns build metadata, preferring ldflags values over embedded VCS settings.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "dev" && buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
+			info.Version = buildInfo.Main.Version
+		}
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+// String renders build metadata on one line (used by the -version flag).
+func (info Info) String() string {
+	return fmt.Sprintf("FCReverseProxy %s (commit %s, built %s, %s)", info.Version, info.Commit, info.BuildDate, info.GoVersion)
+}
+
+// Handler serves build metadata as JSON.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(Get())
+	})
+}
@@ -0,0 +1,109 @@
+package proxy_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// Connections beyond the burst are accepted no faster than the configured rate.
+func TestAcceptRateListener_ThrottlesConnectionFlood(t *testing.T) {
+	banner("accept_limit_test.go")
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	listener := proxy.NewAcceptRateListener(inner, 20, 2) // one token every 50ms after a burst of 2
+	t.Cleanup(func() { _ = listener.Close() })
+
+	const total = 6
+	accepted := make(chan time.Time, total)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- time.Now()
+			_ = conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	for i := 0; i < total; i++ {
+		conn, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatalf("dial %d: %v", i, err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+	}
+
+	var times []time.Time
+	for len(times) < total {
+		select {
+		case at := <-accepted:
+			times = append(times, at)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("accepted %d of %d connections", len(times), total)
+		}
+	}
+	if burst := times[1].Sub(start); burst > 40*time.Millisecond {
+		t.Fatalf("burst connections should be accepted immediately, took %v", burst)
+	}
+	// 4 connections over the burst at 20/s need at least ~200ms.
+	if elapsed := times[total-1].Sub(start); elapsed < 180*time.Millisecond {
+		t.Fatalf("flood accepted in %v, want throttling to >= ~200ms", elapsed)
+	}
+}
+
+// Close unblocks an Accept that is waiting for a token.
+func TestAcceptRateListener_CloseUnblocksWaitingAccept(t *testing.T) {
+	banner("accept_limit_test.go")
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	listener := proxy.NewAcceptRateListener(inner, 0.1, 1)
+
+	conn, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	first, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("first accept: %v", err)
+	}
+	_ = first.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := listener.Accept() // no token for 10s
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_ = listener.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("Accept after Close returned no error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Close did not unblock a throttled Accept")
+	}
+}
+
+// A zero rate leaves the listener untouched.
+func TestAcceptRateListener_ZeroRateDisabled(t *testing.T) {
+	banner("accept_limit_test.go")
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer inner.Close()
+	if proxy.NewAcceptRateListener(inner, 0, 5) != inner {
+		t.Fatalf("rate 0 should return the listener unchanged")
+	}
+}
@@ -0,0 +1,431 @@
+package proxy_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	applog "traefik-challenge-2/internal/log"
+	"traefik-challenge-2/internal/metrics"
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+type cacheKeysPage struct {
+	Total  int                    `json:"total"`
+	Offset int                    `json:"offset"`
+	Limit  int                    `json:"limit"`
+	Keys   []proxy.CacheEntryInfo `json:"keys"`
+}
+
+func TestAdminCacheKeys_Paginates(t *testing.T) {
+	banner("admin_test.go")
+	lruCache := proxy.NewLRUCache(16)
+	for i := 0; i < 5; i++ {
+		lruCache.Set(fmt.Sprintf("key-%d", i), &proxy.CachedResponse{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       []byte("body"),
+			StoredAt:   time.Now(),
+		}, time.Minute)
+	}
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, "http://127.0.0.1:1"), lruCache, true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	handler := proxy.RequireAdminToken("secret", reverseProxy.CacheKeysHandler())
+
+	seen := map[string]bool{}
+	for offset := 0; offset < 5; offset += 2 {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/admin/cache/keys?limit=2&offset=%d", offset), nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("offset=%d: want 200, got %d", offset, rec.Code)
+		}
+
+		var page cacheKeysPage
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("decode page: %v", err)
+		}
+		if page.Total != 5 {
+			t.Fatalf("want total=5, got %d", page.Total)
+		}
+		wantLen := min(2, 5-offset)
+		if len(page.Keys) != wantLen {
+			t.Fatalf("offset=%d: want %d keys, got %d", offset, wantLen, len(page.Keys))
+		}
+		for _, entry := range page.Keys {
+			if entry.Size != 4 || entry.StatusCode != http.StatusOK || entry.ExpiresAt.IsZero() {
+				t.Fatalf("unexpected entry metadata: %+v", entry)
+			}
+			seen[entry.Key] = true
+		}
+	}
+	if len(seen) != 5 {
+		t.Fatalf("pagination should visit every key once, saw %d", len(seen))
+	}
+}
+
+func TestAdminCacheKeys_RequiresToken(t *testing.T) {
+	banner("admin_test.go")
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, "http://127.0.0.1:1"), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+
+	for _, tc := range []struct {
+		name, configured, presented string
+	}{
+		{"wrong token", "secret", "nope"},
+		{"no token configured", "", ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/cache/keys", nil)
+		req.Header.Set("X-Admin-Token", tc.presented)
+		rec := httptest.NewRecorder()
+		proxy.RequireAdminToken(tc.configured, reverseProxy.CacheKeysHandler()).ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("%s: want 403, got %d", tc.name, rec.Code)
+		}
+	}
+}
+
+func TestAdminMaintenance_TogglesProxyTraffic(t *testing.T) {
+	banner("admin_test.go")
+	upstreamServer := startTextUpstream(t, "no-store", []byte("upstream"))
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMaintenanceResponse(90*time.Second, "back soon")
+	admin := proxy.RequireAdminToken("secret", reverseProxy.MaintenanceHandler())
+
+	toggle := func(enabled bool) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/admin/maintenance", strings.NewReader(fmt.Sprintf(`{"enabled":%t}`, enabled)))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+		var status struct {
+			Enabled bool `json:"enabled"`
+		}
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &status) != nil || status.Enabled != enabled {
+			t.Fatalf("toggle %t: status %d body %q", enabled, rec.Code, rec.Body.String())
+		}
+	}
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	toggle(true)
+	rec := serve("/page")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("maintenance on: want 503, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "90" {
+		t.Fatalf("Retry-After: want 90, got %q", got)
+	}
+	if !strings.Contains(rec.Body.String(), "back soon") {
+		t.Fatalf("maintenance body: got %q", rec.Body.String())
+	}
+	if got := serve("/healthz").Code; got != http.StatusOK {
+		t.Fatalf("healthz must bypass maintenance, got %d", got)
+	}
+
+	toggle(false)
+	rec = serve("/page")
+	if rec.Code != http.StatusOK || rec.Body.String() != "upstream" {
+		t.Fatalf("maintenance off: want 200 upstream, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAdmin_UpstreamsReportOutlierEjections(t *testing.T) {
+	banner("admin_test.go")
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	t.Cleanup(failingServer.Close)
+	var healthyHits int64
+	healthyServer := startCountingUpstream(t, &healthyHits)
+	failingURL := mustURL(t, failingServer.URL)
+
+	reverseProxy := proxy.NewReverseProxyMulti([]*url.URL{failingURL, mustURL(t, healthyServer.URL)}, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetOutlierDetection(2, time.Minute, 0)
+
+	before, _ := scrapeMetric(t, "proxy_upstream_ejections_total", fmt.Sprintf(`upstream=%q`, failingURL.Host))
+	// Round-robin alternates targets: the failing one is ejected after its second 500.
+	for i := 0; i < 4; i++ {
+		reverseProxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/warm/%d", i), nil))
+	}
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/after/%d", i), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d after ejection: expected 200 from the healthy target, got %d", i, rec.Code)
+		}
+	}
+	if after, _ := scrapeMetric(t, "proxy_upstream_ejections_total", fmt.Sprintf(`upstream=%q`, failingURL.Host)); after != before+1 {
+		t.Fatalf("expected one ejection counted for %s: before %v after %v", failingURL.Host, before, after)
+	}
+
+	rec := httptest.NewRecorder()
+	reverseProxy.UpstreamsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/upstreams", nil))
+	var snapshot struct {
+		Upstreams []struct {
+			URL       string `json:"url"`
+			Pool      string `json:"pool"`
+			Ejected   bool   `json:"ejected"`
+			Ejections int64  `json:"ejections"`
+		} `json:"upstreams"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("decode snapshot %q: %v", rec.Body.String(), err)
+	}
+	if len(snapshot.Upstreams) != 2 {
+		t.Fatalf("expected two upstreams, got %+v", snapshot.Upstreams)
+	}
+	for _, upstream := range snapshot.Upstreams {
+		wantEjected := upstream.URL == failingURL.String()
+		if upstream.Ejected != wantEjected || (wantEjected && upstream.Ejections != 1) || upstream.Pool != "primary" {
+			t.Fatalf("unexpected snapshot entry %+v", upstream)
+		}
+	}
+}
+
+func TestAdmin_OutlierEjectionKeepsTargetsInRotation(t *testing.T) {
+	banner("admin_test.go")
+	startFailing := func() *url.URL {
+		failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "broken", http.StatusInternalServerError)
+		}))
+		t.Cleanup(failingServer.Close)
+		return mustURL(t, failingServer.URL)
+	}
+
+	countEjected := func(reverseProxy *proxy.ReverseProxy) int {
+		rec := httptest.NewRecorder()
+		reverseProxy.UpstreamsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/upstreams", nil))
+		var snapshot struct {
+			Upstreams []struct {
+				Ejected bool `json:"ejected"`
+			} `json:"upstreams"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+			t.Fatalf("decode snapshot %q: %v", rec.Body.String(), err)
+		}
+		ejected := 0
+		for _, upstream := range snapshot.Upstreams {
+			if upstream.Ejected {
+				ejected++
+			}
+		}
+		return ejected
+	}
+
+	for _, tc := range []struct {
+		name        string
+		targets     int
+		percent     int
+		wantEjected int
+	}{
+		{"lone target is never ejected", 1, 0, 0},
+		{"default caps at half the targets", 2, 0, 1},
+		{"100 percent ejects every target", 2, 100, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			targets := make([]*url.URL, tc.targets)
+			for i := range targets {
+				targets[i] = startFailing()
+			}
+			reverseProxy := proxy.NewReverseProxyMulti(targets, proxy.NewLRUCache(16), false)
+			reverseProxy.SetHealthCheckEnabled(false)
+			reverseProxy.SetOutlierDetection(2, time.Minute, tc.percent)
+
+			// Every target keeps failing; the cap decides how many leave rotation.
+			for i := 0; i < 8; i++ {
+				reverseProxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/fail/%d", i), nil))
+			}
+			if got := countEjected(reverseProxy); got != tc.wantEjected {
+				t.Fatalf("ejected %d of %d targets, want %d", got, tc.targets, tc.wantEjected)
+			}
+			if tc.wantEjected < tc.targets {
+				rec := httptest.NewRecorder()
+				reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/still-routed", nil))
+				if rec.Code != http.StatusInternalServerError {
+					t.Fatalf("a target should stay in rotation: status %d, want the upstream's 500", rec.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminMetricsJSON_ReportsRegisteredMetrics(t *testing.T) {
+	banner("admin_test.go")
+	upstreamServer := startTextUpstream(t, "no-store", []byte("ok"))
+	proxyHandler := newProxy(t, mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false, nil)
+	for i := 0; i < 3; i++ {
+		proxyHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/metrics-json", nil))
+	}
+
+	handler := proxy.RequireAdminToken("secret", metrics.JSONHandler())
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/metrics.json", nil))
+	if rec.Code == http.StatusOK {
+		t.Fatalf("metrics.json served without a token")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/metrics.json", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("status %d content-type %q, want 200 JSON", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var snapshot struct {
+		Metrics []struct {
+			Name   string            `json:"name"`
+			Type   string            `json:"type"`
+			Labels map[string]string `json:"labels"`
+			Value  *float64          `json:"value"`
+			Count  *uint64           `json:"count"`
+		} `json:"metrics"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("decode metrics.json: %v", err)
+	}
+	var requests float64
+	var durations uint64
+	for _, sample := range snapshot.Metrics {
+		if sample.Labels["method"] != http.MethodPut {
+			continue
+		}
+		switch sample.Name {
+		case "proxy_requests_total":
+			if sample.Type != "counter" || sample.Value == nil {
+				t.Fatalf("proxy_requests_total sample malformed: %+v", sample)
+			}
+			requests += *sample.Value
+		case "proxy_request_duration_seconds":
+			if sample.Count != nil {
+				durations += *sample.Count
+			}
+		}
+	}
+	if requests < 3 || durations < 3 {
+		t.Fatalf("PUT requests=%v durations=%d in metrics.json, want >= 3 each", requests, durations)
+	}
+}
+
+func TestAudit_DeniedRequestsEmitEventsWithClientIPAndReason(t *testing.T) {
+	banner("admin_test.go")
+	var mu sync.Mutex
+	var events []applog.AuditEvent
+	applog.SetAuditEnabled(true)
+	applog.SetAuditHook(func(event applog.AuditEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	})
+	t.Cleanup(func() {
+		applog.SetAuditHook(nil)
+		applog.SetAuditEnabled(false)
+	})
+
+	// Admin request without a token from a known client address.
+	adminReq := httptest.NewRequest(http.MethodGet, "/admin/version", nil)
+	adminReq.RemoteAddr = "203.0.113.7:51000"
+	proxy.RequireAdminToken("secret", http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), adminReq)
+
+	// Method outside the allowlist.
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, "http://127.0.0.1:1"), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetAllowedMethods([]string{http.MethodGet})
+	methodReq := httptest.NewRequest(http.MethodDelete, "/orders/1", nil)
+	methodReq.RemoteAddr = "198.51.100.9:40000"
+	reverseProxy.ServeHTTP(httptest.NewRecorder(), methodReq)
+
+	mu.Lock()
+	recorded := events
+	events = nil
+	mu.Unlock()
+	if len(recorded) != 2 {
+		t.Fatalf("expected 2 audit events, got %d: %+v", len(recorded), recorded)
+	}
+	auth, method := recorded[0], recorded[1]
+	if auth.Category != applog.AuditAuth || auth.Decision != "deny" || auth.ClientIP != "203.0.113.7" ||
+		auth.Reason != "missing admin token" || auth.Path != "/admin/version" {
+		t.Fatalf("unexpected auth audit event: %+v", auth)
+	}
+	if method.Category != applog.AuditMethod || method.ClientIP != "198.51.100.9" ||
+		method.Method != http.MethodDelete || !strings.Contains(method.Reason, "DELETE") || method.RequestID == "" {
+		t.Fatalf("unexpected method audit event: %+v", method)
+	}
+
+	// Disabled audit emits nothing.
+	applog.SetAuditEnabled(false)
+	proxy.RequireAdminToken("secret", http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), adminReq)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 0 {
+		t.Fatalf("audit disabled but got events: %+v", events)
+	}
+}
+
+func TestAdmin_TransportResetForcesNewUpstreamConnection(t *testing.T) {
+	banner("admin_test.go")
+	var dialed atomic.Int64
+	upstreamServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	upstreamServer.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dialed.Add(1)
+		}
+	}
+	upstreamServer.Start()
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	fetch := func() {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/conn", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("proxied request: status %d", rec.Code)
+		}
+	}
+
+	fetch()
+	fetch()
+	if got := dialed.Load(); got != 1 {
+		t.Fatalf("expected the second request to reuse the keep-alive connection, dialed %d", got)
+	}
+
+	handler := proxy.RequireAdminToken("secret", reverseProxy.TransportResetHandler())
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin/transport/reset", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET must be rejected, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/admin/transport/reset", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("reset: status %d", rec.Code)
+	}
+
+	fetch()
+	if got := dialed.Load(); got != 2 {
+		t.Fatalf("expected a fresh connection after reset, dialed %d", got)
+	}
+}
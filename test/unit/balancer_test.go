@@ -6,7 +6,9 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 	proxy "traefik-challenge-2/internal/proxy"
 )
 
@@ -259,3 +261,184 @@ func TestRoundRobinBalancerHealthAllUnhealthy(t *testing.T) {
 		t.Fatalf("expected nil when all targets unhealthy, got %v", pickedTarget)
 	}
 }
+
+func TestFailoverBackupServesWhenPrimariesDown(t *testing.T) {
+	banner("balancer_test.go")
+
+	// Primaries report unhealthy; the backup is healthy and answers requests.
+	unhealthyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("primary"))
+	})
+	backupHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write([]byte("backup"))
+	})
+
+	primary1 := httptest.NewServer(unhealthyHandler)
+	defer primary1.Close()
+	primary2 := httptest.NewServer(unhealthyHandler)
+	defer primary2.Close()
+	backupServer := httptest.NewServer(backupHandler)
+	defer backupServer.Close()
+
+	reverseProxy := proxy.NewReverseProxyMulti(
+		[]*url.URL{mustURL(t, primary1.URL), mustURL(t, primary2.URL)},
+		proxy.NewLRUCache(16),
+		false,
+	)
+	reverseProxy.SetHealthCheckEnabled(true)
+	reverseProxy.SetBackupTargets([]*url.URL{mustURL(t, backupServer.URL)})
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "backup" {
+		t.Fatalf("expected backup to serve the request, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBalancer_ClientNetworkPoolsSplitByCIDR(t *testing.T) {
+	banner("balancer_test.go")
+	externalServer := startTextUpstream(t, "no-store", []byte("external"))
+	internalServer := startTextUpstream(t, "no-store", []byte("internal"))
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, externalServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	err := reverseProxy.SetClientNetworkPools([]proxy.ClientNetworkPool{{
+		Name:    "internal",
+		CIDRs:   []string{"10.0.0.0/8"},
+		Targets: []*url.URL{mustURL(t, internalServer.URL)},
+	}})
+	if err != nil {
+		t.Fatalf("SetClientNetworkPools: %v", err)
+	}
+
+	for remoteAddr, want := range map[string]string{
+		"10.1.2.3:1234":    "internal",
+		"203.0.113.7:1234": "external",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/who", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Fatalf("client %s: got %d %q, want %q", remoteAddr, rec.Code, rec.Body.String(), want)
+		}
+	}
+
+	if err := reverseProxy.SetClientNetworkPools([]proxy.ClientNetworkPool{{
+		Name: "bad", CIDRs: []string{"10.0.0.0/33"}, Targets: []*url.URL{mustURL(t, internalServer.URL)},
+	}}); err == nil {
+		t.Fatalf("expected an error for an invalid CIDR")
+	}
+}
+
+// With the cache on, each client network pool keeps its own entries: a response cached for
+// one pool's backends is never served to clients routed to another pool.
+func TestBalancer_ClientNetworkPoolsDoNotShareCacheEntries(t *testing.T) {
+	banner("balancer_test.go")
+	externalServer := startTextUpstream(t, "max-age=60", []byte("external"))
+	internalServer := startTextUpstream(t, "max-age=60", []byte("internal"))
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, externalServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	if err := reverseProxy.SetClientNetworkPools([]proxy.ClientNetworkPool{{
+		Name:    "internal",
+		CIDRs:   []string{"10.0.0.0/8"},
+		Targets: []*url.URL{mustURL(t, internalServer.URL)},
+	}}); err != nil {
+		t.Fatalf("SetClientNetworkPools: %v", err)
+	}
+
+	fetch := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/who", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if first := fetch("10.1.2.3:1234"); first.Body.String() != "internal" || first.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("internal client: got %q (%s), want a MISS from the internal pool", first.Body.String(), first.Header().Get("X-Cache"))
+	}
+	if external := fetch("203.0.113.7:1234"); external.Body.String() != "external" || external.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("external client: got %q (%s), want a MISS from the default targets", external.Body.String(), external.Header().Get("X-Cache"))
+	}
+	if again := fetch("10.9.9.9:1234"); again.Body.String() != "internal" || again.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("second internal client: got %q (%s), want the pool's cached entry", again.Body.String(), again.Header().Get("X-Cache"))
+	}
+}
+
+func TestBalancer_WeightedEWMAStartsStaticThenFavoursFaster(t *testing.T) {
+	banner("balancer_test.go")
+	var slowHits, fastHits int64
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&slowHits, 1)
+		time.Sleep(40 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(slowServer.Close)
+	fastServer := startCountingUpstream(t, &fastHits)
+	slowURL := mustURL(t, slowServer.URL)
+
+	reverseProxy := proxy.NewReverseProxyMulti([]*url.URL{slowURL, mustURL(t, fastServer.URL)}, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.ConfigureBalancer("wrr_ewma")
+	reverseProxy.SetUpstreamWeight(slowURL, 3)
+
+	send := func(count int) {
+		for i := 0; i < count; i++ {
+			rec := httptest.NewRecorder()
+			reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/item/%d", i), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("request %d: expected 200, got %d", i, rec.Code)
+			}
+		}
+	}
+
+	// Before the fast target has been measured, picks follow the static 3:1 weights.
+	send(4)
+	if slow, fast := atomic.LoadInt64(&slowHits), atomic.LoadInt64(&fastHits); slow != 3 || fast != 1 {
+		t.Fatalf("initial distribution should follow weights 3:1, got slow=%d fast=%d", slow, fast)
+	}
+
+	// With latencies observed, most traffic moves to the faster target despite its lower weight.
+	atomic.StoreInt64(&slowHits, 0)
+	atomic.StoreInt64(&fastHits, 0)
+	send(20)
+	if slow, fast := atomic.LoadInt64(&slowHits), atomic.LoadInt64(&fastHits); fast < 15 {
+		t.Fatalf("expected traffic to shift toward the fast target, got slow=%d fast=%d", slow, fast)
+	}
+}
+
+// A target that fails fast must not look like the fastest one: failures feed a penalty
+// into its EWMA instead of their short duration.
+func TestBalancer_WeightedEWMAPenalisesFastFailures(t *testing.T) {
+	banner("balancer_test.go")
+	var healthyHits, failingHits int64
+	healthyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&healthyHits, 1)
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(healthyServer.Close)
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&failingHits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failingServer.Close)
+
+	reverseProxy := proxy.NewReverseProxyMulti([]*url.URL{mustURL(t, healthyServer.URL), mustURL(t, failingServer.URL)}, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.ConfigureBalancer("wrr_ewma")
+
+	for i := 0; i < 24; i++ {
+		reverseProxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/item/%d", i), nil))
+	}
+	if healthy, failing := atomic.LoadInt64(&healthyHits), atomic.LoadInt64(&failingHits); healthy < 18 {
+		t.Fatalf("expected traffic to favour the healthy target, got healthy=%d failing=%d", healthy, failing)
+	}
+}
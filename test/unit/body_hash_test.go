@@ -0,0 +1,186 @@
+package proxy_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// concurrencyTrackingBody serves size bytes slowly and records how many such bodies are
+// being read at the same time.
+type concurrencyTrackingBody struct {
+	remaining int
+	started   bool
+	active    *atomic.Int64
+	peak      *atomic.Int64
+}
+
+func (body *concurrencyTrackingBody) Read(p []byte) (int, error) {
+	if !body.started {
+		body.started = true
+		current := body.active.Add(1)
+		for {
+			seen := body.peak.Load()
+			if current <= seen || body.peak.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+	}
+	if body.remaining == 0 {
+		body.active.Add(-1)
+		return 0, io.EOF
+	}
+	time.Sleep(5 * time.Millisecond)
+	n := min(len(p), body.remaining, 16<<10)
+	for i := range p[:n] {
+		p[i] = 'x'
+	}
+	body.remaining -= n
+	return n, nil
+}
+
+func TestBodyHash_ConcurrencyCapped(t *testing.T) {
+	banner("body_hash_test.go")
+	var upstreamHits int64
+	upstreamServer := startCountingUpstream(t, &upstreamHits)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(64), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetBodyHashConcurrency(2)
+
+	const requests = 8
+	var active, peak atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := &concurrencyTrackingBody{remaining: 128 << 10, active: &active, peak: &peak}
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/upload/%d", i), body)
+			rec := httptest.NewRecorder()
+			reverseProxy.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Errorf("POST: want 200, got %d", rec.Code)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > 2 {
+		t.Fatalf("body hashing concurrency: want at most 2, observed %d", got)
+	}
+	if got := atomic.LoadInt64(&upstreamHits); got != requests {
+		t.Fatalf("every POST should still reach the upstream, got %d", got)
+	}
+}
+
+// gatedBody yields head bytes, then waits until gate is closed (or a timeout, recorded in
+// timedOut) before yielding tail bytes. A proxy that buffers the whole body before
+// forwarding can never open the gate.
+type gatedBody struct {
+	head, tail int
+	gate       <-chan struct{}
+	timedOut   *atomic.Bool
+}
+
+func (body *gatedBody) Read(p []byte) (int, error) {
+	if body.head == 0 && body.tail > 0 && body.gate != nil {
+		select {
+		case <-body.gate:
+		case <-time.After(2 * time.Second):
+			body.timedOut.Store(true)
+		}
+		body.gate = nil
+	}
+	switch {
+	case body.head > 0:
+		n := min(len(p), body.head)
+		body.head -= n
+		return n, nil
+	case body.tail > 0:
+		n := min(len(p), body.tail)
+		body.tail -= n
+		return n, nil
+	}
+	return 0, io.EOF
+}
+
+func TestBodyHash_LargeBodyStreamedNotBuffered(t *testing.T) {
+	banner("body_hash_test.go")
+	const head, tail = 16 << 10, 1 << 20
+	upstreamStarted := make(chan struct{})
+	var startOnce sync.Once
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startOnce.Do(func() { close(upstreamStarted) })
+		received, _ := io.Copy(io.Discard, r.Body)
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		_, _ = fmt.Fprintf(w, "%d", received)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(64), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMaxBodyHashBytes(4 << 10)
+
+	var timedOut atomic.Bool
+	req := httptest.NewRequest(http.MethodPost, "/large-upload", &gatedBody{head: head, tail: tail, gate: upstreamStarted, timedOut: &timedOut})
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, req)
+
+	if timedOut.Load() {
+		t.Fatalf("body was buffered before forwarding: upstream never started while the body was pending")
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != fmt.Sprint(head+tail) {
+		t.Fatalf("want 200 with the full %d bytes upstream, got %d %q", head+tail, rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("X-Cache"); got != "BYPASS" {
+		t.Fatalf("unhashed body must bypass the cache, got X-Cache=%q", got)
+	}
+}
+
+func TestBodyHash_KeyBuildMetricsGrowWithBodySize(t *testing.T) {
+	banner("body_hash_test.go")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+
+	// post sends a cacheable POST with a body of size bytes and returns the increase in hashed
+	// bytes, keying observations and keying seconds.
+	post := func(size int) (hashedBytes, observations, seconds float64) {
+		bytesBefore, _ := scrapeMetric(t, "proxy_cache_body_hash_bytes_total", "")
+		countBefore, _ := scrapeMetric(t, "proxy_cache_key_build_seconds_count", "")
+		sumBefore, _ := scrapeMetric(t, "proxy_cache_key_build_seconds_sum", "")
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/hash-metrics/%d", size), bytes.NewReader(bytes.Repeat([]byte("x"), size)))
+		reverseProxy.ServeHTTP(httptest.NewRecorder(), req)
+		bytesAfter, _ := scrapeMetric(t, "proxy_cache_body_hash_bytes_total", "")
+		countAfter, _ := scrapeMetric(t, "proxy_cache_key_build_seconds_count", "")
+		sumAfter, _ := scrapeMetric(t, "proxy_cache_key_build_seconds_sum", "")
+		return bytesAfter - bytesBefore, countAfter - countBefore, sumAfter - sumBefore
+	}
+
+	smallBytes, smallCount, smallSeconds := post(16)
+	largeBytes, largeCount, largeSeconds := post(8 << 20)
+
+	if smallBytes != 16 || largeBytes != 8<<20 {
+		t.Fatalf("hashed bytes = %v and %v, want 16 and %d", smallBytes, largeBytes, 8<<20)
+	}
+	if smallCount != 1 || largeCount != 1 {
+		t.Fatalf("key build observations = %v and %v, want one per request", smallCount, largeCount)
+	}
+	if largeSeconds <= smallSeconds {
+		t.Fatalf("keying an 8MiB body took %vs, not longer than a 16-byte body (%vs)", largeSeconds, smallSeconds)
+	}
+}
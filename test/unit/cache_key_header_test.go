@@ -0,0 +1,235 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+func TestCacheKeyHeader_MatchesStoredKeyAndVariesByAccept(t *testing.T) {
+	banner("cache_key_header_test.go")
+	upstreamServer := startTextUpstream(t, "max-age=60", []byte("hello"))
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCacheKeyPrefix("dbg:")
+	reverseProxy.SetExposeCacheKey(true)
+
+	fetch := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/items?page=1", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec
+	}
+
+	miss := fetch("application/json")
+	hit := fetch("application/json")
+	if miss.Header().Get("X-Cache") != "MISS" || hit.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("expected MISS then HIT, got %q then %q", miss.Header().Get("X-Cache"), hit.Header().Get("X-Cache"))
+	}
+	jsonKey := miss.Header().Get("X-Cache-Key")
+	if jsonKey == "" || hit.Header().Get("X-Cache-Key") != jsonKey {
+		t.Fatalf("HIT key %q must equal the key stored on MISS %q", hit.Header().Get("X-Cache-Key"), jsonKey)
+	}
+	if !strings.HasPrefix(jsonKey, "dbg:|GET ") || !strings.Contains(jsonKey, "/items?page=1") || !strings.Contains(jsonKey, "|a=application/json") {
+		t.Fatalf("unexpected key layout %q", jsonKey)
+	}
+
+	htmlKey := fetch("text/html").Header().Get("X-Cache-Key")
+	if htmlKey == "" || htmlKey == jsonKey {
+		t.Fatalf("different Accept must produce a different key: %q vs %q", htmlKey, jsonKey)
+	}
+}
+
+func TestCacheKeyHeader_OffByDefault(t *testing.T) {
+	banner("cache_key_header_test.go")
+	upstreamServer := startTextUpstream(t, "max-age=60", []byte("hello"))
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if got := rec.Header().Get("X-Cache-Key"); got != "" {
+		t.Fatalf("X-Cache-Key must be absent by default, got %q", got)
+	}
+}
+
+func TestCacheKeyHeader_IgnoresRequestIDAndVolatileHeaders(t *testing.T) {
+	banner("cache_key_header_test.go")
+	upstreamServer := startTextUpstream(t, "max-age=60", []byte("hello"))
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetExposeCacheKey(true)
+
+	fetch := func(method, body, requestID, date string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/report", strings.NewReader(body))
+		req.Header.Set("X-Request-ID", requestID)
+		req.Header.Set("Date", date)
+		req.Header.Set("Traceparent", "00-"+strings.Repeat(requestID[:1], 32)+"-00f067aa0ba902b7-01")
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Same content, different request IDs, dates and trace context: one entry.
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		first := fetch(method, "same-body", "1111", "Mon, 02 Jan 2006 15:04:05 GMT")
+		second := fetch(method, "same-body", "2222", "Tue, 03 Jan 2006 15:04:05 GMT")
+		if first.Header().Get("X-Cache") != "MISS" || second.Header().Get("X-Cache") != "HIT" {
+			t.Fatalf("%s: expected MISS then HIT, got %q then %q", method, first.Header().Get("X-Cache"), second.Header().Get("X-Cache"))
+		}
+		key := first.Header().Get("X-Cache-Key")
+		if second.Header().Get("X-Cache-Key") != key || strings.Contains(key, "1111") || strings.Contains(key, "2006") {
+			t.Fatalf("%s: volatile headers leaked into the key: %q vs %q", method, key, second.Header().Get("X-Cache-Key"))
+		}
+	}
+}
+
+func TestCacheKeyHeader_NormalizeQuerySortsKeyButNotUpstream(t *testing.T) {
+	banner("cache_key_header_test.go")
+	var upstreamQueries []string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamQueries = append(upstreamQueries, r.URL.RawQuery)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("hello"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetExposeCacheKey(true)
+	reverseProxy.SetNormalizeQuery(true)
+
+	fetch := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	miss := fetch("/q?b=2&a=1&a=0")
+	if len(upstreamQueries) != 1 || upstreamQueries[0] != "b=2&a=1&a=0" {
+		t.Fatalf("upstream must receive the original query order, got %q", upstreamQueries)
+	}
+	if key := miss.Header().Get("X-Cache-Key"); !strings.Contains(key, "/q?a=1&a=0&b=2") {
+		t.Fatalf("expected sorted query in key (repeats kept in order), got %q", key)
+	}
+	if hit := fetch("/q?a=1&b=2&a=0"); hit.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("reordered query should HIT, got %q", hit.Header().Get("X-Cache"))
+	}
+	if other := fetch("/q?a=0&a=1&b=2"); other.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("different order of repeated parameters must not share an entry, got %q", other.Header().Get("X-Cache"))
+	}
+}
+
+func TestCacheKeyHeader_QueryFallbackServesStrippedEntry(t *testing.T) {
+	banner("cache_key_header_test.go")
+	var upstreamHits atomic.Int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("article"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetExposeCacheKey(true)
+	reverseProxy.SetCacheQueryFallback([]string{"/articles"})
+
+	fetch := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	if first := fetch("/articles/1"); first.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first request: X-Cache = %q, want MISS", first.Header().Get("X-Cache"))
+	}
+	hit := fetch("/articles/1?utm=x")
+	if hit.Header().Get("X-Cache") != "HIT" || hit.Body.String() != "article" {
+		t.Fatalf("?utm=x should HIT the query-stripped entry, got %q %q", hit.Header().Get("X-Cache"), hit.Body.String())
+	}
+	if key := hit.Header().Get("X-Cache-Key"); strings.Contains(key, "utm") {
+		t.Fatalf("fallback HIT should expose the stripped key, got %q", key)
+	}
+	if hits := upstreamHits.Load(); hits != 1 {
+		t.Fatalf("upstream hits = %d, want 1", hits)
+	}
+
+	// Paths outside the configured prefixes keep exact-key semantics.
+	fetch("/other")
+	if other := fetch("/other?utm=x"); other.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("unconfigured path must not fall back, got %q", other.Header().Get("X-Cache"))
+	}
+	// The prefix matches whole segments only.
+	fetch("/articles-private")
+	if sibling := fetch("/articles-private?utm=x"); sibling.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("/articles must not enable the fallback for /articles-private, got %q", sibling.Header().Get("X-Cache"))
+	}
+	// Without a stored stripped entry the request still goes upstream.
+	if cold := fetch("/articles/2?utm=y"); cold.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("cold fallback: X-Cache = %q, want MISS", cold.Header().Get("X-Cache"))
+	}
+}
+
+func TestCacheKeyHeader_UnkeyedVaryIsNotStored(t *testing.T) {
+	banner("cache_key_header_test.go")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The body reflects an unkeyed header and says so in Vary.
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Encoding, X-Original-Host")
+		_, _ = w.Write([]byte("host=" + r.Header.Get("X-Original-Host")))
+	}))
+	t.Cleanup(upstreamServer.Close)
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+
+	fetch := func(originalHost string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/home", nil)
+		if originalHost != "" {
+			req.Header.Set("X-Original-Host", originalHost)
+		}
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec
+	}
+
+	poisoned := fetch("evil.example")
+	if poisoned.Body.String() != "host=evil.example" || poisoned.Header().Get("X-Cache") == "MISS" {
+		t.Fatalf("response varying on an unkeyed header must not be stored: %q (X-Cache %q)", poisoned.Body.String(), poisoned.Header().Get("X-Cache"))
+	}
+	if clean := fetch(""); clean.Body.String() != "host=" || clean.Header().Get("X-Cache") == "HIT" {
+		t.Fatalf("a later request without the header got %q (X-Cache %q)", clean.Body.String(), clean.Header().Get("X-Cache"))
+	}
+}
+
+func TestCacheKeyHeader_KeyedHeadersAreNormalized(t *testing.T) {
+	banner("cache_key_header_test.go")
+	upstreamServer := startTextUpstream(t, "max-age=60", []byte("hello"))
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetExposeCacheKey(true)
+
+	fetch := func(acceptEncoding, unkeyed string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/normalized", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		req.Header.Set("X-Forwarded-Host", unkeyed)
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec
+	}
+
+	miss := fetch("gzip, br;q=0.5", "a.example")
+	hit := fetch("GZIP,br ; Q=0.5", "b.example")
+	if miss.Header().Get("X-Cache") != "MISS" || hit.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("equivalent Accept-Encoding spellings must share an entry: %q then %q", miss.Header().Get("X-Cache"), hit.Header().Get("X-Cache"))
+	}
+	if key := miss.Header().Get("X-Cache-Key"); !strings.Contains(key, "|ae=gzip,br;q=0.5") || strings.Contains(key, "a.example") {
+		t.Fatalf("unexpected normalized key %q", key)
+	}
+	if hit.Body.String() != miss.Body.String() {
+		t.Fatalf("requests differing only in an unkeyed header must get the same entry")
+	}
+}
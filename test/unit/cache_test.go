@@ -1,6 +1,7 @@
 package proxy_test
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -95,6 +96,44 @@ func TestCache_RespectsNoCacheRequestDirective(t *testing.T) {
 	}
 }
 
+func TestCache_ClientMinFreshRefetchesNearlyExpiredEntry(t *testing.T) {
+	// Verifies request "Cache-Control: min-fresh" refetches entries that expire too soon.
+	banner("cache_test.go")
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit := atomic.AddInt64(&upstreamHits, 1)
+		w.Header().Set("Cache-Control", "max-age=10")
+		_, _ = w.Write([]byte("v" + strconv.FormatInt(hit, 10)))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	proxyHandler := newProxy(t, mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true, nil)
+	fetch := func(cacheControl string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/nearly-expired", nil)
+		if cacheControl != "" {
+			req.Header.Set("Cache-Control", cacheControl)
+		}
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	fetch("")
+	if rec := fetch(""); rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("plain client: want HIT, got %q", rec.Header().Get("X-Cache"))
+	}
+
+	// At most 10s of freshness remain, less than the 30s the client requires.
+	if rec := fetch("min-fresh=30"); rec.Header().Get("X-Cache") != "MISS" || rec.Body.String() != "v2" {
+		t.Fatalf("min-fresh client: want MISS v2, got X-Cache=%q body=%q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+
+	// A requirement the entry satisfies is still a HIT.
+	if rec := fetch("min-fresh=5"); rec.Header().Get("X-Cache") != "HIT" || rec.Body.String() != "v2" {
+		t.Fatalf("satisfiable min-fresh: want HIT v2, got X-Cache=%q body=%q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+}
+
 func TestCache_ExpiryAndRefetch(t *testing.T) {
 	// Verifies entries expire after TTL and are refreshed on next access.
 	banner("cache_test.go")
@@ -356,8 +395,8 @@ func TestDisallowedMethod_NoCacheInteraction(t *testing.T) {
 	if atomic.LoadInt64(&upstreamHits) != 0 {
 		t.Fatalf("upstream should not have been called for disallowed method")
 	}
-	if v := disallowedRec.Header().Get("X-Cache"); v != "" {
-		t.Fatalf("did not expect X-Cache header on disallowed method, got %q", v)
+	if v := disallowedRec.Header().Get("X-Cache"); v != "BYPASS" {
+		t.Fatalf("expected X-Cache BYPASS on disallowed method, got %q", v)
 	}
 	if allow := disallowedRec.Header().Get("Allow"); allow != "GET" {
 		t.Fatalf("expected Allow header with GET, got %q", allow)
@@ -409,3 +448,983 @@ func TestAllowedMethod_CacheWorksWithRestriction(t *testing.T) {
 		t.Fatalf("expected 1 upstream hit, got %d", upstreamHits)
 	}
 }
+
+func TestCache_KeyPrefixIsolatesSharedCache(t *testing.T) {
+	// Two proxies sharing one cache with different key prefixes must not serve
+	// each other's entries, and a purge only clears the purging proxy's namespace.
+	banner("cache_test.go")
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("hello"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	targetURL, _ := url.Parse(upstreamServer.URL)
+	sharedCache := proxy.NewLRUCache(1024)
+
+	tenantA := proxy.NewReverseProxy(targetURL, sharedCache, true)
+	tenantA.SetHealthCheckEnabled(false)
+	tenantA.SetCacheKeyPrefix("tenant-a:")
+	tenantB := proxy.NewReverseProxy(targetURL, sharedCache, true)
+	tenantB.SetHealthCheckEnabled(false)
+	tenantB.SetCacheKeyPrefix("tenant-b:")
+
+	serve := func(handler http.Handler) string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/shared", nil))
+		return rec.Header().Get("X-Cache")
+	}
+
+	if got := serve(tenantA); got != "MISS" {
+		t.Fatalf("tenant A first request: want MISS, got %q", got)
+	}
+	if got := serve(tenantB); got != "MISS" {
+		t.Fatalf("tenant B must not see tenant A's entry: want MISS, got %q", got)
+	}
+	if got := atomic.LoadInt64(&upstreamHits); got != 2 {
+		t.Fatalf("expected 2 upstream hits, got %d", got)
+	}
+
+	// Purging tenant A leaves tenant B's namespace intact.
+	tenantA.PurgeCache()
+	if got := serve(tenantB); got != "HIT" {
+		t.Fatalf("tenant B entry should survive tenant A purge: want HIT, got %q", got)
+	}
+	if got := serve(tenantA); got != "MISS" {
+		t.Fatalf("tenant A entry should be purged: want MISS, got %q", got)
+	}
+}
+
+func TestCache_PurgeDoesNotReachLongerPrefix(t *testing.T) {
+	// A prefix that is a string prefix of another ("prod" / "prod-eu") must only purge its own keys.
+	banner("cache_test.go")
+	upstreamServer := startTextUpstream(t, "max-age=60", []byte("hello"))
+	sharedCache := proxy.NewLRUCache(1024)
+	newTenant := func(prefix string) *proxy.ReverseProxy {
+		reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), sharedCache, true)
+		reverseProxy.SetHealthCheckEnabled(false)
+		reverseProxy.SetCacheKeyPrefix(prefix)
+		return reverseProxy
+	}
+	prod, prodEU := newTenant("prod"), newTenant("prod-eu")
+
+	serve := func(handler http.Handler) string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/shared", nil))
+		return rec.Header().Get("X-Cache")
+	}
+	serve(prod)
+	serve(prodEU)
+
+	prod.PurgeCache()
+	if got := serve(prodEU); got != "HIT" {
+		t.Fatalf("purging prod must keep prod-eu's entry: want HIT, got %q", got)
+	}
+	if got := serve(prod); got != "MISS" {
+		t.Fatalf("prod entry should be purged: want MISS, got %q", got)
+	}
+}
+
+func TestCache_HEAD_ServedFromGETEntry(t *testing.T) {
+	// With share_head_get, a HEAD after a GET is a HIT from the GET entry with headers and no body.
+	banner("cache_test.go")
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("payload"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	targetURL, _ := url.Parse(upstreamServer.URL)
+	reverseProxy := proxy.NewReverseProxy(targetURL, proxy.NewLRUCache(64), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetShareHeadGet(true)
+
+	getRec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(getRec, httptest.NewRequest(http.MethodGet, "/doc", nil))
+	if xc := getRec.Header().Get("X-Cache"); xc != "MISS" {
+		t.Fatalf("warming GET: want MISS, got %q", xc)
+	}
+
+	headRec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(headRec, httptest.NewRequest(http.MethodHead, "/doc", nil))
+
+	if got := atomic.LoadInt64(&upstreamHits); got != 1 {
+		t.Fatalf("HEAD should not reach upstream, hits=%d", got)
+	}
+	if xc := headRec.Header().Get("X-Cache"); xc != "HIT" {
+		t.Fatalf("HEAD: want HIT, got %q", xc)
+	}
+	if headRec.Header().Get("ETag") != `"v1"` || headRec.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("HEAD should carry GET headers, got %v", headRec.Header())
+	}
+	if got := headRec.Header().Get("Content-Length"); got != strconv.Itoa(len("payload")) {
+		t.Fatalf("HEAD Content-Length: want %d, got %q", len("payload"), got)
+	}
+	if headRec.Body.Len() != 0 {
+		t.Fatalf("HEAD must not carry a body, got %q", headRec.Body.String())
+	}
+}
+
+func TestCache_MaxTTLCapsLongMaxAge(t *testing.T) {
+	// A year-long max-age is capped by max_ttl, so the entry expires quickly.
+	banner("cache_test.go")
+	proxy.SetCacheTTLBounds(0, 100*time.Millisecond)
+	t.Cleanup(func() { proxy.SetCacheTTLBounds(0, 0) })
+
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		w.Header().Set("Cache-Control", "public, max-age=31536000")
+		_, _ = w.Write([]byte("long-lived"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	targetURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := newProxy(t, targetURL, proxy.NewLRUCache(64), true, nil)
+	serve := func() string {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/capped", nil))
+		return rec.Header().Get("X-Cache")
+	}
+
+	if got := serve(); got != "MISS" {
+		t.Fatalf("first request: want MISS, got %q", got)
+	}
+	if got := serve(); got != "HIT" {
+		t.Fatalf("second request: want HIT, got %q", got)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if got := serve(); got != "MISS" {
+		t.Fatalf("entry should expire after max_ttl: want MISS, got %q", got)
+	}
+	if got := atomic.LoadInt64(&upstreamHits); got != 2 {
+		t.Fatalf("expected 2 upstream hits, got %d", got)
+	}
+}
+
+func TestCache_MinTTLFloorBypassesMaxAgeZero(t *testing.T) {
+	// max-age=0 is below the min_ttl floor and must not be cached.
+	banner("cache_test.go")
+	proxy.SetCacheTTLBounds(time.Second, 0)
+	t.Cleanup(func() { proxy.SetCacheTTLBounds(0, 0) })
+
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		w.Header().Set("Cache-Control", "public, max-age=0")
+		_, _ = w.Write([]byte("fleeting"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	targetURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := newProxy(t, targetURL, proxy.NewLRUCache(64), true, nil)
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/floor", nil))
+		if got := rec.Header().Get("X-Cache"); got != "BYPASS" {
+			t.Fatalf("request %d: want BYPASS below min_ttl, got %q", i+1, got)
+		}
+	}
+	if got := atomic.LoadInt64(&upstreamHits); got != 2 {
+		t.Fatalf("expected every request to reach upstream, got %d", got)
+	}
+}
+
+func TestCache_MaxAgeZeroBypassesWithoutMinTTL(t *testing.T) {
+	// With no min_ttl floor, max-age=0 still means "do not reuse": it must not be stored
+	// for the default TTL.
+	banner("cache_test.go")
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		w.Header().Set("Cache-Control", "public, max-age=0")
+		_, _ = w.Write([]byte("fleeting"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	targetURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := newProxy(t, targetURL, proxy.NewLRUCache(64), true, nil)
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/zero", nil))
+		if got := rec.Header().Get("X-Cache"); got != "BYPASS" {
+			t.Fatalf("request %d: want BYPASS for max-age=0, got %q", i+1, got)
+		}
+	}
+	if got := atomic.LoadInt64(&upstreamHits); got != 2 {
+		t.Fatalf("expected every request to reach upstream, got %d", got)
+	}
+}
+
+func TestCache_NeverCacheStatusesBypassRegardlessOfDirectives(t *testing.T) {
+	// A 301 listed in never_cache_statuses is not stored; a 200 still caches.
+	banner("cache_test.go")
+	proxy.SetNeverCacheStatuses([]int{http.StatusMovedPermanently})
+	t.Cleanup(func() { proxy.SetNeverCacheStatuses(nil) })
+
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		if r.URL.Path == "/moved" {
+			w.Header().Set("Location", "/new-home")
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	targetURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := newProxy(t, targetURL, proxy.NewLRUCache(64), true, nil)
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		rec := serve("/moved")
+		if rec.Code != http.StatusMovedPermanently {
+			t.Fatalf("request %d: want 301, got %d", i+1, rec.Code)
+		}
+		if got := rec.Header().Get("X-Cache"); got != "BYPASS" {
+			t.Fatalf("request %d: want BYPASS for never-cached 301, got %q", i+1, got)
+		}
+	}
+	if got := serve("/ok").Header().Get("X-Cache"); got != "MISS" {
+		t.Fatalf("first 200: want MISS, got %q", got)
+	}
+	if got := serve("/ok").Header().Get("X-Cache"); got != "HIT" {
+		t.Fatalf("second 200: want HIT, got %q", got)
+	}
+	if got := atomic.LoadInt64(&upstreamHits); got != 3 {
+		t.Fatalf("expected 3 upstream hits (2 redirects + 1 fill), got %d", got)
+	}
+}
+
+func TestCache_CookieRequestsBypassUnlessAllowlisted(t *testing.T) {
+	// Verifies session-cookie requests bypass a private-by-default cache entry while
+	// requests carrying only allowlisted cookies can still HIT.
+	banner("cache_test.go")
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("page"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(1024), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCookieCachePolicy(true, []string{"_ga"})
+
+	doGet := func(cookie string) string {
+		req := httptest.NewRequest(http.MethodGet, "/page", nil)
+		if cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec.Header().Get("X-Cache")
+	}
+
+	if got := doGet("_ga=GA1.2.3"); got != "MISS" {
+		t.Fatalf("allowlisted cookie first request: want MISS, got %q", got)
+	}
+	if got := doGet("_ga=GA1.2.3"); got != "HIT" {
+		t.Fatalf("allowlisted cookie second request: want HIT, got %q", got)
+	}
+	if got := doGet("session=abc; _ga=GA1.2.3"); got == "HIT" {
+		t.Fatalf("session cookie request must bypass the cache")
+	}
+	if hits := atomic.LoadInt64(&upstreamHits); hits != 2 {
+		t.Fatalf("expected 2 upstream hits, got %d", hits)
+	}
+}
+
+func TestCache_CookieRequestsHitPublicEntries(t *testing.T) {
+	// Verifies explicitly public responses remain cacheable for cookie-carrying requests.
+	banner("cache_test.go")
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		_, _ = w.Write([]byte("shared"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	proxyHandler := newProxy(t, mustURL(t, upstreamServer.URL), proxy.NewLRUCache(1024), true, nil)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/shared", nil)
+		req.Header.Set("Cookie", "session=abc")
+		proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if hits := atomic.LoadInt64(&upstreamHits); hits != 1 {
+		t.Fatalf("expected public response to be served from cache, got %d upstream hits", hits)
+	}
+}
+
+func TestCache_PerUpstreamKeySeparatesEntries(t *testing.T) {
+	// Verifies that with per-upstream keys, two upstreams serving different bodies for the
+	// same path get separate cache entries instead of sharing one.
+	banner("cache_test.go")
+	startBodyUpstream := func(body string, hits *int64) *httptest.Server {
+		upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(hits, 1)
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			_, _ = w.Write([]byte(body))
+		}))
+		t.Cleanup(upstreamServer.Close)
+		return upstreamServer
+	}
+	var hitsA, hitsB int64
+	upstreamA := startBodyUpstream("from-a", &hitsA)
+	upstreamB := startBodyUpstream("from-b", &hitsB)
+
+	reverseProxy := proxy.NewReverseProxyMulti(
+		[]*url.URL{mustURL(t, upstreamA.URL), mustURL(t, upstreamB.URL)},
+		proxy.NewLRUCache(1024), true,
+	)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetPerUpstreamCacheKey(true)
+
+	// Peeked target for a HIT does not advance round-robin, so the sequence is
+	// A (MISS, stored under A) -> B (MISS: A's entry is not shared) -> A (HIT).
+	wantSequence := []struct{ body, cacheStatus string }{
+		{"from-a", "MISS"},
+		{"from-b", "MISS"},
+		{"from-a", "HIT"},
+	}
+	for i, want := range wantSequence {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/same", nil))
+		if rec.Body.String() != want.body || rec.Header().Get("X-Cache") != want.cacheStatus {
+			t.Fatalf("request %d: want %s/%s, got %s/%s", i+1, want.body, want.cacheStatus, rec.Body.String(), rec.Header().Get("X-Cache"))
+		}
+	}
+	if atomic.LoadInt64(&hitsA) != 1 || atomic.LoadInt64(&hitsB) != 1 {
+		t.Fatalf("expected one upstream call each, got a=%d b=%d", hitsA, hitsB)
+	}
+}
+
+func TestCache_EvictionMetricAndPressureWarning(t *testing.T) {
+	// Verifies overflowing a small cache increments proxy_cache_evictions_total and
+	// fires the (throttled) eviction-pressure report once the rate is crossed.
+	banner("cache_test.go")
+	before, _ := scrapeMetric(t, "proxy_cache_evictions_total", "")
+
+	var pressureReports []int
+	lruCache := proxy.NewLRUCacheWithOptions(proxy.LRUCacheOptions{
+		MaxEntries:           2,
+		EvictionWarnRate:     5,
+		EvictionWarnInterval: time.Hour,
+		OnEvictionPressure: func(evictionsPerSecond int) {
+			pressureReports = append(pressureReports, evictionsPerSecond)
+		},
+	})
+
+	const inserts = 20
+	for i := 0; i < inserts; i++ {
+		lruCache.Set("k"+strconv.Itoa(i), &proxy.CachedResponse{StatusCode: http.StatusOK}, time.Minute)
+	}
+
+	wantEvictions := inserts - 2
+	if got := lruCache.Stats().Evictions; got != uint64(wantEvictions) {
+		t.Fatalf("expected %d evictions in stats, got %d", wantEvictions, got)
+	}
+	after, found := scrapeMetric(t, "proxy_cache_evictions_total", "")
+	if !found || after-before != float64(wantEvictions) {
+		t.Fatalf("expected proxy_cache_evictions_total to grow by %d, got %v -> %v", wantEvictions, before, after)
+	}
+	if len(pressureReports) != 1 || pressureReports[0] <= 5 {
+		t.Fatalf("expected exactly one throttled pressure report above the rate, got %v", pressureReports)
+	}
+
+	// Explicit deletes and purges are not capacity evictions.
+	lruCache.Delete("k" + strconv.Itoa(inserts-1))
+	lruCache.DeletePrefix("k")
+	if final, _ := scrapeMetric(t, "proxy_cache_evictions_total", ""); final != after {
+		t.Fatalf("deletes and purges changed proxy_cache_evictions_total: %v -> %v", after, final)
+	}
+}
+
+func TestCache_IfModifiedSinceReturns304OnHit(t *testing.T) {
+	// Verifies a HIT answers 304 without a body when the cached Last-Modified is not
+	// newer than the client's If-Modified-Since, and 200 when the entry is newer.
+	banner("cache_test.go")
+	lastModified := time.Date(2024, time.January, 10, 12, 0, 0, 0, time.UTC)
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		_, _ = w.Write([]byte("document"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	proxyHandler := newProxy(t, mustURL(t, upstreamServer.URL), proxy.NewLRUCache(1024), true, nil)
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/doc", nil))
+
+	conditional := func(since time.Time) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+		req.Header.Set("If-Modified-Since", since.Format(http.TimeFormat))
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := conditional(lastModified)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("expected 304 with empty body, got %d with %d bytes", rec.Code, rec.Body.Len())
+	}
+	if rec.Header().Get("X-Cache") != "HIT" || rec.Header().Get("Last-Modified") == "" {
+		t.Fatalf("expected HIT headers on 304, got %v", rec.Header())
+	}
+
+	rec = conditional(lastModified.Add(-time.Hour))
+	if rec.Code != http.StatusOK || rec.Body.String() != "document" {
+		t.Fatalf("expected full 200 when cached entry is newer, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestShardedCache_CorrectAcrossShards(t *testing.T) {
+	// Verifies keys spread over shards are stored, listed, deleted and counted correctly.
+	banner("cache_test.go")
+	shardedCache := proxy.NewShardedLRUCache(8, 1024)
+
+	const keyCount = 200
+	for i := 0; i < keyCount; i++ {
+		shardedCache.Set("tenant-a|k"+strconv.Itoa(i), &proxy.CachedResponse{StatusCode: http.StatusOK, Body: []byte(strconv.Itoa(i))}, time.Minute)
+	}
+	for i := 0; i < keyCount; i++ {
+		cached, found, stale := shardedCache.Get("tenant-a|k" + strconv.Itoa(i))
+		if !found || stale || string(cached.Body) != strconv.Itoa(i) {
+			t.Fatalf("key %d: found=%v stale=%v", i, found, stale)
+		}
+	}
+	if _, found, _ := shardedCache.Get("missing"); found {
+		t.Fatalf("unexpected hit for missing key")
+	}
+
+	stats := shardedCache.Stats()
+	if stats.Entries != keyCount || stats.Stores != keyCount || stats.Hits != keyCount || stats.Misses != 1 {
+		t.Fatalf("unexpected aggregated stats: %+v", stats)
+	}
+	if page, total := shardedCache.List(50, 180); total != keyCount || len(page) != 20 {
+		t.Fatalf("List: total=%d page=%d", total, len(page))
+	}
+
+	shardedCache.Delete("tenant-a|k0")
+	if removed := shardedCache.DeletePrefix("tenant-a|"); removed != keyCount-1 {
+		t.Fatalf("DeletePrefix removed %d, want %d", removed, keyCount-1)
+	}
+	if entries := shardedCache.Stats().Entries; entries != 0 {
+		t.Fatalf("expected empty cache, got %d entries", entries)
+	}
+}
+
+// BenchmarkCache_ParallelGet runs the same parallel HIT workload against the single-lock
+// cache (shards=1) and the sharded cache, so their results compare directly, e.g.
+// go test ./test/unit -run '^$' -bench ParallelGet -cpu 1,4,16 -count 10 | benchstat -.
+// Contention, and so any gain from sharding, only shows with -cpu > 1.
+func BenchmarkCache_ParallelGet(b *testing.B) {
+	const keyCount = 1024
+	keys := make([]string, keyCount)
+	for i := range keys {
+		keys[i] = "GET http://bench/item/" + strconv.Itoa(i)
+	}
+	for _, shards := range []int{1, 32} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			cacheStore := proxy.NewShardedLRUCache(shards, 4096)
+			for _, key := range keys {
+				cacheStore.Set(key, &proxy.CachedResponse{StatusCode: http.StatusOK}, time.Hour)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					cacheStore.Get(keys[i%keyCount])
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestCache_SweeperRemovesExpiredEntriesWithoutAccess(t *testing.T) {
+	banner("cache_test.go")
+	for _, shards := range []int{1, 4} {
+		cacheStore := proxy.NewShardedLRUCacheWithOptions(shards, proxy.LRUCacheOptions{
+			MaxEntries:    1024,
+			SweepInterval: 20 * time.Millisecond,
+		})
+		t.Cleanup(func() { _ = cacheStore.(io.Closer).Close() })
+
+		for i := 0; i < 600; i++ {
+			cacheStore.Set(fmt.Sprintf("short-%d", i), &proxy.CachedResponse{StatusCode: http.StatusOK}, 50*time.Millisecond)
+		}
+		cacheStore.Set("long", &proxy.CachedResponse{StatusCode: http.StatusOK}, time.Hour)
+		if got := cacheStore.Stats().Entries; got != 601 {
+			t.Fatalf("shards=%d: expected 601 entries after Set, got %d", shards, got)
+		}
+
+		// No Get/Set from here on: only the sweeper can shrink the cache.
+		deadline := time.Now().Add(2 * time.Second)
+		for cacheStore.Stats().Entries != 1 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		stats := cacheStore.Stats()
+		if stats.Entries != 1 || stats.Expired != 600 {
+			t.Fatalf("shards=%d: expected sweeper to leave 1 entry and expire 600, got entries=%d expired=%d", shards, stats.Entries, stats.Expired)
+		}
+	}
+}
+
+func TestCache_CustomKeyFuncIgnoresQuery(t *testing.T) {
+	// A path-only key function makes requests differing only by query share one entry.
+	banner("cache_test.go")
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		_, _ = w.Write([]byte("query=" + r.URL.RawQuery))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(64), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCacheKeyFunc(func(req *http.Request) (string, bool) {
+		return req.Method + " " + req.URL.Path, true
+	})
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	if got := serve("/items?utm=a").Header().Get("X-Cache"); got != "MISS" {
+		t.Fatalf("first request: want MISS, got %q", got)
+	}
+	rec := serve("/items?utm=b")
+	if got := rec.Header().Get("X-Cache"); got != "HIT" {
+		t.Fatalf("different query, same path: want HIT, got %q", got)
+	}
+	if rec.Body.String() != "query=utm=a" {
+		t.Fatalf("expected the first response to be replayed, got %q", rec.Body.String())
+	}
+	if got := atomic.LoadInt64(&upstreamHits); got != 1 {
+		t.Fatalf("expected 1 upstream hit, got %d", got)
+	}
+}
+
+func TestCache_CustomKeyFuncOptsRequestsOut(t *testing.T) {
+	// Returning false from the key function bypasses the cache for that request only.
+	banner("cache_test.go")
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(64), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCacheKeyFunc(func(req *http.Request) (string, bool) {
+		if strings.HasPrefix(req.URL.Path, "/private/") {
+			return "", false
+		}
+		return req.Method + " " + req.URL.Path, true
+	})
+
+	serve := func(path string) string {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Header().Get("X-Cache")
+	}
+	for i := 0; i < 2; i++ {
+		if got := serve("/private/profile"); got != "BYPASS" {
+			t.Fatalf("opted-out request %d: want BYPASS, got %q", i+1, got)
+		}
+	}
+	if got := serve("/public/page"); got != "MISS" {
+		t.Fatalf("first public request: want MISS, got %q", got)
+	}
+	if got := serve("/public/page"); got != "HIT" {
+		t.Fatalf("second public request: want HIT, got %q", got)
+	}
+	if got := atomic.LoadInt64(&upstreamHits); got != 3 {
+		t.Fatalf("expected 3 upstream hits, got %d", got)
+	}
+}
+
+func TestCache_XCachePresentOnEveryOutcome(t *testing.T) {
+	banner("cache_test.go")
+	upstreamServer := startTextUpstream(t, "max-age=60", []byte("hello"))
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetAllowedMethods([]string{http.MethodGet})
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/doc", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first GET: got %d X-Cache=%q, want 200 MISS", rec.Code, rec.Header().Get("X-Cache"))
+	}
+
+	rec = httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/doc", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("X-Cache") != "BYPASS" {
+		t.Fatalf("disallowed method: got %d X-Cache=%q, want 405 BYPASS", rec.Code, rec.Header().Get("X-Cache"))
+	}
+
+	// Health checks against a closed port leave no upstream to pick.
+	unreachableProxy := proxy.NewReverseProxy(closedServerURL(t), proxy.NewLRUCache(16), true)
+	unreachableProxy.SetHealthCheckEnabled(true)
+	rec = httptest.NewRecorder()
+	unreachableProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/doc", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("X-Cache") != "BYPASS" {
+		t.Fatalf("no upstream: got %d X-Cache=%q, want 503 BYPASS", rec.Code, rec.Header().Get("X-Cache"))
+	}
+
+	// /healthz is answered by the proxy itself and carries no cache outcome.
+	rec = httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if values := rec.Header().Values("X-Cache"); len(values) != 0 {
+		t.Fatalf("/healthz: X-Cache=%q, want none", values)
+	}
+}
+
+func TestCache_XCacheSingleValuedOnSharedResponses(t *testing.T) {
+	banner("cache_test.go")
+	upstreamServer := startTextUpstream(t, "no-store", []byte("hello"))
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCollapseForwarding(true, []string{"/reports/"})
+	reverseProxy.SetIdempotency(true, time.Minute)
+
+	assertSingle := func(name string, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		for _, header := range []string{"X-Cache", "X-Request-ID"} {
+			if values := rec.Header().Values(header); len(values) != 1 {
+				t.Fatalf("%s: %s=%q, want exactly one value", name, header, values)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/daily", nil))
+	assertSingle("collapsed GET", rec)
+
+	for _, name := range []string{"idempotent execution", "idempotent replay"} {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("{}"))
+		req.Header.Set("Idempotency-Key", "single-valued")
+		rec = httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		assertSingle(name, rec)
+	}
+}
+
+// BenchmarkProxy_UncachedRequest measures ServeHTTP for a response that is never stored,
+// with caching off (the fast path that skips all cache work) against caching on (key
+// build, lookup and response cacheability check), for each balancing strategy.
+func BenchmarkProxy_UncachedRequest(b *testing.B) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	}))
+	b.Cleanup(upstreamServer.Close)
+	targetURL, _ := url.Parse(upstreamServer.URL)
+
+	for _, strategy := range []string{"rr", "lc"} {
+		for _, cacheOn := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/cache=%v", strategy, cacheOn), func(b *testing.B) {
+				reverseProxy := proxy.NewReverseProxyMulti([]*url.URL{targetURL, targetURL}, proxy.NewLRUCache(16), cacheOn)
+				reverseProxy.SetHealthCheckEnabled(false)
+				reverseProxy.ConfigureBalancer(strategy)
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					rec := httptest.NewRecorder()
+					reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/bench", nil))
+					if rec.Code != http.StatusOK {
+						b.Fatalf("expected 200, got %d", rec.Code)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCache_DisabledPathMatchesBypass(t *testing.T) {
+	banner("cache_test.go")
+	upstreamServer := startHeaderEchoUpstream(t, "X-Request-ID")
+	targetURL := mustURL(t, upstreamServer.URL)
+
+	serve := func(cacheOn bool, requestID string) *httptest.ResponseRecorder {
+		reverseProxy := proxy.NewReverseProxy(targetURL, proxy.NewLRUCache(16), cacheOn)
+		reverseProxy.SetHealthCheckEnabled(false)
+		req := httptest.NewRequest(http.MethodPut, "/parity", strings.NewReader("payload"))
+		req.Header.Set("X-Request-ID", requestID)
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec
+	}
+
+	const metricLabels = `cache="BYPASS",method="PUT",status="200"`
+	for _, cacheOn := range []bool{true, false} {
+		requestID := fmt.Sprintf("parity-%v", cacheOn)
+		before, _ := scrapeMetric(t, "proxy_requests_total", metricLabels)
+		rec := serve(cacheOn, requestID)
+		if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "BYPASS" {
+			t.Fatalf("cacheOn=%v: got %d X-Cache=%q, want 200 BYPASS", cacheOn, rec.Code, rec.Header().Get("X-Cache"))
+		}
+		if rec.Header().Get("X-Request-ID") != requestID || rec.Header().Get("Echo-X-Request-ID") != requestID {
+			t.Fatalf("cacheOn=%v: request ID not propagated: client %q upstream %q", cacheOn,
+				rec.Header().Get("X-Request-ID"), rec.Header().Get("Echo-X-Request-ID"))
+		}
+		if after, _ := scrapeMetric(t, "proxy_requests_total", metricLabels); after != before+1 {
+			t.Fatalf("cacheOn=%v: expected one BYPASS request counted, before %v after %v", cacheOn, before, after)
+		}
+	}
+}
+
+func TestCache_PerKeyByteBudgetEvictsOldestVariants(t *testing.T) {
+	banner("cache_test.go")
+	body := strings.Repeat("x", 4096)
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	for _, shards := range []int{1, 4} {
+		t.Run(fmt.Sprintf("shards=%d", shards), func(t *testing.T) {
+			// Room for two 4 KiB variants per resource, not three.
+			cacheStore := proxy.NewShardedLRUCacheWithOptions(shards, proxy.LRUCacheOptions{MaxEntries: 64, MaxBytesPerKey: 10 * 1024})
+			handler := newProxy(t, mustURL(t, upstreamServer.URL), cacheStore, true, nil)
+
+			fetch := func(path, accept string) string {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.Header.Set("Accept", accept)
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				return rec.Header().Get("X-Cache")
+			}
+
+			fetch("/other", "text/plain")
+			for _, accept := range []string{"text/a", "text/b", "text/c"} {
+				if state := fetch("/doc", accept); state != "MISS" {
+					t.Fatalf("first fetch of variant %s: X-Cache=%s, want MISS", accept, state)
+				}
+			}
+
+			if state := fetch("/doc", "text/a"); state != "MISS" {
+				t.Fatalf("oldest variant should have been evicted by the byte budget, got X-Cache=%s", state)
+			}
+			if state := fetch("/doc", "text/c"); state != "HIT" {
+				t.Fatalf("newest variant should stay cached, got X-Cache=%s", state)
+			}
+			if state := fetch("/other", "text/plain"); state != "HIT" {
+				t.Fatalf("other resources are not charged to /doc's budget, got X-Cache=%s", state)
+			}
+		})
+	}
+}
+
+func TestCache_PerKeyByteBudgetFollowsVariantRecency(t *testing.T) {
+	banner("cache_test.go")
+	// Room for two 4 KiB variants per resource, not three.
+	cacheStore := proxy.NewLRUCacheWithOptions(proxy.LRUCacheOptions{MaxEntries: 64, MaxBytesPerKey: 10 * 1024})
+	body := []byte(strings.Repeat("x", 4096))
+	store := func(key string) {
+		cacheStore.Set(key, &proxy.CachedResponse{StatusCode: http.StatusOK, Body: body}, time.Minute)
+	}
+
+	store("GET /doc|a=text/a")
+	store("GET /doc|a=text/b")
+	// Reading variant a makes b the least recently used variant of /doc.
+	if _, found, _ := cacheStore.Get("GET /doc|a=text/a"); !found {
+		t.Fatalf("variant a missing before the budget is exceeded")
+	}
+	store("GET /doc|a=text/c")
+
+	if _, found, _ := cacheStore.Get("GET /doc|a=text/b"); found {
+		t.Fatalf("least recently used variant b should have been evicted")
+	}
+	for _, key := range []string{"GET /doc|a=text/a", "GET /doc|a=text/c"} {
+		if _, found, _ := cacheStore.Get(key); !found {
+			t.Fatalf("%s should stay cached", key)
+		}
+	}
+}
+
+func TestCache_OnlyIfCachedServesHitsAndNeverForwardsMisses(t *testing.T) {
+	banner("cache_test.go")
+	var upstreamCalls int64
+	upstreamServer := startCountingUpstream(t, &upstreamCalls)
+	handler := newProxy(t, mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true, nil)
+
+	fetch := func(path, cacheControl string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if cacheControl != "" {
+			req.Header.Set("Cache-Control", cacheControl)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Warm one entry, then ask for it with only-if-cached.
+	fetch("/cached", "")
+	if rec := fetch("/cached", "only-if-cached"); rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("stored entry under only-if-cached: status=%d X-Cache=%s, want 200 HIT", rec.Code, rec.Header().Get("X-Cache"))
+	}
+
+	before := atomic.LoadInt64(&upstreamCalls)
+	rec := fetch("/never-stored", "only-if-cached")
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("miss under only-if-cached: status=%d, want 504", rec.Code)
+	}
+	if calls := atomic.LoadInt64(&upstreamCalls); calls != before {
+		t.Fatalf("only-if-cached miss reached the upstream (%d calls, want %d)", calls, before)
+	}
+}
+
+func TestCache_HeuristicFreshnessFromLastModified(t *testing.T) {
+	banner("cache_test.go")
+	proxy.SetHeuristicFreshness(true)
+	t.Cleanup(func() { proxy.SetHeuristicFreshness(false) })
+
+	now := time.Now()
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		age := 100 * time.Second // recently modified -> ~10s
+		if r.URL.Path == "/old" {
+			age = 10 * 24 * time.Hour // modified ten days ago -> ~1 day
+		}
+		w.Header().Set("Last-Modified", now.Add(-age).UTC().Format(http.TimeFormat))
+		_, _ = w.Write([]byte("body"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	cacheStore := proxy.NewLRUCache(16)
+	proxyHandler := newProxy(t, mustURL(t, upstreamServer.URL), cacheStore, true, nil)
+	ttlOf := func(path string) time.Duration {
+		proxyHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		entries, _ := cacheStore.List(16, 0)
+		for _, entry := range entries {
+			if strings.Contains(entry.Key, path+"|") {
+				return entry.ExpiresAt.Sub(entry.StoredAt)
+			}
+		}
+		t.Fatalf("no cache entry for %s", path)
+		return 0
+	}
+
+	recentTTL, oldTTL := ttlOf("/recent"), ttlOf("/old")
+	if recentTTL < 8*time.Second || recentTTL > 12*time.Second {
+		t.Fatalf("recently modified: heuristic TTL %v, want ~10s", recentTTL)
+	}
+	if oldTTL < 23*time.Hour || oldTTL > 25*time.Hour {
+		t.Fatalf("modified ten days ago: heuristic TTL %v, want ~24h", oldTTL)
+	}
+
+	// max_ttl still caps the heuristic.
+	proxy.SetCacheTTLBounds(0, time.Hour)
+	t.Cleanup(func() { proxy.SetCacheTTLBounds(0, 0) })
+	cacheStore.Purge()
+	if cappedTTL := ttlOf("/old"); cappedTTL > time.Hour+time.Second {
+		t.Fatalf("heuristic TTL %v should be capped at max_ttl 1h", cappedTTL)
+	}
+}
+
+func TestCache_StatusTTLsReplaceDefaultBelowDirectives(t *testing.T) {
+	banner("cache_test.go")
+	proxy.SetStatusTTLs([]proxy.StatusTTL{
+		{MinStatus: 200, MaxStatus: 200, TTL: 60 * time.Second},
+		{MinStatus: 400, MaxStatus: 499, TTL: 30 * time.Second},
+		{MinStatus: 404, MaxStatus: 404, TTL: 5 * time.Second},
+	})
+	t.Cleanup(func() { proxy.SetStatusTTLs(nil) })
+
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/explicit":
+			w.Header().Set("Cache-Control", "max-age=7")
+		}
+		_, _ = w.Write([]byte("body"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	cacheStore := proxy.NewLRUCache(16)
+	proxyHandler := newProxy(t, mustURL(t, upstreamServer.URL), cacheStore, true, nil)
+	ttlOf := func(path string) time.Duration {
+		proxyHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		entries, _ := cacheStore.List(16, 0)
+		for _, entry := range entries {
+			if strings.Contains(entry.Key, path+"|") {
+				return entry.ExpiresAt.Sub(entry.StoredAt).Round(time.Second)
+			}
+		}
+		t.Fatalf("no cache entry for %s", path)
+		return 0
+	}
+
+	if ttl := ttlOf("/ok"); ttl != 60*time.Second {
+		t.Fatalf("200 without directives: TTL %v, want 60s", ttl)
+	}
+	// The exact 404 rule is narrower than 4xx.
+	if ttl := ttlOf("/missing"); ttl != 5*time.Second {
+		t.Fatalf("404 without directives: TTL %v, want 5s", ttl)
+	}
+	// Explicit upstream freshness beats the status mapping.
+	if ttl := ttlOf("/explicit"); ttl != 7*time.Second {
+		t.Fatalf("200 with max-age=7: TTL %v, want 7s", ttl)
+	}
+}
+
+func TestCache_TTLJitterSpreadsExpirations(t *testing.T) {
+	banner("cache_test.go")
+	proxy.SetCacheTTLJitter(0.2)
+	t.Cleanup(func() { proxy.SetCacheTTLJitter(0) })
+
+	cacheStore := proxy.NewLRUCache(512)
+	const ttl = 100 * time.Second
+	storedAt := time.Now()
+	for i := 0; i < 200; i++ {
+		cacheStore.Set(fmt.Sprintf("k%d", i), &proxy.CachedResponse{StatusCode: http.StatusOK}, ttl)
+	}
+
+	earliest, latest := time.Duration(1<<62), time.Duration(0)
+	for i := 0; i < 200; i++ {
+		entry, ok, _ := cacheStore.Get(fmt.Sprintf("k%d", i))
+		if !ok {
+			t.Fatalf("entry k%d missing", i)
+		}
+		lifetime := entry.ExpiresAt.Sub(storedAt)
+		// Jitter only shortens: every entry expires within [80s, 100s] of being stored.
+		if lifetime < 80*time.Second-time.Second || lifetime > ttl+time.Second {
+			t.Fatalf("k%d lifetime %v outside the jitter window", i, lifetime)
+		}
+		earliest, latest = min(earliest, lifetime), max(latest, lifetime)
+	}
+	if spread := latest - earliest; spread < 10*time.Second {
+		t.Fatalf("expirations not spread out: %v between earliest and latest", spread)
+	}
+
+	// Without jitter every entry gets the exact TTL.
+	proxy.SetCacheTTLJitter(0)
+	cacheStore.Set("exact", &proxy.CachedResponse{StatusCode: http.StatusOK}, ttl)
+	if entry, _, _ := cacheStore.Get("exact"); time.Until(entry.ExpiresAt) < ttl-time.Second {
+		t.Fatalf("no jitter expected, expires in %v", time.Until(entry.ExpiresAt))
+	}
+}
@@ -0,0 +1,229 @@
+package proxy_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+func TestCollapse_ConcurrentGetsShareOneUpstreamCall(t *testing.T) {
+	banner("collapse_test.go")
+	var upstreamHits int64
+	release := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		<-release
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write([]byte("fresh-report"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCollapseForwarding(true, []string{"/reports/"})
+
+	const clients = 8
+	bodies := make([]string, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/daily", nil))
+			bodies[i] = rec.Body.String()
+		}(i)
+	}
+	// Let every client join the in-flight call before the upstream answers.
+	time.Sleep(150 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt64(&upstreamHits); got != 1 {
+		t.Fatalf("expected 1 upstream hit for %d concurrent GETs, got %d", clients, got)
+	}
+	for i, body := range bodies {
+		if body != "fresh-report" {
+			t.Fatalf("client %d got body %q", i, body)
+		}
+	}
+
+	// The collapsed response is not stored: the next request goes upstream again.
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/daily", nil))
+	if got := atomic.LoadInt64(&upstreamHits); got != 2 {
+		t.Fatalf("expected a fresh upstream hit after the collapsed call, got %d hits", got)
+	}
+}
+
+func TestCollapse_PathsOutsideAllowlistAreNotCollapsed(t *testing.T) {
+	banner("collapse_test.go")
+	var upstreamHits int64
+	release := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		<-release
+		w.Header().Set("Cache-Control", "no-store")
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCollapseForwarding(true, []string{"/reports/"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reverseProxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/live", nil))
+		}()
+	}
+	time.Sleep(150 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt64(&upstreamHits); got != 3 {
+		t.Fatalf("expected 3 upstream hits outside the allowlist, got %d", got)
+	}
+}
+
+// The shared upstream call does not belong to the first client: when it goes away, the
+// clients still waiting receive the response.
+func TestCollapse_LeaderCancellationDoesNotFailFollowers(t *testing.T) {
+	banner("collapse_test.go")
+	var upstreamHits int64
+	release := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		<-release
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write([]byte("fresh-report"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCollapseForwarding(true, []string{"/reports/"})
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan struct{})
+	go func() {
+		defer close(leaderDone)
+		req := httptest.NewRequest(http.MethodGet, "/reports/daily", nil).WithContext(leaderCtx)
+		reverseProxy.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	follower := httptest.NewRecorder()
+	followerDone := make(chan struct{})
+	go func() {
+		defer close(followerDone)
+		reverseProxy.ServeHTTP(follower, httptest.NewRequest(http.MethodGet, "/reports/daily", nil))
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cancelLeader()
+	<-leaderDone
+	close(release)
+	<-followerDone
+
+	if follower.Code != http.StatusOK || follower.Body.String() != "fresh-report" {
+		t.Fatalf("follower got %d %q after the leader left", follower.Code, follower.Body.String())
+	}
+	if got := atomic.LoadInt64(&upstreamHits); got != 1 {
+		t.Fatalf("expected 1 upstream hit, got %d", got)
+	}
+}
+
+func TestCollapse_FollowersReleaseLeastConnectionsReservations(t *testing.T) {
+	banner("collapse_test.go")
+	release := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write([]byte("report"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	upstreamURL := mustURL(t, upstreamServer.URL)
+	reverseProxy := proxy.NewReverseProxyMulti([]*url.URL{upstreamURL}, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.ConfigureBalancer("lc")
+	reverseProxy.SetCollapseForwarding(true, []string{"/reports/"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reverseProxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/reports/daily", nil))
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// Every follower's pick must be returned, or lc sees the target as permanently busy.
+	label := `upstream="` + upstreamURL.Host + `"`
+	if pending, ok := scrapeMetric(t, "proxy_upstream_pending_selections", label); !ok || pending != 0 {
+		t.Fatalf("expected pending selections back at 0, got %v (found=%v)", pending, ok)
+	}
+}
+
+func TestCollapse_ClientNetworkPoolsDoNotShareResponses(t *testing.T) {
+	banner("collapse_test.go")
+	release := make(chan struct{})
+	startPoolUpstream := func(body string) *httptest.Server {
+		upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.Header().Set("Cache-Control", "no-store")
+			_, _ = w.Write([]byte(body))
+		}))
+		t.Cleanup(upstreamServer.Close)
+		return upstreamServer
+	}
+	externalServer := startPoolUpstream("external")
+	internalServer := startPoolUpstream("internal")
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, externalServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCollapseForwarding(true, []string{"/reports/"})
+	if err := reverseProxy.SetClientNetworkPools([]proxy.ClientNetworkPool{{
+		Name:    "internal",
+		CIDRs:   []string{"10.0.0.0/8"},
+		Targets: []*url.URL{mustURL(t, internalServer.URL)},
+	}}); err != nil {
+		t.Fatalf("SetClientNetworkPools: %v", err)
+	}
+
+	// An internal and an external client request the same path while both are in flight.
+	remoteAddrs := []string{"10.1.2.3:1234", "203.0.113.9:1234"}
+	bodies := make([]string, len(remoteAddrs))
+	var wg sync.WaitGroup
+	for i, remoteAddr := range remoteAddrs {
+		wg.Add(1)
+		go func(i int, remoteAddr string) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/reports/daily", nil)
+			req.RemoteAddr = remoteAddr
+			rec := httptest.NewRecorder()
+			reverseProxy.ServeHTTP(rec, req)
+			bodies[i] = rec.Body.String()
+		}(i, remoteAddr)
+		time.Sleep(50 * time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if bodies[0] != "internal" || bodies[1] != "external" {
+		t.Fatalf("each pool must get its own response, got internal=%q external=%q", bodies[0], bodies[1])
+	}
+}
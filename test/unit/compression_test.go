@@ -0,0 +1,266 @@
+package proxy_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// startTextUpstream serves a fixed text body with the given Cache-Control value.
+func startTextUpstream(t *testing.T, cacheControl string, body []byte) *httptest.Server {
+	t.Helper()
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", cacheControl)
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(upstreamServer.Close)
+	return upstreamServer
+}
+
+func TestCompression_GzipWhenAccepted(t *testing.T) {
+	banner("compression_test.go")
+	body := []byte(strings.Repeat("compress me please ", 100))
+	upstreamServer := startTextUpstream(t, "no-store", body)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCompression(true, 0)
+
+	req := httptest.NewRequest(http.MethodGet, "/text", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("expected gzip Content-Encoding, got %q", got)
+	}
+	gzipReader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	decoded, _ := io.ReadAll(gzipReader)
+	if !bytes.Equal(decoded, body) {
+		t.Fatalf("decompressed body mismatch")
+	}
+}
+
+func TestCompression_NoTransformPassesThroughUnchanged(t *testing.T) {
+	banner("compression_test.go")
+	body := []byte(strings.Repeat("do not touch ", 100))
+	upstreamServer := startTextUpstream(t, "no-store, no-transform", body)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCompression(true, 0)
+
+	req := httptest.NewRequest(http.MethodGet, "/text", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Fatalf("no-transform response must not be compressed, got Content-Encoding %q", got)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), body) {
+		t.Fatalf("no-transform body must pass through byte-for-byte")
+	}
+}
+
+func TestRequestDecompression_UpstreamReceivesDecodedBody(t *testing.T) {
+	banner("compression_test.go")
+	type received struct {
+		body            string
+		contentEncoding string
+		contentLength   int64
+	}
+	receivedCh := make(chan received, 1)
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receivedCh <- received{string(body), r.Header.Get("Content-Encoding"), r.ContentLength}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetRequestDecompression(true, 1024)
+
+	plain := `{"hello":"world"}`
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, _ = gzipWriter.Write([]byte(plain))
+	_ = gzipWriter.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/submit", bytes.NewReader(compressed.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	got := <-receivedCh
+	if got.body != plain {
+		t.Fatalf("upstream body = %q, want decoded %q", got.body, plain)
+	}
+	if got.contentEncoding != "" || got.contentLength != int64(len(plain)) {
+		t.Fatalf("expected Content-Encoding removed and Content-Length %d, got %q/%d", len(plain), got.contentEncoding, got.contentLength)
+	}
+
+	// A body that decodes past the cap is rejected before reaching the upstream.
+	var bomb bytes.Buffer
+	gzipWriter = gzip.NewWriter(&bomb)
+	_, _ = gzipWriter.Write(bytes.Repeat([]byte("a"), 4096))
+	_ = gzipWriter.Close()
+	req = httptest.NewRequest(http.MethodPost, "/submit", bytes.NewReader(bomb.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for oversize decoded body, got %d", rec.Code)
+	}
+}
+
+func TestCompression_BrotliPreferredWhenEnabled(t *testing.T) {
+	banner("compression_test.go")
+	body := []byte(strings.Repeat("brotli squeezes text ", 100))
+	upstreamServer := startTextUpstream(t, "no-store", body)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCompression(true, 0)
+	reverseProxy.SetCompressionBrotli(true)
+
+	fetch := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/text", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := fetch("gzip, deflate, br")
+	if got := rec.Header().Get("Content-Encoding"); got != "br" {
+		t.Fatalf("expected br Content-Encoding, got %q", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Fatalf("expected Vary: Accept-Encoding, got %q", got)
+	}
+	decoded, err := io.ReadAll(brotli.NewReader(rec.Body))
+	if err != nil || !bytes.Equal(decoded, body) {
+		t.Fatalf("brotli body mismatch (err %v)", err)
+	}
+
+	// Falls back to gzip when br is refused or weighted lower, and to identity otherwise.
+	for acceptEncoding, want := range map[string]string{
+		"gzip, br;q=0":     "gzip",
+		"br;q=0.5, gzip":   "gzip",
+		"identity":         "",
+		"br;q=1, gzip;q=1": "br",
+	} {
+		if got := fetch(acceptEncoding).Header().Get("Content-Encoding"); got != want {
+			t.Fatalf("Accept-Encoding %q: got %q, want %q", acceptEncoding, got, want)
+		}
+	}
+
+	// Without the brotli switch, br-only clients get identity.
+	reverseProxy.SetCompressionBrotli(false)
+	if got := fetch("br").Header().Get("Content-Encoding"); got != "" {
+		t.Fatalf("br must not be used when disabled, got %q", got)
+	}
+}
+
+func TestCompression_StoreCompressedServesCachedVariant(t *testing.T) {
+	banner("compression_test.go")
+	body := []byte(strings.Repeat("hot compressible asset ", 100))
+	upstreamServer := startTextUpstream(t, "max-age=60", body)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCompression(true, 0)
+	reverseProxy.SetStoreCompressed(true)
+
+	fetch := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/stored-gzip", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec
+	}
+	gzipCount := func() float64 {
+		value, _ := scrapeMetric(t, "proxy_compressed_responses_total", `encoding="gzip"`)
+		return value
+	}
+
+	before := gzipCount()
+	miss := fetch("gzip")
+	hit := fetch("gzip")
+	if miss.Header().Get("X-Cache") != "MISS" || hit.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("expected MISS then HIT, got %q then %q", miss.Header().Get("X-Cache"), hit.Header().Get("X-Cache"))
+	}
+	if got := gzipCount() - before; got != 1 {
+		t.Fatalf("the HIT must reuse the stored gzip body, compressions=%v", got)
+	}
+	if hit.Header().Get("Content-Encoding") != "gzip" || hit.Header().Get("Vary") != "Accept-Encoding" || !bytes.Equal(hit.Body.Bytes(), miss.Body.Bytes()) {
+		t.Fatalf("HIT must carry the stored gzip variant: encoding %q vary %q", hit.Header().Get("Content-Encoding"), hit.Header().Get("Vary"))
+	}
+	if hit.Header().Get("Content-Length") != strconv.Itoa(hit.Body.Len()) {
+		t.Fatalf("Content-Length %q does not match the %d body bytes", hit.Header().Get("Content-Length"), hit.Body.Len())
+	}
+
+	// Identity clients get their own, uncompressed variant.
+	if identity := fetch(""); identity.Header().Get("Content-Encoding") != "" || !bytes.Equal(identity.Body.Bytes(), body) {
+		t.Fatalf("identity variant must be uncompressed, got encoding %q", identity.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestCompression_ReencodedBodiesCarryWeakETag(t *testing.T) {
+	banner("compression_test.go")
+	body := []byte(strings.Repeat("tagged compressible asset ", 100))
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetCompression(true, 0)
+	reverseProxy.SetStoreCompressed(true)
+
+	fetch := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/tagged", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The proxy's gzip bytes are not the upstream's tagged representation: MISS and the
+	// stored variant's HIT both carry the weak form.
+	for _, wantCache := range []string{"MISS", "HIT"} {
+		rec := fetch("gzip")
+		if rec.Header().Get("X-Cache") != wantCache || rec.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("gzip %s: X-Cache %q encoding %q", wantCache, rec.Header().Get("X-Cache"), rec.Header().Get("Content-Encoding"))
+		}
+		if got := rec.Header().Get("ETag"); got != `W/"v1"` {
+			t.Fatalf("gzip %s: ETag %q, want W/\"v1\"", wantCache, got)
+		}
+	}
+	// The identity body is the upstream's own, so its strong ETag stays.
+	if got := fetch("").Header().Get("ETag"); got != `"v1"` {
+		t.Fatalf("identity ETag %q, want \"v1\"", got)
+	}
+}
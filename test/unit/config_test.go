@@ -0,0 +1,259 @@
+package proxy_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"traefik-challenge-2/internal/config"
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// loadConfigYAML writes configYAML as configs/config.yaml in a temp dir and loads it from there.
+func loadConfigYAML(t *testing.T, configYAML string) (*config.Config, error) {
+	t.Helper()
+	tempDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tempDir, "configs"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "configs", "config.yaml"), []byte(configYAML), 0o600); err != nil {
+		t.Fatalf("write cfg: %v", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	return config.Load()
+}
+
+func TestConfig_RejectsDuplicateTargets(t *testing.T) {
+	banner("config_test.go")
+	cases := []struct {
+		name string
+		yaml string
+	}{
+		{"same url twice", `proxy:
+  targets: ["http://backend:9000", "http://backend:9000"]
+`},
+		{"default port and case differ", `proxy:
+  targets: ["http://Backend", "http://backend:80/"]
+`},
+		{"primary repeated as backup", `proxy:
+  targets: ["http://backend:9000"]
+  backup_targets: ["http://backend:9000"]
+`},
+		{"rich form duplicate", `proxy:
+  targets:
+    - "http://backend:9000"
+    - url: "http://backend:9000"
+      weight: 2
+`},
+	}
+	for _, tc := range cases {
+		if _, err := loadConfigYAML(t, tc.yaml); err == nil || !strings.Contains(err.Error(), "duplicate target") {
+			t.Fatalf("%s: expected a duplicate target error, got %v", tc.name, err)
+		}
+	}
+
+	// Distinct ports of one host are different upstreams.
+	if _, err := loadConfigYAML(t, `proxy:
+  targets: ["http://backend:9000", "http://backend:9001"]
+`); err != nil {
+		t.Fatalf("distinct targets rejected: %v", err)
+	}
+}
+
+func TestConfig_MaxTargetsCap(t *testing.T) {
+	banner("config_test.go")
+	_, err := loadConfigYAML(t, `proxy:
+  max_targets: 2
+  targets: ["http://a:9000", "http://b:9000"]
+  backup_targets: ["http://c:9000"]
+`)
+	if err == nil || !strings.Contains(err.Error(), "max_targets") {
+		t.Fatalf("expected max_targets error for 3 targets with cap 2, got %v", err)
+	}
+
+	cfg, err := loadConfigYAML(t, `proxy:
+  max_targets: 2
+  targets: ["http://a:9000", "http://b:9000"]
+`)
+	if err != nil {
+		t.Fatalf("targets within the cap rejected: %v", err)
+	}
+	if len(cfg.TargetURLs) != 2 {
+		t.Fatalf("expected 2 targets, got %d", len(cfg.TargetURLs))
+	}
+}
+
+func TestConfig_StatusTTLKeys(t *testing.T) {
+	banner("config_test.go")
+	t.Cleanup(func() { proxy.SetStatusTTLs(nil) })
+	cfg, err := loadConfigYAML(t, `proxy:
+  targets: ["http://backend:9000"]
+  cache:
+    status_ttls: {"404": "5s", "4xx": "30s", "200-299": "1m"}
+`)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	got := map[[2]int]time.Duration{}
+	for _, rule := range cfg.Cache.StatusTTLs {
+		got[[2]int{rule.MinStatus, rule.MaxStatus}] = rule.TTL
+	}
+	want := map[[2]int]time.Duration{{404, 404}: 5 * time.Second, {400, 499}: 30 * time.Second, {200, 299}: time.Minute}
+	for statusRange, ttl := range want {
+		if got[statusRange] != ttl {
+			t.Fatalf("status_ttls %v: got %v, want %v (all: %v)", statusRange, got[statusRange], ttl, got)
+		}
+	}
+
+	for _, badKey := range []string{"6xx", "abc", "499-400", "99"} {
+		if _, err := loadConfigYAML(t, `proxy:
+  targets: ["http://backend:9000"]
+  cache:
+    status_ttls: {"`+badKey+`": "5s"}
+`); err == nil || !strings.Contains(err.Error(), "status_ttls") {
+			t.Fatalf("status key %q: expected a status_ttls error, got %v", badKey, err)
+		}
+	}
+}
+
+func TestConfig_LoadBalancerStrategyValidated(t *testing.T) {
+	banner("config_test.go")
+	cfg, err := loadConfigYAML(t, `proxy:
+  targets: ["http://a:9000", "http://b:9000"]
+  load_balancer_strategy: Least-Connections
+`)
+	if err != nil {
+		t.Fatalf("known alias rejected: %v", err)
+	}
+	reverseProxy := proxy.NewReverseProxyMulti(cfg.TargetURLs, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	if err := reverseProxy.ConfigureBalancer(cfg.LoadBalancerStrategy); err != nil {
+		t.Fatalf("ConfigureBalancer(%q): %v", cfg.LoadBalancerStrategy, err)
+	}
+
+	_, err = loadConfigYAML(t, `proxy:
+  targets: ["http://a:9000"]
+  load_balancer_strategy: leastconn
+`)
+	if err == nil || !strings.Contains(err.Error(), "load_balancer_strategy") || !strings.Contains(err.Error(), "leastconn") {
+		t.Fatalf("expected an unknown-strategy error for leastconn, got %v", err)
+	}
+	if err := reverseProxy.ConfigureBalancer("leastconn"); err == nil {
+		t.Fatalf("ConfigureBalancer must reject unknown strategies")
+	}
+}
+
+func TestConfig_TargetsWithoutSchemeAssumeHTTP(t *testing.T) {
+	banner("config_test.go")
+	cfg, err := loadConfigYAML(t, `proxy:
+  targets: ["localhost:9000", {url: "reports:9100", timeout: "5s"}]
+  backup_targets: ["backup"]
+`)
+	if err != nil {
+		t.Fatalf("host-only targets rejected: %v", err)
+	}
+	if got := cfg.TargetURLs[0].String(); got != "http://localhost:9000" {
+		t.Fatalf("target = %q, want http://localhost:9000", got)
+	}
+	if got := cfg.TargetOptions[0].URL.String(); got != "http://reports:9100" {
+		t.Fatalf("rich-form target = %q, want http://reports:9100", got)
+	}
+	if got := cfg.BackupTargetURLs[0].String(); got != "http://backup" {
+		t.Fatalf("backup target = %q, want http://backup", got)
+	}
+
+	cfg, err = loadConfigYAML(t, `proxy:
+  assume_scheme: https
+  targets: ["secure.internal:8443"]
+`)
+	if err != nil || cfg.TargetURLs[0].String() != "https://secure.internal:8443" {
+		t.Fatalf("assume_scheme https: cfg=%v err=%v", cfg, err)
+	}
+
+	for name, configYAML := range map[string]string{
+		"invalid host":       "proxy:\n  targets: [\"local host:9000\"]\n",
+		"empty host":         "proxy:\n  targets: [\"http://\"]\n",
+		"missing scheme":     "proxy:\n  targets: [\"://backend:9000\"]\n",
+		"strict mode":        "proxy:\n  assume_scheme: \"\"\n  targets: [\"localhost:9000\"]\n",
+		"bad assumed scheme": "proxy:\n  assume_scheme: ftp\n  targets: [\"localhost:9000\"]\n",
+	} {
+		if _, err := loadConfigYAML(t, configYAML); err == nil {
+			t.Fatalf("%s: expected a config error", name)
+		}
+	}
+}
+
+func TestConfig_MergesBaseAndOverrideFiles(t *testing.T) {
+	banner("config_test.go")
+	configDir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(configDir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	basePath := writeFile("base.yaml", `proxy:
+  targets: ["http://a:9000", "http://b:9000"]
+  allowed_methods: ["GET", "POST"]
+  cache:
+    enabled: true
+    max_entries: 100
+    ttl: "5s"
+`)
+	overridePath := writeFile("prod.yaml", `proxy:
+  allowed_methods: ["GET"]
+  cache:
+    ttl: "30s"
+`)
+	t.Setenv("CONFIG_FILES", basePath+", "+overridePath)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load merged config: %v", err)
+	}
+	if cfg.Cache.TTL != 30*time.Second {
+		t.Fatalf("cache ttl = %v, want the override's 30s", cfg.Cache.TTL)
+	}
+	if !cfg.Cache.Enabled || cfg.Cache.MaxEntries != 100 {
+		t.Fatalf("base cache keys lost in the merge: %+v", cfg.Cache)
+	}
+	if len(cfg.TargetURLs) != 2 || cfg.TargetURLs[1].String() != "http://b:9000" {
+		t.Fatalf("base targets lost in the merge: %v", cfg.TargetURLs)
+	}
+	if strings.Join(cfg.AllowedMethods, ",") != "GET" {
+		t.Fatalf("lists must be replaced, not appended: %v", cfg.AllowedMethods)
+	}
+
+	// proxy.includes merges the listed files (relative to the including file) on top of it.
+	writeFile("ttl.yaml", "proxy:\n  cache:\n    ttl: \"45s\"\n")
+	includingPath := writeFile("main.yaml", `proxy:
+  includes: ["ttl.yaml"]
+  targets: ["http://a:9000"]
+  cache:
+    max_entries: 7
+    ttl: "5s"
+`)
+	t.Setenv("CONFIG_FILES", includingPath)
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatalf("load config with includes: %v", err)
+	}
+	if cfg.Cache.TTL != 45*time.Second || cfg.Cache.MaxEntries != 7 {
+		t.Fatalf("included override not applied: ttl=%v max_entries=%d", cfg.Cache.TTL, cfg.Cache.MaxEntries)
+	}
+
+	t.Setenv("CONFIG_FILES", basePath+","+filepath.Join(configDir, "missing.yaml"))
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "missing.yaml") {
+		t.Fatalf("a missing file must fail loading, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package proxy_test
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+func TestContentDigest_MatchingForwardedMismatchRejected(t *testing.T) {
+	banner("content_digest_test.go")
+	const payload = "upload payload"
+	var forwarded atomic.Int64
+	var lastBody atomic.Value
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lastBody.Store(string(body))
+		forwarded.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetValidateContentDigest(true, 0)
+
+	md5Sum := md5.Sum([]byte(payload))
+	shaSum := sha256.Sum256([]byte(payload))
+	wrongSum := sha256.Sum256([]byte("corrupted payload"))
+	cases := []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{"content-md5 match", "Content-MD5", base64.StdEncoding.EncodeToString(md5Sum[:]), http.StatusCreated},
+		{"digest match", "Digest", "SHA-256=" + base64.StdEncoding.EncodeToString(shaSum[:]), http.StatusCreated},
+		{"digest mismatch", "Digest", "sha-256=" + base64.StdEncoding.EncodeToString(wrongSum[:]), http.StatusBadRequest},
+		{"content-md5 mismatch", "Content-MD5", base64.StdEncoding.EncodeToString(wrongSum[:16]), http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		before := forwarded.Load()
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(payload))
+		req.Header.Set(tc.header, tc.value)
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+
+		if rec.Code != tc.status {
+			t.Fatalf("%s: want %d, got %d (%s)", tc.name, tc.status, rec.Code, rec.Body.String())
+		}
+		wantForwarded := before
+		if tc.status == http.StatusCreated {
+			wantForwarded++
+			if got := lastBody.Load(); got != payload {
+				t.Fatalf("%s: upstream body %q, want %q", tc.name, got, payload)
+			}
+		}
+		if got := forwarded.Load(); got != wantForwarded {
+			t.Fatalf("%s: upstream requests %d, want %d", tc.name, got, wantForwarded)
+		}
+	}
+}
+
+func TestContentDigest_OversizeBodyRejectedWithoutBuffering(t *testing.T) {
+	var forwarded atomic.Int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetValidateContentDigest(true, 8)
+
+	payload := strings.Repeat("x", 64)
+	shaSum := sha256.Sum256([]byte(payload))
+	for _, chunked := range []bool{false, true} {
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(payload))
+		if chunked {
+			// Unknown length: the cap must be enforced while reading.
+			req.ContentLength = -1
+		}
+		req.Header.Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(shaSum[:]))
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("chunked=%v: want 413, got %d (%s)", chunked, rec.Code, rec.Body.String())
+		}
+	}
+	if got := forwarded.Load(); got != 0 {
+		t.Fatalf("upstream requests %d, want 0", got)
+	}
+}
@@ -0,0 +1,237 @@
+package proxy_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// startEchoListener accepts TCP connections and echoes back whatever it receives.
+func startEchoListener(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestForward_ConnectTunnel(t *testing.T) {
+	banner("forward_test.go")
+	echoAddr := startEchoListener(t)
+
+	reverseProxy := proxy.NewReverseProxy(closedServerURL(t), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMode(proxy.ModeForward)
+	reverseProxy.SetConnectAllowlist([]string{echoAddr})
+	proxyServer := httptest.NewServer(reverseProxy)
+	t.Cleanup(proxyServer.Close)
+
+	conn, err := net.Dial("tcp", proxyServer.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, "CONNECT "+echoAddr+" HTTP/1.1\r\nHost: "+echoAddr+"\r\n\r\n"); err != nil {
+		t.Fatalf("write CONNECT: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatalf("read CONNECT response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for CONNECT, got %d", resp.StatusCode)
+	}
+
+	if _, err := io.WriteString(conn, "ping"); err != nil {
+		t.Fatalf("write through tunnel: %v", err)
+	}
+	echoed := make([]byte, 4)
+	if _, err := io.ReadFull(reader, echoed); err != nil {
+		t.Fatalf("read through tunnel: %v", err)
+	}
+	if string(echoed) != "ping" {
+		t.Fatalf("tunnel echoed %q, want ping", echoed)
+	}
+}
+
+// CONNECT is denied unless the destination is allowlisted and the method policy allows it.
+func TestForward_ConnectRequiresAllowlist(t *testing.T) {
+	banner("forward_test.go")
+	echoAddr := startEchoListener(t)
+	_, echoPort, _ := net.SplitHostPort(echoAddr)
+
+	reverseProxy := proxy.NewReverseProxy(closedServerURL(t), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMode(proxy.ModeForward)
+
+	connect := func(authority string) int {
+		req := httptest.NewRequest(http.MethodConnect, "http://"+authority, nil)
+		req.Host = authority
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// No allowlist: forward mode is not an open relay.
+	if code := connect(echoAddr); code != http.StatusForbidden {
+		t.Fatalf("CONNECT without an allowlist: status %d, want 403", code)
+	}
+	reverseProxy.SetConnectAllowlist([]string{"*.example.com:443", "127.0.0.2:*"})
+	if code := connect(echoAddr); code != http.StatusForbidden {
+		t.Fatalf("CONNECT to a destination outside the allowlist: status %d, want 403", code)
+	}
+	if code := connect("127.0.0.1:" + echoPort); code != http.StatusForbidden {
+		t.Fatalf("CONNECT to an unlisted host: status %d, want 403", code)
+	}
+
+	// The method allowlist applies to CONNECT as well.
+	reverseProxy.SetConnectAllowlist([]string{"127.0.0.1:*"})
+	reverseProxy.SetAllowedMethods([]string{"GET"})
+	if code := connect(echoAddr); code != http.StatusMethodNotAllowed {
+		t.Fatalf("CONNECT outside allowed_methods: status %d, want 405", code)
+	}
+}
+
+func TestForward_AbsoluteURIGoesToRequestedOrigin(t *testing.T) {
+	banner("forward_test.go")
+	originServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("origin:" + r.URL.RequestURI()))
+	}))
+	t.Cleanup(originServer.Close)
+
+	// The configured target is unreachable: forward mode must not use it.
+	reverseProxy := proxy.NewReverseProxy(closedServerURL(t), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMode(proxy.ModeForward)
+
+	for i, wantCache := range []string{"MISS", "HIT"} {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, originServer.URL+"/items?page=2", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d (%s)", i, rec.Code, rec.Body.String())
+		}
+		if body := rec.Body.String(); body != "origin:/items?page=2" {
+			t.Fatalf("request %d: body %q", i, body)
+		}
+		if got := rec.Header().Get("X-Cache"); got != wantCache {
+			t.Fatalf("request %d: X-Cache %q, want %s", i, got, wantCache)
+		}
+	}
+
+	// Origin-form targets name no origin and are rejected in forward mode.
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for origin-form target in forward mode, got %d", rec.Code)
+	}
+}
+
+func TestForward_ClientOriginsStayOutOfMetricLabels(t *testing.T) {
+	banner("forward_test.go")
+	originServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "client-chosen")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(originServer.Close)
+	originHost := mustURL(t, originServer.URL).Host
+	deadHost := closedServerURL(t).Host
+
+	reverseProxy := proxy.NewReverseProxy(closedServerURL(t), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMode(proxy.ModeForward)
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	if rec := serve("http://" + originHost + "/labels"); rec.Code != http.StatusOK {
+		t.Fatalf("forwarded request: expected 200, got %d", rec.Code)
+	}
+	if rec := serve("http://" + deadHost + "/labels"); rec.Code < http.StatusInternalServerError {
+		t.Fatalf("unreachable origin: expected an upstream error, got %d", rec.Code)
+	}
+	for _, metric := range []string{"proxy_upstream_requests_total", "proxy_upstream_errors_total", "proxy_upstream_inflight"} {
+		for _, host := range []string{originHost, deadHost, "client-chosen"} {
+			if _, found := scrapeMetric(t, metric, `upstream="`+host+`"`); found {
+				t.Fatalf("%s labelled with client-chosen upstream %q", metric, host)
+			}
+		}
+	}
+	if _, found := scrapeMetric(t, "proxy_upstream_requests_total", `upstream="forward"`); !found {
+		t.Fatal(`proxy_upstream_requests_total has no upstream="forward" series`)
+	}
+}
+
+func TestForward_CollapseKeysKeepTheScheme(t *testing.T) {
+	banner("forward_test.go")
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	originServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		_, _ = w.Write([]byte("plain http"))
+	}))
+	t.Cleanup(originServer.Close)
+	originHost := mustURL(t, originServer.URL).Host
+
+	reverseProxy := proxy.NewReverseProxy(closedServerURL(t), proxy.NewLRUCache(0), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMode(proxy.ModeForward)
+	reverseProxy.SetCollapseForwarding(true, []string{"/"})
+
+	serve := func(target string) chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			rec := httptest.NewRecorder()
+			reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			done <- rec
+		}()
+		return done
+	}
+	leader := serve("http://" + originHost + "/shared")
+	<-entered
+
+	// The https origin on the same host:port is a different resource: it must go upstream
+	// (and fail the TLS handshake against a plain-HTTP server) instead of joining the leader.
+	follower := serve("https://" + originHost + "/shared")
+	var httpsRec *httptest.ResponseRecorder
+	select {
+	case httpsRec = <-follower:
+	case <-time.After(time.Second):
+	}
+	close(release)
+	if httpsRec == nil {
+		httpsRec = <-follower
+	}
+	if rec := <-leader; rec.Code != http.StatusOK {
+		t.Fatalf("http leader: expected 200, got %d", rec.Code)
+	}
+	if httpsRec.Code == http.StatusOK || httpsRec.Body.String() == "plain http" {
+		t.Fatalf("https request shared the http response (%d %q)", httpsRec.Code, httpsRec.Body.String())
+	}
+}
@@ -0,0 +1,148 @@
+package proxy_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// newH2CServer starts a plain-text server that accepts HTTP/2 with prior knowledge (h2c).
+func newH2CServer(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(handler)
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	server.Config.Protocols = protocols
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// grpcFrame wraps a message in the gRPC length-prefixed framing (uncompressed).
+func grpcFrame(message []byte) []byte {
+	frame := make([]byte, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(message)))
+	copy(frame[5:], message)
+	return frame
+}
+
+func TestGRPC_UnaryCallWithTrailers(t *testing.T) {
+	banner("grpc_test.go")
+	// Minimal gRPC echo server: returns the request frame and grpc-status trailers.
+	upstreamServer := newH2CServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			http.Error(w, "grpc requires HTTP/2", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		if r.Header.Get("Te") != "trailers" {
+			http.Error(w, "missing TE: trailers", http.StatusBadRequest)
+			return
+		}
+		requestFrame, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(requestFrame)
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("Grpc-Message", "ok")
+	}))
+
+	// Cache enabled on purpose: gRPC must still bypass it.
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	proxyServer := newH2CServer(t, reverseProxy)
+
+	clientProtocols := new(http.Protocols)
+	clientProtocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: clientProtocols}}
+
+	message := []byte("hello-grpc")
+	req, err := http.NewRequest(http.MethodPost, proxyServer.URL+"/echo.Echo/Say", bytes.NewReader(grpcFrame(message)))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("grpc call through proxy: %v", err)
+	}
+	defer resp.Body.Close()
+	responseFrame, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200, got %d (%s)", resp.StatusCode, responseFrame)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("expected HTTP/2 to the client, got %s", resp.Proto)
+	}
+	if !bytes.Equal(responseFrame, grpcFrame(message)) {
+		t.Fatalf("unexpected response frame: %q", responseFrame)
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Fatalf("want grpc-status trailer 0, got %q (trailers=%v)", got, resp.Trailer)
+	}
+	if got := resp.Trailer.Get("Grpc-Message"); got != "ok" {
+		t.Fatalf("want grpc-message trailer ok, got %q", got)
+	}
+	if got := resp.Header.Get("X-Cache"); got != "BYPASS" {
+		t.Fatalf("gRPC responses must never be cached, X-Cache=%q", got)
+	}
+}
+
+func TestGRPC_UpstreamFailuresUseSharedErrorsAndEjectTargets(t *testing.T) {
+	banner("grpc_test.go")
+	healthyServer := newH2CServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+	}))
+	deadURL := closedServerURL(t)
+
+	reverseProxy := proxy.NewReverseProxyMulti([]*url.URL{deadURL, mustURL(t, healthyServer.URL)}, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetOutlierDetection(1, time.Minute, 0)
+	reverseProxy.SetJSONErrors(true)
+
+	before, _ := scrapeMetric(t, "proxy_upstream_ejections_total", fmt.Sprintf(`upstream=%q`, deadURL.Host))
+	callGRPC := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/echo.Echo/Say", bytes.NewReader(grpcFrame([]byte("hi"))))
+		req.Header.Set("Content-Type", "application/grpc")
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Round-robin sends the first call to the dead target: a shared JSON error answers it.
+	rec := callGRPC()
+	if rec.Code < http.StatusInternalServerError {
+		t.Fatalf("call to the dead target: expected an upstream error, got %d", rec.Code)
+	}
+	var envelope struct {
+		Status    int    `json:"status"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil || envelope.Status != rec.Code || envelope.RequestID == "" {
+		t.Fatalf("expected the JSON error envelope, got %q (%v)", rec.Body.String(), err)
+	}
+
+	// The failure ejected the dead target, so every following call reaches the healthy one.
+	if after, _ := scrapeMetric(t, "proxy_upstream_ejections_total", fmt.Sprintf(`upstream=%q`, deadURL.Host)); after != before+1 {
+		t.Fatalf("expected one ejection counted for %s: before %v after %v", deadURL.Host, before, after)
+	}
+	for i := 0; i < 3; i++ {
+		if rec := callGRPC(); rec.Code != http.StatusOK {
+			t.Fatalf("call %d after ejection: expected 200, got %d", i, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// startHeaderEchoUpstream returns an upstream that echoes selected request headers back
+// as response headers prefixed with "Echo-".
+func startHeaderEchoUpstream(t *testing.T, headerNames ...string) *httptest.Server {
+	t.Helper()
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range headerNames {
+			w.Header().Set("Echo-"+name, r.Header.Get(name))
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+	return upstreamServer
+}
+
+func TestForwardedHeader_RFC7239AppendsElement(t *testing.T) {
+	banner("headers_test.go")
+	upstreamServer := startHeaderEchoUpstream(t, "Forwarded", "X-Forwarded-For")
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetForwardedHeaderMode(proxy.ForwardedModeRFC7239)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/path", nil)
+	req.RemoteAddr = "192.0.2.10:4321"
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, req)
+
+	if got, want := rec.Header().Get("Echo-Forwarded"), "for=192.0.2.10;proto=http;host=example.com"; got != want {
+		t.Fatalf("Forwarded mismatch: got %q want %q", got, want)
+	}
+	if got := rec.Header().Get("Echo-X-Forwarded-For"); got != "" {
+		t.Fatalf("rfc7239 mode should not emit X-Forwarded-For, got %q", got)
+	}
+}
+
+func TestForwardedHeader_PreservesExistingChain(t *testing.T) {
+	banner("headers_test.go")
+	upstreamServer := startHeaderEchoUpstream(t, "Forwarded", "X-Forwarded-For")
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetForwardedHeaderMode(proxy.ForwardedModeBoth)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com:8080/path", nil)
+	req.RemoteAddr = "[2001:db8::1]:4321"
+	req.Header.Set("Forwarded", "for=198.51.100.7;proto=https")
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, req)
+
+	want := `for=198.51.100.7;proto=https, for="[2001:db8::1]";proto=http;host="example.com:8080"`
+	if got := rec.Header().Get("Echo-Forwarded"); got != want {
+		t.Fatalf("Forwarded chain mismatch:\n got  %q\n want %q", got, want)
+	}
+	if got := rec.Header().Get("Echo-X-Forwarded-For"); got != "2001:db8::1" {
+		t.Fatalf("both mode should still emit X-Forwarded-For, got %q", got)
+	}
+}
+
+func TestStripResponseHeaders_RemovedFromClientButUsedInternally(t *testing.T) {
+	banner("headers_test.go")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "strip-test-upstream")
+		w.Header().Set("X-Powered-By", "Express")
+		w.Header().Set("X-Kept", "yes")
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetStripResponseHeaders([]string{"x-powered-by", "X-Upstream"})
+
+	// First request is a MISS, second a HIT: both must be stripped.
+	for _, wantCache := range []string{"MISS", "HIT"} {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/strip", nil))
+		if got := rec.Header().Get("X-Cache"); got != wantCache {
+			t.Fatalf("want X-Cache %s, got %q", wantCache, got)
+		}
+		if rec.Header().Get("X-Upstream") != "" || rec.Header().Get("X-Powered-By") != "" {
+			t.Fatalf("%s: configured headers should be stripped, got %v", wantCache, rec.Header())
+		}
+		if rec.Header().Get("X-Kept") != "yes" {
+			t.Fatalf("%s: unrelated headers must be kept", wantCache)
+		}
+	}
+
+	// The stripped X-Upstream still labels per-upstream metrics.
+	if count, ok := scrapeMetric(t, "proxy_upstream_requests_total", `upstream="strip-test-upstream"`); !ok || count < 1 {
+		t.Fatalf("expected metrics labelled by the stripped X-Upstream, got %v (found=%v)", count, ok)
+	}
+}
+
+func TestTraceIDHeaders_B3TraceIdAdoptedAsRequestID(t *testing.T) {
+	banner("headers_test.go")
+	upstreamServer := startHeaderEchoUpstream(t, "X-Request-ID", "X-B3-TraceId")
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetTraceIDHeaders([]string{"x-amzn-trace-id", "x-b3-traceid"})
+
+	const traceID = "463ac35c9f6413ad48485a3953bb6124"
+	req := httptest.NewRequest(http.MethodGet, "/traced", nil)
+	req.Header.Set("X-B3-TraceId", traceID)
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Request-ID"); got != traceID {
+		t.Fatalf("client X-Request-ID: want adopted trace ID %q, got %q", traceID, got)
+	}
+	if got := rec.Header().Get("Echo-X-Request-ID"); got != traceID {
+		t.Fatalf("upstream X-Request-ID: want %q, got %q", traceID, got)
+	}
+	if got := rec.Header().Get("Echo-X-B3-TraceId"); got != traceID {
+		t.Fatalf("upstream X-B3-TraceId must be forwarded, got %q", got)
+	}
+
+	// An explicit X-Request-ID stays canonical.
+	req = httptest.NewRequest(http.MethodGet, "/traced", nil)
+	req.Header.Set("X-B3-TraceId", traceID)
+	req.Header.Set("X-Request-ID", "client-id")
+	rec = httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Echo-X-Request-ID"); got != "client-id" {
+		t.Fatalf("explicit X-Request-ID must win, got %q", got)
+	}
+}
+
+func TestUpstreamHeaders_InjectedOnlyForSelectedTarget(t *testing.T) {
+	banner("headers_test.go")
+
+	// Each backend rejects requests lacking its own key or carrying the other backend's key.
+	startKeyedUpstream := func(name, want, foreign string) *httptest.Server {
+		upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/healthz" { // health probes stay unauthenticated
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			if r.Header.Get(name) != want || r.Header.Get(foreign) != "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusOK)
+		}))
+		t.Cleanup(upstreamServer.Close)
+		return upstreamServer
+	}
+	serverA := startKeyedUpstream("X-Api-Key", "key-a", "Authorization")
+	serverB := startKeyedUpstream("Authorization", "Bearer token-b", "X-Api-Key")
+	urlA, urlB := mustURL(t, serverA.URL), mustURL(t, serverB.URL)
+
+	reverseProxy := proxy.NewReverseProxyMulti([]*url.URL{urlA, urlB}, proxy.NewLRUCache(16), false)
+	reverseProxy.SetUpstreamHeaders(urlA, map[string]string{"X-Api-Key": "key-a"})
+	reverseProxy.SetUpstreamHeaders(urlB, map[string]string{"Authorization": "Bearer token-b"})
+
+	// Round robin alternates targets; a leaked or missing header would surface as 401.
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/resource", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200 (per-target header missing or leaked)", i, rec.Code)
+		}
+	}
+}
+
+func TestWithProxyHeaders_ServedByWhenEnabled(t *testing.T) {
+	banner("headers_test.go")
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	rec := httptest.NewRecorder()
+	proxy.WithProxyHeaders(next, "proxy-eu-1").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("X-Served-By"); got != "proxy-eu-1" {
+		t.Fatalf("X-Served-By = %q, want proxy-eu-1", got)
+	}
+	if rec.Header().Get("Server") == "" {
+		t.Fatalf("Server header missing")
+	}
+
+	// Disabled (empty instance) sends no X-Served-By.
+	rec = httptest.NewRecorder()
+	proxy.WithProxyHeaders(next, "").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if _, present := rec.Header()["X-Served-By"]; present {
+		t.Fatalf("X-Served-By present while disabled: %q", rec.Header().Get("X-Served-By"))
+	}
+}
+
+func TestHeaders_AllowedHostsRejectsOthersWith421(t *testing.T) {
+	banner("headers_test.go")
+	var upstreamHits atomic.Int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetAllowedHosts([]string{"example.com", " API.Example.com "})
+
+	fetch := func(host string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/page", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := fetch("example.com"); rec.Code != http.StatusOK {
+		t.Fatalf("allowed host: got %d", rec.Code)
+	}
+	if rec := fetch("api.example.com:8080"); rec.Code != http.StatusOK {
+		t.Fatalf("allowed host with port and different case: got %d", rec.Code)
+	}
+	rec := fetch("evil.example.net")
+	if rec.Code != http.StatusMisdirectedRequest || rec.Header().Get("X-Request-ID") == "" {
+		t.Fatalf("disallowed host: got %d (request id %q), want 421", rec.Code, rec.Header().Get("X-Request-ID"))
+	}
+	if got := upstreamHits.Load(); got != 2 {
+		t.Fatalf("disallowed host must not reach the upstream, upstream hits=%d", got)
+	}
+}
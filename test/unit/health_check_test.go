@@ -0,0 +1,137 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// probeRecorder collects /healthz probe timestamps per upstream.
+type probeRecorder struct {
+	mu     sync.Mutex
+	probes map[string][]time.Time
+}
+
+func (recorder *probeRecorder) startUpstream(t *testing.T) *url.URL {
+	t.Helper()
+	var upstreamServer *httptest.Server
+	upstreamServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			recorder.mu.Lock()
+			recorder.probes[upstreamServer.URL] = append(recorder.probes[upstreamServer.URL], time.Now())
+			recorder.mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+	return mustURL(t, upstreamServer.URL)
+}
+
+func (recorder *probeRecorder) snapshot() map[string][]time.Time {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	copied := make(map[string][]time.Time, len(recorder.probes))
+	for target, times := range recorder.probes {
+		copied[target] = append([]time.Time(nil), times...)
+	}
+	return copied
+}
+
+func TestHealthCheck_JitterSpreadsProbes(t *testing.T) {
+	banner("health_check_test.go")
+	recorder := &probeRecorder{probes: map[string][]time.Time{}}
+	var targets []*url.URL
+	for i := 0; i < 6; i++ {
+		targets = append(targets, recorder.startUpstream(t))
+	}
+
+	reverseProxy := proxy.NewReverseProxyMulti(targets, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckSchedule(time.Second, 300*time.Millisecond)
+	t.Cleanup(func() { reverseProxy.SetHealthCheckSchedule(0, 0) })
+
+	// Every target gets its first probe within the jitter window, at different instants.
+	time.Sleep(450 * time.Millisecond)
+	probes := recorder.snapshot()
+	if len(probes) != len(targets) {
+		t.Fatalf("expected all %d targets probed within the jitter window, got %d", len(targets), len(probes))
+	}
+	var earliest, latest time.Time
+	for _, times := range probes {
+		first := times[0]
+		if earliest.IsZero() || first.Before(earliest) {
+			earliest = first
+		}
+		if first.After(latest) {
+			latest = first
+		}
+	}
+	if spread := latest.Sub(earliest); spread < 30*time.Millisecond {
+		t.Fatalf("first probes fired within %v of each other; expected them spread over the jitter window", spread)
+	}
+
+	// Requests use the cached results: serving traffic triggers no extra probes.
+	probeCount := func() int {
+		total := 0
+		for _, times := range recorder.snapshot() {
+			total += len(times)
+		}
+		return total
+	}
+	before := probeCount()
+	for i := 0; i < 6; i++ {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, rec.Code)
+		}
+	}
+	if after := probeCount(); after != before {
+		t.Fatalf("requests triggered %d on-demand probes; expected cached health results", after-before)
+	}
+}
+
+func TestHealthCheck_ProbeTimeoutIsConfigurable(t *testing.T) {
+	banner("health_check_test.go")
+	t.Cleanup(func() { proxy.SetHealthProbeTimeout(0) })
+
+	// /healthz takes 300ms to send its headers.
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			select {
+			case <-time.After(300 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	serve := func() int {
+		// Health checks stay on so the request path probes the target.
+		proxyHandler := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+		rec := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/resource", nil))
+		return rec.Code
+	}
+
+	// The default 500ms deadline outlasts the slow probe.
+	if code := serve(); code != http.StatusOK {
+		t.Fatalf("default probe timeout: status %d, want 200", code)
+	}
+
+	// A 100ms deadline expires first, so the target is marked unhealthy.
+	proxy.SetHealthProbeTimeout(100 * time.Millisecond)
+	start := time.Now()
+	if code := serve(); code == http.StatusOK {
+		t.Fatalf("short probe timeout: status 200, want the target treated as unhealthy")
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Fatalf("request took %v; the probe should give up after 100ms", elapsed)
+	}
+}
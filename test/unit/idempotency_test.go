@@ -0,0 +1,152 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+func TestIdempotency_ConcurrentSameKeyExecutesOnce(t *testing.T) {
+	banner("idempotency_test.go")
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit := atomic.AddInt64(&upstreamHits, 1)
+		time.Sleep(150 * time.Millisecond) // keep the first call in flight
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("order-" + strconv.FormatInt(hit, 10)))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetIdempotency(true, time.Second)
+
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, 2)
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"item":1}`))
+			req.Header.Set("Idempotency-Key", "abc-123")
+			reverseProxy.ServeHTTP(rec, req)
+		}(recorders[i])
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt64(&upstreamHits); got != 1 {
+		t.Fatalf("expected a single upstream execution, got %d", got)
+	}
+	replays := 0
+	for _, rec := range recorders {
+		if rec.Code != http.StatusCreated || rec.Body.String() != "order-1" {
+			t.Fatalf("unexpected response: %d %q", rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("X-Idempotent-Replay") == "true" {
+			replays++
+		}
+	}
+	if replays != 1 {
+		t.Fatalf("expected exactly one replayed response, got %d", replays)
+	}
+
+	// A different key executes independently.
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"item":1}`))
+	req.Header.Set("Idempotency-Key", "other")
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, req)
+	if got := atomic.LoadInt64(&upstreamHits); got != 2 {
+		t.Fatalf("different key should reach upstream, hits=%d", got)
+	}
+}
+
+// A key is scoped to its client and bound to the body it was first used with.
+func TestIdempotency_KeyScopedToClientAndBody(t *testing.T) {
+	banner("idempotency_test.go")
+	var upstreamHits atomic.Int64
+	release := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit := upstreamHits.Add(1)
+		<-release
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("order-" + strconv.FormatInt(hit, 10)))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetIdempotency(true, time.Second)
+
+	post := func(remoteAddr, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Idempotency-Key", "abc-123")
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var wg sync.WaitGroup
+	var first, otherClient *httptest.ResponseRecorder
+	wg.Add(2)
+	go func() { defer wg.Done(); first = post("10.0.0.1:1234", `{"item":1}`) }()
+	time.Sleep(50 * time.Millisecond)
+	go func() { defer wg.Done(); otherClient = post("10.0.0.2:1234", `{"item":1}`) }()
+	time.Sleep(50 * time.Millisecond)
+
+	// Same client and key, different body: rejected while the first call is in flight.
+	if mismatch := post("10.0.0.1:1234", `{"item":2}`); mismatch.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key with another body: status %d, want 422", mismatch.Code)
+	}
+	close(release)
+	wg.Wait()
+
+	if got := upstreamHits.Load(); got != 2 {
+		t.Fatalf("two clients sharing a key should execute separately, got %d upstream hits", got)
+	}
+	if first.Body.String() == otherClient.Body.String() {
+		t.Fatalf("client 10.0.0.2 was replayed the response of 10.0.0.1: %q", otherClient.Body.String())
+	}
+	// A retry with the same body within the window is replayed.
+	if retry := post("10.0.0.1:1234", `{"item":1}`); retry.Header().Get("X-Idempotent-Replay") != "true" || retry.Body.String() != first.Body.String() {
+		t.Fatalf("retry was not replayed: %q %q", retry.Header().Get("X-Idempotent-Replay"), retry.Body.String())
+	}
+}
+
+func TestIdempotency_ReplaysReleaseLeastConnectionsReservations(t *testing.T) {
+	banner("idempotency_test.go")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	upstreamURL := mustURL(t, upstreamServer.URL)
+	reverseProxy := proxy.NewReverseProxyMulti([]*url.URL{upstreamURL}, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.ConfigureBalancer("lc")
+	reverseProxy.SetIdempotency(true, time.Minute)
+
+	// One execution, one replay and one 422 for a different body under the same key.
+	for _, body := range []string{`{"item":1}`, `{"item":1}`, `{"item":2}`} {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "lc-key")
+		reverseProxy.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	label := `upstream="` + upstreamURL.Host + `"`
+	if pending, ok := scrapeMetric(t, "proxy_upstream_pending_selections", label); !ok || pending != 0 {
+		t.Fatalf("expected pending selections back at 0, got %v (found=%v)", pending, ok)
+	}
+}
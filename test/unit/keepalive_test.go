@@ -0,0 +1,109 @@
+package proxy_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// Keepalive requests reach the target with the configured method/path at the configured cadence
+// and reuse the proxy's pooled connection.
+func TestUpstreamKeepalive_PingsTargetsAtInterval(t *testing.T) {
+	banner("keepalive_test.go")
+	var (
+		mu    sync.Mutex
+		times []time.Time
+		other atomic.Int64
+		dials atomic.Int64
+	)
+	upstreamServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/warm" {
+			other.Add(1)
+			return
+		}
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+	}))
+	upstreamServer.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	upstreamServer.Start()
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	const interval = 50 * time.Millisecond
+	reverseProxy.SetUpstreamKeepalive(interval, "get", "warm")
+	t.Cleanup(func() { reverseProxy.SetUpstreamKeepalive(0, "", "") })
+
+	time.Sleep(8*interval + interval/2)
+	reverseProxy.SetUpstreamKeepalive(0, "", "")
+
+	mu.Lock()
+	got := append([]time.Time(nil), times...)
+	mu.Unlock()
+	if len(got) < 5 || len(got) > 9 {
+		t.Fatalf("keepalive requests in 8.5 intervals = %d, want about 8", len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if gap := got[i].Sub(got[i-1]); gap < interval/2 {
+			t.Fatalf("keepalive %d came %v after the previous one, want ~%v", i, gap, interval)
+		}
+	}
+	if n := other.Load(); n != 0 {
+		t.Fatalf("%d requests used another method/path than GET /warm", n)
+	}
+	if n := dials.Load(); n != 1 {
+		t.Fatalf("keepalive opened %d connections, want 1 reused connection", n)
+	}
+
+	// Disabled: no further requests.
+	time.Sleep(3 * interval)
+	mu.Lock()
+	after := len(times)
+	mu.Unlock()
+	if after != len(got) {
+		t.Fatalf("keepalive kept running after being disabled: %d -> %d", len(got), after)
+	}
+}
+
+// Keepalive requests honour the target's base path and carry its upstream headers.
+func TestUpstreamKeepalive_UsesTargetPathAndHeaders(t *testing.T) {
+	banner("keepalive_test.go")
+	pinged := make(chan *http.Request, 16)
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case pinged <- r:
+		default:
+		}
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	target := mustURL(t, upstreamServer.URL+"/api")
+	reverseProxy := proxy.NewReverseProxy(target, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetUpstreamHeaders(target, map[string]string{"X-Api-Key": "secret"})
+	reverseProxy.SetUpstreamKeepalive(20*time.Millisecond, "", "/warm")
+	t.Cleanup(func() { reverseProxy.SetUpstreamKeepalive(0, "", "") })
+
+	select {
+	case request := <-pinged:
+		if request.URL.Path != "/api/warm" {
+			t.Fatalf("keepalive path = %q, want /api/warm", request.URL.Path)
+		}
+		if got := request.Header.Get("X-Api-Key"); got != "secret" {
+			t.Fatalf("keepalive X-Api-Key = %q, want the target's upstream header", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no keepalive request reached the upstream")
+	}
+}
@@ -0,0 +1,66 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	applog "traefik-challenge-2/internal/log"
+)
+
+func TestLoki_RecoversWhenEndpointComesUpAfterStartup(t *testing.T) {
+	banner("loki_test.go")
+	var (
+		ready    atomic.Bool
+		mu       sync.Mutex
+		received []string
+	)
+	lokiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body := make([]byte, 4096)
+		n, _ := r.Body.Read(body)
+		mu.Lock()
+		received = append(received, string(body[:n]))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(lokiServer.Close)
+
+	applog.ConfigureLoki(lokiServer.URL)
+	t.Cleanup(func() { applog.ConfigureLoki("") })
+	stop := applog.StartLokiMonitor(20 * time.Millisecond)
+	t.Cleanup(stop)
+
+	if up, ok := scrapeMetric(t, "proxy_loki_up", ""); !ok || up != 0 {
+		t.Fatalf("expected proxy_loki_up 0 while Loki is down, got %v (present=%v)", up, ok)
+	}
+
+	ready.Store(true)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if up, _ := scrapeMetric(t, "proxy_loki_up", ""); up == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("proxy_loki_up never flipped to 1 after Loki came up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	applog.PushLokiWithLevel("info", "proxy", nil, "loki-recovered-line")
+	mu.Lock()
+	defer mu.Unlock()
+	for _, payload := range received {
+		if strings.Contains(payload, "loki-recovered-line") {
+			return
+		}
+	}
+	t.Fatalf("line pushed after recovery was not received; got %q", received)
+}
@@ -0,0 +1,217 @@
+package proxy_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// startCountingUpstream answers 200 and counts how many requests reached it.
+func startCountingUpstream(t *testing.T, hits *int64) *httptest.Server {
+	t.Helper()
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(hits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+	return upstreamServer
+}
+
+func TestMethods_TraceBlockedByDefault(t *testing.T) {
+	banner("methods_test.go")
+	var upstreamHits int64
+	upstreamServer := startCountingUpstream(t, &upstreamHits)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodTrace, "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for TRACE, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Header().Get("Allow"), http.MethodTrace) {
+		t.Fatalf("Allow must not advertise TRACE: %q", rec.Header().Get("Allow"))
+	}
+
+	// Opting out forwards TRACE like any other method.
+	reverseProxy.SetMethodHandling(true, false)
+	rec = httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodTrace, "/", nil))
+	if rec.Code != http.StatusOK || atomic.LoadInt64(&upstreamHits) != 1 {
+		t.Fatalf("expected TRACE forwarded when not blocked, got %d with %d upstream hits", rec.Code, upstreamHits)
+	}
+}
+
+func TestMethods_OptionsAsteriskAnsweredLocally(t *testing.T) {
+	banner("methods_test.go")
+	var upstreamHits int64
+	upstreamServer := startCountingUpstream(t, &upstreamHits)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetAllowedMethods([]string{"GET", "HEAD", "OPTIONS", "TRACE"})
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "*", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for OPTIONS *, got %d", rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+		t.Fatalf("unexpected Allow header %q", allow)
+	}
+	if hits := atomic.LoadInt64(&upstreamHits); hits != 0 {
+		t.Fatalf("OPTIONS * must not reach the upstream, got %d hits", hits)
+	}
+
+	// OPTIONS on a resource is still forwarded.
+	rec = httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/resource", nil))
+	if hits := atomic.LoadInt64(&upstreamHits); hits != 1 {
+		t.Fatalf("expected OPTIONS /resource forwarded, got %d upstream hits", hits)
+	}
+}
+
+func TestMethods_ConnectRejected(t *testing.T) {
+	banner("methods_test.go")
+	var upstreamHits int64
+	upstreamServer := startCountingUpstream(t, &upstreamHits)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodConnect, "example.com:443", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for CONNECT, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Header().Get("Allow"), http.MethodConnect) {
+		t.Fatalf("Allow must not advertise CONNECT: %q", rec.Header().Get("Allow"))
+	}
+	if got := atomic.LoadInt64(&upstreamHits); got != 0 {
+		t.Fatalf("CONNECT must not reach the upstream, got %d hits", got)
+	}
+}
+
+func TestMethods_AbsoluteFormTarget(t *testing.T) {
+	banner("methods_test.go")
+	var upstreamPath string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.RequestURI()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+
+	// Absolute-form with an allowed scheme is forwarded as origin-form.
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/items?page=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for absolute-form target, got %d", rec.Code)
+	}
+	if upstreamPath != "/items?page=2" {
+		t.Fatalf("upstream saw %q, want /items?page=2", upstreamPath)
+	}
+
+	// Schemes outside the allowlist are rejected before reaching the upstream.
+	reverseProxy.SetAllowedSchemes([]string{"https"})
+	upstreamPath = ""
+	rec = httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/items", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for disallowed scheme, got %d", rec.Code)
+	}
+	if upstreamPath != "" {
+		t.Fatalf("rejected request reached the upstream at %q", upstreamPath)
+	}
+}
+
+func TestMethods_DisallowedHeadServedFromCachedGet(t *testing.T) {
+	banner("methods_test.go")
+	var upstreamHits int64
+	upstreamServer := startCountingUpstream(t, &upstreamHits)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetAllowedMethods([]string{http.MethodGet})
+	reverseProxy.SetShareHeadGet(true)
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/doc", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("priming GET: got %d X-Cache=%q", rec.Code, rec.Header().Get("X-Cache"))
+	}
+
+	// HEAD is not forwarded upstream, but the cached GET can answer it.
+	rec = httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/doc", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("HEAD from cached GET: got %d X-Cache=%q", rec.Code, rec.Header().Get("X-Cache"))
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("HEAD response must not carry a body, got %d bytes", rec.Body.Len())
+	}
+
+	// Without a cached GET the HEAD would need the upstream and is refused.
+	rec = httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/uncached", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("uncached HEAD: expected 405, got %d", rec.Code)
+	}
+	if got := atomic.LoadInt64(&upstreamHits); got != 1 {
+		t.Fatalf("expected only the priming GET upstream, got %d hits", got)
+	}
+}
+
+func TestMethods_DisallowedJSONEnvelope(t *testing.T) {
+	banner("methods_test.go")
+	var upstreamHits int64
+	upstreamServer := startCountingUpstream(t, &upstreamHits)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetAllowedMethods([]string{"GET", "HEAD"})
+	reverseProxy.SetJSONErrors(true)
+
+	before, _ := scrapeMetric(t, "proxy_requests_total", `cache="REJECTED",method="DELETE",status="405"`)
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/items/1", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "GET, HEAD" {
+		t.Fatalf("unexpected Allow header %q", allow)
+	}
+	requestID := rec.Header().Get("X-Request-ID")
+	if requestID == "" {
+		t.Fatalf("405 must carry a generated X-Request-ID")
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Fatalf("expected JSON content type, got %q", got)
+	}
+	var envelope struct {
+		Status    int    `json:"status"`
+		Error     string `json:"error"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("decode envelope %q: %v", rec.Body.String(), err)
+	}
+	if envelope.Status != http.StatusMethodNotAllowed || envelope.Error != "method not allowed" || envelope.RequestID != requestID {
+		t.Fatalf("unexpected envelope %+v (request id header %q)", envelope, requestID)
+	}
+	if after, _ := scrapeMetric(t, "proxy_requests_total", `cache="REJECTED",method="DELETE",status="405"`); after != before+1 {
+		t.Fatalf("405 should be counted with cache=REJECTED: before %v after %v", before, after)
+	}
+	if got := atomic.LoadInt64(&upstreamHits); got != 0 {
+		t.Fatalf("disallowed method must not reach the upstream, got %d hits", got)
+	}
+}
@@ -0,0 +1,197 @@
+package proxy_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	metrics "traefik-challenge-2/internal/metrics"
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// scrapeMetric reads the default Prometheus registry and returns the value of the first
+// sample whose name matches and whose label set contains labelFragment (e.g. `upstream="host"`).
+func scrapeMetric(t *testing.T, name, labelFragment string) (float64, bool) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, name+"{") && !strings.HasPrefix(line, name+" ") {
+			continue
+		}
+		if labelFragment != "" && !strings.Contains(line, labelFragment) {
+			continue
+		}
+		fields := strings.Fields(line)
+		value, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			t.Fatalf("parse sample %q: %v", line, err)
+		}
+		return value, true
+	}
+	return 0, false
+}
+
+func TestMetrics_LeastConnectionsActiveGauge(t *testing.T) {
+	banner("metrics_test.go")
+	release := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	upstreamURL := mustURL(t, upstreamServer.URL)
+	reverseProxy := proxy.NewReverseProxyMulti([]*url.URL{upstreamURL}, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.ConfigureBalancer("lc")
+
+	const concurrent = 3
+	var wg sync.WaitGroup
+	for i := 0; i < concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reverseProxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+		}()
+	}
+
+	label := `upstream="` + upstreamURL.Host + `"`
+	deadline := time.Now().Add(2 * time.Second)
+	var active float64
+	for time.Now().Before(deadline) {
+		active, _ = scrapeMetric(t, "proxy_upstream_active_connections", label)
+		if active == concurrent {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if active != concurrent {
+		t.Fatalf("expected active gauge %d while requests are in flight, got %v", concurrent, active)
+	}
+	if after, _ := scrapeMetric(t, "proxy_upstream_active_connections", label); after != 0 {
+		t.Fatalf("expected active gauge to return to 0, got %v", after)
+	}
+	if pending, ok := scrapeMetric(t, "proxy_upstream_pending_selections", label); !ok || pending != 0 {
+		t.Fatalf("expected pending gauge 0 after completion, got %v (found=%v)", pending, ok)
+	}
+}
+
+func TestMetrics_ExposesRuntimeAndProcessCollectors(t *testing.T) {
+	banner("metrics_test.go")
+	if _, found := scrapeMetric(t, "go_goroutines", ""); !found {
+		t.Fatalf("go_goroutines missing from /metrics")
+	}
+	if _, found := scrapeMetric(t, "process_open_fds", ""); !found {
+		t.Fatalf("process_open_fds missing from /metrics")
+	}
+}
+
+func TestMetrics_ErrorRatioTracksRecent5xxShare(t *testing.T) {
+	banner("metrics_test.go")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	metrics.SetErrorRatioWindow(time.Minute)
+	t.Cleanup(func() { metrics.SetErrorRatioWindow(0) })
+
+	reverseProxy := proxy.NewReverseProxyMulti([]*url.URL{mustURL(t, upstreamServer.URL)}, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+
+	// 15 successes and 5 failures -> 25% errors.
+	for i := 0; i < 20; i++ {
+		path := "/ok"
+		if i%4 == 0 {
+			path = "/fail"
+		}
+		reverseProxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	ratio, found := scrapeMetric(t, "proxy_error_ratio", "")
+	if !found {
+		t.Fatalf("proxy_error_ratio missing from /metrics")
+	}
+	if ratio < 0.2 || ratio > 0.3 {
+		t.Fatalf("expected proxy_error_ratio around 0.25, got %v", ratio)
+	}
+
+	// Shrinking the window clears it, and old responses age out of a short window.
+	metrics.SetErrorRatioWindow(60 * time.Millisecond)
+	reverseProxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+	if ratio, _ := scrapeMetric(t, "proxy_error_ratio", ""); ratio != 1 {
+		t.Fatalf("expected proxy_error_ratio 1 right after a lone failure, got %v", ratio)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if ratio, _ := scrapeMetric(t, "proxy_error_ratio", ""); ratio != 0 {
+		t.Fatalf("expected proxy_error_ratio to decay to 0 after the window, got %v", ratio)
+	}
+}
+
+func TestMetrics_UpstreamLabelFromCustomHeader(t *testing.T) {
+	banner("metrics_test.go")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend-Pool", r.URL.Query().Get("pool"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetUpstreamLabel("X-Backend-Pool", []string{"blue-label-test", "green-label-test"})
+
+	count := func(label string) float64 {
+		value, _ := scrapeMetric(t, "proxy_upstream_requests_total", `upstream="`+label+`"`)
+		return value
+	}
+	beforeBlue, beforeOther := count("blue-label-test"), count("other")
+	for _, pool := range []string{"Blue-Label-Test", "unknown-pool-1", "unknown-pool-2"} {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/labelled?pool="+pool, nil))
+	}
+
+	if got := count("blue-label-test") - beforeBlue; got != 1 {
+		t.Fatalf("allowed pool: counted %v, want 1", got)
+	}
+	if got := count("other") - beforeOther; got != 2 {
+		t.Fatalf("unknown pools must collapse to other: counted %v, want 2", got)
+	}
+	if _, found := scrapeMetric(t, "proxy_upstream_requests_total", `upstream="unknown-pool-1"`); found {
+		t.Fatalf("unknown label value leaked into metrics")
+	}
+
+	// Without an allowlist, values are reported as sent (existing series keep their label).
+	reverseProxy.SetUpstreamLabel("X-Backend-Pool", nil)
+	reverseProxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/labelled?pool=Mixed-Case-Pool", nil))
+	if _, found := scrapeMetric(t, "proxy_upstream_requests_total", `upstream="Mixed-Case-Pool"`); !found {
+		t.Fatalf("label case must be preserved without an allowlist")
+	}
+
+	// Without the header, the target host labels the series.
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/labelled", nil))
+	if _, found := scrapeMetric(t, "proxy_upstream_requests_total", `upstream="`+mustURL(t, upstreamServer.URL).Host+`"`); !found {
+		t.Fatalf("missing header must fall back to the target host")
+	}
+}
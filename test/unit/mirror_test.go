@@ -0,0 +1,109 @@
+package proxy_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+func TestMirror_FloodStaysBoundedAndCountsDrops(t *testing.T) {
+	banner("mirror_test.go")
+	primaryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(primaryServer.Close)
+
+	// Mirror target blocks until the test ends, so every worker stays busy.
+	unblock := make(chan struct{})
+	mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	t.Cleanup(mirrorServer.Close)
+	t.Cleanup(func() { close(unblock) })
+
+	droppedBefore, _ := scrapeMetric(t, "proxy_mirror_dropped_total", "")
+	goroutinesBefore := runtime.NumGoroutine()
+
+	const workers, queueSize, flood = 2, 4, 200
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, primaryServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMirror(mustURL(t, mirrorServer.URL), workers, queueSize, 0)
+
+	for i := 0; i < flood; i++ {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/mirrored", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("primary serving must not be affected by mirroring, got %d", rec.Code)
+		}
+	}
+
+	// Workers plus their in-flight connections only; not one goroutine per request.
+	if grown := runtime.NumGoroutine() - goroutinesBefore; grown > workers*6+10 {
+		t.Fatalf("goroutines grew by %d for %d mirrored requests; pool is not bounded", grown, flood)
+	}
+	droppedAfter, _ := scrapeMetric(t, "proxy_mirror_dropped_total", "")
+	if dropped := droppedAfter - droppedBefore; dropped < flood-workers-queueSize {
+		t.Fatalf("expected at least %d dropped mirror requests, got %v", flood-workers-queueSize, dropped)
+	}
+}
+
+// Only bodies within max_body_bytes are copied to the mirror; larger ones still reach the
+// primary intact.
+func TestMirror_SkipsBodiesAboveLimit(t *testing.T) {
+	banner("mirror_test.go")
+	primaryBodies := make(chan int, 4)
+	primaryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		primaryBodies <- len(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(primaryServer.Close)
+	mirrorBodies := make(chan int, 4)
+	mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mirrorBodies <- len(body)
+	}))
+	t.Cleanup(mirrorServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, primaryServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMirror(mustURL(t, mirrorServer.URL), 1, 4, 16)
+	t.Cleanup(func() { reverseProxy.SetMirror(nil, 0, 0, 0) })
+
+	post := func(body string, knownLength bool) {
+		var reader io.Reader = strings.NewReader(body)
+		if !knownLength {
+			reader = io.MultiReader(reader) // hides the length from httptest.NewRequest
+		}
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload", reader))
+		if got := <-primaryBodies; got != len(body) {
+			t.Fatalf("primary received %d body bytes, want %d", got, len(body))
+		}
+	}
+
+	post("small", true)
+	select {
+	case got := <-mirrorBodies:
+		if got != len("small") {
+			t.Fatalf("mirror received %d body bytes, want %d", got, len("small"))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("small body was not mirrored")
+	}
+
+	post(strings.Repeat("x", 64), true)
+	post(strings.Repeat("y", 64), false)
+	select {
+	case got := <-mirrorBodies:
+		t.Fatalf("a %d-byte body above the 16-byte limit was mirrored", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,153 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+func TestPreserveEncodedPath_KeepsEncodedSlash(t *testing.T) {
+	banner("path_encoding_test.go")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Echo-Request-URI", r.RequestURI)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	// A target base path forces the proxy to join paths, which is where encoding used to be lost.
+	targetURL := mustURL(t, upstreamServer.URL+"/base")
+
+	forward := func(preserve bool) string {
+		reverseProxy := proxy.NewReverseProxy(targetURL, proxy.NewLRUCache(16), false)
+		reverseProxy.SetHealthCheckEnabled(false)
+		reverseProxy.SetPreserveEncodedPath(preserve)
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/a%2Fb.txt?x=1", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		return rec.Header().Get("Echo-Request-URI")
+	}
+
+	if got := forward(true); got != "/base/files/a%2Fb.txt?x=1" {
+		t.Fatalf("preserve_encoded_path: upstream saw %q", got)
+	}
+	if got := forward(false); got != "/base/files/a/b.txt?x=1" {
+		t.Fatalf("default: upstream saw %q", got)
+	}
+}
+
+func TestPathEncoding_MountedTargetRewritesLocationAndCookiePath(t *testing.T) {
+	banner("path_encoding_test.go")
+	var upstreamPath string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		w.Header().Set("Location", "/svc/y?tab=2")
+		if r.URL.Query().Get("absolute") != "" {
+			w.Header().Set("Location", "http://"+r.Host+"/svc/z")
+		}
+		w.Header().Add("Set-Cookie", "session=abc; Path=/svc; HttpOnly")
+		w.Header().Add("Set-Cookie", "other=1; Path=/elsewhere")
+		w.WriteHeader(http.StatusFound)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL+"/svc"), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetRewriteMountedPaths(true)
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x", nil))
+	if upstreamPath != "/svc/x" {
+		t.Fatalf("upstream saw %q, want /svc/x", upstreamPath)
+	}
+	if got := rec.Header().Get("Location"); got != "/y?tab=2" {
+		t.Fatalf("Location = %q, want /y?tab=2", got)
+	}
+	cookies := rec.Header().Values("Set-Cookie")
+	if len(cookies) != 2 || cookies[0] != "session=abc; Path=/; HttpOnly" || cookies[1] != "other=1; Path=/elsewhere" {
+		t.Fatalf("unexpected Set-Cookie values %q", cookies)
+	}
+
+	// Absolute redirects on the target host become client-relative.
+	rec = httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x?absolute=1", nil))
+	if got := rec.Header().Get("Location"); got != "/z" {
+		t.Fatalf("absolute Location = %q, want /z", got)
+	}
+
+	// With rewriting off the prefix is passed through.
+	reverseProxy.SetRewriteMountedPaths(false)
+	rec = httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x", nil))
+	if got := rec.Header().Get("Location"); got != "/svc/y?tab=2" {
+		t.Fatalf("with rewriting off Location = %q, want /svc/y?tab=2", got)
+	}
+}
+
+func TestPathEncoding_TrailingSlashStripSharesCacheEntry(t *testing.T) {
+	banner("path_encoding_test.go")
+	var mu sync.Mutex
+	var seenPaths []string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seenPaths = append(seenPaths, r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	takeSeenPaths := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		paths := seenPaths
+		seenPaths = nil
+		return paths
+	}
+	fetch := func(reverseProxy *proxy.ReverseProxy, path string) string {
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Header().Get("X-Cache")
+	}
+	newStripProxy := func(forward bool) *proxy.ReverseProxy {
+		reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+		reverseProxy.SetHealthCheckEnabled(false)
+		reverseProxy.SetTrailingSlashNormalization(proxy.TrailingSlashStrip, forward)
+		return reverseProxy
+	}
+
+	// Key-only: both forms share the entry, the upstream still saw the path as sent.
+	keyOnly := newStripProxy(false)
+	if state := fetch(keyOnly, "/api/items/"); state != "MISS" {
+		t.Fatalf("first fetch: X-Cache=%s, want MISS", state)
+	}
+	if state := fetch(keyOnly, "/api/items"); state != "HIT" {
+		t.Fatalf("/api/items after /api/items/: X-Cache=%s, want HIT", state)
+	}
+	if paths := takeSeenPaths(); len(paths) != 1 || paths[0] != "/api/items/" {
+		t.Fatalf("key-only normalization must not change the forwarded path, upstream saw %v", paths)
+	}
+
+	// Forwarding too: the upstream receives the canonical form.
+	forwarding := newStripProxy(true)
+	fetch(forwarding, "/api/other/")
+	if state := fetch(forwarding, "/api/other"); state != "HIT" {
+		t.Fatalf("/api/other after /api/other/: X-Cache=%s, want HIT", state)
+	}
+	if paths := takeSeenPaths(); len(paths) != 1 || paths[0] != "/api/other" {
+		t.Fatalf("forwarded path should be stripped, upstream saw %v", paths)
+	}
+
+	// Off (the default) keeps them distinct.
+	distinct := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	distinct.SetHealthCheckEnabled(false)
+	fetch(distinct, "/api/items/")
+	if state := fetch(distinct, "/api/items"); state != "MISS" {
+		t.Fatalf("without normalization the forms must not share an entry, X-Cache=%s", state)
+	}
+}
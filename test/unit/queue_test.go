@@ -1,11 +1,15 @@
 package proxy_test
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -179,3 +183,390 @@ func TestQueue_ClientCancellationWhileQueued(t *testing.T) {
 		t.Fatalf("expected 503 for client cancellation, got %d", rec.Code)
 	}
 }
+
+func TestQueue_DisabledNeverRejects(t *testing.T) {
+	banner("queue_test.go")
+
+	// A burst larger than MaxQueue+MaxConcurrent, held at the upstream until every request
+	// has arrived, so all of them are in flight at once.
+	queueConfig := proxy.QueueConfig{MaxQueue: 4, MaxConcurrent: 4, EnqueueTimeout: 5 * time.Second}
+	requestCount := 3 * (queueConfig.MaxQueue + queueConfig.MaxConcurrent)
+	burst := func(queued bool) (statusCodes []int, peak int64) {
+		var inFlight int64
+		allArrived := make(chan struct{})
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			current := atomic.AddInt64(&inFlight, 1)
+			for {
+				observed := atomic.LoadInt64(&peak)
+				if current <= observed || atomic.CompareAndSwapInt64(&peak, observed, current) {
+					break
+				}
+			}
+			if current == int64(requestCount) {
+				close(allArrived)
+			}
+			select {
+			case <-allArrived:
+			case <-time.After(time.Second):
+			}
+			atomic.AddInt64(&inFlight, -1)
+			fmt.Fprint(w, "ok")
+		}))
+		defer upstream.Close()
+
+		reverseProxy := proxy.NewReverseProxy(mustURL(t, upstream.URL), proxy.NewLRUCache(0), false)
+		reverseProxy.SetHealthCheckEnabled(false)
+		var handler http.Handler = reverseProxy
+		if queued {
+			handler = reverseProxy.WithQueue(queueConfig)
+		}
+
+		var wg sync.WaitGroup
+		statusCodes = make([]int, requestCount)
+		for i := 0; i < requestCount; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+				statusCodes[i] = rec.Code
+			}(i)
+		}
+		wg.Wait()
+		return statusCodes, atomic.LoadInt64(&peak)
+	}
+
+	// Control: with the queue, the same burst is partly rejected.
+	queuedCodes, _ := burst(true)
+	rejected := 0
+	for _, status := range queuedCodes {
+		if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+			rejected++
+		}
+	}
+	if rejected == 0 {
+		t.Fatalf("control: expected the queued proxy to reject part of the burst, got %v", queuedCodes)
+	}
+
+	// Without WithQueue (proxy.queue.enabled: false) misses go straight upstream.
+	statusCodes, peak := burst(false)
+	for i, status := range statusCodes {
+		if status != http.StatusOK {
+			t.Fatalf("request %d: expected 200 with queue disabled, got %d", i, status)
+		}
+	}
+	if peak != int64(requestCount) {
+		t.Fatalf("expected all %d requests in flight at once with queue disabled, peak %d", requestCount, peak)
+	}
+}
+
+func TestQueue_WarmupBoundsConcurrencyAfterPurge(t *testing.T) {
+	banner("queue_test.go")
+
+	var currentConcurrency, peakConcurrency int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cur := atomic.AddInt64(&currentConcurrency, 1)
+		for {
+			observedPeak := atomic.LoadInt64(&peakConcurrency)
+			if cur <= observedPeak || atomic.CompareAndSwapInt64(&peakConcurrency, observedPeak, cur) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt64(&currentConcurrency, -1)
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprint(w, "ok")
+	}))
+	t.Cleanup(upstream.Close)
+
+	// Full limit is 20, but a long warm window starting at 10% admits only ~2 at once.
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstream.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy = reverseProxy.WithQueue(proxy.QueueConfig{
+		MaxQueue:       100,
+		MaxConcurrent:  20,
+		EnqueueTimeout: 5 * time.Second,
+		WarmupWindow:   time.Minute,
+		WarmupFraction: 0.1,
+	})
+	reverseProxy.PurgeCache()
+
+	var wg sync.WaitGroup
+	requestCount := 20
+	statusCodes := make([]int, requestCount)
+	for i := 0; i < requestCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			reverseProxy.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/cold/%d", i), nil))
+			statusCodes[i] = rec.Code
+		}(i)
+	}
+	wg.Wait()
+
+	for i, status := range statusCodes {
+		if status != http.StatusOK {
+			t.Fatalf("request %d: expected 200 after waiting out the warm-up cap, got %d", i, status)
+		}
+	}
+	if peak := atomic.LoadInt64(&peakConcurrency); peak > 2 {
+		t.Fatalf("expected upstream concurrency <= 2 during warm-up, observed %d", peak)
+	}
+}
+
+func TestQueue_MethodLimitCapsPostsWhileGetsFlow(t *testing.T) {
+	banner("queue_test.go")
+	var activePosts, maxActivePosts int64
+	releasePosts := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			current := atomic.AddInt64(&activePosts, 1)
+			for {
+				observed := atomic.LoadInt64(&maxActivePosts)
+				if current <= observed || atomic.CompareAndSwapInt64(&maxActivePosts, observed, current) {
+					break
+				}
+			}
+			<-releasePosts
+			atomic.AddInt64(&activePosts, -1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(0), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy = reverseProxy.WithQueue(proxy.QueueConfig{
+		MaxQueue:       16,
+		MaxConcurrent:  8,
+		EnqueueTimeout: 5 * time.Second,
+		MethodLimits:   map[string]int{"POST": 1},
+	})
+
+	// Saturate the POST cap: one runs, the others wait for the POST semaphore.
+	var postsDone sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		postsDone.Add(1)
+		go func() {
+			defer postsDone.Done()
+			reverseProxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/orders", nil))
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// GETs are not bound by the POST cap and complete while POSTs are stuck.
+	for i := 0; i < 3; i++ {
+		getStart := time.Now()
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/items/%d", i), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %d: expected 200, got %d", i, rec.Code)
+		}
+		if elapsed := time.Since(getStart); elapsed > time.Second {
+			t.Fatalf("GET %d took %v while POSTs were saturated", i, elapsed)
+		}
+	}
+
+	close(releasePosts)
+	postsDone.Wait()
+	if got := atomic.LoadInt64(&maxActivePosts); got != 1 {
+		t.Fatalf("expected at most 1 concurrent POST, observed %d", got)
+	}
+}
+
+func TestQueue_PostsWaitingOnMethodCapDoNotHoldGlobalSlots(t *testing.T) {
+	banner("queue_test.go")
+	releasePosts := make(chan struct{})
+	postEntered := make(chan struct{}, 4)
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			postEntered <- struct{}{}
+			<-releasePosts
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(0), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy = reverseProxy.WithQueue(proxy.QueueConfig{
+		MaxQueue:       8,
+		MaxConcurrent:  2,
+		EnqueueTimeout: 3 * time.Second,
+		MethodLimits:   map[string]int{"POST": 1},
+	})
+
+	// One POST runs on a global slot; the others wait for the POST cap. If the waiters
+	// held the remaining global slot, the GET below could never be admitted.
+	var postsDone sync.WaitGroup
+	t.Cleanup(func() {
+		close(releasePosts)
+		postsDone.Wait()
+	})
+	for i := 0; i < 3; i++ {
+		postsDone.Add(1)
+		go func() {
+			defer postsDone.Done()
+			reverseProxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/orders", nil))
+		}()
+	}
+	select {
+	case <-postEntered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no POST reached the upstream")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if depth, _ := scrapeMetric(t, "proxy_queue_depth", ""); depth == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("waiting POSTs never queued")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	getStart := time.Now()
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET with the POST cap full: status %d, want 200", rec.Code)
+	}
+	if elapsed := time.Since(getStart); elapsed > time.Second {
+		t.Fatalf("GET took %v while POSTs waited on their cap", elapsed)
+	}
+}
+
+func TestQueue_PipelinedRequestsAnswerInOrder(t *testing.T) {
+	banner("queue_test.go")
+
+	// Earlier requests are slower, so any reordering on the connection would show up.
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		index, _ := strconv.Atoi(r.URL.Query().Get("i"))
+		time.Sleep(time.Duration(5-index) * 20 * time.Millisecond)
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprintf(w, "response-%d", index)
+	}))
+	t.Cleanup(upstream.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstream.URL), proxy.NewLRUCache(0), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	frontend := httptest.NewServer(reverseProxy.WithQueue(proxy.QueueConfig{
+		MaxQueue:       8,
+		MaxConcurrent:  8,
+		EnqueueTimeout: time.Second,
+	}))
+	t.Cleanup(frontend.Close)
+
+	conn, err := net.Dial("tcp", frontend.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	// Write all requests before reading any response.
+	const requests = 5
+	for i := 0; i < requests; i++ {
+		fmt.Fprintf(conn, "GET /item?i=%d HTTP/1.1\r\nHost: proxy.test\r\n\r\n", i)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	for i := 0; i < requests; i++ {
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("read response %d: %v", i, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want := fmt.Sprintf("response-%d", i); string(body) != want {
+			t.Fatalf("pipelined response %d: got %q, want %q", i, body, want)
+		}
+	}
+}
+
+func TestQueue_CacheHitsServeWhileQueueSaturated(t *testing.T) {
+	banner("queue_test.go")
+	releaseSlow := make(chan struct{})
+	slowEntered := make(chan struct{}, 4)
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hot" {
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = w.Write([]byte("hot"))
+			return
+		}
+		slowEntered <- struct{}{}
+		<-releaseSlow
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy = reverseProxy.WithQueue(proxy.QueueConfig{
+		MaxQueue:       1,
+		MaxConcurrent:  1,
+		EnqueueTimeout: 5 * time.Second,
+	})
+
+	// Warm the hot key before saturating.
+	reverseProxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hot", nil))
+	hitsBefore, _ := scrapeMetric(t, "proxy_cache_hits_served_total", "")
+
+	// One slow request holds the only slot; a second waits in the only queue position.
+	// Start the second only once the first reached the upstream, so it is the one queued.
+	var slowDone sync.WaitGroup
+	sendSlow := func(i int) {
+		slowDone.Add(1)
+		go func() {
+			defer slowDone.Done()
+			reverseProxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/slow/%d", i), nil))
+		}()
+	}
+	t.Cleanup(func() {
+		close(releaseSlow)
+		slowDone.Wait()
+	})
+	sendSlow(0)
+	select {
+	case <-slowEntered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("first slow request never reached the upstream")
+	}
+	sendSlow(1)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if depth, _ := scrapeMetric(t, "proxy_queue_depth", ""); depth == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("second slow request never entered the queue")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The queue is full: another MISS is rejected outright.
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow/extra", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("MISS with a full queue: status %d, want 429", rec.Code)
+	}
+
+	// HITs on the hot key still answer immediately.
+	for i := 0; i < 5; i++ {
+		hitStart := time.Now()
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hot", nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "HIT" {
+			t.Fatalf("hot key during saturation: status %d X-Cache %q, want 200 HIT", rec.Code, rec.Header().Get("X-Cache"))
+		}
+		if elapsed := time.Since(hitStart); elapsed > 100*time.Millisecond {
+			t.Fatalf("HIT took %v while the queue was saturated", elapsed)
+		}
+	}
+	if hitsAfter, _ := scrapeMetric(t, "proxy_cache_hits_served_total", ""); hitsAfter-hitsBefore != 5 {
+		t.Fatalf("proxy_cache_hits_served_total grew by %v, want 5", hitsAfter-hitsBefore)
+	}
+}
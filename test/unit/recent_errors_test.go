@@ -0,0 +1,118 @@
+package proxy_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	applog "traefik-challenge-2/internal/log"
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+type recentErrorsBody struct {
+	Count  int                 `json:"count"`
+	Errors []applog.ErrorEvent `json:"errors"`
+}
+
+func fetchRecentErrors(t *testing.T, query string) recentErrorsBody {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	applog.RecentErrorsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/errors"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/admin/errors: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var body recentErrorsBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode /admin/errors: %v", err)
+	}
+	return body
+}
+
+// Upstream 4xx/5xx responses and proxy failures land in the ring, newest first, with context.
+func TestRecentErrors_RecordsProxyAndUpstreamErrors(t *testing.T) {
+	banner("recent_errors_test.go")
+	applog.SetRecentErrorsCapacity(10)
+	t.Cleanup(func() { applog.SetRecentErrorsCapacity(100) })
+
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/recent/missing":
+			http.NotFound(w, r)
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(upstreamServer.Close)
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+
+	deadProxy := proxy.NewReverseProxy(closedServerURL(t), proxy.NewLRUCache(16), false)
+	deadProxy.SetHealthCheckEnabled(false)
+
+	requests := []struct {
+		handler http.Handler
+		path    string
+		id      string
+	}{
+		{reverseProxy, "/recent/broken", "err-500"},
+		{reverseProxy, "/recent/missing", "err-404"},
+		{deadProxy, "/recent/unreachable", "err-dial"},
+		{reverseProxy, "/recent/broken-again", "err-last"},
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest(http.MethodGet, r.path, nil)
+		req.Header.Set("X-Request-ID", r.id)
+		r.handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	body := fetchRecentErrors(t, "")
+	if body.Count != len(requests) {
+		t.Fatalf("count = %d, want %d: %+v", body.Count, len(requests), body.Errors)
+	}
+	byID := map[string]applog.ErrorEvent{}
+	for _, event := range body.Errors {
+		byID[event.RequestID] = event
+	}
+	if event := byID["err-500"]; event.Status != http.StatusInternalServerError || event.URL != "/recent/broken" || event.Method != http.MethodGet {
+		t.Fatalf("500 event = %+v", event)
+	}
+	if event := byID["err-404"]; event.Status != http.StatusNotFound {
+		t.Fatalf("404 event = %+v", event)
+	}
+	if event := byID["err-dial"]; event.Status < 500 || event.Error == "" || event.Upstream == "" {
+		t.Fatalf("dial failure event should carry the upstream and error message: %+v", event)
+	}
+	if body.Errors[0].RequestID != "err-last" {
+		t.Fatalf("events should be newest first, got %q first", body.Errors[0].RequestID)
+	}
+
+	if limited := fetchRecentErrors(t, "?limit=2"); limited.Count != 2 || limited.Errors[0].RequestID != "err-last" {
+		t.Fatalf("limit=2 returned %+v", limited)
+	}
+}
+
+// Once full, the ring keeps only the newest events.
+func TestRecentErrors_RingOverwritesOldest(t *testing.T) {
+	banner("recent_errors_test.go")
+	applog.SetRecentErrorsCapacity(2)
+	t.Cleanup(func() { applog.SetRecentErrorsCapacity(100) })
+
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(upstreamServer.Close)
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+
+	for _, id := range []string{"ring-1", "ring-2", "ring-3"} {
+		req := httptest.NewRequest(http.MethodGet, "/ring", nil)
+		req.Header.Set("X-Request-ID", id)
+		reverseProxy.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	body := fetchRecentErrors(t, "")
+	if body.Count != 2 || body.Errors[0].RequestID != "ring-3" || body.Errors[1].RequestID != "ring-2" {
+		t.Fatalf("ring = %+v, want ring-3, ring-2", body.Errors)
+	}
+}
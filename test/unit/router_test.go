@@ -0,0 +1,86 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// namedHandler answers with its name so tests can see which route was taken.
+func namedHandler(name string) http.Handler {
+	return proxy.StaticResponse(http.StatusOK, "text/plain", []byte(name))
+}
+
+func routeOf(t *testing.T, router *proxy.Router, method, host, target string) string {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	req.Host = host
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Body.String()
+}
+
+func TestRouter_FirstMatchWins(t *testing.T) {
+	banner("router_test.go")
+	router := proxy.NewRouter(namedHandler("default"))
+	router.Handle("robots", namedHandler("robots"))
+	router.Handle("api", namedHandler("api"))
+	router.Handle("api-writes", namedHandler("api-writes"))
+
+	rules := []proxy.RouteRule{
+		{Name: "robots", Match: proxy.RouteMatch{Path: "/robots.txt"}, Handler: "robots"},
+		{Name: "api-get", Match: proxy.RouteMatch{PathPrefix: "/api/", Methods: []string{"GET", "HEAD"}}, Handler: "api"},
+		// Shadowed for GET by the rule above; only reached by other methods.
+		{Name: "api-all", Match: proxy.RouteMatch{PathPrefix: "/api/"}, Handler: "api-writes"},
+	}
+	for _, rule := range rules {
+		if err := router.AddRule(rule); err != nil {
+			t.Fatalf("AddRule(%s): %v", rule.Name, err)
+		}
+	}
+
+	cases := []struct{ method, target, want string }{
+		{http.MethodGet, "/robots.txt", "robots"},
+		{http.MethodGet, "/api/items", "api"},
+		{http.MethodPost, "/api/items", "api-writes"},
+		{http.MethodGet, "/robots.txt.bak", "default"},
+	}
+	for _, tc := range cases {
+		if got := routeOf(t, router, tc.method, "example.com", tc.target); got != tc.want {
+			t.Fatalf("%s %s: routed to %q, want %q", tc.method, tc.target, got, tc.want)
+		}
+	}
+}
+
+func TestRouter_HostGlobMatching(t *testing.T) {
+	banner("router_test.go")
+	router := proxy.NewRouter(namedHandler("default"))
+	router.Handle("tenant", namedHandler("tenant"))
+	if err := router.AddRule(proxy.RouteRule{Name: "tenants", Match: proxy.RouteMatch{Host: "*.example.com"}, Handler: "tenant"}); err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+
+	if got := routeOf(t, router, http.MethodGet, "Shop.Example.com:8080", "/"); got != "tenant" {
+		t.Fatalf("subdomain with port: routed to %q, want tenant", got)
+	}
+	if got := routeOf(t, router, http.MethodGet, "example.com", "/"); got != "default" {
+		t.Fatalf("apex host: routed to %q, want default", got)
+	}
+}
+
+func TestRouter_FallthroughAndValidation(t *testing.T) {
+	banner("router_test.go")
+	router := proxy.NewRouter(namedHandler("default"))
+	if err := router.AddRule(proxy.RouteRule{Name: "missing", Match: proxy.RouteMatch{Path: "/x"}, Handler: "nope"}); err == nil {
+		t.Fatalf("expected error for unknown handler")
+	}
+	router.Handle("static", namedHandler("static"))
+	if err := router.AddRule(proxy.RouteRule{Name: "bad-host", Match: proxy.RouteMatch{Host: "[a-"}, Handler: "static"}); err == nil {
+		t.Fatalf("expected error for malformed host pattern")
+	}
+	if got := routeOf(t, router, http.MethodGet, "example.com", "/anything"); got != "default" {
+		t.Fatalf("no rules: routed to %q, want default", got)
+	}
+}
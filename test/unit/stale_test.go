@@ -0,0 +1,145 @@
+package proxy_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// startStaleUpstream answers "v<n>" per request with the given Cache-Control; while failing
+// is set it answers 503 instead.
+func startStaleUpstream(t *testing.T, cacheControl string, hits *int64, failing *atomic.Bool) *httptest.Server {
+	t.Helper()
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit := atomic.AddInt64(hits, 1)
+		if failing.Load() {
+			http.Error(w, "upstream down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Cache-Control", cacheControl)
+		_, _ = fmt.Fprintf(w, "v%d", hit)
+	}))
+	t.Cleanup(upstreamServer.Close)
+	return upstreamServer
+}
+
+func getThrough(t *testing.T, handler http.Handler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestStale_WhileRevalidateBoundedByMaxStale(t *testing.T) {
+	banner("stale_test.go")
+	var upstreamHits int64
+	var failing atomic.Bool
+	upstreamServer := startStaleUpstream(t, "max-age=1, stale-while-revalidate=3600", &upstreamHits, &failing)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMaxStale(500 * time.Millisecond)
+
+	getThrough(t, reverseProxy, "/fresh-window")
+	getThrough(t, reverseProxy, "/past-limit")
+
+	// Slightly past expiry: inside both the directive window and max_stale.
+	time.Sleep(1200 * time.Millisecond)
+	rec := getThrough(t, reverseProxy, "/fresh-window")
+	if rec.Header().Get("X-Cache") != "STALE" {
+		t.Fatalf("expected STALE within max_stale, got X-Cache=%q body=%q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+
+	// Past max_stale: the hour-long SWR window must not be honored; fetch fresh instead.
+	time.Sleep(600 * time.Millisecond)
+	hitsBefore := atomic.LoadInt64(&upstreamHits)
+	rec = getThrough(t, reverseProxy, "/past-limit")
+	if rec.Header().Get("X-Cache") == "STALE" {
+		t.Fatalf("entry older than max_stale was served stale: body=%q", rec.Body.String())
+	}
+	if rec.Header().Get("X-Cache") != "MISS" || atomic.LoadInt64(&upstreamHits) == hitsBefore {
+		t.Fatalf("expected a synchronous fresh fetch, got X-Cache=%q", rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestStale_IfErrorBoundedByMaxStale(t *testing.T) {
+	banner("stale_test.go")
+	var upstreamHits int64
+	var failing atomic.Bool
+	upstreamServer := startStaleUpstream(t, "max-age=1, stale-if-error=3600", &upstreamHits, &failing)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMaxStale(500 * time.Millisecond)
+
+	if rec := getThrough(t, reverseProxy, "/report"); rec.Body.String() != "v1" {
+		t.Fatalf("priming request: body %q", rec.Body.String())
+	}
+	failing.Store(true)
+
+	time.Sleep(1200 * time.Millisecond)
+	rec := getThrough(t, reverseProxy, "/report")
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "STALE" || rec.Body.String() != "v1" {
+		t.Fatalf("expected stale v1 within max_stale, got %d X-Cache=%q body=%q", rec.Code, rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	rec = getThrough(t, reverseProxy, "/report")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected the upstream 503 once the entry is older than max_stale, got %d X-Cache=%q", rec.Code, rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestStale_DisabledWithoutMaxStale(t *testing.T) {
+	banner("stale_test.go")
+	var upstreamHits int64
+	var failing atomic.Bool
+	upstreamServer := startStaleUpstream(t, "max-age=1, stale-if-error=3600", &upstreamHits, &failing)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+
+	getThrough(t, reverseProxy, "/report")
+	failing.Store(true)
+	time.Sleep(1100 * time.Millisecond)
+	if rec := getThrough(t, reverseProxy, "/report"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("stale serving must be off by default, got %d X-Cache=%q", rec.Code, rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestStale_ClientMaxStaleServesExpiredEntry(t *testing.T) {
+	banner("stale_test.go")
+	var upstreamHits int64
+	var failing atomic.Bool
+	upstreamServer := startStaleUpstream(t, "max-age=1", &upstreamHits, &failing)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMaxStale(time.Minute)
+
+	getThrough(t, reverseProxy, "/tolerant")
+	time.Sleep(1200 * time.Millisecond)
+
+	// Expired by ~0.2s, well inside the client's 60s tolerance: served without revalidating.
+	req := httptest.NewRequest(http.MethodGet, "/tolerant", nil)
+	req.Header.Set("Cache-Control", "max-stale=60")
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, req)
+	if rec.Header().Get("X-Cache") != "STALE" || rec.Body.String() != "v1" {
+		t.Fatalf("max-stale client: want STALE v1, got X-Cache=%q body=%q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+	if got := atomic.LoadInt64(&upstreamHits); got != 1 {
+		t.Fatalf("max-stale client must not reach the upstream, got %d hits", got)
+	}
+
+	// A client without max-stale gets a fresh copy.
+	rec = getThrough(t, reverseProxy, "/tolerant")
+	if rec.Header().Get("X-Cache") != "MISS" || rec.Body.String() != "v2" {
+		t.Fatalf("normal client: want MISS v2, got X-Cache=%q body=%q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+}
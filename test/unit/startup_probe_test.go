@@ -0,0 +1,189 @@
+package proxy_test
+
+import (
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// closedServerURL returns the URL of a server that has already been shut down.
+func closedServerURL(t *testing.T) *url.URL {
+	t.Helper()
+	server := httptest.NewServer(http.NotFoundHandler())
+	targetURL := mustURL(t, server.URL)
+	server.Close()
+	return targetURL
+}
+
+func TestStartupProbe_AllUnreachableFailsWhenRequired(t *testing.T) {
+	banner("startup_probe_test.go")
+	targets := []*url.URL{closedServerURL(t), closedServerURL(t)}
+
+	results, err := proxy.StartupSelfTest(targets, 200*time.Millisecond, true)
+	if err == nil {
+		t.Fatalf("expected startup error when no target is reachable")
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected a result per target, got %d", len(results))
+	}
+	for _, result := range results {
+		if result.Reachable || result.Err == nil {
+			t.Fatalf("target %s should be reported unreachable: %+v", result.Target, result)
+		}
+	}
+
+	// Without require_one_healthy the probe only reports.
+	if _, err := proxy.StartupSelfTest(targets, 200*time.Millisecond, false); err != nil {
+		t.Fatalf("probe should not fail when not required: %v", err)
+	}
+}
+
+func TestStartupProbe_OneReachableSucceeds(t *testing.T) {
+	banner("startup_probe_test.go")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	results, err := proxy.StartupSelfTest([]*url.URL{closedServerURL(t), mustURL(t, upstreamServer.URL)}, time.Second, true)
+	if err != nil {
+		t.Fatalf("one reachable target should satisfy require_one_healthy: %v", err)
+	}
+	if !results[1].Reachable || results[1].StatusCode != http.StatusOK {
+		t.Fatalf("expected second target reachable with 200, got %+v", results[1])
+	}
+}
+
+func TestStartupProbe_BoundedConcurrencyAndDeadline(t *testing.T) {
+	banner("startup_probe_test.go")
+	var inflight, peak int64
+	release := make(chan struct{})
+	trackedHandler := func(hang bool) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			current := atomic.AddInt64(&inflight, 1)
+			defer atomic.AddInt64(&inflight, -1)
+			for {
+				seen := atomic.LoadInt64(&peak)
+				if current <= seen || atomic.CompareAndSwapInt64(&peak, seen, current) {
+					break
+				}
+			}
+			if hang {
+				<-release
+				return
+			}
+			time.Sleep(30 * time.Millisecond)
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+
+	var targets []*url.URL
+	for i := 0; i < 6; i++ {
+		server := httptest.NewServer(trackedHandler(false))
+		t.Cleanup(server.Close)
+		targets = append(targets, mustURL(t, server.URL))
+	}
+	for i := 0; i < 4; i++ {
+		targets = append(targets, closedServerURL(t))
+	}
+	// Targets that never answer are listed last and must be cut off by the deadline.
+	for i := 0; i < 2; i++ {
+		server := httptest.NewServer(trackedHandler(true))
+		t.Cleanup(server.Close)
+		targets = append(targets, mustURL(t, server.URL))
+	}
+	t.Cleanup(func() { close(release) })
+
+	started := time.Now()
+	results, err := proxy.StartupSelfTestWithOptions(targets, proxy.StartupProbeOptions{
+		Timeout:           10 * time.Second,
+		Concurrency:       3,
+		Deadline:          500 * time.Millisecond,
+		RequireOneHealthy: true,
+	})
+	if err != nil {
+		t.Fatalf("six reachable targets should satisfy require_one_healthy: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("deadline should end the probe promptly, took %v", elapsed)
+	}
+	if got := atomic.LoadInt64(&peak); got > 3 {
+		t.Fatalf("expected at most 3 probes in flight, saw %d", got)
+	}
+	if len(results) != len(targets) {
+		t.Fatalf("expected a result per target, got %d of %d", len(results), len(targets))
+	}
+	for index, result := range results {
+		if wantReachable := index < 6; result.Reachable != wantReachable || result.Target != targets[index] {
+			t.Fatalf("target %d: unexpected result %+v", index, result)
+		}
+	}
+	if summary := proxy.SummarizeStartupProbe(results); !strings.Contains(summary, "6/12 targets reachable") {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+}
+
+func TestCapabilityProbe_DetectsHTTP2AndGzip(t *testing.T) {
+	banner("startup_probe_test.go")
+	var lastProto atomic.Int32
+	h2Upstream := newH2CServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastProto.Store(int32(r.ProtoMajor))
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			_, _ = gz.Write([]byte("ok"))
+			_ = gz.Close()
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	h1Upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(h1Upstream.Close)
+
+	h2URL, h1URL := mustURL(t, h2Upstream.URL), mustURL(t, h1Upstream.URL)
+	mixed := proxy.NewReverseProxyMulti([]*url.URL{h2URL, h1URL}, proxy.NewLRUCache(0), false)
+	mixed.SetHealthCheckEnabled(false)
+	results := mixed.ProbeUpstreamCapabilities(time.Second, true)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if h2 := results[0]; h2.Err != nil || !h2.HTTP2 || !h2.Gzip {
+		t.Fatalf("h2c upstream: want HTTP2 and gzip, got %+v", h2)
+	}
+	if h1 := results[1]; h1.Err != nil || h1.HTTP2 || h1.Gzip {
+		t.Fatalf("h1-only upstream: want neither HTTP2 nor gzip, got %+v", h1)
+	}
+	summary := proxy.SummarizeCapabilities(results)
+	if !strings.Contains(summary, h2URL.Host+"=h2,gzip=true") || !strings.Contains(summary, h1URL.Host+"=http/1.1,gzip=false") {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+
+	// Mixed fleet: the transport is left alone, so the h1-only upstream still works.
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		mixed.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("mixed fleet request %d: status %d", i, rec.Code)
+		}
+	}
+
+	// Every target speaks HTTP/2: configure_transport switches upstream connections to h2c.
+	h2Only := proxy.NewReverseProxy(h2URL, proxy.NewLRUCache(0), false)
+	h2Only.SetHealthCheckEnabled(false)
+	h2Only.ProbeUpstreamCapabilities(time.Second, true)
+	lastProto.Store(0)
+	rec := httptest.NewRecorder()
+	h2Only.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || lastProto.Load() != 2 {
+		t.Fatalf("after probing an h2c-only fleet: status %d, upstream proto major %d (want 200, 2)", rec.Code, lastProto.Load())
+	}
+}
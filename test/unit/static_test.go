@@ -0,0 +1,129 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+func TestStaticRoutes_ServeWithoutUpstream(t *testing.T) {
+	banner("static_test.go")
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		_, _ = w.Write([]byte("from upstream"))
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	maintenancePage := filepath.Join(t.TempDir(), "maintenance.html")
+	if err := os.WriteFile(maintenancePage, []byte("<h1>back soon</h1>"), 0o600); err != nil {
+		t.Fatalf("write maintenance page: %v", err)
+	}
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	handler, err := proxy.NewStaticRouter([]proxy.StaticRoute{
+		{Path: "/robots.txt", ContentType: "text/plain; charset=utf-8", Body: "User-agent: *\nDisallow: /\n"},
+		{Path: "/maintenance", Status: http.StatusServiceUnavailable, File: maintenancePage},
+	}, reverseProxy)
+	if err != nil {
+		t.Fatalf("NewStaticRouter: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "User-agent: *\nDisallow: /\n" {
+		t.Fatalf("robots.txt: got %d %q", rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+		t.Fatalf("robots.txt: content type %q", contentType)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/maintenance", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "<h1>back soon</h1>" {
+		t.Fatalf("maintenance: got %d %q", rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Fatalf("maintenance: content type %q inferred from file extension", contentType)
+	}
+
+	if hits := atomic.LoadInt64(&upstreamHits); hits != 0 {
+		t.Fatalf("static routes must not reach the upstream, got %d hits", hits)
+	}
+
+	// Other paths are still proxied.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/page", nil))
+	if rec.Body.String() != "from upstream" || atomic.LoadInt64(&upstreamHits) != 1 {
+		t.Fatalf("non-static path: got %q with %d upstream hits", rec.Body.String(), upstreamHits)
+	}
+}
+
+func TestStaticRoutes_DefaultRootResponseWhenNoUpstream(t *testing.T) {
+	banner("static_test.go")
+	// The only target fails its health check, so every request finds no upstream.
+	reverseProxy := proxy.NewReverseProxy(closedServerURL(t), proxy.NewLRUCache(16), true)
+	reverseProxy.SetDefaultRootResponse(http.StatusOK, "text/plain; charset=utf-8", "proxy up, no backend yet\n")
+
+	serve := func(handler http.Handler, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := serve(reverseProxy, "/")
+	if rec.Code != http.StatusOK || rec.Body.String() != "proxy up, no backend yet\n" || rec.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Fatalf("expected configured root response, got %d %q (%q)", rec.Code, rec.Body.String(), rec.Header().Get("Content-Type"))
+	}
+	if rec := serve(reverseProxy, "/other"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("non-root paths keep the no-upstream error, got %d", rec.Code)
+	}
+
+	// A static route for "/" overrides the default root response.
+	handler, err := proxy.NewStaticRouter([]proxy.StaticRoute{{Path: "/", Body: "static root"}}, reverseProxy)
+	if err != nil {
+		t.Fatalf("NewStaticRouter: %v", err)
+	}
+	if rec := serve(handler, "/"); rec.Code != http.StatusOK || rec.Body.String() != "static root" {
+		t.Fatalf("static route must win for /, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStaticRoutes_ApplyAdmissionChecks(t *testing.T) {
+	banner("static_test.go")
+	reverseProxy := proxy.NewReverseProxy(closedServerURL(t), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetAllowedMethods([]string{http.MethodGet, http.MethodHead})
+	reverseProxy.SetAllowedHosts([]string{"example.com"})
+	handler, err := proxy.NewStaticRouter([]proxy.StaticRoute{{Path: "/robots.txt", Body: "User-agent: *\n"}}, reverseProxy)
+	if err != nil {
+		t.Fatalf("NewStaticRouter: %v", err)
+	}
+	serve := func(method, host string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/robots.txt", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(http.MethodGet, "example.com"); rec.Code != http.StatusOK {
+		t.Fatalf("allowed GET: got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPost, "example.com"); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST outside the method allowlist: got %d, want 405", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "other.test"); rec.Code != http.StatusMisdirectedRequest {
+		t.Fatalf("host outside allowed_hosts: got %d, want 421", rec.Code)
+	}
+	reverseProxy.SetMaintenance(true)
+	if rec := serve(http.MethodGet, "example.com"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("maintenance mode: got %d, want 503", rec.Code)
+	}
+}
@@ -0,0 +1,225 @@
+package proxy_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+// startSSEUpstream sends one event immediately and a second one after holdSecond.
+func startSSEUpstream(t *testing.T, holdSecond time.Duration) *httptest.Server {
+	t.Helper()
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(holdSecond):
+		case <-r.Context().Done():
+			return
+		}
+		fmt.Fprint(w, "data: second\n\n")
+	}))
+	t.Cleanup(upstreamServer.Close)
+	return upstreamServer
+}
+
+// timeToFirstEvent returns how long the client waited for the first SSE data line.
+func timeToFirstEvent(t *testing.T, proxyURL string) (time.Duration, *http.Response) {
+	t.Helper()
+	requestStart := time.Now()
+	resp, err := http.Get(proxyURL + "/events")
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "data: first" {
+		t.Fatalf("first event: %q, %v", line, err)
+	}
+	return time.Since(requestStart), resp
+}
+
+func TestStream_SSEFlushedAtConfiguredInterval(t *testing.T) {
+	banner("stream_test.go")
+	const holdSecond = 2 * time.Second
+	upstreamServer := startSSEUpstream(t, holdSecond)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	const flushInterval = 200 * time.Millisecond
+	reverseProxy.SetStreaming(4096, flushInterval)
+	proxyServer := httptest.NewServer(reverseProxy)
+	t.Cleanup(proxyServer.Close)
+
+	waited, resp := timeToFirstEvent(t, proxyServer.URL)
+	// Delivered by the interval flush: not immediately, but long before the stream ends.
+	if waited < flushInterval/2 || waited >= holdSecond {
+		t.Fatalf("first event after %v, want about %v (stream continues for %v)", waited, flushInterval, holdSecond)
+	}
+	if resp.Header.Get("X-Cache") != "BYPASS" {
+		t.Fatalf("streamed responses must bypass the cache, got X-Cache %q", resp.Header.Get("X-Cache"))
+	}
+}
+
+func TestStream_SSEFlushedImmediatelyByDefault(t *testing.T) {
+	banner("stream_test.go")
+	const holdSecond = 2 * time.Second
+	upstreamServer := startSSEUpstream(t, holdSecond)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	proxyServer := httptest.NewServer(reverseProxy)
+	t.Cleanup(proxyServer.Close)
+
+	if waited, _ := timeToFirstEvent(t, proxyServer.URL); waited >= holdSecond/2 {
+		t.Fatalf("first event took %v; SSE must not wait for the stream to end", waited)
+	}
+}
+
+func TestStream_ChunkedPassthroughKeepsUncacheableResponsesChunked(t *testing.T) {
+	banner("stream_test.go")
+	// Upstream answers in flushed chunks without Content-Length.
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cacheable" {
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		} else {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "part-%d;", i)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	fetch := func(t *testing.T, chunked bool, path string) (*http.Response, string) {
+		t.Helper()
+		reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+		reverseProxy.SetHealthCheckEnabled(false)
+		reverseProxy.SetStreamChunked(chunked)
+		proxyServer := httptest.NewServer(reverseProxy)
+		t.Cleanup(proxyServer.Close)
+		resp, err := http.Get(proxyServer.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+	const wantBody = "part-0;part-1;part-2;"
+
+	resp, body := fetch(t, true, "/live")
+	if body != wantBody || resp.ContentLength != -1 || len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Fatalf("passthrough: body %q content-length %d transfer-encoding %v, want chunked without Content-Length",
+			body, resp.ContentLength, resp.TransferEncoding)
+	}
+
+	// Cacheable responses are still buffered so they can be stored.
+	resp, body = fetch(t, true, "/cacheable")
+	if body != wantBody || resp.ContentLength != int64(len(wantBody)) || resp.Header.Get("X-Cache") != "MISS" {
+		t.Fatalf("cacheable: body %q content-length %d X-Cache %q, want buffered MISS", body, resp.ContentLength, resp.Header.Get("X-Cache"))
+	}
+
+	// Without passthrough the body is buffered and gets a Content-Length.
+	resp, body = fetch(t, false, "/live")
+	if body != wantBody || resp.ContentLength != int64(len(wantBody)) {
+		t.Fatalf("buffered: body %q content-length %d, want %d", body, resp.ContentLength, len(wantBody))
+	}
+}
+
+func TestStream_OversizedUpstreamBodyIsStreamedNotBuffered(t *testing.T) {
+	banner("stream_test.go")
+	const chunkSize = 64 << 10
+	clientGotData := make(chan struct{})
+	// A cacheable-looking response: four chunks, the last held back until the client has seen
+	// data, which only happens if the proxy stops buffering at the cap.
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		chunk := []byte(strings.Repeat("x", chunkSize))
+		for i := 0; i < 3; i++ {
+			_, _ = w.Write(chunk)
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-clientGotData:
+		case <-time.After(5 * time.Second):
+			return
+		}
+		_, _ = w.Write(chunk)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	cacheStore := proxy.NewLRUCache(16)
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), cacheStore, true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMaxUpstreamBodyBytes(chunkSize)
+	proxyServer := httptest.NewServer(reverseProxy)
+	t.Cleanup(proxyServer.Close)
+
+	resp, err := http.Get(proxyServer.URL + "/large")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("X-Cache") != "BYPASS" {
+		t.Fatalf("oversized body: X-Cache %q, want BYPASS", resp.Header.Get("X-Cache"))
+	}
+	prefix := make([]byte, chunkSize)
+	if _, err := io.ReadFull(resp.Body, prefix); err != nil {
+		t.Fatalf("read first chunk: %v", err)
+	}
+	close(clientGotData)
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read remainder: %v", err)
+	}
+	if total := len(prefix) + len(rest); total != 4*chunkSize {
+		t.Fatalf("received %d bytes, want %d", total, 4*chunkSize)
+	}
+	if entries, _ := cacheStore.List(16, 0); len(entries) != 0 {
+		t.Fatalf("oversized body was cached: %d entries", len(entries))
+	}
+}
+
+func TestStream_AccessLoggedWhenStreamEnds(t *testing.T) {
+	banner("stream_test.go")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, "data: retry later\n\n")
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+
+	req := httptest.NewRequest(http.MethodGet, "/events/logged", nil)
+	req.Header.Set("X-Request-ID", "stream-logged")
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "data: retry later\n\n" {
+		t.Fatalf("streamed response: %d %q", rec.Code, rec.Body.String())
+	}
+
+	// The response log line (and its recent-errors entry for a 5xx) is written once the stream ends.
+	for _, event := range fetchRecentErrors(t, "").Errors {
+		if event.RequestID == "stream-logged" {
+			if event.Status != http.StatusServiceUnavailable || event.URL != "/events/logged" || event.Cache != "BYPASS" {
+				t.Fatalf("unexpected stream log event %+v", event)
+			}
+			return
+		}
+	}
+	t.Fatal("streamed response was never logged")
+}
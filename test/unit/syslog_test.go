@@ -0,0 +1,56 @@
+//go:build !windows && !plan9
+
+package proxy_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	applog "traefik-challenge-2/internal/log"
+)
+
+func TestSyslog_AccessLineSentOverUDP(t *testing.T) {
+	banner("syslog_test.go")
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	if err := applog.ConfigureSyslog("udp", listener.LocalAddr().String(), "local0", "proxy-test"); err != nil {
+		t.Fatalf("ConfigureSyslog: %v", err)
+	}
+	t.Cleanup(applog.DisableSyslog)
+
+	req := httptest.NewRequest(http.MethodGet, "/syslog-check", nil)
+	req.Header.Set("X-Request-ID", "syslog-req-1")
+	applog.LogProxyRequest(req)
+
+	// The request logs one info line and one debug line; only the info line is sent.
+	buffer := make([]byte, 4096)
+	_ = listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := listener.ReadFrom(buffer)
+	if err != nil {
+		t.Fatalf("no syslog message received: %v", err)
+	}
+	message := string(buffer[:n])
+	if !strings.Contains(message, "proxy-test") || !strings.Contains(message, "REQ method=GET url=/syslog-check | cache=MISS req_id=syslog-req-1") {
+		t.Fatalf("unexpected syslog message %q", message)
+	}
+	// local0 (16) * 8 + info (6) = 134.
+	if !strings.HasPrefix(message, "<134>") {
+		t.Fatalf("expected local0.info priority, got %q", message)
+	}
+	_ = listener.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, _, err := listener.ReadFrom(buffer); err == nil {
+		t.Fatalf("debug line must not reach syslog, got %q", buffer[:n])
+	}
+
+	if err := applog.ConfigureSyslog("udp", listener.LocalAddr().String(), "nonsense", ""); err == nil {
+		t.Fatalf("expected an error for an unknown facility")
+	}
+}
@@ -0,0 +1,250 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+func TestRequestTimeout_HeaderCarriesRemainingBudget(t *testing.T) {
+	banner("timeout_test.go")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Echo-Budget", r.Header.Get("X-Request-Timeout-Ms"))
+		w.Header().Set("Cache-Control", "no-store")
+		time.Sleep(150 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	// One request at a time: the second one waits in the queue and sees a smaller budget.
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetRequestTimeout(2*time.Second, "X-Request-Timeout-Ms")
+	reverseProxy = reverseProxy.WithQueue(proxy.QueueConfig{MaxQueue: 4, MaxConcurrent: 1, EnqueueTimeout: time.Second})
+
+	budgets := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range budgets {
+		wg.Add(1)
+		go func(slot int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/budget", nil))
+			budget, err := strconv.Atoi(rec.Header().Get("Echo-Budget"))
+			if err != nil {
+				t.Errorf("missing/invalid timeout header: %q", rec.Header().Get("Echo-Budget"))
+				return
+			}
+			budgets[slot] = budget
+		}(i)
+		time.Sleep(20 * time.Millisecond) // deterministic arrival order
+	}
+	wg.Wait()
+
+	if budgets[0] <= 0 || budgets[0] > 2000 {
+		t.Fatalf("first budget out of range: %d", budgets[0])
+	}
+	if budgets[1] >= budgets[0]-100 {
+		t.Fatalf("queued request should see a budget reduced by its wait: first=%d second=%d", budgets[0], budgets[1])
+	}
+}
+
+func TestRequestTimeout_DeadlineCancelsUpstream(t *testing.T) {
+	banner("timeout_test.go")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetRequestTimeout(100*time.Millisecond, "")
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("want 504 when the budget expires, got %d", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("outbound context deadline not applied; took %s", elapsed)
+	}
+}
+
+func TestRequestTimeout_PerUpstreamOverride(t *testing.T) {
+	banner("timeout_test.go")
+	startDelayed := func(delay time.Duration, hits *atomic.Int64) *httptest.Server {
+		upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			time.Sleep(delay)
+			w.WriteHeader(http.StatusOK)
+		}))
+		t.Cleanup(upstreamServer.Close)
+		return upstreamServer
+	}
+	var slowHits, fastHits atomic.Int64
+	slowServer := startDelayed(300*time.Millisecond, &slowHits)
+	fastServer := startDelayed(150*time.Millisecond, &fastHits)
+	slowURL, fastURL := mustURL(t, slowServer.URL), mustURL(t, fastServer.URL)
+
+	// The global budget (200ms) would fail the slow target and pass the fast one;
+	// the overrides flip both.
+	reverseProxy := proxy.NewReverseProxyMulti([]*url.URL{slowURL, fastURL}, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetRequestTimeout(200*time.Millisecond, "")
+	reverseProxy.SetUpstreamTimeout(slowURL, time.Second)
+	reverseProxy.SetUpstreamTimeout(fastURL, 50*time.Millisecond)
+
+	for i := 0; i < 4; i++ {
+		slowBefore, fastBefore := slowHits.Load(), fastHits.Load()
+		rec := httptest.NewRecorder()
+		reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/work", nil))
+		switch {
+		case slowHits.Load() > slowBefore:
+			if rec.Code != http.StatusOK {
+				t.Fatalf("slow target with 1s override: expected 200, got %d", rec.Code)
+			}
+		case fastHits.Load() > fastBefore:
+			if rec.Code != http.StatusGatewayTimeout {
+				t.Fatalf("fast target with 50ms override: expected 504, got %d", rec.Code)
+			}
+		default:
+			t.Fatalf("request %d reached no upstream (status %d)", i, rec.Code)
+		}
+	}
+	if slowHits.Load() == 0 || fastHits.Load() == 0 {
+		t.Fatalf("expected both targets to be exercised, slow=%d fast=%d", slowHits.Load(), fastHits.Load())
+	}
+}
+
+func TestUpstreamResponseTimeHeader_ReflectsSlowUpstream(t *testing.T) {
+	banner("timeout_test.go")
+	const delay = 80 * time.Millisecond
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetExposeUpstreamTime(true)
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	milliseconds, err := strconv.Atoi(rec.Header().Get("X-Upstream-Response-Time"))
+	if err != nil {
+		t.Fatalf("X-Upstream-Response-Time %q is not whole milliseconds: %v", rec.Header().Get("X-Upstream-Response-Time"), err)
+	}
+	if elapsed := time.Duration(milliseconds) * time.Millisecond; elapsed < delay || elapsed > delay+time.Second {
+		t.Fatalf("X-Upstream-Response-Time %dms does not reflect the %v upstream delay", milliseconds, delay)
+	}
+
+	// Cache hits never reach the upstream, so they carry no upstream time.
+	rec = httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rec.Header().Get("X-Cache") != "HIT" || rec.Header().Get("X-Upstream-Response-Time") != "" {
+		t.Fatalf("cache hit: X-Cache=%q X-Upstream-Response-Time=%q, want HIT and no header",
+			rec.Header().Get("X-Cache"), rec.Header().Get("X-Upstream-Response-Time"))
+	}
+}
+
+func TestRequestTimeout_ClientHeaderShortensAndIsClamped(t *testing.T) {
+	banner("timeout_test.go")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetClientTimeout("X-Request-Timeout-Ms", 300*time.Millisecond)
+
+	fetch := func(requested string) (int, time.Duration) {
+		req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+		if requested != "" {
+			req.Header.Set("X-Request-Timeout-Ms", requested)
+		}
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		reverseProxy.ServeHTTP(rec, req)
+		return rec.Code, time.Since(start)
+	}
+
+	// A 100ms client budget against a 1s upstream: 504 well before the upstream answers.
+	if code, elapsed := fetch("100"); code != http.StatusGatewayTimeout || elapsed > 250*time.Millisecond {
+		t.Fatalf("client budget: got %d after %v, want 504 after ~100ms", code, elapsed)
+	}
+	// Above the server max: clamped to 300ms.
+	if code, elapsed := fetch("10000"); code != http.StatusGatewayTimeout || elapsed < 250*time.Millisecond || elapsed > 700*time.Millisecond {
+		t.Fatalf("clamped budget: got %d after %v, want 504 after ~300ms", code, elapsed)
+	}
+	// No (or an invalid) header: no budget, the upstream answers.
+	if code, _ := fetch("soon"); code != http.StatusOK {
+		t.Fatalf("invalid header must be ignored, got %d", code)
+	}
+}
+
+// A client budget on a collapsed request only bounds that client's wait: the shared upstream
+// call keeps running for the clients without a budget.
+func TestRequestTimeout_ClientBudgetDoesNotShortenSharedFetch(t *testing.T) {
+	banner("timeout_test.go")
+	var upstreamHits atomic.Int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHits.Add(1)
+		select {
+		case <-time.After(300 * time.Millisecond):
+			w.Header().Set("Cache-Control", "no-store")
+			_, _ = w.Write([]byte("report"))
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetClientTimeout("X-Request-Timeout-Ms", time.Second)
+	reverseProxy.SetCollapseForwarding(true, []string{"/reports/"})
+
+	impatient, patient := httptest.NewRecorder(), httptest.NewRecorder()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		req := httptest.NewRequest(http.MethodGet, "/reports/daily", nil)
+		req.Header.Set("X-Request-Timeout-Ms", "100")
+		reverseProxy.ServeHTTP(impatient, req)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	go func() {
+		defer wg.Done()
+		reverseProxy.ServeHTTP(patient, httptest.NewRequest(http.MethodGet, "/reports/daily", nil))
+	}()
+	wg.Wait()
+
+	if impatient.Code != http.StatusGatewayTimeout {
+		t.Fatalf("client with a 100ms budget: status %d, want 504", impatient.Code)
+	}
+	if patient.Code != http.StatusOK || patient.Body.String() != "report" {
+		t.Fatalf("client without a budget got %d %q, want the shared response", patient.Code, patient.Body.String())
+	}
+	if got := upstreamHits.Load(); got != 1 {
+		t.Fatalf("expected 1 shared upstream call, got %d", got)
+	}
+}
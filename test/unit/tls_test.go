@@ -12,12 +12,14 @@ import (
 	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
 	config "traefik-challenge-2/internal/config"
+	metrics "traefik-challenge-2/internal/metrics"
 )
 
 // --- Helpers ---
@@ -222,4 +224,69 @@ func TestTLS_StaticHandshake(t *testing.T) {
 	if len(resp.TLS.PeerCertificates) == 0 {
 		t.Fatalf("no peer certs")
 	}
-}
\ No newline at end of file
+}
+
+func TestTLS_HandshakeMetricsByVersionAndResult(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	metrics.InstrumentTLSHandshakes(server.Config)
+	server.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	const (
+		tls12Success = `result="success",version="TLS 1.2"`
+		tls13Success = `result="success",version="TLS 1.3"`
+		failed       = `cipher="unknown",result="failure",version="unknown"`
+	)
+	counter := func(labels string) float64 {
+		value, _ := scrapeMetric(t, "proxy_tls_handshakes_total", labels)
+		return value
+	}
+	before := map[string]float64{tls12Success: counter(tls12Success), tls13Success: counter(tls13Success), failed: counter(failed)}
+
+	get := func(minVersion, maxVersion uint16) {
+		client := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true, // test-only: self-signed httptest certificate
+					MinVersion:         minVersion,
+					MaxVersion:         maxVersion,
+				},
+			},
+			Timeout: 3 * time.Second,
+		}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("GET (max version %x): %v", maxVersion, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		client.CloseIdleConnections()
+	}
+	get(tls.VersionTLS12, tls.VersionTLS12)
+	get(tls.VersionTLS13, tls.VersionTLS13)
+
+	// TLS 1.1 is below the server minimum, so the handshake fails before negotiation.
+	rawConn, err := tls.Dial("tcp", server.Listener.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+		MaxVersion:         tls.VersionTLS11,
+	})
+	if err == nil {
+		rawConn.Close()
+		t.Fatalf("TLS 1.1 handshake unexpectedly succeeded")
+	}
+
+	// Failures are reported when the server closes the connection, so poll briefly.
+	deadline := time.Now().Add(2 * time.Second)
+	for _, labels := range []string{tls12Success, tls13Success, failed} {
+		for counter(labels) < before[labels]+1 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := counter(labels); got != before[labels]+1 {
+			t.Fatalf("proxy_tls_handshakes_total{%s}: want %v, got %v", labels, before[labels]+1, got)
+		}
+	}
+}
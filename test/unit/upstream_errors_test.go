@@ -0,0 +1,212 @@
+package proxy_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+func TestUpstreamErrors_RefusedIs503(t *testing.T) {
+	banner("upstream_errors_test.go")
+	targetURL := closedServerURL(t)
+	reverseProxy := proxy.NewReverseProxy(targetURL, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/refused", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for refused connection, got %d", rec.Code)
+	}
+	count, found := scrapeMetric(t, "proxy_upstream_errors_total", `class="refused",upstream="`+targetURL.Host+`"`)
+	if !found || count != 1 {
+		t.Fatalf("expected one refused error for %s, got %v (found=%v)", targetURL.Host, count, found)
+	}
+}
+
+func TestUpstreamErrors_TimeoutIs504(t *testing.T) {
+	banner("upstream_errors_test.go")
+	release := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(upstreamServer.Close)
+	t.Cleanup(func() { close(release) })
+
+	targetURL := mustURL(t, upstreamServer.URL)
+	reverseProxy := proxy.NewReverseProxy(targetURL, proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetRequestTimeout(50*time.Millisecond, "")
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504 for upstream timeout, got %d", rec.Code)
+	}
+	count, found := scrapeMetric(t, "proxy_upstream_errors_total", `class="timeout",upstream="`+targetURL.Host+`"`)
+	if !found || count != 1 {
+		t.Fatalf("expected one timeout error for %s, got %v (found=%v)", targetURL.Host, count, found)
+	}
+	if _, refused := scrapeMetric(t, "proxy_upstream_errors_total", `class="refused",upstream="`+targetURL.Host+`"`); refused {
+		t.Fatalf("timeout must not be classified as refused")
+	}
+}
+
+func TestUpstreamErrors_NoHealthyUpstreamIs503WithRetryAfter(t *testing.T) {
+	banner("upstream_errors_test.go")
+	reverseProxy := proxy.NewReverseProxy(closedServerURL(t), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(true)
+	reverseProxy.SetUpstreamUnavailable(1500*time.Millisecond, http.StatusServiceUnavailable)
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/down", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 with no healthy upstream, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("expected Retry-After rounded up to 2, got %q", got)
+	}
+}
+
+func TestUpstreamErrors_ProtocolErrorIs502(t *testing.T) {
+	banner("upstream_errors_test.go")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte("this is not http\r\n\r\n"))
+		_ = conn.Close()
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), false)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetUpstreamUnavailable(5*time.Second, http.StatusServiceUnavailable)
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/garbled", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502 for a malformed upstream response, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "" {
+		t.Fatalf("502 must not advertise Retry-After, got %q", got)
+	}
+
+	// Refused connections can be reported as upstream errors instead of "down".
+	refusedProxy := proxy.NewReverseProxy(closedServerURL(t), proxy.NewLRUCache(16), false)
+	refusedProxy.SetHealthCheckEnabled(false)
+	refusedProxy.SetUpstreamUnavailable(5*time.Second, http.StatusBadGateway)
+	rec = httptest.NewRecorder()
+	refusedProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/refused", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502 for refused connection with refused_status 502, got %d", rec.Code)
+	}
+}
+
+func TestUpstreamErrors_TypedErrorsMapToStatus(t *testing.T) {
+	banner("upstream_errors_test.go")
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{proxy.ErrNoUpstream, http.StatusServiceUnavailable},
+		{proxy.ErrQueueFull, http.StatusTooManyRequests},
+		{proxy.ErrQueueTimeout, http.StatusServiceUnavailable},
+		{proxy.ErrQueueCanceled, http.StatusServiceUnavailable},
+		{proxy.ErrUpstream, http.StatusBadGateway},
+		{&proxy.UpstreamError{Class: "timeout", Status: http.StatusGatewayTimeout, Err: errors.New("deadline")}, http.StatusGatewayTimeout},
+		{fmt.Errorf("wrapped: %w", proxy.ErrQueueFull), http.StatusTooManyRequests},
+		{errors.New("unknown"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		if got := proxy.ErrorStatus(tc.err); got != tc.status {
+			t.Errorf("ErrorStatus(%v) = %d, want %d", tc.err, got, tc.status)
+		}
+	}
+	if !errors.Is(&proxy.UpstreamError{Err: errors.New("reset")}, proxy.ErrUpstream) {
+		t.Errorf("UpstreamError should match ErrUpstream")
+	}
+}
+
+func TestUpstreamErrors_TypedErrorsRecordStatusMetric(t *testing.T) {
+	banner("upstream_errors_test.go")
+	requests := func(status int) float64 {
+		value, _ := scrapeMetric(t, "proxy_requests_total", fmt.Sprintf(`cache="BYPASS",method="GET",status="%d"`, status))
+		return value
+	}
+	expectCounted := func(name string, status int, serve func() int) {
+		t.Helper()
+		before := requests(status)
+		if got := serve(); got != status {
+			t.Fatalf("%s: status %d, want %d", name, got, status)
+		}
+		if after := requests(status); after != before+1 {
+			t.Fatalf("%s: proxy_requests_total{status=%d} went %v -> %v, want +1", name, status, before, after)
+		}
+	}
+	serve := func(handler http.Handler, path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	// ErrNoUpstream: the only target fails its health check.
+	unhealthy := proxy.NewReverseProxy(closedServerURL(t), proxy.NewLRUCache(16), false)
+	expectCounted("no upstream", http.StatusServiceUnavailable, func() int { return serve(unhealthy, "/down") })
+
+	// ErrUpstream: the upstream answers with something that is not HTTP.
+	garbled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			_, _ = conn.Write([]byte("this is not http\r\n\r\n"))
+			_ = conn.Close()
+		}
+	}))
+	t.Cleanup(garbled.Close)
+	badGateway := proxy.NewReverseProxy(mustURL(t, garbled.URL), proxy.NewLRUCache(16), false)
+	badGateway.SetHealthCheckEnabled(false)
+	expectCounted("upstream error", http.StatusBadGateway, func() int { return serve(badGateway, "/garbled") })
+
+	// ErrQueueFull / ErrQueueTimeout: one request holds the only slot, another the only queue place.
+	arrived := make(chan struct{}, 4)
+	release := make(chan struct{})
+	slowUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(slowUpstream.Close)
+	queued := proxy.NewReverseProxy(mustURL(t, slowUpstream.URL), proxy.NewLRUCache(16), false).WithQueue(proxy.QueueConfig{
+		MaxQueue:       1,
+		MaxConcurrent:  1,
+		EnqueueTimeout: 500 * time.Millisecond,
+	})
+	queued.SetHealthCheckEnabled(false)
+
+	var holders sync.WaitGroup
+	holders.Add(1)
+	go func() {
+		defer holders.Done()
+		serve(queued, "/hold")
+	}()
+	<-arrived
+	timedOut := make(chan int, 1)
+	go func() { timedOut <- serve(queued, "/wait") }()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if depth, _ := scrapeMetric(t, "proxy_queue_depth", ""); depth == 1 {
+			break
+		}
+	}
+	expectCounted("queue full", http.StatusTooManyRequests, func() int { return serve(queued, "/rejected") })
+	expectCounted("queue timeout", http.StatusServiceUnavailable, func() int { return <-timedOut })
+	close(release)
+	holders.Wait()
+}
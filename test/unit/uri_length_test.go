@@ -0,0 +1,45 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	proxy "traefik-challenge-2/internal/proxy"
+)
+
+func TestMaxURILength_RejectsBeforeUpstream(t *testing.T) {
+	banner("uri_length_test.go")
+	var upstreamHits int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&upstreamHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	const maxLength = 64
+	reverseProxy := proxy.NewReverseProxy(mustURL(t, upstreamServer.URL), proxy.NewLRUCache(16), true)
+	reverseProxy.SetHealthCheckEnabled(false)
+	reverseProxy.SetMaxURILength(maxLength)
+
+	// Path + query together count toward the limit.
+	atLimit := "/p?q=" + strings.Repeat("a", maxLength-len("/p?q="))
+	overLimit := atLimit + "a"
+
+	rec := httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, overLimit, nil))
+	if rec.Code != http.StatusRequestURITooLong {
+		t.Fatalf("expected 414 for %d-byte URI, got %d", len(overLimit), rec.Code)
+	}
+	if hits := atomic.LoadInt64(&upstreamHits); hits != 0 {
+		t.Fatalf("expected no upstream work for rejected URI, got %d hits", hits)
+	}
+
+	rec = httptest.NewRecorder()
+	reverseProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, atLimit, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for URI at the limit, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,34 @@
+package proxy_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	proxy "traefik-challenge-2/internal/proxy"
+	"traefik-challenge-2/internal/version"
+)
+
+func TestAdminVersion_ReportsBuildInfo(t *testing.T) {
+	banner("version_test.go")
+	handler := proxy.RequireAdminToken("secret", version.Handler())
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/version", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("want 200, got %d", rec.Code)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &fields); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, key := range []string{"version", "commit", "build_date", "go_version"} {
+		if value, ok := fields[key].(string); !ok || value == "" {
+			t.Fatalf("field %q missing or empty in %v", key, fields)
+		}
+	}
+}